@@ -42,7 +42,8 @@ import (
 
 func main() {
 	var addr, tocpath, dirpath, isopath, psarcpath, psversion string
-	var gowversion int
+	var renderflp, renderframes, renderout string
+	var gowversion, rendercolumns int
 	var parsecheck bool
 	flag.StringVar(&addr, "i", ":8000", "Address of server")
 	flag.StringVar(&tocpath, "toc", "", "Path to folder with toc file")
@@ -52,6 +53,10 @@ func main() {
 	flag.StringVar(&psversion, "ps", "ps2", "Playstation version (ps2, ps3, psvita)")
 	flag.IntVar(&gowversion, "gowversion", 0, "0 - auto, 1 - 'gow1', 2 - 'gow2'")
 	flag.BoolVar(&parsecheck, "parsecheck", false, "Check every file for parse errors (for devs)")
+	flag.StringVar(&renderflp, "renderflp", "", "Render flp frames to png and exit ('wadname/flpname')")
+	flag.StringVar(&renderframes, "frames", "0", "Frames for renderflp (0,5,10-20 or 0-100:10)")
+	flag.IntVar(&rendercolumns, "columns", 0, "Contact sheet columns for renderflp, 0 - auto")
+	flag.StringVar(&renderout, "o", "", "Output png file for renderflp (default '<flpname>.png')")
 	flag.Parse()
 
 	var err error
@@ -111,6 +116,10 @@ func main() {
 	//parsecheck = true
 	if parsecheck {
 		parseCheck(rootdir)
+	} else if renderflp != "" {
+		if err := renderFlp(rootdir, renderflp, renderframes, rendercolumns, renderout); err != nil {
+			log.Fatalf("Cannot render flp: %v", err)
+		}
 	} else {
 		status.Info("Starting web server on address '%s'", addr)
 
@@ -3,6 +3,7 @@ package pack
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"path/filepath"
 	"strings"
 
@@ -28,6 +29,23 @@ func CallHandler(s utils.ResourceSource, r *io.SectionReader) (interface{}, erro
 	}
 }
 
+type ActionHandler func(d vfs.Directory, w http.ResponseWriter, r *http.Request) error
+
+var gActionHandlers map[string]ActionHandler = make(map[string]ActionHandler, 0)
+
+// SetActionHandler registers action that operates on whole pack (for example on multiple wads at once)
+func SetActionHandler(action string, h ActionHandler) {
+	gActionHandlers[action] = h
+}
+
+func CallActionHandler(d vfs.Directory, w http.ResponseWriter, r *http.Request, action string) error {
+	if h, found := gActionHandlers[action]; found {
+		return h(d, w, r)
+	} else {
+		return fmt.Errorf("[pack] Cannot find handler for '%s' action", action)
+	}
+}
+
 type PackResSrc struct {
 	pf vfs.File
 	d  vfs.Directory
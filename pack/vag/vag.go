@@ -1,13 +1,99 @@
 package vag
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
 
 	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/ps2/vagp"
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
+type ImportResult struct {
+	SampleRate uint32
+	Channels   int
+	Samples    int // per channel
+	Size       int
+}
+
+// ReadWaveUpload reads wave from "data" file of request,
+// optional params are "rate" and loop points in output samples "loopstart" and "loopend"
+func ReadWaveUpload(r *http.Request) (*utils.Wave, uint32, *adpcm.Loop, error) {
+	file, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	wav, err := utils.WaveRead(data)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var rate uint32
+	if str := r.FormValue("rate"); str != "" {
+		v, err := strconv.ParseUint(str, 10, 32)
+		if err != nil || v == 0 {
+			return nil, 0, nil, fmt.Errorf("Invalid rate '%s'", str)
+		}
+		rate = uint32(v)
+	}
+
+	var loop *adpcm.Loop
+	if strStart, strEnd := r.FormValue("loopstart"), r.FormValue("loopend"); strStart != "" || strEnd != "" {
+		start, err := strconv.Atoi(strStart)
+		if err != nil || start < 0 {
+			return nil, 0, nil, fmt.Errorf("Invalid loopstart '%s'", strStart)
+		}
+		end, err := strconv.Atoi(strEnd)
+		if err != nil || end <= start {
+			return nil, 0, nil, fmt.Errorf("Invalid loopend '%s'", strEnd)
+		}
+		loop = &adpcm.Loop{Start: start, End: end}
+	}
+	return wav, rate, loop, nil
+}
+
+// HttpAction handles actions of standalone vag file
+func HttpAction(d vfs.Directory, name string, v *vagp.VAGP, w http.ResponseWriter, r *http.Request, action string) error {
+	switch action {
+	case "importwav":
+		wav, rate, loop, err := ReadWaveUpload(r)
+		if err != nil {
+			return err
+		}
+		v.ReplaceWave(wav, rate, loop)
+		data := v.Marshal()
+
+		f, err := vfs.DirectoryGetFile(d, name)
+		if err != nil {
+			return err
+		}
+		if err := vfs.OpenFileAndCopy(f, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		webutils.WriteJson(w, &ImportResult{
+			SampleRate: v.SampleRate,
+			Channels:   1,
+			Samples:    len(v.WaveData) / 16 * adpcm.BlockSamples,
+			Size:       len(data),
+		})
+	default:
+		return fmt.Errorf("Unknown action '%s'", action)
+	}
+	return nil
+}
+
 func init() {
 	h := func(p utils.ResourceSource, r *io.SectionReader) (interface{}, error) {
 		return vagp.NewVAGPFromReader(r)
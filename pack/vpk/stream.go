@@ -0,0 +1,181 @@
+package vpk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// WaveReader decodes vpk to wav on demand. Seeking maps wav offset to interleaved chunk,
+// so it can be used with http.ServeContent
+type WaveReader struct {
+	vpk    *VPK
+	r      io.ReaderAt
+	header []byte
+	size   int64
+	pos    int64
+
+	chunkPcmSize int    // of all channels
+	chunkIndex   int    // decoded chunk, -1 if none
+	chunk        []byte // interleaved pcm
+	in           []byte
+	streams      []*adpcm.AdpcmStream
+}
+
+func (vpk *VPK) NewWaveReader(r io.ReaderAt) (*WaveReader, error) {
+	if err := vpk.checkChannels(); err != nil {
+		return nil, err
+	}
+	channels := int(vpk.Channels)
+	dataSize := adpcm.AdpcmSizeToWaveSize(int(vpk.DataSize)) * channels
+
+	loop, err := vpk.FindLoop(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	if err := utils.WaveWriteHeaderLoop(&header, uint16(channels), vpk.SampleRate, uint32(dataSize), loop); err != nil {
+		return nil, err
+	}
+
+	wr := &WaveReader{
+		vpk:          vpk,
+		r:            r,
+		header:       header.Bytes(),
+		size:         int64(header.Len() + dataSize),
+		chunkPcmSize: adpcm.AdpcmSizeToWaveSize(ChunkSize) * channels,
+		chunkIndex:   -1,
+		in:           make([]byte, ChunkSize*channels),
+		streams:      make([]*adpcm.AdpcmStream, channels),
+	}
+	wr.chunk = make([]byte, wr.chunkPcmSize)
+	for i := range wr.streams {
+		wr.streams[i] = adpcm.NewAdpcmStream()
+	}
+	return wr, nil
+}
+
+// FindLoop scans block flags of first channel chunk by chunk, channels are expected to loop together.
+// Result is cached per resource, so stream requests of same file scan it once
+func (vpk *VPK) FindLoop(r io.ReaderAt) (*adpcm.Loop, error) {
+	if vpk.cachedLoop() {
+		return vpk.loop, nil
+	}
+	var stream adpcm.AdpcmStream
+	chunk := make([]byte, ChunkSize)
+	for off := 0; off < int(vpk.DataSize); off += ChunkSize {
+		n := int(vpk.DataSize) - off
+		if n > ChunkSize {
+			n = ChunkSize
+		}
+		if _, err := r.ReadAt(chunk[:n], int64(utils.SECTOR_SIZE+off*int(vpk.Channels))); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if stream.ScanFlags(chunk[:n]) {
+			break
+		}
+	}
+	vpk.cacheLoop(stream.Loop)
+	return vpk.loop, nil
+}
+
+func (wr *WaveReader) Size() int64 {
+	return wr.size
+}
+
+// decodeChunk decodes chunk continuing adpcm history of previous one.
+// When jumping, only previous chunk is decoded first to warm up history,
+// error of filters history fades long before end of chunk
+func (wr *WaveReader) decodeChunk(index int) error {
+	if wr.chunkIndex == index {
+		return nil
+	}
+	from := index
+	if wr.chunkIndex != index-1 {
+		for i := range wr.streams {
+			wr.streams[i] = adpcm.NewAdpcmStream()
+		}
+		if index > 0 {
+			from = index - 1
+		}
+	}
+	for i := from; i <= index; i++ {
+		if err := wr.unpackChunk(i); err != nil {
+			wr.chunkIndex = -1
+			return err
+		}
+	}
+	return nil
+}
+
+func (wr *WaveReader) unpackChunk(index int) error {
+	channels := len(wr.streams)
+	dataLen := int(wr.vpk.DataSize) - index*ChunkSize
+	if dataLen > ChunkSize {
+		dataLen = ChunkSize
+	}
+	if _, err := wr.r.ReadAt(wr.in, int64(utils.SECTOR_SIZE+index*ChunkSize*channels)); err != nil && err != io.EOF {
+		return err
+	}
+
+	for i := range wr.chunk {
+		wr.chunk[i] = 0
+	}
+	for iCh, s := range wr.streams {
+		buf, err := s.Unpack(wr.in[iCh*ChunkSize : iCh*ChunkSize+dataLen])
+		if err != nil {
+			return err
+		}
+		for k := 0; k < len(buf)/2; k++ {
+			pos := (k*channels + iCh) * 2
+			wr.chunk[pos] = buf[k*2]
+			wr.chunk[pos+1] = buf[k*2+1]
+		}
+	}
+	wr.chunkIndex = index
+	return nil
+}
+
+func (wr *WaveReader) Read(p []byte) (int, error) {
+	if wr.pos >= wr.size {
+		return 0, io.EOF
+	}
+	if wr.pos < int64(len(wr.header)) {
+		n := copy(p, wr.header[wr.pos:])
+		wr.pos += int64(n)
+		return n, nil
+	}
+
+	off := int(wr.pos) - len(wr.header)
+	if err := wr.decodeChunk(off / wr.chunkPcmSize); err != nil {
+		return 0, err
+	}
+	chunk := wr.chunk[off%wr.chunkPcmSize:]
+	if left := wr.size - wr.pos; int64(len(chunk)) > left {
+		chunk = chunk[:left]
+	}
+	n := copy(p, chunk)
+	wr.pos += int64(n)
+	return n, nil
+}
+
+func (wr *WaveReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += wr.pos
+	case io.SeekEnd:
+		offset += wr.size
+	default:
+		return 0, errors.New("Invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Negative position")
+	}
+	wr.pos = offset
+	return offset, nil
+}
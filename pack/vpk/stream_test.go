@@ -0,0 +1,117 @@
+package vpk
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func testVpk(t *testing.T) (*VPK, []byte) {
+	header := make([]byte, utils.SECTOR_SIZE)
+	header[0x14] = 2
+	vpk := &VPK{Channels: 2, SampleRate: 22050}
+
+	// several chunks per channel with different content in every channel
+	count := ChunkSize / 16 * adpcm.BlockSamples * 9 / 2
+	wav := &utils.Wave{SampleRate: 22050, Samples: make([][]int16, 2)}
+	for ch := range wav.Samples {
+		wav.Samples[ch] = make([]int16, count)
+		for i := range wav.Samples[ch] {
+			v := math.Sin(float64(i)*0.05*float64(ch+1)) + 0.5*math.Sin(float64(i)*0.0131)
+			wav.Samples[ch][i] = int16(v * 15000)
+		}
+	}
+	data := vpk.ReplaceWave(header, wav, 0, &adpcm.Loop{Start: 28 * 40, End: count})
+
+	parsed, err := NewVPKFromReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed, data
+}
+
+func TestWaveReaderSeek(t *testing.T) {
+	vpk, data := testVpk(t)
+
+	var full bytes.Buffer
+	if _, err := vpk.AsWave(bytes.NewReader(data), &full); err != nil {
+		t.Fatal(err)
+	}
+	wav, err := utils.WaveRead(full.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.Loop == nil || wav.Loop.Start != 28*40 || wav.Loop.End != len(wav.Samples[0]) {
+		t.Errorf("Invalid loop %v", wav.Loop)
+	}
+
+	wr, err := vpk.NewWaveReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wr.Size() != int64(full.Len()) {
+		t.Fatalf("Size %d, expected %d", wr.Size(), full.Len())
+	}
+
+	// jumps forward and backward, inside chunk, across chunk boundaries and near end
+	chunk := int64(wr.chunkPcmSize)
+	header := int64(len(wr.header))
+	for _, off := range []int64{
+		header + chunk*3 + 100, 10, header + chunk - 2, header + chunk*4,
+		header + chunk*2 + 1, wr.Size() - 50, header + 7, 0,
+	} {
+		if _, err := wr.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 3000)
+		n, err := io.ReadFull(wr, got)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		expected := full.Bytes()[off:]
+		if len(expected) > len(got) {
+			expected = expected[:len(got)]
+		}
+		if !bytes.Equal(got[:n], expected) {
+			t.Errorf("Data at offset %d differs from sequential decoding", off)
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestFindLoopCachedPerResource(t *testing.T) {
+	vpk, data := testVpk(t)
+	source := loopKey{Name: "TEST.VPK", Size: int64(len(data))}
+	vpk.source = source
+
+	loop, err := vpk.FindLoop(bytes.NewReader(data))
+	if err != nil || loop == nil || loop.Start != 28*40 {
+		t.Fatalf("Invalid loop %v: %v", loop, err)
+	}
+
+	// every request opens new instance, file must not be scanned again
+	again, err := NewVPKFromReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.source = source
+	if cached, err := again.FindLoop(failingReader{}); err != nil || cached == nil || *cached != *loop {
+		t.Errorf("Loop is not cached: %v %v", cached, err)
+	}
+
+	// other size of resource means file was changed
+	again, _ = NewVPKFromReader(bytes.NewReader(data))
+	again.source = loopKey{Name: source.Name, Size: source.Size + 1}
+	if _, err := again.FindLoop(failingReader{}); err == nil {
+		t.Errorf("Loop of changed file taken from cache")
+	}
+}
@@ -1,18 +1,64 @@
 package vpk
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"net/http"
+	"sync"
 
 	"github.com/mogaika/god_of_war_browser/pack"
+	file_vag "github.com/mogaika/god_of_war_browser/pack/vag"
 	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
+// size of channel data chunk, chunks of all channels are interleaved
+const ChunkSize = 0x1000
+
 type VPK struct {
 	SampleRate uint32
 	Channels   uint32
 	DataSize   uint32 // of one channel
+
+	loop        *adpcm.Loop
+	loopScanned bool
+	source      loopKey // empty if vpk is not opened from resource
+}
+
+type loopKey struct {
+	Name string
+	Size int64
+}
+
+// loops found by FindLoop, instance of vpk is created for every request,
+// so without it every range request of stream rescans whole channel
+var loopCache = struct {
+	sync.Mutex
+	loops map[loopKey]*adpcm.Loop
+}{loops: make(map[loopKey]*adpcm.Loop)}
+
+func (vpk *VPK) cacheLoop(loop *adpcm.Loop) {
+	vpk.loop, vpk.loopScanned = loop, true
+	if vpk.source.Name == "" {
+		return
+	}
+	loopCache.Lock()
+	defer loopCache.Unlock()
+	loopCache.loops[vpk.source] = loop
+}
+
+func (vpk *VPK) cachedLoop() bool {
+	if vpk.loopScanned || vpk.source.Name == "" {
+		return vpk.loopScanned
+	}
+	loopCache.Lock()
+	defer loopCache.Unlock()
+	vpk.loop, vpk.loopScanned = loopCache.loops[vpk.source]
+	return vpk.loopScanned
 }
 
 func NewVPKFromReader(r io.ReaderAt) (*VPK, error) {
@@ -30,73 +76,115 @@ func NewVPKFromReader(r io.ReaderAt) (*VPK, error) {
 	return vpk, nil
 }
 
-func (vpk *VPK) AsWave(r io.Reader, w io.Writer) (int, error) {
-	if vpk.Channels > 4 {
-		panic(vpk.Channels)
+func (vpk *VPK) checkChannels() error {
+	if vpk.Channels == 0 || vpk.Channels > 4 {
+		return fmt.Errorf("Unsupported channels count %d", vpk.Channels)
 	}
+	return nil
+}
 
-	var inBlockSize = 0x1000 * vpk.Channels
-
-	var in = make([]byte, inBlockSize)
-	var out = make([]byte, adpcm.AdpcmSizeToWaveSize(int(inBlockSize)))
-
-	// skip first sector
-	if _, err := r.Read(in[:utils.SECTOR_SIZE]); err != nil {
+func (vpk *VPK) AsWave(r io.ReaderAt, w io.Writer) (int, error) {
+	wr, err := vpk.NewWaveReader(r)
+	if err != nil {
 		return 0, err
 	}
+	n, err := io.Copy(w, wr)
+	return int(n), err
+}
 
-	var adpcmStream = make([]*adpcm.AdpcmStream, vpk.Channels)
-	for i := range adpcmStream {
-		adpcmStream[i] = adpcm.NewAdpcmStream()
+// ReplaceWave encodes every channel of wave and returns new vpk file.
+// First sector is taken from original file, channels count is kept.
+// If loop is nil then loop of wave is used
+func (vpk *VPK) ReplaceWave(header []byte, wav *utils.Wave, rate uint32, loop *adpcm.Loop) []byte {
+	if rate == 0 {
+		rate = vpk.SampleRate
+	}
+	wav = wav.Remix(int(vpk.Channels)).Resample(rate)
+	if loop == nil {
+		loop = wav.Loop
 	}
 
-	if err := utils.WaveWriteHeader(w, uint16(vpk.Channels), vpk.SampleRate, uint32(adpcm.AdpcmSizeToWaveSize(int(vpk.DataSize))*2)); err != nil {
-		return 0, err
+	streams := make([][]byte, vpk.Channels)
+	for i := range streams {
+		streams[i] = adpcm.Encode(wav.Samples[i], loop)
+	}
+	vpk.SampleRate = rate
+	vpk.DataSize = uint32(len(streams[0]))
+	vpk.loop, vpk.loopScanned = adpcm.FindLoop(streams[0]), true
+
+	chunks := (len(streams[0]) + ChunkSize - 1) / ChunkSize
+	result := make([]byte, utils.SECTOR_SIZE+chunks*ChunkSize*len(streams))
+	copy(result, header[:utils.SECTOR_SIZE])
+	binary.LittleEndian.PutUint32(result[0x4:], vpk.DataSize)
+	binary.LittleEndian.PutUint32(result[0x10:], vpk.SampleRate)
+
+	pos := utils.SECTOR_SIZE
+	for iChunk := 0; iChunk < chunks; iChunk++ {
+		for _, stream := range streams {
+			end := (iChunk + 1) * ChunkSize
+			if end > len(stream) {
+				end = len(stream)
+			}
+			copy(result[pos:], stream[iChunk*ChunkSize:end])
+			pos += ChunkSize
+		}
 	}
+	return result
+}
 
-	inLeft := int(vpk.DataSize)
-	n := 0
-	for inLeft > 0 {
-		_, err := r.Read(in)
+// HttpAction handles actions of vpk file
+func (vpk *VPK) HttpAction(d vfs.Directory, name string, w http.ResponseWriter, r *http.Request, action string) error {
+	switch action {
+	case "importwav":
+		if err := vpk.checkChannels(); err != nil {
+			return err
+		}
+		wav, rate, loop, err := file_vag.ReadWaveUpload(r)
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		datalen := 0x1000
-		if inLeft < 0x1000 {
-			datalen = inLeft
+		f, err := vfs.DirectoryGetFile(d, name)
+		if err != nil {
+			return err
 		}
-
-		for i, s := range adpcmStream {
-			buf, err := s.Unpack(in[i*0x1000 : i*0x1000+datalen])
-			if err != nil {
-				return 0, err
-			}
-
-			for k := 0; k < len(buf)/2; k++ {
-				j := uint32(k * 2) // 16bit
-				outchpos := j*vpk.Channels + uint32(i*2)
-				out[outchpos] = buf[j]
-				out[outchpos+1] = buf[j+1]
-			}
-
+		fr, err := vfs.OpenFileAndGetReader(f, true)
+		if err != nil {
+			return err
 		}
-
-		if wn, err := w.Write(out); err != nil {
-			return n, err
-		} else {
-			n += wn
+		header := make([]byte, utils.SECTOR_SIZE)
+		_, err = fr.ReadAt(header, 0)
+		f.Close()
+		if err != nil {
+			return err
 		}
 
-		inLeft -= 0x1000
+		data := vpk.ReplaceWave(header, wav, rate, loop)
+		if err := vfs.OpenFileAndCopy(f, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		vpk.source.Size = int64(len(data))
+		vpk.cacheLoop(vpk.loop)
+		webutils.WriteJson(w, &file_vag.ImportResult{
+			SampleRate: vpk.SampleRate,
+			Channels:   int(vpk.Channels),
+			Samples:    int(vpk.DataSize) / 16 * adpcm.BlockSamples,
+			Size:       len(data),
+		})
+	default:
+		return fmt.Errorf("Unknown action '%s'", action)
 	}
-
-	return n, nil
+	return nil
 }
 
 func init() {
 	h := func(p utils.ResourceSource, r *io.SectionReader) (interface{}, error) {
-		return NewVPKFromReader(r)
+		vpk, err := NewVPKFromReader(r)
+		if err != nil {
+			return nil, err
+		}
+		vpk.source = loopKey{Name: p.Name(), Size: p.Size()}
+		return vpk, nil
 	}
 	pack.SetHandler(".VPK", h)
 	pack.SetHandler(".VP1", h)
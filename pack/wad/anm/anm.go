@@ -2,6 +2,7 @@ package anm
 
 import (
 	"encoding/binary"
+	"log"
 	"math"
 	"os"
 
@@ -169,14 +170,10 @@ func NewFromData(data []byte) (*Animations, error) {
 
 						data := make([]*AnimState0Skinning, sd.CountOfSomething)
 						for i := 0; i < int(sd.CountOfSomething); i++ {
-							skinAnim := AnimState0SkinningFromBuf(rawAct[sd.OffsetToData:], i, _l)
-							skinAnim.ParseRotations(rawAct[sd.OffsetToData:], i, _l)
-							data[i] = skinAnim
+							data[i] = AnimState0SkinningFromBuf(rawAct[sd.OffsetToData:], i, _l)
 						}
 						for i := 0; i < int(u16(rawAct, 0x7a)); i++ {
-							skinAnim := AnimState0SkinningFromBuf(rawAct[sd.OffsetToData:], i, _l)
-							skinAnim.ParsePositions(rawAct[sd.OffsetToData:], i, _l, rawAct)
-							data = append(data, skinAnim)
+							data = append(data, AnimState0SkinningPositionsFromBuf(rawAct[sd.OffsetToData:], i, _l, rawAct))
 						}
 						sd.Data = data
 					case DATATYPE_TEXTURESHEET:
@@ -197,8 +194,28 @@ func NewFromData(data []byte) (*Animations, error) {
 	return a, nil
 }
 
+type Ajax struct {
+	*Animations
+	Skinning []*SkinningAnimation `json:",omitempty"`
+}
+
 func (anm *Animations) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
-	return anm, nil
+	res := &Ajax{Animations: anm}
+
+	// skinning decoding depends on idle pose of object animation belongs to
+	if wrsrc.Node.Parent != wad.NODE_INVALID {
+		if parent, _, err := wrsrc.Wad.GetInstanceFromNode(wrsrc.Node.Parent); err == nil {
+			if skel, ok := parent.(Skeleton); ok {
+				skinning, err := anm.DecodeAllSkinning(skel.SkinningIdlePose())
+				if err != nil {
+					log.Printf("[anm] Error decoding skinning of '%s': %v", wrsrc.Name(), err)
+				}
+				res.Skinning = skinning
+			}
+		}
+	}
+
+	return res, nil
 }
 
 func init() {
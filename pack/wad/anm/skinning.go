@@ -0,0 +1,328 @@
+package anm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// SkinningJointPose is idle local transform of joint in animation units
+type SkinningJointPose struct {
+	Rotation     [4]float32 // Q.14 quaternion (xyzw) or Q.14 euler angles (fraction of full turn)
+	Position     [4]float32
+	IsQuaternion bool // joint flags & 0x8000, otherwise rotation is euler
+}
+
+// Skeleton implemented by objects that skinning animations applied to
+type Skeleton interface {
+	SkinningIdlePose() []SkinningJointPose
+}
+
+// SkinningJointTrack contains per frame local transform of animated joint
+type SkinningJointTrack struct {
+	Joint     int
+	Rotations [][4]float32 `json:",omitempty"` // normalized quaternions (xyzw)
+	Positions [][3]float32 `json:",omitempty"`
+}
+
+// SkinningAnimation is decoded DATATYPE_SKINNING state of act
+type SkinningAnimation struct {
+	Group       string
+	Act         string
+	StateIndex  int
+	FrameTime   float32
+	Duration    float32
+	FramesCount int
+	Joints      []SkinningJointTrack
+}
+
+const skinningFixedPoint = 1.0 / (1 << 14)
+
+// JointRotationToQuat converts Q.14 joint rotation to normalized quaternion (xyzw)
+func JointRotationToQuat(rot [4]float32, isQuaternion bool) [4]float32 {
+	if isQuaternion {
+		q := mgl32.Quat{
+			W: rot[3] * skinningFixedPoint,
+			V: mgl32.Vec3{rot[0] * skinningFixedPoint, rot[1] * skinningFixedPoint, rot[2] * skinningFixedPoint},
+		}
+		if q.Len() < 1e-6 {
+			return [4]float32{0, 0, 0, 1}
+		}
+		q = q.Normalize()
+		return [4]float32{q.V[0], q.V[1], q.V[2], q.W}
+	}
+
+	// same as gl-matrix quat.fromEuler
+	halfTurnToRad := math.Pi * skinningFixedPoint
+	x := float64(rot[0]) * halfTurnToRad
+	y := float64(rot[1]) * halfTurnToRad
+	z := float64(rot[2]) * halfTurnToRad
+	sx, cx := math.Sincos(x)
+	sy, cy := math.Sincos(y)
+	sz, cz := math.Sincos(z)
+	return [4]float32{
+		float32(sx*cy*cz - cx*sy*sz),
+		float32(cx*sy*cz + sx*cy*sz),
+		float32(cx*cy*sz - sx*sy*cz),
+		float32(cx*cy*cz + sx*sy*sz),
+	}
+}
+
+func sampleValue(samples interface{}, index int) (float32, bool) {
+	switch s := samples.(type) {
+	case []float32:
+		if index < len(s) {
+			return s[index], true
+		}
+	case []int16:
+		if index < len(s) {
+			return float32(s[index]), true
+		}
+	}
+	return 0, false
+}
+
+// streamSampleIndex returns sample index of stream for frame, or -1 if stream not affects frame
+func streamSampleIndex(manager, globalManager *AnimSamplesManager, frame int) int {
+	lastGlobalFrame := int(globalManager.Count) + int(globalManager.Offset) + int(globalManager.DatasCount3) - 1
+	if frame > lastGlobalFrame || frame < int(manager.Offset) {
+		return -1
+	}
+
+	index := frame - int(manager.Offset)
+	if index >= int(manager.Count)+int(manager.DatasCount3) {
+		return -1
+	} else if index > int(manager.Count)-1 {
+		return int(manager.Count) - 1
+	}
+	return index
+}
+
+// applySkinningStream advances values (jointId*4+coord indexed) from frame-1 to frame
+func applySkinningStream(stream *AnimStateSubstream, globalManager *AnimSamplesManager, frame int,
+	values [][4]float32, touched map[int]bool) error {
+	index := streamSampleIndex(&stream.Manager, globalManager, frame)
+	if index < 0 {
+		return nil
+	}
+
+	if _, additive := stream.Samples[-100]; additive {
+		// additive samples contain difference between neighbor frames
+		prevIndex := -1
+		if frame > 0 {
+			prevIndex = streamSampleIndex(&stream.Manager, globalManager, frame-1)
+		}
+		if prevIndex < 0 || prevIndex == index {
+			return nil
+		}
+		for key, samples := range stream.Samples {
+			if key < 0 {
+				continue
+			}
+			if key/4 >= len(values) {
+				return fmt.Errorf("Joint %d out of skeleton (%d joints)", key/4, len(values))
+			}
+			v, ok := sampleValue(samples, prevIndex)
+			if !ok {
+				return fmt.Errorf("Sample %d out of stream %d", prevIndex, key)
+			}
+			values[key/4][key%4] += v
+			touched[key/4] = true
+		}
+	} else {
+		for key, samples := range stream.Samples {
+			if key < 0 {
+				continue
+			}
+			if key/4 >= len(values) {
+				return fmt.Errorf("Joint %d out of skeleton (%d joints)", key/4, len(values))
+			}
+			v, ok := sampleValue(samples, index)
+			if !ok {
+				return fmt.Errorf("Sample %d out of stream %d", index, key)
+			}
+			values[key/4][key%4] = v
+			touched[key/4] = true
+		}
+	}
+	return nil
+}
+
+func applySkinningStreams(global *AnimStateSubstream, add, rough []AnimStateSubstream, frame int,
+	values [][4]float32, touched map[int]bool) error {
+	if global.Manager.Count != 0 {
+		return applySkinningStream(global, &global.Manager, frame, values, touched)
+	}
+	for i := range add {
+		if err := applySkinningStream(&add[i], &global.Manager, frame, values, touched); err != nil {
+			return err
+		}
+	}
+	for i := range rough {
+		if err := applySkinningStream(&rough[i], &global.Manager, frame, values, touched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeSkinning evaluates DATATYPE_SKINNING state of act frame by frame starting from idle pose
+func (anm *Animations) DecodeSkinning(iGroup, iAct, iState int, pose []SkinningJointPose) (*SkinningAnimation, error) {
+	if iGroup >= len(anm.Groups) || iAct >= len(anm.Groups[iGroup].Acts) || iState >= len(anm.DataTypes) {
+		return nil, fmt.Errorf("Invalid animation index %d/%d/%d", iGroup, iAct, iState)
+	}
+	if anm.DataTypes[iState].TypeId != DATATYPE_SKINNING {
+		return nil, fmt.Errorf("State %d is not skinning animation", iState)
+	}
+	act := &anm.Groups[iGroup].Acts[iAct]
+	sd := &act.StateDescrs[iState]
+	states, ok := sd.Data.([]*AnimState0Skinning)
+	if !ok {
+		return nil, fmt.Errorf("Skinning data of act '%s' not parsed", act.Name)
+	}
+	if sd.FrameTime <= 0 {
+		return nil, fmt.Errorf("Invalid frame time %f", sd.FrameTime)
+	}
+
+	framesCount := int(math.Ceil(float64(act.Duration/sd.FrameTime) - 1e-4))
+	if framesCount < 1 {
+		framesCount = 1
+	}
+
+	rotations := make([][4]float32, len(pose))
+	positions := make([][4]float32, len(pose))
+	for i := range pose {
+		rotations[i] = pose[i].Rotation
+		positions[i] = pose[i].Position
+	}
+
+	rotationTouched := make(map[int]bool)
+	positionTouched := make(map[int]bool)
+	rotationFrames := make([][][4]float32, framesCount)
+	positionFrames := make([][][4]float32, framesCount)
+	for frame := 0; frame < framesCount; frame++ {
+		for _, state := range states {
+			if err := applySkinningStreams(&state.RotationStream, state.RotationSubStreamsAdd,
+				state.RotationSubStreamsRough, frame, rotations, rotationTouched); err != nil {
+				return nil, fmt.Errorf("Rotation frame %d: %v", frame, err)
+			}
+			if err := applySkinningStreams(&state.PositionStream, state.PositionSubStreamsAdd,
+				state.PositionSubStreamsRough, frame, positions, positionTouched); err != nil {
+				return nil, fmt.Errorf("Position frame %d: %v", frame, err)
+			}
+		}
+		rotationFrames[frame] = append([][4]float32{}, rotations...)
+		positionFrames[frame] = append([][4]float32{}, positions...)
+	}
+
+	result := &SkinningAnimation{
+		Group:       anm.Groups[iGroup].Name,
+		Act:         act.Name,
+		StateIndex:  iState,
+		FrameTime:   sd.FrameTime,
+		Duration:    act.Duration,
+		FramesCount: framesCount,
+		Joints:      make([]SkinningJointTrack, 0),
+	}
+
+	joints := make([]int, 0, len(pose))
+	for iJoint := range pose {
+		if rotationTouched[iJoint] || positionTouched[iJoint] {
+			joints = append(joints, iJoint)
+		}
+	}
+	sort.Ints(joints)
+
+	for _, iJoint := range joints {
+		track := SkinningJointTrack{Joint: iJoint}
+		if rotationTouched[iJoint] {
+			track.Rotations = make([][4]float32, framesCount)
+			for frame := range rotationFrames {
+				track.Rotations[frame] = JointRotationToQuat(rotationFrames[frame][iJoint], pose[iJoint].IsQuaternion)
+			}
+		}
+		if positionTouched[iJoint] {
+			track.Positions = make([][3]float32, framesCount)
+			for frame := range positionFrames {
+				p := positionFrames[frame][iJoint]
+				track.Positions[frame] = [3]float32{p[0], p[1], p[2]}
+			}
+		}
+		result.Joints = append(result.Joints, track)
+	}
+
+	return result, nil
+}
+
+// DecodeAllSkinning decodes every skinning state of every act
+func (anm *Animations) DecodeAllSkinning(pose []SkinningJointPose) ([]*SkinningAnimation, error) {
+	result := make([]*SkinningAnimation, 0)
+	for iState, dt := range anm.DataTypes {
+		if dt.TypeId != DATATYPE_SKINNING {
+			continue
+		}
+		for iGroup := range anm.Groups {
+			for iAct := range anm.Groups[iGroup].Acts {
+				sa, err := anm.DecodeSkinning(iGroup, iAct, iState, pose)
+				if err != nil {
+					return result, fmt.Errorf("Error decoding act '%s' of group '%s': %v",
+						anm.Groups[iGroup].Acts[iAct].Name, anm.Groups[iGroup].Name, err)
+				}
+				result = append(result, sa)
+			}
+		}
+	}
+	return result, nil
+}
+
+func lerpSample(frameTime float32, framesCount int, t float32) (int, int, float32) {
+	f := t / frameTime
+	i := int(f)
+	if i >= framesCount-1 {
+		return framesCount - 1, framesCount - 1, 0
+	}
+	return i, i + 1, f - float32(i)
+}
+
+// Resample returns animation sampled with rate frames per second.
+// Positions are interpolated linearly, rotations using normalized lerp
+func (sa *SkinningAnimation) Resample(rate float32) *SkinningAnimation {
+	lastTime := float32(sa.FramesCount-1) * sa.FrameTime
+	framesCount := int(lastTime*rate+1e-4) + 1
+
+	result := *sa
+	result.FrameTime = 1 / rate
+	result.FramesCount = framesCount
+	result.Joints = make([]SkinningJointTrack, len(sa.Joints))
+
+	for iTrack, track := range sa.Joints {
+		rt := SkinningJointTrack{Joint: track.Joint}
+		if track.Rotations != nil {
+			rt.Rotations = make([][4]float32, framesCount)
+		}
+		if track.Positions != nil {
+			rt.Positions = make([][3]float32, framesCount)
+		}
+		for frame := 0; frame < framesCount; frame++ {
+			i0, i1, k := lerpSample(sa.FrameTime, sa.FramesCount, float32(frame)/rate)
+			if track.Rotations != nil {
+				q0 := mgl32.Quat{W: track.Rotations[i0][3], V: mgl32.Vec3{track.Rotations[i0][0], track.Rotations[i0][1], track.Rotations[i0][2]}}
+				q1 := mgl32.Quat{W: track.Rotations[i1][3], V: mgl32.Vec3{track.Rotations[i1][0], track.Rotations[i1][1], track.Rotations[i1][2]}}
+				if q0.Dot(q1) < 0 {
+					q1 = q1.Scale(-1)
+				}
+				q := mgl32.QuatNlerp(q0, q1, k)
+				rt.Rotations[frame] = [4]float32{q.V[0], q.V[1], q.V[2], q.W}
+			}
+			if track.Positions != nil {
+				for c := 0; c < 3; c++ {
+					rt.Positions[frame][c] = track.Positions[i0][c] + (track.Positions[i1][c]-track.Positions[i0][c])*k
+				}
+			}
+		}
+		result.Joints[iTrack] = rt
+	}
+	return &result
+}
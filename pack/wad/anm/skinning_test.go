@@ -0,0 +1,76 @@
+package anm
+
+import (
+	"math"
+	"testing"
+)
+
+func newTestSkinningAnimations(state *AnimState0Skinning, frameTime, duration float32) *Animations {
+	return &Animations{
+		DataTypes: []AnimDatatype{{TypeId: DATATYPE_SKINNING}},
+		Groups: []AnimGroup{{
+			Name: "group",
+			Acts: []AnimAct{{
+				Name:     "act",
+				Duration: duration,
+				StateDescrs: []AnimActStateDescr{{
+					FrameTime: frameTime,
+					Data:      []*AnimState0Skinning{state},
+				}},
+			}},
+		}},
+	}
+}
+
+func TestDecodeSkinningPositions(t *testing.T) {
+	state := &AnimState0Skinning{}
+	// raw stream sets joint 1 x, additive stream moves joint 1 y
+	state.PositionStream.Manager.Offset = 0
+	state.PositionStream.Manager.DatasCount3 = 4
+	state.PositionSubStreamsRough = []AnimStateSubstream{{
+		Manager: AnimSamplesManager{Count: 4},
+		Samples: map[int]interface{}{4: []float32{1, 2, 3, 4}},
+	}}
+	state.PositionSubStreamsAdd = []AnimStateSubstream{{
+		Manager: AnimSamplesManager{Count: 4},
+		Samples: map[int]interface{}{-100: true, 5: []float32{0.5, 0.5, 0.5, 0.5}},
+	}}
+
+	pose := []SkinningJointPose{
+		{Rotation: [4]float32{0, 0, 0, 1 << 14}, IsQuaternion: true},
+		{Rotation: [4]float32{0, 0, 0, 1 << 14}, Position: [4]float32{0, 10, 0, 1}, IsQuaternion: true},
+	}
+
+	a := newTestSkinningAnimations(state, 0.5, 2)
+	sa, err := a.DecodeSkinning(0, 0, 0, pose)
+	if err != nil {
+		t.Fatalf("DecodeSkinning error: %v", err)
+	}
+	if sa.FramesCount != 4 {
+		t.Fatalf("FramesCount=%d; expected 4", sa.FramesCount)
+	}
+	if len(sa.Joints) != 1 || sa.Joints[0].Joint != 1 || sa.Joints[0].Rotations != nil {
+		t.Fatalf("Unexpected tracks %+v", sa.Joints)
+	}
+
+	expected := [][3]float32{{1, 10, 0}, {2, 10.5, 0}, {3, 11, 0}, {4, 11.5, 0}}
+	for i, p := range sa.Joints[0].Positions {
+		if p != expected[i] {
+			t.Errorf("Frame %d position %v; expected %v", i, p, expected[i])
+		}
+	}
+}
+
+func TestJointRotationToQuat(t *testing.T) {
+	// quarter turn around z axis as euler
+	q := JointRotationToQuat([4]float32{0, 0, 1 << 12, 0}, false)
+	s := float32(math.Sqrt2 / 2)
+	if math.Abs(float64(q[2]-s)) > 1e-5 || math.Abs(float64(q[3]-s)) > 1e-5 {
+		t.Errorf("Euler rotation %v; expected [0 0 %f %f]", q, s, s)
+	}
+
+	q = JointRotationToQuat([4]float32{0, 0, 0, 1 << 13}, true)
+	if q != [4]float32{0, 0, 0, 1} {
+		t.Errorf("Quaternion rotation %v not normalized", q)
+	}
+}
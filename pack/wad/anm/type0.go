@@ -55,8 +55,18 @@ func (a *AnimState0Skinning) GetShiftsArray(descr *AnimStateDescrHeader, stateDa
 	return shifts
 }
 
+// AnimState0SkinningFromBuf parses rotation state of skinning data
 func AnimState0SkinningFromBuf(buf []byte, stateIndex int, _l *utils.Logger) *AnimState0Skinning {
-	return &AnimState0Skinning{}
+	a := &AnimState0Skinning{}
+	a.ParseRotations(buf, stateIndex, _l)
+	return a
+}
+
+// AnimState0SkinningPositionsFromBuf parses position state of skinning data, stored in separate table of act
+func AnimState0SkinningPositionsFromBuf(buf []byte, stateIndex int, _l *utils.Logger, rawAct []byte) *AnimState0Skinning {
+	a := &AnimState0Skinning{}
+	a.ParsePositions(buf, stateIndex, _l, rawAct)
+	return a
 }
 
 func shiftToCoeff(shift int8) float32 {
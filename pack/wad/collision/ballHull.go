@@ -30,7 +30,7 @@ func (c *ShapeBallHull) GetSectionSize(section int) uint32 {
 	}
 }
 
-func NewBallHull(f io.ReaderAt, wrtw io.Writer) (*ShapeBallHull, error) {
+func NewBallHull(f io.ReaderAt) (*ShapeBallHull, error) {
 	buf := make([]byte, BALLHULL_HEADER_SIZE)
 	if _, err := f.ReadAt(buf, 0); err != nil {
 		return nil, err
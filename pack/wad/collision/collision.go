@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"io/ioutil"
 
 	"github.com/mogaika/god_of_war_browser/config"
 
@@ -22,7 +21,7 @@ type Collision struct {
 	Shape     interface{}
 }
 
-func NewFromData(f io.ReaderAt, wrtr io.Writer) (c *Collision, err error) {
+func NewFromData(f io.ReaderAt) (c *Collision, err error) {
 	var buf [16]byte
 	if _, err := f.ReadAt(buf[:], 0); err != nil {
 		return nil, err
@@ -44,10 +43,12 @@ func NewFromData(f io.ReaderAt, wrtr io.Writer) (c *Collision, err error) {
 
 	switch c.ShapeName {
 	case "SheetHdr":
-		c.Shape, err = NewRibSheet(f, wrtr)
+		c.Shape, err = NewRibSheet(f)
 	case "BallHull":
-		c.Shape, err = NewBallHull(f, wrtr)
+		c.Shape, err = NewBallHull(f)
 	default:
+		// mCDbgHdr is recognised, but layout of debug collision is not known yet.
+		// parsecheck filters this error
 		return nil, fmt.Errorf("Unknown enz shape type %s", c.ShapeName)
 	}
 
@@ -60,12 +61,6 @@ func (c *Collision) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 
 func init() {
 	wad.SetHandler(config.GOW1, COLLISION_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		/*
-			fpath := filepath.Join("logs", wrsrc.Wad.Name(), fmt.Sprintf("%.4d-%s.enz.obj", wrsrc.Tag.Id, wrsrc.Tag.Name))
-			os.MkdirAll(filepath.Dir(fpath), 0777)
-			f, _ := os.Create(fpath)
-			defer f.Close()
-		*/
-		return NewFromData(bytes.NewReader(wrsrc.Tag.Data), ioutil.Discard)
+		return NewFromData(bytes.NewReader(wrsrc.Tag.Data))
 	})
 }
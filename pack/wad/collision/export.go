@@ -0,0 +1,286 @@
+package collision
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// ExportGroup is part of collision geometry sharing same collision context (material)
+type ExportGroup struct {
+	Name      string
+	Positions [][3]float32
+	Triangles [][3]uint32
+}
+
+type exportGroupsBuilder struct {
+	groups map[string]*ExportGroup
+	// vertex remap of source index to group index
+	remap map[*ExportGroup]map[uint32]uint32
+}
+
+func newExportGroupsBuilder() *exportGroupsBuilder {
+	return &exportGroupsBuilder{
+		groups: make(map[string]*ExportGroup),
+		remap:  make(map[*ExportGroup]map[uint32]uint32),
+	}
+}
+
+func (b *exportGroupsBuilder) group(name string) *ExportGroup {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &ExportGroup{Name: name}
+		b.groups[name] = g
+		b.remap[g] = make(map[uint32]uint32)
+	}
+	return g
+}
+
+func (b *exportGroupsBuilder) addTriangle(name string, positions [][3]float32, a, c, d uint32) error {
+	g := b.group(name)
+	var tri [3]uint32
+	for i, index := range [3]uint32{a, c, d} {
+		if int(index) >= len(positions) {
+			return fmt.Errorf("Vertex index %d out of range (%d vertices)", index, len(positions))
+		}
+		local, ok := b.remap[g][index]
+		if !ok {
+			local = uint32(len(g.Positions))
+			g.Positions = append(g.Positions, positions[index])
+			b.remap[g][index] = local
+		}
+		tri[i] = local
+	}
+	g.Triangles = append(g.Triangles, tri)
+	return nil
+}
+
+// addSphere appends uv sphere triangulation to group
+func (b *exportGroupsBuilder) addSphere(name string, center [3]float32, radius float32, rings, segments int) {
+	g := b.group(name)
+	base := uint32(len(g.Positions))
+	for r := 0; r <= rings; r++ {
+		theta := math.Pi * float64(r) / float64(rings)
+		st, ct := math.Sincos(theta)
+		for s := 0; s < segments; s++ {
+			phi := 2 * math.Pi * float64(s) / float64(segments)
+			sp, cp := math.Sincos(phi)
+			g.Positions = append(g.Positions, [3]float32{
+				center[0] + radius*float32(st*cp),
+				center[1] + radius*float32(ct),
+				center[2] + radius*float32(st*sp),
+			})
+		}
+	}
+	for r := 0; r < rings; r++ {
+		for s := 0; s < segments; s++ {
+			a := base + uint32(r*segments+s)
+			c := base + uint32(r*segments+(s+1)%segments)
+			d := base + uint32((r+1)*segments+s)
+			e := base + uint32((r+1)*segments+(s+1)%segments)
+			if r != 0 {
+				g.Triangles = append(g.Triangles, [3]uint32{a, d, c})
+			}
+			if r != rings-1 {
+				g.Triangles = append(g.Triangles, [3]uint32{c, d, e})
+			}
+		}
+	}
+}
+
+func (b *exportGroupsBuilder) result() []*ExportGroup {
+	result := make([]*ExportGroup, 0, len(b.groups))
+	for _, g := range b.groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (rib *ShapeRibSheet) ctxName(ctx uint16) string {
+	if int(ctx) < len(rib.CtxNames) && rib.CtxNames[ctx] != "" {
+		return rib.CtxNames[ctx]
+	}
+	return fmt.Sprintf("ctx_%d", ctx)
+}
+
+func (rib *ShapeRibSheet) exportGroups(b *exportGroupsBuilder) error {
+	positions := make([][3]float32, len(rib.Some9Points))
+	for i, p := range rib.Some9Points {
+		positions[i] = [3]float32{p[0], p[1], p[2]}
+	}
+
+	for i, tri := range rib.Some7TrianglesIndex {
+		if err := b.addTriangle(rib.ctxName(rib.Some7TrianglesCtx[i]), positions,
+			uint32(tri[0]), uint32(tri[1]), uint32(tri[2])); err != nil {
+			return fmt.Errorf("Triangle %d: %v", i, err)
+		}
+	}
+	for i, quad := range rib.Some8QuadsIndex {
+		name := rib.ctxName(rib.Some8QuadsCtx[i])
+		if err := b.addTriangle(name, positions, uint32(quad[0]), uint32(quad[1]), uint32(quad[2])); err != nil {
+			return fmt.Errorf("Quad %d: %v", i, err)
+		}
+		if err := b.addTriangle(name, positions, uint32(quad[3]), uint32(quad[0]), uint32(quad[2])); err != nil {
+			return fmt.Errorf("Quad %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (bh *ShapeBallHull) exportGroups(b *exportGroupsBuilder) {
+	// same radius scale as browser viewer uses
+	b.addSphere("hull", [3]float32{bh.Vector[0], bh.Vector[1], bh.Vector[2]}, bh.Vector[3]*2, 8, 12)
+	for _, v := range bh.Some4cVectors {
+		if v[3] > 0 {
+			b.addSphere("balls", [3]float32{v[0], v[1], v[2]}, v[3]*2, 6, 8)
+		}
+	}
+}
+
+// ExportGroups returns collision triangles grouped by collision context name
+func (c *Collision) ExportGroups() ([]*ExportGroup, error) {
+	b := newExportGroupsBuilder()
+	switch shape := c.Shape.(type) {
+	case *ShapeRibSheet:
+		if err := shape.exportGroups(b); err != nil {
+			return nil, err
+		}
+	case *ShapeBallHull:
+		shape.exportGroups(b)
+	default:
+		return nil, fmt.Errorf("Export of shape %s not supported", c.ShapeName)
+	}
+	return b.result(), nil
+}
+
+// ExportGroups returns triangles of geometry shape grouped by flags
+func (gs *GeomShape) ExportGroups() ([]*ExportGroup, error) {
+	positions := make([][3]float32, len(gs.Vertexes))
+	for i := range gs.Vertexes {
+		positions[i] = gs.Vertexes[i].Pos
+	}
+
+	b := newExportGroupsBuilder()
+	for i, index := range gs.Indexes {
+		if err := b.addTriangle(fmt.Sprintf("flags_%.4x", index.Flags), positions,
+			uint32(index.Indexes[0]), uint32(index.Indexes[1]), uint32(index.Indexes[2])); err != nil {
+			return nil, fmt.Errorf("Triangle %d: %v", i, err)
+		}
+	}
+	return b.result(), nil
+}
+
+// ExportGroupsObj writes groups as wavefront obj, every group is separate object
+func ExportGroupsObj(w io.Writer, name string, groups []*ExportGroup) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n", name)
+	vertexOffset := uint32(1)
+	for _, g := range groups {
+		fmt.Fprintf(bw, "o %s\ng %s\n", g.Name, g.Name)
+		for _, p := range g.Positions {
+			fmt.Fprintf(bw, "v %f %f %f\n", p[0], p[1], p[2])
+		}
+		for _, t := range g.Triangles {
+			fmt.Fprintf(bw, "f %d %d %d\n", t[0]+vertexOffset, t[1]+vertexOffset, t[2]+vertexOffset)
+		}
+		vertexOffset += uint32(len(g.Positions))
+	}
+	return bw.Flush()
+}
+
+// ExportGroupsGLTF adds mesh with primitive per group to gltf document and returns mesh index
+func ExportGroupsGLTF(doc *gltf.Document, name string, groups []*ExportGroup) (int, error) {
+	mesh := gltf.Mesh{Name: name, Primitives: make([]gltf.Primitive, 0, len(groups))}
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		if len(g.Triangles) == 0 {
+			continue
+		}
+		indices := make([]uint32, 0, len(g.Triangles)*3)
+		for _, t := range g.Triangles {
+			indices = append(indices, t[:]...)
+		}
+		mesh.Primitives = append(mesh.Primitives, gltf.Primitive{
+			Attributes: map[string]int{"POSITION": doc.AddVec3(g.Positions, true)},
+			Indices:    gltf.Index(doc.AddIndices(indices)),
+			Material: gltf.Index(doc.AddMaterial(gltf.Material{
+				Name:        g.Name,
+				DoubleSided: true,
+				PbrMetallicRoughness: &gltf.PbrMetallicRoughness{
+					BaseColorFactor: &[4]float32{1, 0, 1, 1},
+					RoughnessFactor: 1,
+				},
+			})),
+			Mode:   gltf.MODE_TRIANGLES,
+			Extras: map[string]interface{}{"collision": g.Name},
+		})
+		names = append(names, g.Name)
+	}
+	if len(mesh.Primitives) == 0 {
+		return -1, fmt.Errorf("Collision is empty")
+	}
+	mesh.Extras = map[string]interface{}{"groups": names}
+	return doc.AddMesh(mesh), nil
+}
+
+func exportGroupsHttp(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, groups []*ExportGroup) {
+	var buf bytes.Buffer
+	var fileName string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "obj":
+		if err := ExportGroupsObj(&buf, wrsrc.Name(), groups); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting obj: %v", err))
+			return
+		}
+		fileName = wrsrc.Name() + ".obj"
+	case "gltf":
+		doc := gltf.NewDocument("god_of_war_browser")
+		mesh, err := ExportGroupsGLTF(doc, wrsrc.Name(), groups)
+		if err == nil {
+			doc.AddScene(wrsrc.Name(), []int{doc.AddNode(gltf.Node{Name: wrsrc.Name(), Mesh: &mesh})})
+			err = doc.EncodeGLB(&buf)
+		}
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting gltf: %v", err))
+			return
+		}
+		fileName = wrsrc.Name() + ".glb"
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown collision format '%s'", format))
+		return
+	}
+	webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), fileName)
+}
+
+func (c *Collision) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "export":
+		groups, err := c.ExportGroups()
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting collision: %v", err))
+			return
+		}
+		exportGroupsHttp(wrsrc, w, r, groups)
+	}
+}
+
+func (gs *GeomShape) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "export":
+		groups, err := gs.ExportGroups()
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting geometry shape: %v", err))
+			return
+		}
+		exportGroupsHttp(wrsrc, w, r, groups)
+	}
+}
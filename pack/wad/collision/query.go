@@ -0,0 +1,444 @@
+package collision
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/inst"
+)
+
+// Triangles are in world space, collisions of objects are placed by instances
+type Triangle struct {
+	Vertices [3]mgl32.Vec3
+	Context  string // collision context name (group of export)
+	Source   string // name of resource triangle loaded from
+	Instance string // name of instance that placed object collision, empty if not placed by instance
+	Node     wad.NodeId
+}
+
+type Hit struct {
+	Triangle int
+	Point    mgl32.Vec3
+	Normal   mgl32.Vec3
+	Distance float32
+}
+
+const bvhLeafSize = 4
+
+type bvhNode struct {
+	Min, Max mgl32.Vec3
+	// for leaf Left is first triangle and Count is count of triangles
+	Left, Right int
+	Count       int
+}
+
+// World is collection of collision triangles with bvh on top of them
+type World struct {
+	Triangles []Triangle
+	Skipped   []string // resources that cannot be converted to triangles
+	nodes     []bvhNode
+}
+
+func triangleBounds(t *Triangle) (mgl32.Vec3, mgl32.Vec3) {
+	min, max := t.Vertices[0], t.Vertices[0]
+	for _, v := range t.Vertices[1:] {
+		for c := 0; c < 3; c++ {
+			min[c] = float32(math.Min(float64(min[c]), float64(v[c])))
+			max[c] = float32(math.Max(float64(max[c]), float64(v[c])))
+		}
+	}
+	return min, max
+}
+
+func triangleCentroid(t *Triangle) mgl32.Vec3 {
+	return t.Vertices[0].Add(t.Vertices[1]).Add(t.Vertices[2]).Mul(1.0 / 3.0)
+}
+
+func (world *World) build(first, count int) int {
+	node := bvhNode{}
+	node.Min, node.Max = triangleBounds(&world.Triangles[first])
+	for i := first + 1; i < first+count; i++ {
+		min, max := triangleBounds(&world.Triangles[i])
+		for c := 0; c < 3; c++ {
+			node.Min[c] = float32(math.Min(float64(node.Min[c]), float64(min[c])))
+			node.Max[c] = float32(math.Max(float64(node.Max[c]), float64(max[c])))
+		}
+	}
+
+	index := len(world.nodes)
+	world.nodes = append(world.nodes, node)
+
+	if count <= bvhLeafSize {
+		world.nodes[index].Left = first
+		world.nodes[index].Count = count
+		return index
+	}
+
+	// split by median of longest axis
+	size := node.Max.Sub(node.Min)
+	axis := 0
+	if size[1] > size[axis] {
+		axis = 1
+	}
+	if size[2] > size[axis] {
+		axis = 2
+	}
+	tris := world.Triangles[first : first+count]
+	sort.Slice(tris, func(i, j int) bool {
+		return triangleCentroid(&tris[i])[axis] < triangleCentroid(&tris[j])[axis]
+	})
+
+	half := count / 2
+	left := world.build(first, half)
+	right := world.build(first+half, count-half)
+	world.nodes[index].Left = left
+	world.nodes[index].Right = right
+	return index
+}
+
+// objectServerId is obj.OBJECT_MAGIC, obj package depends on collision
+const objectServerId = 0x00040001
+
+func (world *World) addGroups(name, instance string, nodeId wad.NodeId, groups []*ExportGroup, m mgl32.Mat4) {
+	for _, g := range groups {
+		for _, t := range g.Triangles {
+			tri := Triangle{Context: g.Name, Source: name, Instance: instance, Node: nodeId}
+			for i, index := range t {
+				p := g.Positions[index]
+				tri.Vertices[i] = m.Mul4x1(mgl32.Vec4{p[0], p[1], p[2], 1}).Vec3()
+			}
+			world.Triangles = append(world.Triangles, tri)
+		}
+	}
+}
+
+func (world *World) skip(n *wad.Node, err error) {
+	world.Skipped = append(world.Skipped, fmt.Sprintf("%s: %v", n.Tag.Name, err))
+}
+
+// addShape adds node if it is collision shape. Collisions that cannot be parsed are reported in Skipped
+func (world *World) addShape(w *wad.Wad, n *wad.Node, instance string, m mgl32.Mat4) {
+	f, serverId, err := w.GetInstanceFromNode(n.Id)
+	if err != nil {
+		if serverId == COLLISION_MAGIC {
+			world.skip(n, err)
+		}
+		return
+	}
+	var groups []*ExportGroup
+	switch shape := f.(type) {
+	case *Collision:
+		groups, err = shape.ExportGroups()
+	case *GeomShape:
+		groups, err = shape.ExportGroups()
+	default:
+		return
+	}
+	if err != nil {
+		world.skip(n, err)
+	} else {
+		world.addGroups(n.Tag.Name, instance, n.Id, groups, m)
+	}
+}
+
+// addInstance adds collisions of instance object transformed by instance
+func (world *World) addInstance(w *wad.Wad, n *wad.Node, instance *inst.Instance, m mgl32.Mat4) {
+	object := w.GetNodeByName(instance.Object, n.Id-1, false)
+	if object == nil {
+		world.skip(n, fmt.Errorf("Cannot find object '%s'", instance.Object))
+		return
+	}
+	for _, id := range object.SubGroupNodes {
+		world.addShape(w, w.GetNodeById(id), n.Tag.Name, m)
+	}
+}
+
+// isObjectPart returns true if node belongs to object, such collisions are placed by instances
+func isObjectPart(w *wad.Wad, n *wad.Node) bool {
+	if n.Parent == wad.NODE_INVALID {
+		return false
+	}
+	_, serverId, _ := w.GetInstanceFromNode(n.Parent)
+	return serverId == objectServerId
+}
+
+// NewWorld loads every collision and geometry shape resource of wad in world space.
+// Collisions of objects are added for every instance of object.
+// If root is not wad.NODE_INVALID only resources of root subtree (cxt chunk) are loaded
+func NewWorld(w *wad.Wad, root wad.NodeId) (*World, error) {
+	world := &World{
+		Triangles: make([]Triangle, 0),
+		Skipped:   make([]string, 0),
+	}
+
+	visited := make(map[wad.NodeId]bool)
+	var walk func(ids []wad.NodeId, m mgl32.Mat4)
+	walk = func(ids []wad.NodeId, m mgl32.Mat4) {
+		for _, id := range ids {
+			n := w.GetNodeById(id)
+			if n == nil || visited[n.Id] {
+				continue
+			}
+			visited[n.Id] = true
+
+			sub := m
+			if f, _, err := w.GetInstanceFromNode(n.Id); err == nil {
+				if instance, ok := f.(*inst.Instance); ok {
+					sub = m.Mul4(instance.Matrix())
+					world.addInstance(w, n, instance, sub)
+				}
+			}
+			if !isObjectPart(w, n) {
+				world.addShape(w, n, "", m)
+			}
+
+			walk(n.SubGroupNodes, sub)
+		}
+	}
+
+	if root == wad.NODE_INVALID {
+		walk(w.Roots, mgl32.Ident4())
+	} else {
+		if int(root) < 0 || int(root) >= len(w.Nodes) {
+			return nil, fmt.Errorf("Invalid node id %d", root)
+		}
+		walk([]wad.NodeId{root}, mgl32.Ident4())
+	}
+
+	if len(world.Triangles) != 0 {
+		world.build(0, len(world.Triangles))
+	}
+	return world, nil
+}
+
+type worldKey struct {
+	Wad  string
+	Root wad.NodeId
+}
+
+var worldCache = struct {
+	sync.Mutex
+	worlds map[worldKey]*World
+}{worlds: make(map[worldKey]*World)}
+
+// CachedWorld returns world built by NewWorld, it is rebuilt after wad saved
+func CachedWorld(w *wad.Wad, root wad.NodeId) (*World, error) {
+	worldCache.Lock()
+	defer worldCache.Unlock()
+
+	key := worldKey{Wad: w.Name(), Root: root}
+	if world, ok := worldCache.worlds[key]; ok {
+		return world, nil
+	}
+	world, err := NewWorld(w, root)
+	if err != nil {
+		return nil, err
+	}
+	worldCache.worlds[key] = world
+	return world, nil
+}
+
+func dropCachedWorlds(w *wad.Wad) {
+	worldCache.Lock()
+	defer worldCache.Unlock()
+
+	for key := range worldCache.worlds {
+		if key.Wad == w.Name() {
+			delete(worldCache.worlds, key)
+		}
+	}
+}
+
+func rayIntersectsBox(origin, invDir, min, max mgl32.Vec3, maxDist float32) bool {
+	tmin, tmax := float32(0), maxDist
+	for c := 0; c < 3; c++ {
+		t1 := (min[c] - origin[c]) * invDir[c]
+		t2 := (max[c] - origin[c]) * invDir[c]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		// NaN appears when ray is parallel to slab and starts on its plane
+		if t1 == t1 && t1 > tmin {
+			tmin = t1
+		}
+		if t2 == t2 && t2 < tmax {
+			tmax = t2
+		}
+		if tmin > tmax {
+			return false
+		}
+	}
+	return true
+}
+
+// rayIntersectsTriangle is Moller-Trumbore intersection, returns distance along normalized dir
+func rayIntersectsTriangle(origin, dir mgl32.Vec3, t *Triangle) (float32, bool) {
+	const epsilon = 1e-7
+	e1 := t.Vertices[1].Sub(t.Vertices[0])
+	e2 := t.Vertices[2].Sub(t.Vertices[0])
+	p := dir.Cross(e2)
+	det := e1.Dot(p)
+	if det > -epsilon && det < epsilon {
+		return 0, false
+	}
+	invDet := 1 / det
+	s := origin.Sub(t.Vertices[0])
+	u := s.Dot(p) * invDet
+	if u < 0 || u > 1 {
+		return 0, false
+	}
+	q := s.Cross(e1)
+	v := dir.Dot(q) * invDet
+	if v < 0 || u+v > 1 {
+		return 0, false
+	}
+	dist := e2.Dot(q) * invDet
+	return dist, dist >= 0
+}
+
+func (t *Triangle) normal() mgl32.Vec3 {
+	n := t.Vertices[1].Sub(t.Vertices[0]).Cross(t.Vertices[2].Sub(t.Vertices[0]))
+	if n.Len() < 1e-12 {
+		return n
+	}
+	return n.Normalize()
+}
+
+// RayCast returns nearest triangle hit by ray within maxDist
+func (world *World) RayCast(origin, dir mgl32.Vec3, maxDist float32) (*Hit, bool) {
+	if len(world.nodes) == 0 || dir.Len() == 0 {
+		return nil, false
+	}
+	dir = dir.Normalize()
+	invDir := mgl32.Vec3{1 / dir[0], 1 / dir[1], 1 / dir[2]}
+
+	var best *Hit
+	stack := []int{0}
+	for len(stack) != 0 {
+		node := &world.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		if !rayIntersectsBox(origin, invDir, node.Min, node.Max, maxDist) {
+			continue
+		}
+		if node.Count == 0 {
+			stack = append(stack, node.Left, node.Right)
+			continue
+		}
+		for i := node.Left; i < node.Left+node.Count; i++ {
+			if dist, ok := rayIntersectsTriangle(origin, dir, &world.Triangles[i]); ok && dist <= maxDist {
+				maxDist = dist
+				best = &Hit{
+					Triangle: i,
+					Point:    origin.Add(dir.Mul(dist)),
+					Normal:   world.Triangles[i].normal(),
+					Distance: dist,
+				}
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// closestPointOnTriangle from Real-Time Collision Detection (Ericson) 5.1.5
+func closestPointOnTriangle(p mgl32.Vec3, t *Triangle) mgl32.Vec3 {
+	a, b, c := t.Vertices[0], t.Vertices[1], t.Vertices[2]
+	ab, ac, ap := b.Sub(a), c.Sub(a), p.Sub(a)
+	d1, d2 := ab.Dot(ap), ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+	bp := p.Sub(b)
+	d3, d4 := ab.Dot(bp), ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.Mul(d1 / (d1 - d3)))
+	}
+	cp := p.Sub(c)
+	d5, d6 := ab.Dot(cp), ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.Mul(d2 / (d2 - d6)))
+	}
+	va := d3*d6 - d5*d4
+	if va <= 0 && (d4-d3) >= 0 && (d5-d6) >= 0 {
+		return b.Add(c.Sub(b).Mul((d4 - d3) / ((d4 - d3) + (d5 - d6))))
+	}
+	denom := 1 / (va + vb + vc)
+	return a.Add(ab.Mul(vb * denom)).Add(ac.Mul(vc * denom))
+}
+
+func boxDistance(p, min, max mgl32.Vec3) float32 {
+	var d mgl32.Vec3
+	for c := 0; c < 3; c++ {
+		if p[c] < min[c] {
+			d[c] = min[c] - p[c]
+		} else if p[c] > max[c] {
+			d[c] = p[c] - max[c]
+		}
+	}
+	return d.Len()
+}
+
+// visitInRange calls cb for every triangle which bounding box is within radius of point.
+// cb returns new radius to shrink search
+func (world *World) visitInRange(p mgl32.Vec3, radius float32, cb func(i int, radius float32) float32) {
+	if len(world.nodes) == 0 {
+		return
+	}
+	stack := []int{0}
+	for len(stack) != 0 {
+		node := &world.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		if boxDistance(p, node.Min, node.Max) > radius {
+			continue
+		}
+		if node.Count == 0 {
+			stack = append(stack, node.Left, node.Right)
+			continue
+		}
+		for i := node.Left; i < node.Left+node.Count; i++ {
+			radius = cb(i, radius)
+		}
+	}
+}
+
+// Nearest returns closest surface point within maxDist
+func (world *World) Nearest(p mgl32.Vec3, maxDist float32) (*Hit, bool) {
+	var best *Hit
+	world.visitInRange(p, maxDist, func(i int, radius float32) float32 {
+		point := closestPointOnTriangle(p, &world.Triangles[i])
+		if dist := point.Sub(p).Len(); dist <= radius {
+			best = &Hit{Triangle: i, Point: point, Normal: world.Triangles[i].normal(), Distance: dist}
+			return dist
+		}
+		return radius
+	})
+	return best, best != nil
+}
+
+// SphereOverlap returns every triangle touched by sphere, sorted by distance
+func (world *World) SphereOverlap(center mgl32.Vec3, radius float32) []Hit {
+	hits := make([]Hit, 0)
+	world.visitInRange(center, radius, func(i int, r float32) float32 {
+		point := closestPointOnTriangle(center, &world.Triangles[i])
+		if dist := point.Sub(center).Len(); dist <= radius {
+			hits = append(hits, Hit{Triangle: i, Point: point, Normal: world.Triangles[i].normal(), Distance: dist})
+		}
+		return r
+	})
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+	return hits
+}
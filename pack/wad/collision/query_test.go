@@ -0,0 +1,187 @@
+package collision
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/inst"
+)
+
+func randomWorld(r *rand.Rand, count int) *World {
+	world := &World{Triangles: make([]Triangle, count)}
+	for i := range world.Triangles {
+		center := mgl32.Vec3{r.Float32()*100 - 50, r.Float32()*100 - 50, r.Float32()*100 - 50}
+		for v := range world.Triangles[i].Vertices {
+			world.Triangles[i].Vertices[v] = center.Add(mgl32.Vec3{r.Float32()*10 - 5, r.Float32()*10 - 5, r.Float32()*10 - 5})
+		}
+		world.Triangles[i].Source = string(rune('a' + i%26))
+	}
+	world.build(0, count)
+	return world
+}
+
+func TestRayCastMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	world := randomWorld(r, 300)
+
+	for q := 0; q < 500; q++ {
+		origin := mgl32.Vec3{r.Float32()*160 - 80, r.Float32()*160 - 80, r.Float32()*160 - 80}
+		dir := mgl32.Vec3{r.Float32()*2 - 1, r.Float32()*2 - 1, r.Float32()*2 - 1}
+		if dir.Len() < 1e-3 {
+			continue
+		}
+
+		best := float32(math.MaxFloat32)
+		for i := range world.Triangles {
+			if dist, ok := rayIntersectsTriangle(origin, dir.Normalize(), &world.Triangles[i]); ok && dist < best {
+				best = dist
+			}
+		}
+
+		hit, ok := world.RayCast(origin, dir, math.MaxFloat32)
+		if ok != (best != math.MaxFloat32) {
+			t.Fatalf("Ray %v %v: hit %v, brute force %v", origin, dir, ok, best)
+		}
+		if ok && math.Abs(float64(hit.Distance-best)) > 1e-3 {
+			t.Fatalf("Ray %v %v: distance %v, brute force %v", origin, dir, hit.Distance, best)
+		}
+	}
+}
+
+func TestNearestAndSphereMatchBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	world := randomWorld(r, 300)
+
+	for q := 0; q < 200; q++ {
+		p := mgl32.Vec3{r.Float32()*160 - 80, r.Float32()*160 - 80, r.Float32()*160 - 80}
+		radius := r.Float32() * 20
+
+		best := float32(math.MaxFloat32)
+		inRadius := 0
+		for i := range world.Triangles {
+			dist := closestPointOnTriangle(p, &world.Triangles[i]).Sub(p).Len()
+			if dist < best {
+				best = dist
+			}
+			if dist <= radius {
+				inRadius++
+			}
+		}
+
+		hit, ok := world.Nearest(p, math.MaxFloat32)
+		if !ok || math.Abs(float64(hit.Distance-best)) > 1e-3 {
+			t.Fatalf("Nearest %v: %v %v, brute force %v", p, hit, ok, best)
+		}
+
+		hits := world.SphereOverlap(p, radius)
+		if len(hits) != inRadius {
+			t.Fatalf("Sphere %v %v: %d hits, brute force %d", p, radius, len(hits), inRadius)
+		}
+		for i := 1; i < len(hits); i++ {
+			if hits[i].Distance < hits[i-1].Distance {
+				t.Fatalf("Sphere hits are not sorted")
+			}
+		}
+	}
+}
+
+func TestRayCastMaxDist(t *testing.T) {
+	world := &World{Triangles: []Triangle{{Vertices: [3]mgl32.Vec3{{-1, -1, 5}, {1, -1, 5}, {0, 1, 5}}}}}
+	world.build(0, 1)
+
+	hit, ok := world.RayCast(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, 2}, 10)
+	if !ok || math.Abs(float64(hit.Distance-5)) > 1e-5 || hit.Point.Sub(mgl32.Vec3{0, 0, 5}).Len() > 1e-5 {
+		t.Fatalf("Unexpected hit %v %v", hit, ok)
+	}
+	if math.Abs(math.Abs(float64(hit.Normal[2]))-1) > 1e-5 {
+		t.Errorf("Unexpected normal %v", hit.Normal)
+	}
+	if _, ok := world.RayCast(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, 1}, 4); ok {
+		t.Errorf("Hit beyond max distance")
+	}
+	if _, ok := world.RayCast(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, -1}, 10); ok {
+		t.Errorf("Hit behind ray")
+	}
+}
+
+type testNodeFile struct{}
+
+func (testNodeFile) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) { return nil, nil }
+
+func TestNewWorldInstances(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	shape := &GeomShape{
+		Vertexes: []GeomShapeVertex{{Pos: [3]float32{0, 0, 0}}, {Pos: [3]float32{1, 0, 0}}, {Pos: [3]float32{0, 1, 0}}},
+		Indexes:  []GeomShapeIndex{{Indexes: [3]uint16{0, 1, 2}}},
+	}
+	// capacity is reserved, so nodes can point to tags
+	w := &wad.Wad{Tags: make([]wad.Tag, 0, 16)}
+	addNode := func(name string, parent wad.NodeId, cache wad.File, serverId uint32) {
+		id := wad.NodeId(len(w.Nodes))
+		w.Tags = append(w.Tags, wad.Tag{Id: wad.TagId(id), Name: name, Size: 1, NodeId: id})
+		w.Nodes = append(w.Nodes, &wad.Node{
+			Id:             id,
+			Tag:            &w.Tags[id],
+			Parent:         parent,
+			Cache:          cache,
+			CachedServerId: serverId,
+		})
+		if parent == wad.NODE_INVALID {
+			w.Roots = append(w.Roots, id)
+		} else {
+			w.Nodes[parent].SubGroupNodes = append(w.Nodes[parent].SubGroupNodes, id)
+		}
+	}
+	addNode("OBJ", wad.NODE_INVALID, testNodeFile{}, objectServerId)
+	addNode("COLL", 0, shape, 0)
+	addNode("INST1", wad.NODE_INVALID, &inst.Instance{Object: "OBJ", Position1: mgl32.Vec4{10, 0, 0, 1}}, inst.INSTANCE_MAGIC)
+	addNode("INST2", wad.NODE_INVALID, &inst.Instance{Object: "OBJ", Position1: mgl32.Vec4{0, 0, 20, 1},
+		Rotation: mgl32.Vec4{0, 0, math.Pi / 2, 0}}, inst.INSTANCE_MAGIC)
+	addNode("LOOSE", wad.NODE_INVALID, shape, 0)
+	// debug collision shape is not supported, so it must be reported
+	addNode("DBG", wad.NODE_INVALID, nil, 0)
+	dbg := w.Nodes[len(w.Nodes)-1].Tag
+	dbg.Tag = wad.TAG_GOW1_SERVER_INSTANCE
+	dbg.Data = append([]byte{COLLISION_MAGIC, 0, 0, 0}, []byte("mCDbgHdr\x00\x00\x00\x00")...)
+
+	world, err := NewWorld(w, wad.NODE_INVALID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(world.Triangles) != 3 {
+		t.Fatalf("Got %d triangles, object collision must be placed only by instances", len(world.Triangles))
+	}
+
+	if len(world.Skipped) != 1 || !strings.HasPrefix(world.Skipped[0], "DBG: ") {
+		t.Errorf("Unexpected skipped %v", world.Skipped)
+	}
+
+	expected := map[string][3]mgl32.Vec3{
+		"INST1": {{10, 0, 0}, {11, 0, 0}, {10, 1, 0}},
+		"INST2": {{0, 0, 20}, {0, 1, 20}, {-1, 0, 20}},
+		"":      {{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+	}
+	for _, tri := range world.Triangles {
+		exp, ok := expected[tri.Instance]
+		if !ok {
+			t.Fatalf("Unexpected instance '%s'", tri.Instance)
+		}
+		for i := range exp {
+			if tri.Vertices[i].Sub(exp[i]).Len() > 1e-5 {
+				t.Errorf("Instance '%s' vertex %d: %v, expected %v", tri.Instance, i, tri.Vertices[i], exp[i])
+			}
+		}
+	}
+
+	hit, ok := world.RayCast(mgl32.Vec3{10.2, 0.2, 5}, mgl32.Vec3{0, 0, -1}, 100)
+	if !ok || world.Triangles[hit.Triangle].Instance != "INST1" {
+		t.Errorf("Ray must hit collision of INST1: %v %v", hit, ok)
+	}
+}
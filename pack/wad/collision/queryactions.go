@@ -0,0 +1,145 @@
+package collision
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+type QueryHit struct {
+	Hit
+	Context  string
+	Source   string
+	Instance string
+	Node     wad.NodeId
+	Vertices [3]mgl32.Vec3
+}
+
+type QueryResult struct {
+	TrianglesCount int
+	Skipped        []string
+	Hits           []QueryHit
+}
+
+func parseQueryVec3(r *http.Request, name string) (mgl32.Vec3, error) {
+	var v mgl32.Vec3
+	values, err := utils.ParseFloats(r.FormValue(name), 3)
+	if err != nil {
+		return v, fmt.Errorf("Parameter '%s': %v", name, err)
+	}
+	copy(v[:], values)
+	return v, nil
+}
+
+func parseQueryFloat(r *http.Request, name string, def float32) (float32, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Parameter '%s': %v", name, err)
+	}
+	return float32(f), nil
+}
+
+func (world *World) queryHit(h Hit) QueryHit {
+	t := &world.Triangles[h.Triangle]
+	return QueryHit{Hit: h, Context: t.Context, Source: t.Source, Instance: t.Instance, Node: t.Node, Vertices: t.Vertices}
+}
+
+// Query processes request with parameters:
+// type=ray&origin=x,y,z&dir=x,y,z[&max=dist]
+// type=nearest&point=x,y,z[&max=dist]
+// type=sphere&center=x,y,z&radius=r
+func (world *World) Query(r *http.Request) (*QueryResult, error) {
+	result := &QueryResult{
+		TrianglesCount: len(world.Triangles),
+		Skipped:        world.Skipped,
+		Hits:           make([]QueryHit, 0),
+	}
+
+	maxDist, err := parseQueryFloat(r, "max", math.MaxFloat32)
+	if err != nil {
+		return nil, err
+	}
+
+	switch qtype := r.FormValue("type"); qtype {
+	case "ray":
+		origin, err := parseQueryVec3(r, "origin")
+		if err != nil {
+			return nil, err
+		}
+		dir, err := parseQueryVec3(r, "dir")
+		if err != nil {
+			return nil, err
+		}
+		if hit, ok := world.RayCast(origin, dir, maxDist); ok {
+			result.Hits = append(result.Hits, world.queryHit(*hit))
+		}
+	case "nearest":
+		point, err := parseQueryVec3(r, "point")
+		if err != nil {
+			return nil, err
+		}
+		if hit, ok := world.Nearest(point, maxDist); ok {
+			result.Hits = append(result.Hits, world.queryHit(*hit))
+		}
+	case "sphere":
+		center, err := parseQueryVec3(r, "center")
+		if err != nil {
+			return nil, err
+		}
+		radius, err := parseQueryFloat(r, "radius", 0)
+		if err != nil {
+			return nil, err
+		}
+		if radius <= 0 {
+			return nil, fmt.Errorf("Parameter 'radius' must be positive")
+		}
+		for _, hit := range world.SphereOverlap(center, radius) {
+			result.Hits = append(result.Hits, world.queryHit(hit))
+		}
+	default:
+		return nil, fmt.Errorf("Unknown query type '%s'", qtype)
+	}
+	return result, nil
+}
+
+func init() {
+	wad.AddSaveHandler(dropCachedWorlds)
+
+	// node parameter limits query to subtree of node (cxt chunk)
+	wad.SetActionHandler("collisionquery", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		root := wad.NodeId(wad.NODE_INVALID)
+		if node := r.FormValue("node"); node != "" {
+			id, err := strconv.Atoi(node)
+			if err != nil {
+				n := w.GetNodeByName(node, 0, true)
+				if n == nil {
+					return fmt.Errorf("Cannot find node '%s'", node)
+				}
+				id = int(n.Id)
+			}
+			root = wad.NodeId(id)
+		}
+
+		world, err := CachedWorld(w, root)
+		if err != nil {
+			return err
+		}
+		result, err := world.Query(r)
+		if err != nil {
+			return err
+		}
+		webutils.WriteJson(rw, result)
+		return nil
+	})
+}
@@ -3,10 +3,11 @@ package collision
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 
 	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/utils"
 )
 
 const RIBSHEET_HEADER_SIZE = 0x90
@@ -29,12 +30,15 @@ type ShapeRibSheet struct {
 	OffsetToSome9  uint32 // ?? floats array
 	OffsetToSome10 uint32
 
+	CtxNames            []string
 	Some7TrianglesIndex [][3]uint16
+	Some7TrianglesCtx   []uint16 // probably index of ctxNames
 	Some8QuadsIndex     [][4]uint16
+	Some8QuadsCtx       []uint16 // probably index of ctxNames
 	Some9Points         []mgl32.Vec3
 }
 
-func NewRibSheet(f io.ReaderAt, wrtw io.Writer) (*ShapeRibSheet, error) {
+func NewRibSheet(f io.ReaderAt) (*ShapeRibSheet, error) {
 	buf := make([]byte, RIBSHEET_HEADER_SIZE)
 	if _, err := f.ReadAt(buf, 0); err != nil {
 		return nil, err
@@ -59,6 +63,18 @@ func NewRibSheet(f io.ReaderAt, wrtw io.Writer) (*ShapeRibSheet, error) {
 		OffsetToSome10: binary.LittleEndian.Uint32(buf[0x8c:0x90]),
 	}
 
+	{
+		namesBuf := make([]byte, rib.OffsetToSome4-rib.OffsetToSome3)
+		if _, err := f.ReadAt(namesBuf, int64(rib.OffsetToSome3)); err != nil {
+			return nil, err
+		}
+
+		rib.CtxNames = make([]string, len(namesBuf)/0x18)
+		for i := range rib.CtxNames {
+			rib.CtxNames[i] = utils.BytesToString(namesBuf[i*0x18 : (i+1)*0x18])
+		}
+	}
+
 	{
 		indexBuf := make([]byte, rib.OffsetToSome8-rib.OffsetToSome7)
 		if _, err := f.ReadAt(indexBuf, int64(rib.OffsetToSome7)); err != nil {
@@ -66,8 +82,10 @@ func NewRibSheet(f io.ReaderAt, wrtw io.Writer) (*ShapeRibSheet, error) {
 		}
 
 		rib.Some7TrianglesIndex = make([][3]uint16, len(indexBuf)/10)
+		rib.Some7TrianglesCtx = make([]uint16, len(rib.Some7TrianglesIndex))
 		for i := range rib.Some7TrianglesIndex {
 			triaBuf := indexBuf[i*10 : (i+1)*10]
+			rib.Some7TrianglesCtx[i] = binary.LittleEndian.Uint16(triaBuf[0:2])
 			rib.Some7TrianglesIndex[i][0] = binary.LittleEndian.Uint16(triaBuf[4:6])
 			rib.Some7TrianglesIndex[i][1] = binary.LittleEndian.Uint16(triaBuf[6:8])
 			rib.Some7TrianglesIndex[i][2] = binary.LittleEndian.Uint16(triaBuf[8:10])
@@ -81,8 +99,10 @@ func NewRibSheet(f io.ReaderAt, wrtw io.Writer) (*ShapeRibSheet, error) {
 		}
 
 		rib.Some8QuadsIndex = make([][4]uint16, len(quadIndexBuf)/12)
+		rib.Some8QuadsCtx = make([]uint16, len(rib.Some8QuadsIndex))
 		for i := range rib.Some8QuadsIndex {
 			quadBuf := quadIndexBuf[i*12 : (i+1)*12]
+			rib.Some8QuadsCtx[i] = binary.LittleEndian.Uint16(quadBuf[0:2])
 			rib.Some8QuadsIndex[i][0] = binary.LittleEndian.Uint16(quadBuf[4:6])
 			rib.Some8QuadsIndex[i][1] = binary.LittleEndian.Uint16(quadBuf[6:8])
 			rib.Some8QuadsIndex[i][2] = binary.LittleEndian.Uint16(quadBuf[8:10])
@@ -105,21 +125,5 @@ func NewRibSheet(f io.ReaderAt, wrtw io.Writer) (*ShapeRibSheet, error) {
 		//log.Printf("%d points loaded", len(rib.Some9Points))
 	}
 
-	{
-		fmt.Fprintf(wrtw, "o ribsheet\n")
-		for _, point := range rib.Some9Points {
-			fmt.Fprintf(wrtw, "v %f %f %f\n", point[0], point[1], point[2])
-		}
-		fmt.Fprintf(wrtw, "o triangles\n")
-		for _, triIndex := range rib.Some7TrianglesIndex {
-			fmt.Fprintf(wrtw, "f %d %d %d\n", triIndex[0]+1, triIndex[1]+1, triIndex[2]+1)
-		}
-		fmt.Fprintf(wrtw, "o quads\n")
-		for _, quadIndex := range rib.Some8QuadsIndex {
-			fmt.Fprintf(wrtw, "f %d %d %d\n", quadIndex[0]+1, quadIndex[1]+1, quadIndex[2]+1)
-			fmt.Fprintf(wrtw, "f %d %d %d\n", quadIndex[3]+1, quadIndex[0]+1, quadIndex[2]+1)
-		}
-	}
-
 	return rib, nil
 }
@@ -1,13 +1,16 @@
 package cxt
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
 
 	"github.com/mogaika/god_of_war_browser/config"
 
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	"github.com/mogaika/god_of_war_browser/pack/wad/inst"
 	"github.com/mogaika/god_of_war_browser/pack/wad/obj"
+	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
 const CHUNK_MAGIC = 0x80000001
@@ -65,8 +68,36 @@ func (cxt *Chunk) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return ajax, nil
 }
 
+func (cxt *Chunk) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "gltf":
+		var buf bytes.Buffer
+		doc, err := cxt.ExportGLTF(wrsrc)
+		if err == nil {
+			err = doc.EncodeGLB(&buf)
+		}
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting gltf: %v", err))
+			return
+		}
+		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Name()+".glb")
+	}
+}
+
 func init() {
 	wad.SetHandler(config.GOW1, CHUNK_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		return NewFromData(wrsrc.Tag.Data)
 	})
+	wad.SetActionHandler("gltfscene", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		doc, err := ExportWadGLTF(w)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := doc.EncodeGLB(&buf); err != nil {
+			return err
+		}
+		webutils.WriteFile(rw, bytes.NewReader(buf.Bytes()), w.Name()+".glb")
+		return nil
+	})
 }
@@ -0,0 +1,283 @@
+package cxt
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/collision"
+	"github.com/mogaika/god_of_war_browser/pack/wad/inst"
+	"github.com/mogaika/god_of_war_browser/pack/wad/light"
+	"github.com/mogaika/god_of_war_browser/pack/wad/obj"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+const (
+	gltfLightsExtension     = "KHR_lights_punctual"
+	gltfVisibilityExtension = "KHR_node_visibility"
+)
+
+type gltfSceneObject struct {
+	obj       *obj.Object
+	models    *obj.GLTFModels // nil if object has no models
+	collision *int            // mesh of object collision
+}
+
+// SceneExporter assembles instances of cxt chunks into single gltf scene.
+// Meshes, materials and textures of objects are shared between instances
+type SceneExporter struct {
+	Doc *gltf.Document
+
+	wad        *wad.Wad
+	sceneNodes []int
+	objects    map[wad.NodeId]*gltfSceneObject
+	lights     []interface{}
+	ambient    []interface{}
+}
+
+func NewSceneExporter(w *wad.Wad) *SceneExporter {
+	return &SceneExporter{
+		Doc:        gltf.NewDocument("god_of_war_browser"),
+		wad:        w,
+		sceneNodes: make([]int, 0),
+		objects:    make(map[wad.NodeId]*gltfSceneObject),
+		lights:     make([]interface{}, 0),
+		ambient:    make([]interface{}, 0),
+	}
+}
+
+func (se *SceneExporter) object(node *wad.Node) (*gltfSceneObject, error) {
+	if o, ok := se.objects[node.Id]; ok {
+		return o, nil
+	}
+
+	instance, _, err := se.wad.GetInstanceFromNode(node.Id)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := instance.(*obj.Object)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not object", node.Tag.Name)
+	}
+
+	o := &gltfSceneObject{obj: object}
+	wrsrc := se.wad.GetNodeResourceByNodeId(node.Id)
+	if models, err := object.ExportGLTFModels(wrsrc, se.Doc); err == nil {
+		o.models = models
+	}
+
+	for _, id := range node.SubGroupNodes {
+		n := se.wad.GetNodeById(id)
+		sub, _, err := se.wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		if c, ok := sub.(*collision.Collision); ok {
+			groups, err := c.ExportGroups()
+			if err != nil {
+				log.Printf("[cxt] Skipping collision '%s': %v", n.Tag.Name, err)
+				continue
+			}
+			mesh, err := collision.ExportGroupsGLTF(se.Doc, n.Tag.Name, groups)
+			if err != nil {
+				log.Printf("[cxt] Skipping collision '%s': %v", n.Tag.Name, err)
+				continue
+			}
+			o.collision = &mesh
+		}
+	}
+
+	se.objects[node.Id] = o
+	return o, nil
+}
+
+func (se *SceneExporter) addInstance(parent int, chunkNode *wad.Node, instance *inst.Instance, name string) error {
+	objectNode := se.wad.GetNodeByName(instance.Object, chunkNode.Id-1, false)
+	if objectNode == nil {
+		return fmt.Errorf("Cannot find object '%s'", instance.Object)
+	}
+	o, err := se.object(objectNode)
+	if err != nil {
+		return err
+	}
+
+	t := [3]float32{instance.Position1[0], instance.Position1[1], instance.Position1[2]}
+	q := instance.RotationQuat()
+	r := [4]float32{q.V[0], q.V[1], q.V[2], q.W}
+	instNode := se.Doc.AddNode(gltf.Node{
+		Name:        name,
+		Translation: &t,
+		Rotation:    &r,
+		Extras: map[string]interface{}{
+			"object": instance.Object,
+			"id":     instance.Id,
+			"params": instance.Params,
+		},
+	})
+	se.Doc.AddChild(parent, instNode)
+
+	if o.models != nil {
+		skel, skinned := o.obj.AddGLTFNodes(se.Doc, instance.Object, o.models)
+		se.Doc.AddChild(instNode, skel.Root)
+		se.sceneNodes = append(se.sceneNodes, skinned...)
+	}
+
+	if o.collision != nil {
+		se.Doc.UseExtension(gltfVisibilityExtension)
+		se.Doc.AddChild(instNode, se.Doc.AddNode(gltf.Node{
+			Name: instance.Object + "_collision",
+			Mesh: o.collision,
+			Extensions: map[string]interface{}{
+				gltfVisibilityExtension: map[string]interface{}{"visible": false},
+			},
+			Extras: map[string]interface{}{"layer": "collision"},
+		}))
+	}
+	return nil
+}
+
+// AddChunk adds node with every instance of cxt chunk
+func (se *SceneExporter) AddChunk(node *wad.Node) error {
+	root := se.Doc.AddNode(gltf.Node{Name: node.Tag.Name})
+	se.sceneNodes = append(se.sceneNodes, root)
+
+	for _, id := range node.SubGroupNodes {
+		n := se.wad.GetNodeById(id)
+		instance, _, err := se.wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		if i, ok := instance.(*inst.Instance); ok {
+			if err := se.addInstance(root, node, i, n.Tag.Name); err != nil {
+				return fmt.Errorf("Error exporting instance '%s': %v", n.Tag.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func lightColor(l *light.Light) [3]float32 {
+	var c [3]float32
+	for i := range c {
+		c[i] = float32(math.Max(0, math.Min(1, float64(l.Color[i]))))
+	}
+	return c
+}
+
+// AddLight adds light as KHR_lights_punctual light, world is transform of light position.
+// Ambient lights have no analogue, so they are stored in scene extras
+func (se *SceneExporter) AddLight(name string, l *light.Light, world mgl32.Mat4) {
+	raw := map[string]interface{}{
+		"name":     name,
+		"flags":    l.Flags,
+		"position": l.Position,
+		"rotation": l.Rotation,
+		"color":    l.Color,
+	}
+
+	typ := l.TypeName()
+	switch typ {
+	case "ambient":
+		se.ambient = append(se.ambient, raw)
+		return
+	case "point", "directional":
+	default:
+		log.Printf("[cxt] Skipping light '%s' with unknown flags 0x%x", name, l.Flags)
+		return
+	}
+
+	se.Doc.UseExtension(gltfLightsExtension)
+	se.lights = append(se.lights, map[string]interface{}{
+		"name":      name,
+		"type":      typ,
+		"color":     lightColor(l),
+		"intensity": 1,
+	})
+
+	pos := world.Col(3)
+	t := [3]float32{pos[0], pos[1], pos[2]}
+	node := gltf.Node{
+		Name:        name,
+		Translation: &t,
+		Extensions: map[string]interface{}{
+			gltfLightsExtension: map[string]interface{}{"light": len(se.lights) - 1},
+		},
+		Extras: raw,
+	}
+	// probably rotation of directional light is direction vector,
+	// gltf light shines along -Z of node
+	if dir := world.Mul4x1(l.Rotation.Vec3().Vec4(0)).Vec3(); typ == "directional" && dir.Len() > 1e-6 {
+		q := mgl32.QuatBetweenVectors(mgl32.Vec3{0, 0, -1}, dir.Normalize())
+		node.Rotation = &[4]float32{q.V[0], q.V[1], q.V[2], q.W}
+	}
+	se.sceneNodes = append(se.sceneNodes, se.Doc.AddNode(node))
+}
+
+// AddLights adds every light of node subtree
+func (se *SceneExporter) AddLights(ids []wad.NodeId) {
+	for _, id := range ids {
+		n := se.wad.GetNodeById(id)
+		if n == nil {
+			continue
+		}
+		if instance, _, err := se.wad.GetInstanceFromNode(n.Id); err == nil {
+			if l, ok := instance.(*light.Light); ok {
+				se.AddLight(n.Tag.Name, l, lightWorldMatrix(se.wad, n, l))
+			}
+		}
+		// links to other nodes have no own subnodes
+		if n.Id == id {
+			se.AddLights(n.SubGroupNodes)
+		}
+	}
+}
+
+// Finish adds scene with all added nodes
+func (se *SceneExporter) Finish(name string) *gltf.Document {
+	if len(se.lights) != 0 {
+		if se.Doc.Extensions == nil {
+			se.Doc.Extensions = make(map[string]interface{})
+		}
+		se.Doc.Extensions[gltfLightsExtension] = map[string]interface{}{"lights": se.lights}
+	}
+	scene := se.Doc.AddScene(name, se.sceneNodes)
+	if len(se.ambient) != 0 {
+		se.Doc.Scenes[scene].Extras = map[string]interface{}{"ambientLights": se.ambient}
+	}
+	return se.Doc
+}
+
+// ExportGLTF exports instances and lights of chunk
+func (cxt *Chunk) ExportGLTF(wrsrc *wad.WadNodeRsrc) (*gltf.Document, error) {
+	se := NewSceneExporter(wrsrc.Wad)
+	if err := se.AddChunk(wrsrc.Node); err != nil {
+		return nil, err
+	}
+	se.AddLights(wrsrc.Node.SubGroupNodes)
+	return se.Finish(wrsrc.Name()), nil
+}
+
+// ExportWadGLTF exports every cxt chunk and every light of wad
+func ExportWadGLTF(w *wad.Wad) (*gltf.Document, error) {
+	se := NewSceneExporter(w)
+	for _, n := range w.Nodes {
+		// skip links to chunks
+		if w.GetNodeById(n.Id) != n {
+			continue
+		}
+		instance, _, err := w.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		if _, ok := instance.(*Chunk); ok {
+			if err := se.AddChunk(n); err != nil {
+				return nil, fmt.Errorf("Error exporting chunk '%s': %v", n.Tag.Name, err)
+			}
+		}
+	}
+	se.AddLights(w.Roots)
+	return se.Finish(w.Name()), nil
+}
@@ -0,0 +1,106 @@
+package cxt
+
+import (
+	"net/http"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/inst"
+	"github.com/mogaika/god_of_war_browser/pack/wad/light"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+type LightInfo struct {
+	Node     wad.NodeId
+	Name     string
+	Type     string
+	Light    *light.Light
+	Group    string // name of parent node
+	Chunk    string // cxt chunk light belongs to
+	Instance string // instance light belongs to, light is transformed by it
+
+	WorldMatrix    mgl32.Mat4
+	WorldPosition  mgl32.Vec3
+	WorldDirection mgl32.Vec3 // rotation of light is probably direction vector
+}
+
+// instancesMatrix returns transform applied to node by parent instances
+func instancesMatrix(w *wad.Wad, n *wad.Node) mgl32.Mat4 {
+	m := mgl32.Ident4()
+	for id := n.Parent; id != wad.NODE_INVALID; id = w.Nodes[id].Parent {
+		if pi, _, err := w.GetInstanceFromNode(w.Nodes[id].Id); err == nil {
+			if v, ok := pi.(*inst.Instance); ok {
+				m = v.Matrix().Mul4(m)
+			}
+		}
+	}
+	return m
+}
+
+// lightWorldMatrix returns light position transformed by parent instances
+func lightWorldMatrix(w *wad.Wad, n *wad.Node, l *light.Light) mgl32.Mat4 {
+	return instancesMatrix(w, n).Mul4(mgl32.Translate3D(l.Position[0], l.Position[1], l.Position[2]))
+}
+
+// ListLights returns every light of wad with transform applied by parent instances
+func ListLights(w *wad.Wad) []LightInfo {
+	result := make([]LightInfo, 0)
+	for _, n := range w.Nodes {
+		// skip links
+		if w.GetNodeById(n.Id) != n {
+			continue
+		}
+		instance, _, err := w.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		l, ok := instance.(*light.Light)
+		if !ok {
+			continue
+		}
+
+		info := LightInfo{
+			Node:        n.Id,
+			Name:        n.Tag.Name,
+			Type:        l.TypeName(),
+			Light:       l,
+			WorldMatrix: lightWorldMatrix(w, n, l),
+		}
+		if parent := w.GetNodeById(n.Parent); parent != nil {
+			info.Group = parent.Tag.Name
+		}
+
+		for id := n.Parent; id != wad.NODE_INVALID; id = w.Nodes[id].Parent {
+			p := w.Nodes[id]
+			pi, _, err := w.GetInstanceFromNode(p.Id)
+			if err != nil {
+				continue
+			}
+			switch pi.(type) {
+			case *inst.Instance:
+				if info.Instance == "" {
+					info.Instance = p.Tag.Name
+				}
+			case *Chunk:
+				if info.Chunk == "" {
+					info.Chunk = p.Tag.Name
+				}
+			}
+		}
+
+		info.WorldPosition = info.WorldMatrix.Col(3).Vec3()
+		if dir := info.WorldMatrix.Mul4x1(l.Rotation.Vec3().Vec4(0)).Vec3(); dir.Len() > 1e-6 {
+			info.WorldDirection = dir.Normalize()
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func init() {
+	wad.SetActionHandler("lights", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		webutils.WriteJson(rw, ListLights(w))
+		return nil
+	})
+}
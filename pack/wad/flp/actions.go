@@ -2,8 +2,11 @@ package flp
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
@@ -63,6 +66,42 @@ func (f *FLP) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.
 		if err := f.actionImportBmFont(wrsrc, zr, scale); err != nil {
 			webutils.WriteError(w, err)
 		}
+	case "importttf":
+		fTtf, _, err := r.FormFile("data")
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		defer fTtf.Close()
+		data, err := ioutil.ReadAll(fTtf)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+
+		scale := float32(1.0)
+		if strScale := r.FormValue("scale"); strScale != "" {
+			possibleScale, err := strconv.ParseFloat(strScale, 32)
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("Invalid scale: %v", err))
+				return
+			}
+			scale = float32(possibleScale)
+		}
+		size := 0.0
+		if strSize := r.FormValue("size"); strSize != "" {
+			if size, err = strconv.ParseFloat(strSize, 64); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Invalid size: %v", err))
+				return
+			}
+		}
+
+		result, err := f.actionImportTtf(wrsrc, data, []rune(r.FormValue("chars")), size, scale, r.FormValue("texture"))
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteJson(w, result)
 	case "scriptstring":
 		q := r.URL.Query()
 		id, err := strconv.ParseInt(q.Get("id"), 10, 32)
@@ -81,6 +120,117 @@ func (f *FLP) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.
 		}); err != nil {
 			webutils.WriteError(w, err)
 		}
+	case "script":
+		id, err := strconv.Atoi(r.FormValue("id"))
+		scripts := f.Scripts()
+		if err != nil || id < 0 || id >= len(scripts) {
+			webutils.WriteError(w, fmt.Errorf("Invalid script id '%s'", r.FormValue("id")))
+			return
+		}
+		if err := scripts[id].Assemble(r.FormValue("code")); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		f.collectScriptPushRefs()
+
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+			wrsrc.Tag.Id: f.marshalBufferWithHeader().Bytes(),
+		}); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteJson(w, scripts[id])
+	case "scriptcheck":
+		type result struct {
+			Id    int
+			Error string
+		}
+		results := make([]result, 0)
+		for _, s := range f.Scripts() {
+			if err := s.CheckRoundTrip(); err != nil {
+				results = append(results, result{Id: s.Id, Error: err.Error()})
+			}
+		}
+		webutils.WriteJson(w, results)
+	case "json":
+		data, err := f.ExportJson()
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, bytes.NewReader(data), wrsrc.Name()+".json")
+	case "importjson":
+		file, _, err := r.FormFile("data")
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		defer file.Close()
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+
+		imported, err := NewFromJson(data)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		data = imported.marshalBufferWithHeader().Bytes()
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{wrsrc.Tag.Id: data}); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteJson(w, struct {
+			Size    int
+			Scripts int
+		}{len(data), len(imported.Scripts())})
+	case "render":
+		opts := &RenderOptions{}
+		frames := r.FormValue("frames")
+		if frames == "" {
+			frames = r.FormValue("frame")
+		}
+		if frames != "" {
+			var err error
+			if opts.Frames, err = ParseRenderFrames(frames); err != nil {
+				webutils.WriteError(w, err)
+				return
+			}
+		}
+		for _, param := range []struct {
+			name  string
+			value *int
+		}{{"width", &opts.Width}, {"height", &opts.Height}, {"columns", &opts.Columns}} {
+			if str := r.FormValue(param.name); str != "" {
+				var err error
+				if *param.value, err = strconv.Atoi(str); err != nil || *param.value <= 0 {
+					webutils.WriteError(w, fmt.Errorf("Invalid %s '%s'", param.name, str))
+					return
+				}
+			}
+		}
+		for _, param := range []struct {
+			name  string
+			value *float64
+		}{{"originx", &opts.OriginX}, {"originy", &opts.OriginY}} {
+			if str := r.FormValue(param.name); str != "" {
+				var err error
+				if *param.value, err = strconv.ParseFloat(str, 64); err != nil {
+					webutils.WriteError(w, fmt.Errorf("Invalid %s: %v", param.name, err))
+					return
+				}
+			}
+		}
+
+		data, err := f.RenderPng(wrsrc, opts)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
 	case "transform":
 		if strings.ToUpper(r.Method) == "POST" {
 			if err := r.ParseForm(); err != nil {
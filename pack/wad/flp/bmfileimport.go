@@ -2,9 +2,11 @@ package flp
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"image"
+	"image/png"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -102,28 +104,67 @@ func (f *FLP) actionImportBmFont(wrsrc *wad.WadNodeRsrc, zr *zip.Reader, scale f
 		if err != nil {
 			return fmt.Errorf("Cannot open texture '%s' from archive: %v", texture_name, err)
 		}
-		defer f.Close()
-
-		if txrTag := wrsrc.Wad.GetTagByName("TXR_"+texture_name, meshTagId, false); txrTag != nil {
-			txrInst, _, err := wrsrc.Wad.GetInstanceFromTag(txrTag.Id)
-			if err != nil {
-				return fmt.Errorf("Error when reuploading txr '%s': %v", texture_name, err)
-			}
-			txr := txrInst.(*file_txr.Texture)
-			txr.ChangeTexture(wrsrc.Wad.GetNodeResourceByTagId(txrTag.Id), f)
-		} else {
-			img, _, err := image.Decode(f)
-			if err != nil {
-				return fmt.Errorf("Cannot decode image '%s': %v", texture_name, err)
-			}
-			file_txr.CreateNewTextureInWad(wrsrc.Wad, texture_name, meshTagId-4, img)
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Cannot decode image '%s': %v", texture_name, err)
+		}
+		if err := importFontTexture(wrsrc, meshTagId, texture_name, img); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func bmFontNewMeshPartReferenceFromChar(bmf *bmfont.Font, char *bmfont.Char, mesh *file_mesh.Mesh, prevRef *MeshPartReference, scale float32) *MeshPartReference {
+// importFontTexture replaces TXR_<name> texture or creates new one near font mesh
+func importFontTexture(wrsrc *wad.WadNodeRsrc, meshTagId wad.TagId, name string, img image.Image) error {
+	txrTag := wrsrc.Wad.GetTagByName("TXR_"+name, meshTagId, false)
+	if txrTag == nil {
+		return file_txr.CreateNewTextureInWad(wrsrc.Wad, name, meshTagId-4, img)
+	}
+
+	txrInst, _, err := wrsrc.Wad.GetInstanceFromTag(txrTag.Id)
+	if err != nil {
+		return fmt.Errorf("Error when reuploading txr '%s': %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return txrInst.(*file_txr.Texture).ChangeTexture(wrsrc.Wad.GetNodeResourceByTagId(txrTag.Id), &buf)
+}
+
+// fontGlyphQuad is glyph rectangle in pixels relative to baseline and texture coordinates of glyph
+type fontGlyphQuad struct {
+	X, Y    [2]float32
+	U, V    [2]float32
+	Texture string // name without TXR_ prefix
+}
+
+func bmFontCharQuad(bmf *bmfont.Font, char *bmfont.Char) *fontGlyphQuad {
+	return &fontGlyphQuad{
+		X: [2]float32{
+			float32(char.Xoffset),
+			float32(char.Xoffset) + float32(char.Width),
+		},
+		Y: [2]float32{
+			-float32(bmf.Common.Base) + float32(char.Yoffset),
+			-float32(bmf.Common.Base) + float32(char.Yoffset) + float32(char.Height),
+		},
+		U: [2]float32{
+			float32(char.X) / float32(bmf.Common.ScaleW),
+			float32(char.X+char.Width) / float32(bmf.Common.ScaleW),
+		},
+		V: [2]float32{
+			float32(char.Y) / float32(bmf.Common.ScaleH),
+			float32(char.Y+char.Height) / float32(bmf.Common.ScaleH),
+		},
+		Texture: bmf.Pages[char.Page],
+	}
+}
+
+func newFontMeshPartReference(quad *fontGlyphQuad, mesh *file_mesh.Mesh, prevRef *MeshPartReference, scale float32) *MeshPartReference {
 	meshPartIndex := int16(len(mesh.Parts))
 	if prevRef != nil {
 		meshPartIndex = prevRef.MeshPartIndex
@@ -156,27 +197,16 @@ func bmFontNewMeshPartReferenceFromChar(bmf *bmfont.Font, char *bmfont.Char, mes
 		Unk1c:                 1,
 		SourceVerticesCount:   4,
 		RawDmaAndJointsData: generateMeshDmaPacketData(
-			[2]float32{
-				float32(char.Xoffset) * scale,
-				(float32(char.Xoffset) + float32(char.Width)) * scale,
-			}, [2]float32{
-				(-float32(bmf.Common.Base) + float32(char.Yoffset)) * scale,
-				(-float32(bmf.Common.Base) + float32(char.Yoffset) + float32(char.Height)) * scale,
-			},
-			[2]float32{
-				float32(char.X) / float32(bmf.Common.ScaleW),
-				float32(char.X+char.Width) / float32(bmf.Common.ScaleW),
-			}, [2]float32{
-				float32(char.Y) / float32(bmf.Common.ScaleH),
-				float32(char.Y+char.Height) / float32(bmf.Common.ScaleH),
-			}),
+			[2]float32{quad.X[0] * scale, quad.X[1] * scale},
+			[2]float32{quad.Y[0] * scale, quad.Y[1] * scale},
+			quad.U, quad.V),
 	}}
 
 	return &MeshPartReference{
 		MeshPartIndex: meshPartIndex,
 		Materials: []MeshPartMaterialSlot{{
 			Color:       0xffffffff,
-			TextureName: "TXR_" + bmf.Pages[char.Page],
+			TextureName: "TXR_" + quad.Texture,
 		}},
 	}
 }
@@ -189,39 +219,46 @@ func (f *FLP) ImportBmFont(font *Font, mesh *file_mesh.Mesh, bmf *bmfont.Font, s
 
 	for iBmChar := range bmf.Chars {
 		bmchar := &bmf.Chars[iBmChar]
-		unicodeChar := rune(bmchar.Id)
-
-		var ansiiCharId uint8 = 0
-		if charAlias, charAliasExists := fontAliases[unicodeChar]; charAliasExists {
-			ansiiCharId = charAlias
-		} else {
-			if unicodeChar < 0x100 {
-				ansiiCharId = uint8(unicodeChar)
-			} else {
-				return fmt.Errorf("Cannot map char '%v' (%v). Please update font_aliases.cfg file", string(unicodeChar), unicodeChar)
-			}
+		ansiiCharId, err := fontCharByte(fontAliases, rune(bmchar.Id))
+		if err != nil {
+			return err
 		}
-
-		glyphId := font.CharNumberToSymbolIdMap[ansiiCharId]
 		charWidth := int16(float32(bmchar.Xadvance) * file_mesh.GSFixedPoint8 * scale)
-		if glyphId == -1 {
-			// create new glyph
-			newGlyphId := int16(font.CharsCount)
-			newMeshRef := bmFontNewMeshPartReferenceFromChar(bmf, bmchar, mesh, nil, scale)
-			font.MeshesRefs = append(font.MeshesRefs, *newMeshRef)
-			font.SymbolWidths = append(font.SymbolWidths, charWidth)
-			font.CharsCount++
-			font.CharNumberToSymbolIdMap[ansiiCharId] = newGlyphId
-		} else {
-			// update exists glyph
-			font.MeshesRefs[glyphId] = *bmFontNewMeshPartReferenceFromChar(bmf, bmchar, mesh, &font.MeshesRefs[glyphId], scale)
-			font.SymbolWidths[glyphId] = charWidth
-		}
+		setFontGlyph(font, mesh, ansiiCharId, charWidth, bmFontCharQuad(bmf, bmchar), scale)
 	}
 
 	return nil
 }
 
+// fontCharByte maps unicode char to char number of font using font aliases
+func fontCharByte(fontAliases config.FontCharToAsciiByteAssoc, unicodeChar rune) (uint8, error) {
+	if charAlias, charAliasExists := fontAliases[unicodeChar]; charAliasExists {
+		return charAlias, nil
+	}
+	if unicodeChar < 0x100 {
+		return uint8(unicodeChar), nil
+	}
+	return 0, fmt.Errorf("Cannot map char '%v' (%v). Please update font_aliases.cfg file", string(unicodeChar), unicodeChar)
+}
+
+// setFontGlyph creates new glyph for char or updates exists one
+func setFontGlyph(font *Font, mesh *file_mesh.Mesh, ansiiCharId uint8, charWidth int16, quad *fontGlyphQuad, scale float32) {
+	glyphId := font.CharNumberToSymbolIdMap[ansiiCharId]
+	if glyphId == -1 {
+		// create new glyph
+		newGlyphId := int16(font.CharsCount)
+		newMeshRef := newFontMeshPartReference(quad, mesh, nil, scale)
+		font.MeshesRefs = append(font.MeshesRefs, *newMeshRef)
+		font.SymbolWidths = append(font.SymbolWidths, charWidth)
+		font.CharsCount++
+		font.CharNumberToSymbolIdMap[ansiiCharId] = newGlyphId
+	} else {
+		// update exists glyph
+		font.MeshesRefs[glyphId] = *newFontMeshPartReference(quad, mesh, &font.MeshesRefs[glyphId], scale)
+		font.SymbolWidths[glyphId] = charWidth
+	}
+}
+
 func generateMeshDmaPacketData(x [2]float32, y [2]float32, texture_u [2]float32, texture_v [2]float32) []byte {
 	dmaPacketData := make([]byte, len(preparedMeshDmaPacketData))
 	copy(dmaPacketData, preparedMeshDmaPacketData)
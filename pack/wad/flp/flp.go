@@ -1,7 +1,6 @@
 package flp
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
@@ -39,8 +38,6 @@ func posPad4(pos int) int {
 	}
 }
 
-var currentFlpInstance *FLP
-
 type FLP struct {
 	Unk04                 uint32
 	Unk08                 uint32
@@ -59,12 +56,9 @@ type FLP struct {
 	scriptPushRefs []ScriptOpcodeStringPushReference
 }
 
+// GlobalHandler is index in FLP.GlobalHandlersIndexes
 type GlobalHandler uint16
 
-func (gh GlobalHandler) MarshalJSON() ([]byte, error) {
-	return json.Marshal(currentFlpInstance.GlobalHandlersIndexes[gh])
-}
-
 type GlobalHandlerIndex struct {
 	TypeArrayId       uint16
 	IdInThatTypeArray uint16
@@ -200,7 +194,6 @@ type BlendColor struct {
 
 func NewFromData(buf []byte) (*FLP, error) {
 	f := &FLP{}
-	currentFlpInstance = f
 	if err := f.fromBuffer(buf); err != nil {
 		return nil, fmt.Errorf("Error when reading flp header: %v", err)
 	}
@@ -0,0 +1,125 @@
+package flp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExportJson returns complete representation of flp.
+// Scripts are stored as decompiled text and assembled back on import,
+// global handlers are stored as indexes of GlobalHandlersIndexes
+func (f *FLP) ExportJson() ([]byte, error) {
+	return json.MarshalIndent(f, "", "\t")
+}
+
+// NewFromJson rebuilds flp from ExportJson output
+func NewFromJson(data []byte) (*FLP, error) {
+	f := &FLP{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("Unmarshaling error: %v", err)
+	}
+
+	for i, s := range f.Scripts() {
+		if s == nil {
+			return nil, fmt.Errorf("Script %d is missed", i)
+		}
+		if err := s.Assemble(s.Decompiled); err != nil {
+			return nil, fmt.Errorf("Error assembling script %d: %v", i, err)
+		}
+		s.Id = i
+	}
+	f.collectScriptPushRefs()
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// validate checks counts and references that cannot be checked by marshaler
+func (f *FLP) validate() error {
+	checkHandler := func(gh GlobalHandler, where string) error {
+		if int(gh) >= len(f.GlobalHandlersIndexes) {
+			return fmt.Errorf("%s: global handler %d out of range (%d handlers)", where, gh, len(f.GlobalHandlersIndexes))
+		}
+		return nil
+	}
+	checkU16 := func(count int, where string) error {
+		if count > 0xffff {
+			return fmt.Errorf("%s: too many elements (%d)", where, count)
+		}
+		return nil
+	}
+
+	if err := checkU16(len(f.Transformations), "Transformations"); err != nil {
+		return err
+	}
+	if err := checkU16(len(f.BlendColors), "BlendColors"); err != nil {
+		return err
+	}
+
+	for i, font := range f.Fonts {
+		where := fmt.Sprintf("Font %d", i)
+		if font.Flags&(4|2) == (4 | 2) {
+			return fmt.Errorf("%s: flags 2 and 4 cannot be used together", where)
+		}
+		if len(font.SymbolWidths) != int(font.CharsCount) {
+			return fmt.Errorf("%s: %d symbol widths for %d chars", where, len(font.SymbolWidths), font.CharsCount)
+		}
+		if font.Flags&(4|2) != 0 && len(font.MeshesRefs) != int(font.CharsCount) {
+			return fmt.Errorf("%s: %d mesh references for %d chars", where, len(font.MeshesRefs), font.CharsCount)
+		}
+		mapSize := int(font.CharsCount)
+		if font.Flags&1 != 0 {
+			mapSize = 0x100
+		}
+		if len(font.CharNumberToSymbolIdMap) != mapSize {
+			return fmt.Errorf("%s: char map must contain %d elements", where, mapSize)
+		}
+	}
+
+	for i, dl := range f.DynamicLabels {
+		if err := checkHandler(dl.FontHandler, fmt.Sprintf("Dynamic label %d", i)); err != nil {
+			return err
+		}
+	}
+
+	checkScreen := func(d6s1 *Data6Subtype1, where string) error {
+		if err := checkU16(len(d6s1.ElementsAnimation), where+" animations"); err != nil {
+			return err
+		}
+		if err := checkU16(len(d6s1.FrameScriptLables), where+" frame script labels"); err != nil {
+			return err
+		}
+		for i, ea := range d6s1.ElementsAnimation {
+			if err := checkU16(len(ea.KeyFrames), fmt.Sprintf("%s animation %d", where, i)); err != nil {
+				return err
+			}
+			for j, kf := range ea.KeyFrames {
+				if err := checkHandler(kf.ElementHandler, fmt.Sprintf("%s animation %d keyframe %d", where, i, j)); err != nil {
+					return err
+				}
+			}
+		}
+		for i, fsl := range d6s1.FrameScriptLables {
+			if err := checkU16(len(fsl.Subs), fmt.Sprintf("%s frame script label %d", where, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := range f.Datas6 {
+		if err := checkScreen(&f.Datas6[i].Sub1, fmt.Sprintf("Data6 %d", i)); err != nil {
+			return err
+		}
+		if err := checkU16(len(f.Datas6[i].Sub2s), fmt.Sprintf("Data6 %d events", i)); err != nil {
+			return err
+		}
+	}
+	for i := range f.Datas7 {
+		if err := checkScreen(&f.Datas7[i], fmt.Sprintf("Data7 %d", i)); err != nil {
+			return err
+		}
+	}
+	return checkScreen(&f.Data8, "Data8")
+}
@@ -0,0 +1,130 @@
+package flp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// testFlp returns flp with every section filled
+func testFlp() *FLP {
+	return &FLP{
+		Unk04: 4,
+		Unk08: 8,
+		GlobalHandlersIndexes: []GlobalHandlerIndex{
+			{TypeArrayId: 3, IdInThatTypeArray: 0},
+			{TypeArrayId: 4, IdInThatTypeArray: 0},
+			{TypeArrayId: 5, IdInThatTypeArray: 0},
+			{TypeArrayId: 7, IdInThatTypeArray: 0},
+		},
+		MeshPartReferences: []MeshPartReference{
+			{MeshPartIndex: 1, Materials: []MeshPartMaterialSlot{{Color: 0x80808080, TextureName: "TXR_test"}}},
+		},
+		Fonts: []Font{{
+			CharsCount:              2,
+			Size:                    16,
+			Flags:                   2,
+			MeshesRefs:              []MeshPartReference{{MeshPartIndex: 0}, {MeshPartIndex: 2}},
+			SymbolWidths:            []int16{10, 12},
+			CharNumberToSymbolIdMap: []int16{0, 1},
+			Float020:                1.5,
+		}},
+		StaticLabels: []StaticLabel{{
+			Transformation: Transformation{Matrix: [4]float64{1, 0, 0, 1}, OffsetX: 2, OffsetY: -3},
+			RenderCommandsList: []*StaticLabelRenderCommand{{
+				Flags:       8 | 4 | 2 | 1,
+				FontHandler: 0,
+				FontScale:   1,
+				BlendColor:  [4]byte{0x80, 0x80, 0x80, 0x80},
+				OffsetX:     4,
+				OffsetY:     5,
+				Glyphs:      []StaticLabelRenderCommandSingleGlyph{{GlyphId: 1, Width: 12}, {GlyphId: 0, Width: 10}},
+			}},
+		}},
+		DynamicLabels: []DynamicLabel{{ValueName: "value", Placeholder: "placeholder", FontHandler: 0, Width1: 100}},
+		Datas6: []Data6{{
+			Sub1: Data6Subtype1{
+				TotalFramesCount: 2,
+				ElementsAnimation: []ElementAnimation{{
+					FramesCount: 1,
+					KeyFrames:   []KeyFrame{{WhenThisFrameEnds: 2, ElementHandler: 1, Name: "frame"}},
+				}},
+				FrameScriptLables: []FrameScriptLabel{{
+					TriggerFrameNumber: 1,
+					LabelName:          "label",
+					Subs:               []Data6Subtype1Subtype2Subtype1{{Script: NewScriptFromData(testScript, nil)}},
+				}},
+			},
+			Sub2s: []Data6Subtype2{{Script: NewScriptFromData(testScript, nil), EventKeysMask: 16}},
+		}},
+		Datas7: []Data6Subtype1{{
+			TotalFramesCount:  1,
+			ElementsAnimation: []ElementAnimation{{FramesCount: 1, KeyFrames: []KeyFrame{{ElementHandler: 2}}}},
+		}},
+		Data8: Data6Subtype1{
+			ElementsAnimation: []ElementAnimation{{FramesCount: 1, KeyFrames: []KeyFrame{{ElementHandler: 3, ColorId: 0}}}},
+		},
+		Transformations: []Transformation{{Matrix: [4]float64{1, 0, 0, 1}}, {Matrix: [4]float64{0.5, 0, 0, 0.5}, OffsetX: 1}},
+		BlendColors:     []BlendColor{{Color: [4]uint16{256, 256, 256, 256}}},
+	}
+}
+
+func TestJsonRoundTrip(t *testing.T) {
+	original := testFlp().marshalBufferWithHeader().Bytes()
+	f, err := NewFromData(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := f.marshalBufferWithHeader().Bytes(); !bytes.Equal(data, original) {
+		t.Fatalf("Binary round trip changed flp:\n% x\n% x", data, original)
+	}
+
+	doc, err := f.ExportJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := NewFromJson(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := imported.marshalBufferWithHeader().Bytes(); !bytes.Equal(data, original) {
+		t.Errorf("Json round trip changed flp:\n% x\n% x", data, original)
+	}
+
+	// handlers are plain indexes, so export does not depend on other flp instances
+	var raw struct {
+		Datas6 []struct {
+			Sub1 struct {
+				ElementsAnimation []struct{ KeyFrames []json.RawMessage }
+			}
+		}
+	}
+	if err := json.Unmarshal(doc, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var kf struct{ ElementHandler json.RawMessage }
+	if err := json.Unmarshal(raw.Datas6[0].Sub1.ElementsAnimation[0].KeyFrames[0], &kf); err != nil || string(kf.ElementHandler) != "1" {
+		t.Errorf("Unexpected element handler %s: %v", kf.ElementHandler, err)
+	}
+}
+
+func TestJsonImportValidation(t *testing.T) {
+	for name, change := range map[string]func(f *FLP){
+		"handler out of range": func(f *FLP) { f.Data8.ElementsAnimation[0].KeyFrames[0].ElementHandler = 4 },
+		"font handler":         func(f *FLP) { f.DynamicLabels[0].FontHandler = 10 },
+		"symbol widths":        func(f *FLP) { f.Fonts[0].SymbolWidths = f.Fonts[0].SymbolWidths[:1] },
+		"font flags":           func(f *FLP) { f.Fonts[0].Flags = 6 },
+		"char map":             func(f *FLP) { f.Fonts[0].Flags |= 1 },
+		"broken script":        func(f *FLP) { f.Datas6[0].Sub2s[0].Script.Decompiled = "unknown_opcode" },
+	} {
+		f := testFlp()
+		change(f)
+		doc, err := f.ExportJson()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewFromJson(doc); err == nil {
+			t.Errorf("%s: invalid flp imported", name)
+		}
+	}
+}
@@ -0,0 +1,654 @@
+package flp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// Localization entries are identified by "<wad>/<tag>/static/<label>/<command>"
+// for glyphs of static label render command and "<wad>/<tag>/script/<ref>"
+// for ps2 script string pushes (same index as in scriptstring action).
+// Glyphs without char in font are written as "{glyph N}"
+
+type LocalizationEntry struct {
+	Id          string
+	Comment     string
+	Text        string // source text
+	Translation string
+}
+
+type LocalizationMissingChar struct {
+	Id   string
+	Char string
+	Font int // -1 if char cannot be encoded to byte at all
+}
+
+type LocalizationReport struct {
+	Updated []string
+	Skipped []string // source text changed since export
+	Missing []LocalizationMissingChar
+	Errors  []string
+}
+
+func NewLocalizationReport() *LocalizationReport {
+	return &LocalizationReport{
+		Updated: make([]string, 0),
+		Skipped: make([]string, 0),
+		Missing: make([]LocalizationMissingChar, 0),
+		Errors:  make([]string, 0),
+	}
+}
+
+var localizationGlyphRe = regexp.MustCompile(`\{glyph (\d+)\}`)
+
+type textCodec struct {
+	aliases config.FontCharToAsciiByteAssoc
+	reverse map[uint8]rune
+}
+
+func newTextCodec() (*textCodec, error) {
+	aliases, err := config.GetFontAliases()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load font aliases file: %v", err)
+	}
+	c := &textCodec{aliases: aliases, reverse: make(map[uint8]rune)}
+	for r, b := range aliases {
+		if prev, ok := c.reverse[b]; !ok || r < prev {
+			c.reverse[b] = r
+		}
+	}
+	return c, nil
+}
+
+func (c *textCodec) decodeChar(b uint8) rune {
+	if r, ok := c.reverse[b]; ok {
+		return r
+	}
+	return rune(b)
+}
+
+// same mapping as ImportBmFont uses
+func (c *textCodec) encodeChar(r rune) (uint8, bool) {
+	if b, ok := c.aliases[r]; ok {
+		return b, true
+	}
+	if r < 0x100 {
+		return uint8(r), true
+	}
+	return 0, false
+}
+
+func (c *textCodec) decodeString(data []byte) string {
+	var s strings.Builder
+	for _, b := range data {
+		s.WriteRune(c.decodeChar(b))
+	}
+	return s.String()
+}
+
+func (f *FLP) fontByHandler(handler uint16) (int, *Font, error) {
+	if int(handler) >= len(f.GlobalHandlersIndexes) {
+		return -1, nil, fmt.Errorf("Font handler %d out of range", handler)
+	}
+	gh := f.GlobalHandlersIndexes[handler]
+	if gh.TypeArrayId != 3 || int(gh.IdInThatTypeArray) >= len(f.Fonts) {
+		return -1, nil, fmt.Errorf("Handler %d is not a font", handler)
+	}
+	return int(gh.IdInThatTypeArray), &f.Fonts[gh.IdInThatTypeArray], nil
+}
+
+func (font *Font) glyphOfChar(char uint8) int16 {
+	if int(char) >= len(font.CharNumberToSymbolIdMap) {
+		return -1
+	}
+	return font.CharNumberToSymbolIdMap[char]
+}
+
+// walkLabelCommands calls cb for every render command with glyphs.
+// Font set by command is used by following commands too
+func (f *FLP) walkLabelCommands(cb func(iLabel, iCmd int, cmd *StaticLabelRenderCommand, iFont int, font *Font, scale float64) error) error {
+	for iLabel := range f.StaticLabels {
+		iFont, font, scale := -1, (*Font)(nil), 1.0
+		for iCmd, cmd := range f.StaticLabels[iLabel].RenderCommandsList {
+			if cmd.Flags&8 != 0 {
+				var err error
+				if iFont, font, err = f.fontByHandler(cmd.FontHandler); err != nil {
+					return fmt.Errorf("Static label %d command %d: %v", iLabel, iCmd, err)
+				}
+				scale = cmd.FontScale
+			}
+			if len(cmd.Glyphs) == 0 {
+				continue
+			}
+			if font == nil {
+				return fmt.Errorf("Static label %d command %d: glyphs without font", iLabel, iCmd)
+			}
+			if err := cb(iLabel, iCmd, cmd, iFont, font, scale); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *textCodec) decodeGlyphs(font *Font, glyphs []StaticLabelRenderCommandSingleGlyph) string {
+	chars := make(map[int16]uint8)
+	for i := len(font.CharNumberToSymbolIdMap) - 1; i >= 0; i-- {
+		if g := font.CharNumberToSymbolIdMap[i]; g != -1 {
+			chars[g] = uint8(i)
+		}
+	}
+	var s strings.Builder
+	for _, glyph := range glyphs {
+		if char, ok := chars[int16(glyph.GlyphId)]; ok && char != 0 {
+			s.WriteRune(c.decodeChar(char))
+		} else {
+			fmt.Fprintf(&s, "{glyph %d}", glyph.GlyphId)
+		}
+	}
+	return s.String()
+}
+
+// encodeGlyphs returns glyphs with widths from font symbol widths and list of chars missed in font
+func (c *textCodec) encodeGlyphs(font *Font, scale float64, text string) ([]StaticLabelRenderCommandSingleGlyph, []rune) {
+	glyphs := make([]StaticLabelRenderCommandSingleGlyph, 0, len(text))
+	missing := make([]rune, 0)
+	addGlyph := func(id int16) {
+		width := 0.0
+		if int(id) < len(font.SymbolWidths) {
+			width = float64(font.SymbolWidths[id]) * scale / 16.0
+		}
+		glyphs = append(glyphs, StaticLabelRenderCommandSingleGlyph{GlyphId: uint16(id), Width: width})
+	}
+
+	for len(text) != 0 {
+		if loc := localizationGlyphRe.FindStringSubmatchIndex(text); loc != nil && loc[0] == 0 {
+			id, err := strconv.ParseUint(text[loc[2]:loc[3]], 10, 16)
+			if err == nil && id < uint64(font.CharsCount) {
+				addGlyph(int16(id))
+				text = text[loc[1]:]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		char, ok := c.encodeChar(r)
+		if !ok || font.glyphOfChar(char) == -1 {
+			missing = append(missing, r)
+			continue
+		}
+		addGlyph(font.glyphOfChar(char))
+	}
+	return glyphs, missing
+}
+
+// LocalizationEntries returns visible texts of static labels and ps2 script strings
+func (f *FLP) LocalizationEntries(prefix string) ([]LocalizationEntry, error) {
+	c, err := newTextCodec()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LocalizationEntry, 0)
+	if err := f.walkLabelCommands(func(iLabel, iCmd int, cmd *StaticLabelRenderCommand, iFont int, font *Font, scale float64) error {
+		entries = append(entries, LocalizationEntry{
+			Id:      fmt.Sprintf("%s/static/%d/%d", prefix, iLabel, iCmd),
+			Comment: fmt.Sprintf("static label %d command %d font %d", iLabel, iCmd, iFont),
+			Text:    c.decodeGlyphs(font, cmd.Glyphs),
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for i, ref := range f.scriptPushRefs {
+		entries = append(entries, LocalizationEntry{
+			Id:      fmt.Sprintf("%s/script/%d", prefix, i),
+			Comment: fmt.Sprintf("script string %d", i),
+			Text:    c.decodeString(ref.String),
+		})
+	}
+	return entries, nil
+}
+
+// ApplyLocalization updates texts which ids starts with prefix.
+// Returns true if flp was changed
+func (f *FLP) ApplyLocalization(prefix string, translations map[string]LocalizationEntry, report *LocalizationReport) (bool, error) {
+	c, err := newTextCodec()
+	if err != nil {
+		return false, err
+	}
+	changed := false
+
+	reportMissing := func(id string, font int, missing []rune) bool {
+		for _, r := range missing {
+			report.Missing = append(report.Missing, LocalizationMissingChar{Id: id, Char: string(r), Font: font})
+		}
+		return len(missing) != 0
+	}
+	// returns new text if entry must be updated
+	lookup := func(id, current string) (string, bool) {
+		tr, ok := translations[id]
+		if !ok || tr.Translation == current {
+			return "", false
+		}
+		if tr.Text != current {
+			report.Skipped = append(report.Skipped, id)
+			return "", false
+		}
+		return tr.Translation, true
+	}
+
+	if err := f.walkLabelCommands(func(iLabel, iCmd int, cmd *StaticLabelRenderCommand, iFont int, font *Font, scale float64) error {
+		id := fmt.Sprintf("%s/static/%d/%d", prefix, iLabel, iCmd)
+		text, ok := lookup(id, c.decodeGlyphs(font, cmd.Glyphs))
+		if !ok {
+			return nil
+		}
+		glyphs, missing := c.encodeGlyphs(font, scale, text)
+		if reportMissing(id, iFont, missing) {
+			return nil
+		}
+		cmd.Glyphs = glyphs
+		report.Updated = append(report.Updated, id)
+		changed = true
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	iRef := 0
+	for _, s := range f.Scripts() {
+		changes := make(map[*ScriptOpcode]map[int][]byte)
+		refInOp := make(map[*ScriptOpcode]int)
+		for _, ref := range s.pushRefs {
+			id := fmt.Sprintf("%s/script/%d", prefix, iRef)
+			iRef++
+			iInOp := refInOp[ref.Opcode]
+			refInOp[ref.Opcode]++
+
+			text, ok := lookup(id, c.decodeString(ref.String))
+			if !ok {
+				continue
+			}
+			encoded := make([]byte, 0, len(text))
+			missing := make([]rune, 0)
+			for _, r := range text {
+				if b, ok := c.encodeChar(r); ok && b != 0 {
+					encoded = append(encoded, b)
+				} else {
+					missing = append(missing, r)
+				}
+			}
+			if reportMissing(id, -1, missing) {
+				continue
+			}
+			if changes[ref.Opcode] == nil {
+				changes[ref.Opcode] = make(map[int][]byte)
+			}
+			changes[ref.Opcode][iInOp] = encoded
+			report.Updated = append(report.Updated, id)
+		}
+		if len(changes) != 0 {
+			if err := s.replacePushStrings(changes); err != nil {
+				return false, fmt.Errorf("Script %d: %v", s.Id, err)
+			}
+			changed = true
+		}
+	}
+	if changed {
+		f.collectScriptPushRefs()
+	}
+	return changed, nil
+}
+
+// replacePushStrings changes non-empty strings of ps2 push opcodes by index
+// of string inside opcode. Script is reassembled, so jumps are relocated
+func (s *Script) replacePushStrings(changes map[*ScriptOpcode]map[int][]byte) error {
+	text := s.disassembleWith(func(op *ScriptOpcode) string {
+		opChanges, ok := changes[op]
+		if !ok {
+			return op.String
+		}
+		var data bytes.Buffer
+		iStr := 0
+		for pos := 0; pos < len(op.Data); {
+			if op.Data[pos] == 0 {
+				l := bytes.IndexByte(op.Data[pos+1:], 0)
+				if l < 0 {
+					l = len(op.Data) - pos - 1
+				}
+				str := op.Data[pos+1 : pos+1+l]
+				if l != 0 {
+					if newStr, ok := opChanges[iStr]; ok {
+						str = newStr
+					}
+					iStr++
+				}
+				data.WriteByte(0)
+				data.Write(str)
+				data.WriteByte(0)
+				pos += l + 2
+			} else {
+				end := pos + 5
+				if end > len(op.Data) {
+					end = len(op.Data)
+				}
+				data.Write(op.Data[pos:end])
+				pos = end
+			}
+		}
+		return fmt.Sprintf("raw opcode 0x%x data %x", op.Code, data.Bytes())
+	})
+	return s.Assemble(text)
+}
+
+func poQuote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// WritePO writes gettext catalogue with id as msgctxt and current text as msgid
+func WritePO(w io.Writer, entries []LocalizationEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "msgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	for _, e := range entries {
+		bw.WriteString("\n")
+		if e.Comment != "" {
+			fmt.Fprintf(bw, "#. %s\n", e.Comment)
+		}
+		fmt.Fprintf(bw, "msgctxt %s\nmsgid %s\nmsgstr \"\"\n", poQuote(e.Id), poQuote(e.Text))
+	}
+	return bw.Flush()
+}
+
+// ReadPO parses gettext catalogue produced by WritePO.
+// Result is keyed by msgctxt.
+// Untranslated and fuzzy entries are ignored
+func ReadPO(r io.Reader) (map[string]LocalizationEntry, error) {
+	result := make(map[string]LocalizationEntry)
+
+	var ctx, id, str *string
+	var target **string
+	fuzzy := false
+	flush := func() {
+		if ctx != nil && id != nil && str != nil && *str != "" && !fuzzy {
+			result[*ctx] = LocalizationEntry{Id: *ctx, Text: *id, Translation: *str}
+		}
+		ctx, id, str, target, fuzzy = nil, nil, nil, nil, false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 0x10000), 0x1000000)
+	for iLine := 1; scanner.Scan(); iLine++ {
+		line := strings.TrimSpace(scanner.Text())
+		if iLine == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				if str != nil {
+					flush()
+				}
+				fuzzy = true
+			}
+			continue
+		}
+
+		keyword := ""
+		if !strings.HasPrefix(line, `"`) {
+			if i := strings.IndexByte(line, ' '); i > 0 {
+				keyword, line = line[:i], strings.TrimSpace(line[i+1:])
+			}
+		}
+		value, err := strconv.Unquote(line)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: invalid string: %v", iLine, err)
+		}
+
+		switch keyword {
+		case "":
+			if target == nil || *target == nil {
+				return nil, fmt.Errorf("Line %d: unexpected string continuation", iLine)
+			}
+			**target += value
+			continue
+		case "msgctxt":
+			if str != nil {
+				flush()
+			}
+			target = &ctx
+		case "msgid":
+			if str != nil {
+				flush()
+			}
+			target = &id
+		case "msgstr":
+			target = &str
+		default:
+			return nil, fmt.Errorf("Line %d: unknown keyword '%s'", iLine, keyword)
+		}
+		*target = &value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return result, nil
+}
+
+// flp tags of wad, data is used directly because every tag
+// is parsed into new instance (cached instances are not modified)
+func wadFlpTags(w *wad.Wad) []*wad.Tag {
+	tags := make([]*wad.Tag, 0)
+	for i := range w.Tags {
+		t := &w.Tags[i]
+		if len(t.Data) >= HEADER_SIZE && binary.LittleEndian.Uint32(t.Data) == FLP_MAGIC {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func localizationPrefix(w *wad.Wad, t *wad.Tag) string {
+	return w.Name() + "/" + t.Name
+}
+
+// WadLocalizationEntries collects entries of every flp in wad
+func WadLocalizationEntries(w *wad.Wad) ([]LocalizationEntry, error) {
+	if config.GetGOWVersion() != config.GOW1 {
+		return nil, fmt.Errorf("Localization supported only for GOW1")
+	}
+	entries := make([]LocalizationEntry, 0)
+	for _, t := range wadFlpTags(w) {
+		f, err := NewFromData(t.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		flpEntries, err := f.LocalizationEntries(localizationPrefix(w, t))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		entries = append(entries, flpEntries...)
+	}
+	return entries, nil
+}
+
+// ApplyWadLocalization updates every flp of wad and saves wad once.
+// If save is false, only report is filled
+func ApplyWadLocalization(w *wad.Wad, translations map[string]LocalizationEntry, report *LocalizationReport, save bool) error {
+	if config.GetGOWVersion() != config.GOW1 {
+		return fmt.Errorf("Localization supported only for GOW1")
+	}
+	updates := make(map[wad.TagId][]byte)
+	for _, t := range wadFlpTags(w) {
+		prefix := localizationPrefix(w, t)
+		found := false
+		for id := range translations {
+			if strings.HasPrefix(id, prefix+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		f, err := NewFromData(t.Data)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", prefix, err))
+			continue
+		}
+		changed, err := f.ApplyLocalization(prefix, translations, report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", prefix, err))
+			continue
+		}
+		if changed {
+			updates[t.Id] = f.marshalBufferWithHeader().Bytes()
+		}
+	}
+	if !save || len(updates) == 0 {
+		return nil
+	}
+	return w.UpdateTagsData(updates)
+}
+
+func sortedLocalizationWads(translations map[string]LocalizationEntry) []string {
+	wads := make(map[string]bool)
+	for id := range translations {
+		if i := strings.IndexByte(id, '/'); i > 0 {
+			wads[id[:i]] = true
+		}
+	}
+	result := make([]string, 0, len(wads))
+	for name := range wads {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func readLocalizationUpload(r *http.Request) (map[string]LocalizationEntry, error) {
+	file, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadPO(file)
+}
+
+func init() {
+	wad.SetActionHandler("localization", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		entries, err := WadLocalizationEntries(w)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := WritePO(&buf, entries); err != nil {
+			return err
+		}
+		webutils.WriteFile(rw, &buf, w.Name()+".po")
+		return nil
+	})
+	wad.SetActionHandler("importlocalization", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		translations, err := readLocalizationUpload(r)
+		if err != nil {
+			return err
+		}
+		report := NewLocalizationReport()
+		if err := ApplyWadLocalization(w, translations, report, r.FormValue("check") == ""); err != nil {
+			return err
+		}
+		webutils.WriteJson(rw, report)
+		return nil
+	})
+	pack.SetActionHandler("localization", func(d vfs.Directory, rw http.ResponseWriter, r *http.Request) error {
+		files, err := d.List()
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		entries := make([]LocalizationEntry, 0)
+		for _, name := range files {
+			if strings.ToUpper(filepath.Ext(name)) != ".WAD" {
+				continue
+			}
+			inst, err := pack.GetInstanceHandler(d, name)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if w, ok := inst.(*wad.Wad); ok {
+				wadEntries, err := WadLocalizationEntries(w)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				entries = append(entries, wadEntries...)
+			}
+		}
+		var buf bytes.Buffer
+		if err := WritePO(&buf, entries); err != nil {
+			return err
+		}
+		webutils.WriteFile(rw, &buf, "localization.po")
+		return nil
+	})
+	pack.SetActionHandler("importlocalization", func(d vfs.Directory, rw http.ResponseWriter, r *http.Request) error {
+		translations, err := readLocalizationUpload(r)
+		if err != nil {
+			return err
+		}
+		report := NewLocalizationReport()
+		for _, name := range sortedLocalizationWads(translations) {
+			inst, err := pack.GetInstanceHandler(d, name)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			w, ok := inst.(*wad.Wad)
+			if !ok {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: not a wad", name))
+				continue
+			}
+			if err := ApplyWadLocalization(w, translations, report, r.FormValue("check") == ""); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+		webutils.WriteJson(rw, report)
+		return nil
+	})
+}
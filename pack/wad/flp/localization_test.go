@@ -0,0 +1,246 @@
+package flp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+func TestWritePOReadPO(t *testing.T) {
+	entries := []LocalizationEntry{
+		{Id: "R_MENU/FLP_menu/static/0/1", Comment: "font 0", Text: "New \"game\"\n\tstart"},
+		{Id: "R_MENU/FLP_menu/script/2", Text: "back\\slash é"},
+	}
+	var buf bytes.Buffer
+	if err := WritePO(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	po := buf.String()
+	if !strings.Contains(po, `msgid "New \"game\"\n\tstart"`) || !strings.Contains(po, "#. font 0\n") {
+		t.Fatalf("Unexpected catalogue:\n%s", po)
+	}
+
+	// untranslated catalogue gives nothing
+	if result, err := ReadPO(strings.NewReader(po)); err != nil || len(result) != 0 {
+		t.Fatalf("Untranslated entries read: %v %v", result, err)
+	}
+
+	// translator fills entries, second translation is split into continuation lines
+	po = strings.NewReplacer(
+		"msgid \"New \\\"game\\\"\\n\\tstart\"\nmsgstr \"\"",
+		"msgid \"New \\\"game\\\"\\n\\tstart\"\nmsgstr \"Nouvelle \\\"partie\\\"\\n\\tcommencer\"",
+		"msgid \"back\\\\slash é\"\nmsgstr \"\"",
+		"msgid \"back\\\\slash é\"\nmsgstr \"\"\n\"retour \"\n\"arrière\"",
+	).Replace(po)
+	result, err := ReadPO(strings.NewReader("\ufeff" + po))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]LocalizationEntry{
+		entries[0].Id: {Id: entries[0].Id, Text: entries[0].Text, Translation: "Nouvelle \"partie\"\n\tcommencer"},
+		entries[1].Id: {Id: entries[1].Id, Text: entries[1].Text, Translation: "retour arrière"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got %+v\nexpected %+v", result, expected)
+	}
+}
+
+func TestReadPOContinuationAndFuzzy(t *testing.T) {
+	po := `msgid ""
+msgstr ""
+"Content-Type: text/plain; charset=UTF-8\n"
+
+#. comment
+msgctxt "a"
+msgid ""
+"multi "
+"line"
+msgstr "first "
+"second"
+
+#, fuzzy
+msgctxt "b"
+msgid "fuzzy"
+msgstr "ignored"
+
+msgctxt "c"
+msgid "after fuzzy"
+msgstr "kept"
+
+#, c-format, fuzzy
+msgctxt "d"
+msgid "fuzzy again"
+msgstr "ignored"
+msgctxt "e"
+msgid "no blank line"
+msgstr "kept too"
+`
+	result, err := ReadPO(strings.NewReader(po))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]LocalizationEntry{
+		"a": {Id: "a", Text: "multi line", Translation: "first second"},
+		"c": {Id: "c", Text: "after fuzzy", Translation: "kept"},
+		"e": {Id: "e", Text: "no blank line", Translation: "kept too"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got %+v\nexpected %+v", result, expected)
+	}
+
+	for _, bad := range []string{
+		"\"orphan continuation\"\n",
+		"msgfoo \"unknown keyword\"\n",
+		"msgid \"not closed\n",
+	} {
+		if _, err := ReadPO(strings.NewReader(bad)); err == nil {
+			t.Errorf("No error for %q", bad)
+		}
+	}
+}
+
+func TestEncodeGlyphs(t *testing.T) {
+	c := &textCodec{
+		aliases: config.FontCharToAsciiByteAssoc{'é': 0x82},
+		reverse: map[uint8]rune{0x82: 'é'},
+	}
+	font := &Font{
+		CharsCount:              4,
+		Flags:                   1,
+		SymbolWidths:            []int16{16, 32, 48, 8},
+		CharNumberToSymbolIdMap: make([]int16, 0x100),
+	}
+	for i := range font.CharNumberToSymbolIdMap {
+		font.CharNumberToSymbolIdMap[i] = -1
+	}
+	font.CharNumberToSymbolIdMap['A'] = 0
+	font.CharNumberToSymbolIdMap['B'] = 1
+	font.CharNumberToSymbolIdMap[0x82] = 2
+
+	glyphs, missing := c.encodeGlyphs(font, 2, "ABé{glyph 3}Жx")
+	expected := []StaticLabelRenderCommandSingleGlyph{{0, 2}, {1, 4}, {2, 6}, {3, 1}}
+	if !reflect.DeepEqual(glyphs, expected) {
+		t.Errorf("Got glyphs %v, expected %v", glyphs, expected)
+	}
+	if string(missing) != "Жx" {
+		t.Errorf("Got missing %q", string(missing))
+	}
+	if text := c.decodeGlyphs(font, glyphs); text != "ABé{glyph 3}" {
+		t.Errorf("Decoded '%s'", text)
+	}
+
+	// glyph out of font is not a glyph reference
+	glyphs, missing = c.encodeGlyphs(font, 1, "{glyph 4}")
+	if len(glyphs) != 0 || string(missing) != "{glyph 4}" {
+		t.Errorf("Got glyphs %v, missing %q", glyphs, string(missing))
+	}
+}
+
+// testLabelFlp returns flp with font of chars 'H', 'i', '!' and static label "Hi" drawn by root timeline
+func testLabelFlp() *FLP {
+	font := Font{
+		CharsCount:              3,
+		Flags:                   1,
+		SymbolWidths:            []int16{320, 320, 320},
+		CharNumberToSymbolIdMap: make([]int16, 0x100),
+		MeshesRefs:              []MeshPartReference{{MeshPartIndex: 0}, {MeshPartIndex: 0}, {MeshPartIndex: 0}},
+	}
+	for i := range font.CharNumberToSymbolIdMap {
+		font.CharNumberToSymbolIdMap[i] = -1
+	}
+	font.CharNumberToSymbolIdMap['H'] = 0
+	font.CharNumberToSymbolIdMap['i'] = 1
+	font.CharNumberToSymbolIdMap['!'] = 2
+
+	return &FLP{
+		GlobalHandlersIndexes: []GlobalHandlerIndex{
+			{TypeArrayId: 3, IdInThatTypeArray: 0},
+			{TypeArrayId: 4, IdInThatTypeArray: 0},
+		},
+		Fonts: []Font{font},
+		StaticLabels: []StaticLabel{{
+			Transformation: Transformation{Matrix: [4]float64{1, 0, 0, 1}, OffsetX: 100, OffsetY: 100},
+			RenderCommandsList: []*StaticLabelRenderCommand{{
+				Flags:       8,
+				FontHandler: 0,
+				FontScale:   1,
+				Glyphs:      []StaticLabelRenderCommandSingleGlyph{{GlyphId: 0, Width: 20}, {GlyphId: 1, Width: 20}},
+			}},
+		}},
+		Data8: Data6Subtype1{
+			TotalFramesCount:  1,
+			ElementsAnimation: []ElementAnimation{{FramesCount: 1, KeyFrames: []KeyFrame{{WhenThisFrameEnds: 1, ElementHandler: 1}}}},
+		},
+	}
+}
+
+// useFontAliases runs test in directory with font_aliases.cfg, it is loaded from working directory
+func useFontAliases(t *testing.T, aliases string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "font_aliases.cfg"), []byte(aliases), 0666); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLocalizationStaticLabels(t *testing.T) {
+	useFontAliases(t, "{}")
+	f := testLabelFlp()
+	const id = "R_TEST/FLP_test/static/0/0"
+
+	entries, err := f.LocalizationEntries("R_TEST/FLP_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Id != id || entries[0].Text != "Hi" {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+
+	report := NewLocalizationReport()
+	changed, err := f.ApplyLocalization("R_TEST/FLP_test", map[string]LocalizationEntry{
+		id:                            {Id: id, Text: "Hi", Translation: "iH!"},
+		"R_TEST/FLP_test/static/0/1":  {Text: "x", Translation: "y"},
+		"R_TEST/FLP_other/static/0/0": {Text: "Hi", Translation: "H"},
+	}, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !reflect.DeepEqual(report.Updated, []string{id}) {
+		t.Fatalf("Changed %v, report %+v", changed, report)
+	}
+	expected := []StaticLabelRenderCommandSingleGlyph{{1, 20}, {0, 20}, {2, 20}}
+	if glyphs := f.StaticLabels[0].RenderCommandsList[0].Glyphs; !reflect.DeepEqual(glyphs, expected) {
+		t.Errorf("Got glyphs %v, expected %v", glyphs, expected)
+	}
+
+	// source text changed and chars missed in font are reported, label is kept
+	report = NewLocalizationReport()
+	changed, err = f.ApplyLocalization("R_TEST/FLP_test", map[string]LocalizationEntry{
+		id: {Id: id, Text: "Hi", Translation: "H"},
+	}, report)
+	if err != nil || changed || !reflect.DeepEqual(report.Skipped, []string{id}) {
+		t.Errorf("Stale translation: %v %v %+v", changed, err, report)
+	}
+	report = NewLocalizationReport()
+	changed, err = f.ApplyLocalization("R_TEST/FLP_test", map[string]LocalizationEntry{
+		id: {Id: id, Text: "iH!", Translation: "Hoi"},
+	}, report)
+	if err != nil || changed || len(report.Missing) != 1 || report.Missing[0].Char != "o" || report.Missing[0].Font != 0 {
+		t.Errorf("Missing char: %v %v %+v", changed, err, report)
+	}
+	if glyphs := f.StaticLabels[0].RenderCommandsList[0].Glyphs; !reflect.DeepEqual(glyphs, expected) {
+		t.Errorf("Glyphs changed: %v", glyphs)
+	}
+}
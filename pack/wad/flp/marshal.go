@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math"
+	"sort"
 
 	"github.com/mogaika/god_of_war_browser/utils"
 )
@@ -45,7 +46,15 @@ func (fm *FlpMarshaler) compileStringAndReturnFile() *bytes.Buffer {
 	var stringSection bytes.Buffer
 	stringSection.WriteByte(0) // empty string at start
 
-	for k, v := range map[string][]StringPosReplacerReference(fm.sbuffer) {
+	// sorted, so same flp always produces same bytes
+	keys := make([]string, 0, len(fm.sbuffer))
+	for k := range fm.sbuffer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := fm.sbuffer[k]
 		var offbuf [4]byte
 		off := stringSection.Len()
 
@@ -340,8 +340,6 @@ func (f *FLP) fromBuffer(buf []byte) error {
 		pos += f.DynamicLabels[i].FromBuf(buf[pos:])
 	}
 
-	enterScriptPushRefFiller()
-
 	for i := range f.Datas6 {
 		pos += f.Datas6[i].FromBuf(buf[pos:])
 	}
@@ -361,8 +359,6 @@ func (f *FLP) fromBuffer(buf []byte) error {
 	pos += f.Data8.FromBuf(buf[pos:])
 	pos = f.Data8.Parse(buf, pos)
 
-	f.scriptPushRefs = exitScriptPushRefFiller()
-
 	pos = posPad4(pos)
 	for i := range f.Transformations {
 		pos += f.Transformations[i].FromBuf(buf[pos:])
@@ -384,6 +380,11 @@ func (f *FLP) fromBuffer(buf []byte) error {
 
 	f.SetNameFromStringSector(buf[stringsSectorStart:])
 
+	for i, s := range f.Scripts() {
+		s.Id = i
+	}
+	f.collectScriptPushRefs()
+
 	return nil
 }
 
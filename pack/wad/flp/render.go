@@ -0,0 +1,446 @@
+package flp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mesh "github.com/mogaika/god_of_war_browser/pack/wad/mesh"
+	file_txr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+)
+
+const (
+	// ps2 ntsc frame buffer
+	RenderWidth  = 640
+	RenderHeight = 448
+
+	renderMaxDepth     = 32
+	renderMaxSheetSize = 8192 * 8192
+	renderMaxDimension = 8192 // of single frame, columns and rows
+	renderMaxFrames    = 1024
+)
+
+type RenderOptions struct {
+	Frames  []int
+	Width   int
+	Height  int
+	OriginX float64 // position of flp (0, 0) on the frame
+	OriginY float64
+	Columns int // contact sheet columns, 0 - auto
+}
+
+// 2d affine matrix a, b, c, d, tx, ty: x' = a*x + c*y + tx, y' = b*x + d*y + ty
+type renderMatrix [6]float64
+
+var renderIdentity = renderMatrix{1, 0, 0, 1, 0, 0}
+
+func (t *Transformation) renderMatrix() renderMatrix {
+	return renderMatrix{t.Matrix[0], t.Matrix[1], t.Matrix[2], t.Matrix[3], t.OffsetX, t.OffsetY}
+}
+
+// mul returns matrix which applies n first and then m
+func (m renderMatrix) mul(n renderMatrix) renderMatrix {
+	return renderMatrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m renderMatrix) translate(x, y float64) renderMatrix {
+	return m.mul(renderMatrix{1, 0, 0, 1, x, y})
+}
+
+func (m renderMatrix) scale(s float64) renderMatrix {
+	return m.mul(renderMatrix{s, 0, 0, s, 0, 0})
+}
+
+func (m renderMatrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+type renderColor [4]float64
+
+var renderWhite = renderColor{1, 1, 1, 1}
+
+func (c renderColor) mul(o renderColor) renderColor {
+	return renderColor{c[0] * o[0], c[1] * o[1], c[2] * o[2], c[3] * o[3]}
+}
+
+type renderVertex struct {
+	x, y  float64
+	u, v  float64
+	color renderColor
+}
+
+type renderer struct {
+	f        *FLP
+	wrsrc    *wad.WadNodeRsrc
+	mesh     *file_mesh.Mesh
+	textures map[string]*image.NRGBA
+	target   *image.NRGBA
+	clip     image.Rectangle
+}
+
+// ParseRenderFrames parses list like "0,5,10-20,30-90:10"
+func ParseRenderFrames(s string) ([]int, error) {
+	frames := make([]int, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		step := 1
+		if i := strings.IndexByte(item, ':'); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("Invalid step in '%s'", item)
+			}
+			item = item[:i]
+		}
+		from, to := item, item
+		if i := strings.IndexByte(item, '-'); i != -1 {
+			from, to = item[:i], item[i+1:]
+		}
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("Invalid frame '%s'", from)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("Invalid frame '%s'", to)
+		}
+		if count := (end-start)/step + 1; count > renderMaxFrames-len(frames) {
+			return nil, fmt.Errorf("Too many frames, limit is %d", renderMaxFrames)
+		}
+		for frame := start; frame <= end; frame += step {
+			frames = append(frames, frame)
+		}
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("No frames provided")
+	}
+	return frames, nil
+}
+
+// RenderFrames draws root timeline (Data8) at provided frames.
+// Multiple frames are placed on contact sheet row by row.
+// Scripts are not executed, so frames changed by scripts probably look different in game
+func (f *FLP) RenderFrames(wrsrc *wad.WadNodeRsrc, opts *RenderOptions) (*image.NRGBA, error) {
+	width, height := opts.Width, opts.Height
+	if width <= 0 {
+		width = RenderWidth
+	}
+	if height <= 0 {
+		height = RenderHeight
+	}
+	frames := opts.Frames
+	if len(frames) == 0 {
+		frames = []int{0}
+	}
+	if len(frames) > renderMaxFrames {
+		return nil, fmt.Errorf("Too many frames, limit is %d", renderMaxFrames)
+	}
+	columns := opts.Columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(frames)))))
+	}
+	if columns > len(frames) {
+		columns = len(frames)
+	}
+	rows := (len(frames) + columns - 1) / columns
+	// check every value before multiplication, so product cannot overflow
+	for _, v := range []struct {
+		Name  string
+		Value int
+	}{{"width", width}, {"height", height}, {"columns", columns}, {"rows", rows}} {
+		if v.Value <= 0 || v.Value > renderMaxDimension {
+			return nil, fmt.Errorf("Invalid %s %d, must be in range 1..%d", v.Name, v.Value, renderMaxDimension)
+		}
+	}
+	if width*columns*height*rows > renderMaxSheetSize {
+		return nil, fmt.Errorf("Image %dx%d is too big", width*columns, height*rows)
+	}
+
+	mesh, _, err := getMeshForFlp(wrsrc)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find mesh for flp: %v", err)
+	}
+
+	r := &renderer{
+		f:        f,
+		wrsrc:    wrsrc,
+		mesh:     mesh,
+		textures: make(map[string]*image.NRGBA),
+		target:   image.NewNRGBA(image.Rect(0, 0, width*columns, height*rows)),
+	}
+	draw.Draw(r.target, r.target.Bounds(), image.NewUniform(color.NRGBA{A: 0xff}), image.Point{}, draw.Src)
+
+	for i, frame := range frames {
+		r.clip = image.Rect(0, 0, width, height).Add(image.Pt((i%columns)*width, (i/columns)*height))
+		root := renderIdentity.translate(float64(r.clip.Min.X)+opts.OriginX, float64(r.clip.Min.Y)+opts.OriginY)
+		r.drawSprite(&f.Data8, frame, root, renderWhite, 0)
+	}
+	return r.target, nil
+}
+
+// RenderPng is RenderFrames encoded to png
+func (f *FLP) RenderPng(wrsrc *wad.WadNodeRsrc, opts *RenderOptions) ([]byte, error) {
+	img, err := f.RenderFrames(wrsrc, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("Cannot encode png: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *renderer) drawSprite(s *Data6Subtype1, frame int, m renderMatrix, c renderColor, depth int) {
+	if depth > renderMaxDepth {
+		return
+	}
+	if s.TotalFramesCount != 0 {
+		frame %= int(s.TotalFramesCount)
+	}
+	for iEa := range s.ElementsAnimation {
+		start, runStart := 0, 0
+		keyFrames := s.ElementsAnimation[iEa].KeyFrames
+		for i := range keyFrames {
+			kf := &keyFrames[i]
+			// nested sprite keeps playing while consecutive keyframes reference it
+			if i == 0 || keyFrames[i-1].ElementHandler != kf.ElementHandler {
+				runStart = start
+			}
+			if frame < int(kf.WhenThisFrameEnds) {
+				r.drawKeyFrame(kf, frame-runStart, m, c, depth)
+				break
+			}
+			start = int(kf.WhenThisFrameEnds)
+		}
+	}
+}
+
+func (r *renderer) drawKeyFrame(kf *KeyFrame, frame int, m renderMatrix, c renderColor, depth int) {
+	f := r.f
+	if int(kf.TransformationId) < len(f.Transformations) {
+		m = m.mul(f.Transformations[kf.TransformationId].renderMatrix())
+	}
+	if int(kf.ColorId) < len(f.BlendColors) {
+		bc := f.BlendColors[kf.ColorId].Color
+		c = c.mul(renderColor{float64(bc[0]) / 256, float64(bc[1]) / 256, float64(bc[2]) / 256, float64(bc[3]) / 256})
+	}
+	if int(kf.ElementHandler) >= len(f.GlobalHandlersIndexes) {
+		return
+	}
+
+	gh := f.GlobalHandlersIndexes[kf.ElementHandler]
+	id := int(gh.IdInThatTypeArray)
+	switch gh.TypeArrayId {
+	case 1:
+		if id < len(f.MeshPartReferences) {
+			r.drawMeshPartReference(&f.MeshPartReferences[id], m, c)
+		}
+	case 4:
+		if id < len(f.StaticLabels) {
+			r.drawStaticLabel(&f.StaticLabels[id], m, c)
+		}
+	case 6:
+		if id < len(f.Datas6) {
+			r.drawSprite(&f.Datas6[id].Sub1, frame, m, c, depth+1)
+		}
+	case 7:
+		if id < len(f.Datas7) {
+			r.drawSprite(&f.Datas7[id], frame, m, c, depth+1)
+		}
+	}
+	// dynamic labels values are set by game code, root node cannot be child
+}
+
+func (r *renderer) drawStaticLabel(sl *StaticLabel, m renderMatrix, c renderColor) {
+	m = m.mul(sl.Transformation.renderMatrix())
+	var font *Font
+	x, y, scale := 0.0, 0.0, 1.0
+	cmdColor := renderWhite
+	for _, cmd := range sl.RenderCommandsList {
+		if cmd.Flags&8 != 0 {
+			var err error
+			if _, font, err = r.f.fontByHandler(cmd.FontHandler); err != nil {
+				log.Printf("Cannot render label of %s: %v", r.wrsrc.Name(), err)
+				return
+			}
+			scale = cmd.FontScale
+		}
+		if cmd.Flags&4 != 0 {
+			for i := range cmdColor {
+				cmdColor[i] = float64(cmd.BlendColor[i]) / 128
+			}
+		}
+		if cmd.Flags&2 != 0 {
+			x = cmd.OffsetX
+		}
+		if cmd.Flags&1 != 0 {
+			y = cmd.OffsetY
+		}
+		for _, glyph := range cmd.Glyphs {
+			if font != nil && int(glyph.GlyphId) < len(font.MeshesRefs) {
+				r.drawMeshPartReference(&font.MeshesRefs[glyph.GlyphId], m.translate(x, y).scale(scale), c.mul(cmdColor))
+			}
+			x += glyph.Width
+		}
+	}
+}
+
+func (r *renderer) drawMeshPartReference(ref *MeshPartReference, m renderMatrix, c renderColor) {
+	if ref.MeshPartIndex < 0 || int(ref.MeshPartIndex) >= len(r.mesh.Parts) {
+		return
+	}
+	for _, group := range r.mesh.Parts[ref.MeshPartIndex].Groups {
+		for iObject := range group.Objects {
+			object := &group.Objects[iObject]
+			var texture *image.NRGBA
+			if iObject < len(ref.Materials) {
+				texture = r.texture(ref.Materials[iObject].TextureName)
+			} else if len(ref.Materials) != 0 {
+				texture = r.texture(ref.Materials[0].TextureName)
+			}
+			for _, packets := range object.Packets {
+				for iPacket := range packets {
+					r.drawPacket(&packets[iPacket], texture, m, c)
+				}
+			}
+		}
+	}
+}
+
+func (r *renderer) drawPacket(p *file_mesh.Packet, texture *image.NRGBA, m renderMatrix, c renderColor) {
+	vertices := make([]renderVertex, len(p.Trias.X))
+	for i := range vertices {
+		v := &vertices[i]
+		v.x, v.y = m.apply(float64(p.Trias.X[i]), float64(p.Trias.Y[i]))
+		if i < len(p.Uvs.U) {
+			v.u, v.v = float64(p.Uvs.U[i]), float64(p.Uvs.V[i])
+		}
+		v.color = c
+		if i < len(p.Blend.R) {
+			v.color = c.mul(renderColor{
+				float64(p.Blend.R[i]) / 128, float64(p.Blend.G[i]) / 128,
+				float64(p.Blend.B[i]) / 128, float64(p.Blend.A[i]) / 128,
+			})
+		}
+	}
+	for i := 2; i < len(vertices); i++ {
+		if !p.Trias.Skip[i] {
+			r.drawTriangle(&vertices[i-2], &vertices[i-1], &vertices[i], texture)
+		}
+	}
+}
+
+// drawTriangle fills triangle with nearest texture sampling and alpha blending
+func (r *renderer) drawTriangle(v0, v1, v2 *renderVertex, texture *image.NRGBA) {
+	area := (v1.x-v0.x)*(v2.y-v0.y) - (v1.y-v0.y)*(v2.x-v0.x)
+	if area == 0 {
+		return
+	}
+	bounds := image.Rect(
+		int(math.Floor(math.Min(v0.x, math.Min(v1.x, v2.x)))),
+		int(math.Floor(math.Min(v0.y, math.Min(v1.y, v2.y)))),
+		int(math.Ceil(math.Max(v0.x, math.Max(v1.x, v2.x))))+1,
+		int(math.Ceil(math.Max(v0.y, math.Max(v1.y, v2.y))))+1,
+	).Intersect(r.clip)
+
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			x, y := float64(px)+0.5, float64(py)+0.5
+			w0 := ((v1.x-x)*(v2.y-y) - (v1.y-y)*(v2.x-x)) / area
+			w1 := ((v2.x-x)*(v0.y-y) - (v2.y-y)*(v0.x-x)) / area
+			w2 := 1 - w0 - w1
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+			var clr renderColor
+			for i := range clr {
+				clr[i] = w0*v0.color[i] + w1*v1.color[i] + w2*v2.color[i]
+			}
+			if texture != nil {
+				clr = clr.mul(sampleTexture(texture, w0*v0.u+w1*v1.u+w2*v2.u, w0*v0.v+w1*v1.v+w2*v2.v))
+			}
+			r.blend(px, py, clr)
+		}
+	}
+}
+
+func sampleTexture(img *image.NRGBA, u, v float64) renderColor {
+	size := img.Rect.Size()
+	x := int(math.Max(0, math.Min(u*float64(size.X), float64(size.X-1))))
+	y := int(math.Max(0, math.Min(v*float64(size.Y), float64(size.Y-1))))
+	pix := img.Pix[img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y):]
+	return renderColor{float64(pix[0]) / 255, float64(pix[1]) / 255, float64(pix[2]) / 255, float64(pix[3]) / 255}
+}
+
+func (r *renderer) blend(x, y int, c renderColor) {
+	a := math.Max(0, math.Min(c[3], 1))
+	pix := r.target.Pix[r.target.PixOffset(x, y):]
+	for i := 0; i < 3; i++ {
+		src := math.Max(0, math.Min(c[i], 1)) * 255
+		pix[i] = uint8(src*a + float64(pix[i])*(1-a) + 0.5)
+	}
+}
+
+// texture returns first image of texture or nil if texture cannot be loaded
+func (r *renderer) texture(name string) *image.NRGBA {
+	if name == "" {
+		return nil
+	}
+	if img, ok := r.textures[name]; ok {
+		return img
+	}
+	img, err := r.loadTexture(name)
+	if err != nil {
+		log.Printf("Cannot load texture %s for %s: %v", name, r.wrsrc.Name(), err)
+	}
+	r.textures[name] = img
+	return img
+}
+
+func (r *renderer) loadTexture(name string) (*image.NRGBA, error) {
+	node := r.wrsrc.Wad.GetNodeByName(name, r.wrsrc.Node.Id, false)
+	if node == nil {
+		return nil, fmt.Errorf("Cannot find node")
+	}
+	inst, _, err := r.wrsrc.Wad.GetInstanceFromNode(node.Id)
+	if err != nil {
+		return nil, err
+	}
+	txr, ok := inst.(*file_txr.Texture)
+	if !ok {
+		return nil, fmt.Errorf("Node is not a texture")
+	}
+	marshaled, err := txr.Marshal(r.wrsrc.Wad.GetNodeResourceByNodeId(node.Id))
+	if err != nil {
+		return nil, err
+	}
+	ajax := marshaled.(*file_txr.Ajax)
+	if len(ajax.Images) == 0 {
+		return nil, fmt.Errorf("Texture has no images")
+	}
+	decoded, err := png.Decode(bytes.NewReader(ajax.Images[0].Image))
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(decoded.Bounds())
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	return img, nil
+}
@@ -0,0 +1,73 @@
+package flp
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	file_mesh "github.com/mogaika/god_of_war_browser/pack/wad/mesh"
+)
+
+func TestParseRenderFrames(t *testing.T) {
+	frames, err := ParseRenderFrames("0,5,10-12,30-50:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{0, 5, 10, 11, 12, 30, 40, 50}; !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Got %v, expected %v", frames, expected)
+	}
+
+	for _, s := range []string{"", "5-1", "-1", "0-10:0", "0-2000000000", "0-1000,0-1000"} {
+		if _, err := ParseRenderFrames(s); err == nil {
+			t.Errorf("Expected error for '%s'", s)
+		}
+	}
+}
+
+func TestRenderFramesLimits(t *testing.T) {
+	f := &FLP{}
+	for _, opts := range []*RenderOptions{
+		{Width: 1 << 40, Height: 1 << 40},
+		{Width: 8192, Height: 8192, Frames: []int{0, 1}},
+		{Frames: make([]int, renderMaxFrames+1)},
+	} {
+		if _, err := f.RenderFrames(nil, opts); err == nil {
+			t.Errorf("Expected error for %dx%d with %d frames", opts.Width, opts.Height, len(opts.Frames))
+		}
+	}
+}
+
+// testGlyphMesh returns mesh with single part of 10x10 quad
+func testGlyphMesh() *file_mesh.Mesh {
+	var p file_mesh.Packet
+	p.Trias.X = []float32{0, 10, 0, 10}
+	p.Trias.Y = []float32{0, 0, 10, 10}
+	p.Trias.Z = make([]float32, 4)
+	p.Trias.Skip = []bool{true, true, false, false}
+	return &file_mesh.Mesh{Parts: []file_mesh.Part{{
+		Groups: []file_mesh.Group{{Objects: []file_mesh.Object{{Packets: [][]file_mesh.Packet{{p}}}}}},
+	}}}
+}
+
+func TestRenderStaticLabel(t *testing.T) {
+	f := testLabelFlp()
+	r := &renderer{
+		f:        f,
+		mesh:     testGlyphMesh(),
+		textures: make(map[string]*image.NRGBA),
+		target:   image.NewNRGBA(image.Rect(0, 0, 200, 200)),
+	}
+	r.clip = r.target.Bounds()
+	r.drawSprite(&f.Data8, 0, renderIdentity, renderWhite, 0)
+
+	// glyphs are placed at label offset one after another by glyph width
+	for _, pt := range []struct {
+		X, Y  int
+		Glyph bool
+	}{{105, 105, true}, {125, 105, true}, {115, 105, false}, {95, 105, false}, {105, 115, false}} {
+		pix := r.target.Pix[r.target.PixOffset(pt.X, pt.Y):]
+		if drawn := pix[0] == 0xff && pix[1] == 0xff && pix[2] == 0xff; drawn != pt.Glyph {
+			t.Errorf("Pixel %d,%d: %v, expected glyph %v", pt.X, pt.Y, pix[:4], pt.Glyph)
+		}
+	}
+}
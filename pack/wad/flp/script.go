@@ -7,22 +7,19 @@ import (
 	"log"
 	"math"
 	"strings"
-	"sync"
 
 	"github.com/mogaika/god_of_war_browser/config"
-
-	"github.com/Pallinder/go-randomdata"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
-var scriptPushRefFiller []ScriptOpcodeStringPushReference
-var scriptPushRefLocker sync.Mutex
-
 type Script struct {
+	Id              int             // index in FLP.Scripts()
 	Opcodes         []*ScriptOpcode `json:"-"`
 	Decompiled      string
 	labels          map[int16]string
 	marshaled       []byte
+	original        []byte
+	pushRefs        []ScriptOpcodeStringPushReference
 	staticStringRef map[string][]uint16 // string ot offset
 }
 
@@ -38,9 +35,58 @@ type ScriptOpcodeStringPushReference struct {
 	String []byte
 }
 
+// opcodes without parameters
+var scriptSimpleOpcodes = map[byte]string{
+	0:    "end",
+	6:    "Play",
+	7:    "Stop",
+	0xa:  "@push_float = @pop_float2 + @pop_float1",
+	0xb:  "@push_float = @pop_float2 - @pop_float1",
+	0xc:  "@push_float = @pop_float2 * @pop_float1",
+	0xd:  "@push_float = @pop_float2 / @pop_float1",
+	0xe:  "@push_bool = @pop_float1 == close to == @pop_float2",
+	0xf:  "@push_bool = @pop_float2 < @pop_float1",
+	0x10: "@push_bool = @pop_bool1 AND @pop_bool2",
+	0x11: "@push_bool = @pop_bool1 OR @pop_bool2",
+	0x12: "@push_bool = convert_to_bool @pop_any",
+	0x13: "@push_bool = strcmp(@pop_string2, @pop_string1) <= 0",
+	0x17: "@pop_any to nothing",
+	0x18: "@push_float = round @pop_float",
+	0x1c: "@push_any vfs get @pop_string1",
+	0x1d: "vfs set @pop_string2 = @pop_string1",
+	0x20: "SetTarget @pop_string1",
+	0x21: "@push_string = @pop_string2 append to @pop_string1",
+	0x34: "@push_float current timer value",
+}
+
+func scriptLabelName(offset int16) string {
+	return fmt.Sprintf("label_%.4x", uint16(offset))
+}
+
+// scriptQuote escapes quote, backslash and non printable bytes, so string can be assembled back
+func scriptQuote(b []byte) string {
+	var out bytes.Buffer
+	out.WriteByte('\'')
+	for _, c := range b {
+		switch {
+		case c == '\'' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "\\x%.2x", c)
+		}
+	}
+	out.WriteByte('\'')
+	return out.String()
+}
+
 func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 	s.Opcodes = make([]*ScriptOpcode, 0)
 	s.labels = make(map[int16]string)
+	s.pushRefs = make([]ScriptOpcodeStringPushReference, 0)
+	vita := config.GetPlayStationVersion() == config.PSVita
 
 	originalBufLen := len(buf)
 	for len(buf) != 0 {
@@ -52,16 +98,8 @@ func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 
 		jmpOffsetToStr := func(jmpoff uint16, opoff int16) string {
 			targetOffset := int16(op.Offset + int16(jmpoff) + opoff)
-
-			var targetLabel string
-			if lbl, ok := s.labels[targetOffset]; !ok {
-				targetLabel = strings.ToLower(randomdata.SillyName())
-				s.labels[targetOffset] = targetLabel
-			} else {
-				targetLabel = lbl
-			}
-
-			return fmt.Sprintf("$%s(%+x=%.4x)", targetLabel, int16(jmpoff), targetOffset)
+			s.labels[targetOffset] = scriptLabelName(targetOffset)
+			return fmt.Sprintf("$%s(%+x=%.4x)", s.labels[targetOffset], int16(jmpoff), targetOffset)
 		}
 
 		strFromOffset := func(dataoff uint16) string {
@@ -75,7 +113,7 @@ func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 				s.staticStringRef[str] = make([]uint16, 0)
 			}
 			s.staticStringRef[str] = append(s.staticStringRef[str], uint16(op.Offset)+1+dataoff)
-			return str
+			return scriptQuote([]byte(str))
 		}
 
 		var stringRepr string = fmt.Sprintf("unknown opcode 0x%x", op.Code)
@@ -88,56 +126,58 @@ func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 				opLen := binary.LittleEndian.Uint16(buf)
 				buf = buf[2:]
 				op.Data = buf[:opLen]
+				data := op.Data
 
 				switch op.Code {
 				case 0x81:
-					stringRepr = fmt.Sprintf("GotoFrame %d", binary.LittleEndian.Uint16(buf))
+					stringRepr = fmt.Sprintf("GotoFrame %d", binary.LittleEndian.Uint16(data))
 				case 0x83:
-					stringRepr = fmt.Sprintf("Fs queue '%s' command '%s', or response result",
-						utils.BytesToString(buf), utils.BytesToString(buf[1+utils.BytesStringLength(buf):]))
+					l := utils.BytesStringLength(data)
+					command := data[l:]
+					if len(command) != 0 {
+						command = command[1:]
+					}
+					stringRepr = fmt.Sprintf("Fs queue %s command %s, or response result",
+						scriptQuote(data[:l]), scriptQuote(command[:utils.BytesStringLength(command)]))
 				case 0x8b:
-					stringRepr = fmt.Sprintf("SetTarget '%s'", utils.BytesToString(buf))
+					stringRepr = fmt.Sprintf("SetTarget %s", scriptQuote(data[:utils.BytesStringLength(data)]))
 				case 0x8c:
-					stringRepr = fmt.Sprintf("GotoLabel '%s'", utils.BytesToString(buf))
+					stringRepr = fmt.Sprintf("GotoLabel %s", scriptQuote(data[:utils.BytesStringLength(data)]))
 				case 0x96:
 					pos := uint16(0)
+					stringRepr = "@push"
 					for pos < opLen {
-						stringRepr = "@push"
-						if buf[pos] == 0 {
-							l := uint16(utils.BytesStringLength(buf[pos+1:]))
+						if data[pos] == 0 {
+							l := uint16(utils.BytesStringLength(data[pos+1:]))
 
 							if l != 0 {
-								reff := ScriptOpcodeStringPushReference{
+								s.pushRefs = append(s.pushRefs, ScriptOpcodeStringPushReference{
 									Opcode: op,
-									String: buf[pos+1 : pos+1+l],
-								}
-
-								if reff.String[len(reff.String)-1] == 0 {
-									reff.String = reff.String[:len(reff.String)-1]
-								}
-								scriptPushRefFiller = append(scriptPushRefFiller, reff)
+									String: data[pos+1 : pos+1+l],
+								})
 							}
-							stringRepr += fmt.Sprintf("_string '%s' ", utils.DumpToOneLineString(buf[pos+1:pos+1+l]))
+							stringRepr += fmt.Sprintf("_string %s ", scriptQuote(data[pos+1:pos+1+l]))
 							pos += uint16(l) + 2
 						} else {
-							stringRepr += fmt.Sprintf("_float %v ", math.Float32frombits(binary.LittleEndian.Uint32(buf[pos+1:])))
+							stringRepr += fmt.Sprintf("_float %v ", math.Float32frombits(binary.LittleEndian.Uint32(data[pos+1:])))
 							pos += 5
 						}
 					}
+					stringRepr = strings.TrimSpace(stringRepr)
 				case 0x99:
-					stringRepr = fmt.Sprintf("jump %s", jmpOffsetToStr(binary.LittleEndian.Uint16(buf), 5))
+					stringRepr = fmt.Sprintf("jump %s", jmpOffsetToStr(binary.LittleEndian.Uint16(data), 5))
 				case 0x9e:
 					stringRepr = "CallFrame @pop_string"
 				case 0x9d:
-					stringRepr = fmt.Sprintf("jump %s if @pop_bool == true", jmpOffsetToStr(binary.LittleEndian.Uint16(buf), 5))
+					stringRepr = fmt.Sprintf("jump %s if @pop_bool == true", jmpOffsetToStr(binary.LittleEndian.Uint16(data), 5))
 				case 0x9f:
 					state := "PLAY"
-					if buf[0] == 0 {
+					if data[0] == 0 {
 						state = "STOP"
 					}
 					stringRepr = fmt.Sprintf("GotoExpression @pop_string (%s)", state)
 				default:
-					stringRepr = fmt.Sprintf(" unknown opcode  << dump{%s} >>", utils.DumpToOneLineString(buf[:opLen]))
+					stringRepr = fmt.Sprintf("unknown opcode 0x%x data %x", op.Code, data)
 				}
 				buf = buf[opLen:]
 			} else if config.GetPlayStationVersion() == config.PSVita {
@@ -148,36 +188,36 @@ func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 					stringRepr = fmt.Sprintf("GotoFrame %d", binary.LittleEndian.Uint16(buf))
 					opLen = 2
 				case 0x83:
-					stringRepr = fmt.Sprintf("Fs queue '%s' command '%s' or response result",
+					stringRepr = fmt.Sprintf("Fs queue %s command %s, or response result",
 						strFromOffset(0), strFromOffset(2))
 					opLen = 4
 				case 0x8a:
-					stringRepr = fmt.Sprintf("unused opcode 0x%x", op.Code)
+					stringRepr = fmt.Sprintf("unused opcode 0x%x data %x", op.Code, buf[:3])
 					opLen = 3
 				case 0x8b:
-					stringRepr = fmt.Sprintf("SetTarget '%s'", strFromOffset(0))
+					stringRepr = fmt.Sprintf("SetTarget %s", strFromOffset(0))
 					opLen = 2
 				case 0x8c:
-					stringRepr = fmt.Sprintf("GotoLabel '%s'", strFromOffset(0))
+					stringRepr = fmt.Sprintf("GotoLabel %s", strFromOffset(0))
 					opLen = 2
 				case 0x96:
 					if buf[0] == 1 {
 						opLen = 5
-						stringRepr = fmt.Sprintf("push_float %v ", math.Float32frombits(binary.LittleEndian.Uint32(buf[1:])))
+						stringRepr = fmt.Sprintf("push_float %v", math.Float32frombits(binary.LittleEndian.Uint32(buf[1:])))
 					} else {
 						if buf[0] != 0 {
 							opLen = 2
-							stringRepr = fmt.Sprintf("push_string '%s'", strFromOffset(0))
+							stringRepr = fmt.Sprintf("push_string_short %s", strFromOffset(0))
 						} else {
 							opLen = 3
-							stringRepr = fmt.Sprintf("push_string '%s' ", strFromOffset(1))
+							stringRepr = fmt.Sprintf("push_string %s", strFromOffset(1))
 						}
 					}
 				case 0x99:
 					stringRepr = fmt.Sprintf("jump %s", jmpOffsetToStr(binary.LittleEndian.Uint16(buf), 3))
 					opLen = 2
 				case 0x9a:
-					stringRepr = fmt.Sprintf("unused opcode 0x%x", op.Code)
+					stringRepr = fmt.Sprintf("unused opcode 0x%x data %x", op.Code, buf[:1])
 					opLen = 1
 				case 0x9d:
 					stringRepr = fmt.Sprintf("jump %s if @pop_bool == true", jmpOffsetToStr(binary.LittleEndian.Uint16(buf), 3))
@@ -200,78 +240,58 @@ func (s *Script) parseOpcodes(buf []byte, stringsSector []byte) {
 			} else {
 				log.Panicf("Unsupported version of ps")
 			}
-		} else {
-			switch op.Code {
-			case 0:
-				stringRepr = "end"
-			case 6:
-				stringRepr = "Play"
-			case 7:
-				stringRepr = "Stop"
-			case 0xa:
-				stringRepr = "@push_float = @pop_float2 + @pop_float1"
-			case 0xb:
-				stringRepr = "@push_float = @pop_float2 - @pop_float1"
-			case 0xc:
-				stringRepr = "@push_float = @pop_float2 * @pop_float1"
-			case 0xd:
-				stringRepr = "@push_float = @pop_float2 / @pop_float1"
-			case 0xe:
-				stringRepr = "@push_bool = @pop_float1 == close to == @pop_float2"
-			case 0xf:
-				stringRepr = "@push_bool = @pop_float2 < @pop_float1"
-			case 0x10:
-				stringRepr = "@push_bool = @pop_bool1 AND @pop_bool2"
-			case 0x11:
-				stringRepr = "@push_bool = @pop_bool1 OR @pop_bool2"
-			case 0x12:
-				stringRepr = "@push_bool = convert_to_bool @pop_any"
-			case 0x13:
-				stringRepr = "@push_bool = strcmp(@pop_string2, @pop_string1) <= 0"
-			case 0x17:
-				stringRepr = " @pop_any to nothing"
-			case 0x18:
-				stringRepr = "@push_float = round @pop_float"
-			case 0x1c:
-				stringRepr = "@push_any vfs get @pop_string1"
-			case 0x1d:
-				stringRepr = "vfs set @pop_string2 = @pop_string1"
-			case 0x20:
-				stringRepr = "SetTarget @pop_string1"
-			case 0x21:
-				stringRepr = "@push_string = @pop_string2 append to @pop_string1"
-			case 0x34:
-				stringRepr = "@push_float  current timer value"
-			default:
-				stringRepr = " unknown opcode "
-			}
+		} else if str, ok := scriptSimpleOpcodes[op.Code]; ok {
+			stringRepr = str
+		}
+
+		// representation of opcodes with non-standard encoding (for example, unusual
+		// parameter length) cannot be assembled back, so use raw form for them
+		if !scriptIsJump(op.Code) && !scriptReprMatches(stringRepr, op, vita) {
+			stringRepr = fmt.Sprintf("raw opcode 0x%x data %x", op.Code, op.Data)
 		}
+
 		op.String = stringRepr
 		s.Opcodes = append(s.Opcodes, op)
 	}
 }
 
 func (s *Script) dissasembleToString() string {
+	return s.disassembleWith(func(op *ScriptOpcode) string { return op.String })
+}
+
+// disassembleWith prints opcodes using repr, used to produce modified text for assembler
+func (s *Script) disassembleWith(repr func(op *ScriptOpcode) string) string {
 	strs := make([]string, 0)
-	pos := int16(0)
-	ops := s.Opcodes
-	for len(ops) != 0 {
+	// labels only can be placed between opcodes,
+	// jumps to other offsets are assembled using explicit offset
+	printLabel := func(pos int16) {
 		if label, ex := s.labels[pos]; ex {
 			strs = append(strs, fmt.Sprintf("%.4x: $%s", pos, label))
 		}
+	}
 
-		op := ops[0]
-		if op.Offset == pos {
-			strs = append(strs, fmt.Sprintf("%.4x: %.2x: %s", op.Offset, op.Code, op.String))
-			ops = ops[1:]
-		}
-
-		pos++
+	end := int16(0)
+	for _, op := range s.Opcodes {
+		printLabel(op.Offset)
+		strs = append(strs, fmt.Sprintf("%.4x: %.2x: %s", op.Offset, op.Code, repr(op)))
+		end = op.Offset + int16(op.size())
 	}
+	printLabel(end)
 
 	return strings.Join(strs, "\n")
 }
 
+// size of opcode in stream
+func (op *ScriptOpcode) size() int {
+	if op.Code&0x80 == 0 {
+		return 1
+	}
+	if config.GetPlayStationVersion() != config.PSVita {
+		return 3 + len(op.Data)
+	}
+	return 1 + len(op.Data)
+}
+
 func (s *Script) Marshal() []byte {
 	var r bytes.Buffer
 	for _, op := range s.Opcodes {
@@ -291,8 +311,9 @@ func (s *Script) Marshal() []byte {
 
 func NewScriptFromData(buf []byte, stringsSector []byte) *Script {
 	s := new(Script)
+	s.original = buf
 	s.parseOpcodes(buf, stringsSector)
-	s.Decompiled = strings.Replace("\n"+s.dissasembleToString(), "\n", "<br>", -1)
+	s.Decompiled = s.dissasembleToString()
 	return s
 }
 
@@ -306,15 +327,34 @@ func (oref *ScriptOpcodeStringPushReference) ChangeString(data []byte) {
 	oref.Opcode.Data = buf.Bytes()
 }
 
-func enterScriptPushRefFiller() {
-	scriptPushRefFiller = make([]ScriptOpcodeStringPushReference, 0)
-	scriptPushRefLocker.Lock()
+func (d6s1 *Data6Subtype1) scripts() []*Script {
+	result := make([]*Script, 0)
+	for i := range d6s1.FrameScriptLables {
+		for j := range d6s1.FrameScriptLables[i].Subs {
+			result = append(result, d6s1.FrameScriptLables[i].Subs[j].Script)
+		}
+	}
+	return result
+}
+
+// Scripts returns every script of flp in order of marshaling
+func (f *FLP) Scripts() []*Script {
+	result := make([]*Script, 0)
+	for i := range f.Datas6 {
+		result = append(result, f.Datas6[i].Sub1.scripts()...)
+		for j := range f.Datas6[i].Sub2s {
+			result = append(result, f.Datas6[i].Sub2s[j].Script)
+		}
+	}
+	for i := range f.Datas7 {
+		result = append(result, f.Datas7[i].scripts()...)
+	}
+	return append(result, f.Data8.scripts()...)
 }
 
-func exitScriptPushRefFiller() []ScriptOpcodeStringPushReference {
-	defer func() {
-		scriptPushRefFiller = nil
-		scriptPushRefLocker.Unlock()
-	}()
-	return scriptPushRefFiller
+func (f *FLP) collectScriptPushRefs() {
+	f.scriptPushRefs = make([]ScriptOpcodeStringPushReference, 0)
+	for _, s := range f.Scripts() {
+		f.scriptPushRefs = append(f.scriptPushRefs, s.pushRefs...)
+	}
 }
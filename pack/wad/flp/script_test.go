@@ -0,0 +1,53 @@
+package flp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// ps2 script covering every opcode form, including encodings that are kept as raw opcodes
+var testScript = []byte{
+	0x96, 0x0a, 0x00, 0x00, 'a', 'b', '\'', 0x00, 0x01, 0x00, 0x00, 0x80, 0x3f, // @push_string 'ab\'' _float 1
+	0x8b, 0x04, 0x00, 'b', 0xe9, '\\', 0x00, // SetTarget 'b\xe9\\'
+	0x83, 0x04, 0x00, 'q', 0x00, 'c', 0x00, // Fs queue 'q' command 'c'
+	0x9d, 0x02, 0x00, 0x05, 0x00, // jump to GotoExpression if true
+	0x81, 0x02, 0x00, 0x03, 0x00, // GotoFrame 3
+	0x9f, 0x01, 0x00, 0x02, // GotoExpression with unusual state, raw
+	0x81, 0x03, 0x00, 0x01, 0x02, 0x03, // GotoFrame with unusual length, raw
+	0x99, 0x02, 0x00, 0xec, 0xff, // jump back to GotoFrame 3
+	0x06, 0x55, 0x00,
+}
+
+func TestScriptRoundTrip(t *testing.T) {
+	s := NewScriptFromData(testScript, nil)
+	if err := s.CheckRoundTrip(); err != nil {
+		t.Fatalf("%v\n%s", err, s.Decompiled)
+	}
+	if !strings.Contains(s.Decompiled, "$label_0025") || !strings.Contains(s.Decompiled, "@push_string 'ab\\'' _float 1") {
+		t.Errorf("Unexpected decompiled text:\n%s", s.Decompiled)
+	}
+}
+
+func TestScriptAssembleRelocatesJumps(t *testing.T) {
+	s := NewScriptFromData(testScript, nil)
+	// insert opcode right after label of backward jump
+	text := strings.Replace(s.Decompiled, "0020: 81:", "Play\n0020: 81:", 1)
+	if err := s.Assemble(text); err != nil {
+		t.Fatal(err)
+	}
+	code := s.Marshal()
+	if len(code) != len(testScript)+1 {
+		t.Fatalf("Wrong size %d", len(code))
+	}
+	// forward jump skips inserted opcode, backward jump lands on it
+	if !bytes.Equal(code[0x1b:0x20], []byte{0x9d, 0x02, 0x00, 0x06, 0x00}) {
+		t.Errorf("Forward jump not relocated: %x", code[0x1b:0x20])
+	}
+	if !bytes.Equal(code[0x30:0x35], []byte{0x99, 0x02, 0x00, 0xeb, 0xff}) {
+		t.Errorf("Backward jump not relocated: %x", code[0x30:0x35])
+	}
+	if err := s.CheckRoundTrip(); err != nil {
+		t.Error(err)
+	}
+}
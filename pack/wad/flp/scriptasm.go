@@ -0,0 +1,439 @@
+package flp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+// ScriptAssembly is result of assembling script text.
+// Strings are used only on ps vita, where string parameters are
+// offsets in strings sector of flp, resolved by FlpMarshaler
+type ScriptAssembly struct {
+	Code    []byte
+	Strings map[string][]uint16 // string to offsets of u16 parameters
+}
+
+type scriptStringParam struct {
+	pos   int // position in instruction data
+	value string
+}
+
+type scriptInstruction struct {
+	code    byte
+	data    []byte
+	strings []scriptStringParam
+	label   string // jump target label
+	target  int    // explicit jump target offset, -1 if not provided
+}
+
+var (
+	scriptAddrRe  = regexp.MustCompile(`^[0-9a-fA-F]{4,}:\s+`)
+	scriptCodeRe  = regexp.MustCompile(`^[0-9a-fA-F]{2}:\s+`)
+	scriptLabelRe = regexp.MustCompile(`^\$([A-Za-z0-9_]+)$`)
+	scriptRawRe   = regexp.MustCompile(`^(?:raw|unknown|unused) opcode 0x([0-9a-fA-F]{1,2})(?: data ([0-9a-fA-F]*))?$`)
+	scriptJumpRe  = regexp.MustCompile(`^jump \$([A-Za-z0-9_]+)(?:\(([+-]?[0-9a-fA-F]+)=(-?[0-9a-fA-F]+)\))?( if @pop_bool == true)?$`)
+)
+
+func scriptIsJump(code byte) bool {
+	return code == 0x99 || code == 0x9d
+}
+
+// scriptUnquote reads string produced by scriptQuote from start of s and returns rest of s
+func scriptUnquote(s string) ([]byte, string, error) {
+	if len(s) == 0 || s[0] != '\'' {
+		return nil, s, fmt.Errorf("Expected quoted string at '%s'", s)
+	}
+	var out bytes.Buffer
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return out.Bytes(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, s, fmt.Errorf("Unterminated escape sequence")
+			}
+			i++
+			switch s[i] {
+			case '\'', '\\':
+				out.WriteByte(s[i])
+			case 'x':
+				if i+2 >= len(s) {
+					return nil, s, fmt.Errorf("Unterminated escape sequence")
+				}
+				b, err := hex.DecodeString(s[i+1 : i+3])
+				if err != nil {
+					return nil, s, fmt.Errorf("Invalid escape sequence '\\x%s'", s[i+1:i+3])
+				}
+				out.Write(b)
+				i += 2
+			default:
+				return nil, s, fmt.Errorf("Unknown escape sequence '\\%c'", s[i])
+			}
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	return nil, s, fmt.Errorf("Unterminated string")
+}
+
+// scriptQuotedArgs reads quoted strings separated by words of sep from s
+func scriptQuotedArgs(s string, seps ...string) ([][]byte, string, error) {
+	result := make([][]byte, 0)
+	for i := 0; ; i++ {
+		str, rest, err := scriptUnquote(strings.TrimSpace(s))
+		if err != nil {
+			return nil, s, err
+		}
+		result = append(result, str)
+		s = strings.TrimSpace(rest)
+		if i >= len(seps) {
+			return result, s, nil
+		}
+		if !strings.HasPrefix(s, seps[i]) {
+			return nil, s, fmt.Errorf("Expected '%s' at '%s'", seps[i], s)
+		}
+		s = s[len(seps[i]):]
+	}
+}
+
+func (ins *scriptInstruction) stringParam(str []byte, vita bool) {
+	if vita {
+		ins.strings = append(ins.strings, scriptStringParam{pos: len(ins.data), value: string(str)})
+		ins.data = append(ins.data, 0, 0)
+	} else {
+		ins.data = append(append(ins.data, str...), 0)
+	}
+}
+
+func parseScriptFloat(s string) ([]byte, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return nil, err
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(f)))
+	return buf[:], nil
+}
+
+// parseScriptInstruction parses single instruction in form produced by Script.parseOpcodes
+func parseScriptInstruction(text string, vita bool) (*scriptInstruction, error) {
+	text = strings.TrimSpace(text)
+	normalized := strings.Join(strings.Fields(text), " ")
+	ins := &scriptInstruction{data: make([]byte, 0), target: -1}
+
+	for code, str := range scriptSimpleOpcodes {
+		if normalized == str {
+			ins.code = code
+			return ins, nil
+		}
+	}
+
+	if m := scriptRawRe.FindStringSubmatch(normalized); m != nil {
+		code, _ := strconv.ParseUint(m[1], 16, 8)
+		data, err := hex.DecodeString(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid data: %v", err)
+		}
+		if code&0x80 == 0 && len(data) != 0 {
+			return nil, fmt.Errorf("Opcode 0x%x cannot have data", code)
+		}
+		ins.code = byte(code)
+		ins.data = data
+		return ins, nil
+	}
+
+	if m := scriptJumpRe.FindStringSubmatch(normalized); m != nil {
+		ins.code = 0x99
+		if m[4] != "" {
+			ins.code = 0x9d
+		}
+		ins.label = m[1]
+		if m[3] != "" {
+			target, err := strconv.ParseInt(m[3], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid jump target: %v", err)
+			}
+			ins.target = int(target)
+		}
+		ins.data = append(ins.data, 0, 0)
+		return ins, nil
+	}
+
+	word := text
+	if i := strings.IndexAny(text, " '"); i >= 0 {
+		word = text[:i]
+	}
+	rest := strings.TrimSpace(text[len(word):])
+
+	switch {
+	case word == "GotoFrame":
+		frame, err := strconv.ParseUint(rest, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid frame: %v", err)
+		}
+		ins.code = 0x81
+		ins.data = append(ins.data, byte(frame), byte(frame>>8))
+	case word == "Fs" && strings.HasPrefix(rest, "queue "):
+		args, tail, err := scriptQuotedArgs(strings.TrimPrefix(rest, "queue "), "command")
+		if err != nil {
+			return nil, err
+		}
+		if tail != "" && tail != ", or response result" {
+			return nil, fmt.Errorf("Unexpected '%s'", tail)
+		}
+		ins.code = 0x83
+		ins.stringParam(args[0], vita)
+		ins.stringParam(args[1], vita)
+	case word == "SetTarget" || word == "GotoLabel":
+		args, tail, err := scriptQuotedArgs(rest)
+		if err != nil {
+			return nil, err
+		}
+		if tail != "" {
+			return nil, fmt.Errorf("Unexpected '%s'", tail)
+		}
+		ins.code = 0x8b
+		if word == "GotoLabel" {
+			ins.code = 0x8c
+		}
+		ins.stringParam(args[0], vita)
+	case normalized == "CallFrame @pop_string":
+		ins.code = 0x9e
+	case normalized == "GotoExpression @pop_string (PLAY)":
+		ins.code = 0x9f
+		ins.data = append(ins.data, 1)
+	case normalized == "GotoExpression @pop_string (STOP)":
+		ins.code = 0x9f
+		ins.data = append(ins.data, 0)
+	case !vita && strings.HasPrefix(word, "@push"):
+		// items of push are glued to first one: @push_string 'a' _float 1
+		ins.code = 0x96
+		s := strings.TrimSpace(strings.TrimPrefix(text, "@push"))
+		for s != "" {
+			switch {
+			case strings.HasPrefix(s, "_string"):
+				args, tail, err := scriptQuotedArgs(strings.TrimPrefix(s, "_string"))
+				if err != nil {
+					return nil, err
+				}
+				ins.data = append(append(append(ins.data, 0), args[0]...), 0)
+				s = tail
+			case strings.HasPrefix(s, "_float"):
+				fields := strings.Fields(strings.TrimPrefix(s, "_float"))
+				if len(fields) == 0 {
+					return nil, fmt.Errorf("Missed float value")
+				}
+				f, err := parseScriptFloat(fields[0])
+				if err != nil {
+					return nil, fmt.Errorf("Invalid float: %v", err)
+				}
+				ins.data = append(append(ins.data, 1), f...)
+				s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(s, "_float")), fields[0]))
+			default:
+				return nil, fmt.Errorf("Expected _string or _float at '%s'", s)
+			}
+		}
+	case vita && word == "push_float":
+		f, err := parseScriptFloat(rest)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid float: %v", err)
+		}
+		ins.code = 0x96
+		ins.data = append(append(ins.data, 1), f...)
+	case vita && (word == "push_string" || word == "push_string_short"):
+		args, tail, err := scriptQuotedArgs(rest)
+		if err != nil {
+			return nil, err
+		}
+		if tail != "" {
+			return nil, fmt.Errorf("Unexpected '%s'", tail)
+		}
+		ins.code = 0x96
+		if word == "push_string" {
+			ins.data = append(ins.data, 0)
+		}
+		ins.stringParam(args[0], vita)
+	default:
+		return nil, fmt.Errorf("Unknown instruction")
+	}
+	return ins, nil
+}
+
+// scriptReprMatches checks that text representation of opcode is assembled to same bytes
+func scriptReprMatches(repr string, op *ScriptOpcode, vita bool) bool {
+	ins, err := parseScriptInstruction(repr, vita)
+	if err != nil || ins.code != op.Code {
+		return false
+	}
+	if scriptIsJump(op.Code) {
+		return len(op.Data) == 2
+	}
+	if op.Code&0x80 == 0 {
+		return true
+	}
+	if len(ins.data) != len(op.Data) {
+		return false
+	}
+	// string offsets are not known at this point, but strings itself were read from them
+	for _, s := range ins.strings {
+		copy(ins.data[s.pos:s.pos+2], op.Data[s.pos:])
+	}
+	return bytes.Equal(ins.data, op.Data)
+}
+
+// AssembleScript compiles text produced by Script decompiler back to opcodes.
+// Accepts label lines "$name" and jumps "jump $name" or "jump $name if @pop_bool == true".
+// Address and opcode columns of decompiled text are optional and ignored.
+// Jump to label not defined in text uses explicit target from "(+offset=target)" suffix
+func AssembleScript(text string) (*ScriptAssembly, error) {
+	vita := config.GetPlayStationVersion() == config.PSVita
+
+	type fixup struct {
+		pos    int // position of u16 jump parameter
+		end    int // position after jump opcode
+		label  string
+		target int
+		line   int
+	}
+
+	asm := &ScriptAssembly{Code: make([]byte, 0), Strings: make(map[string][]uint16)}
+	labels := make(map[string]int)
+	fixups := make([]fixup, 0)
+
+	for iLine, rawLine := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		line = scriptAddrRe.ReplaceAllString(line, "")
+		if m := scriptLabelRe.FindStringSubmatch(line); m != nil {
+			labels[m[1]] = len(asm.Code)
+			continue
+		}
+		line = scriptCodeRe.ReplaceAllString(line, "")
+
+		ins, err := parseScriptInstruction(line, vita)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d '%s': %v", iLine+1, rawLine, err)
+		}
+
+		asm.Code = append(asm.Code, ins.code)
+		if ins.code&0x80 == 0 {
+			continue
+		}
+		if !vita {
+			if len(ins.data) > 0xffff {
+				return nil, fmt.Errorf("Line %d: opcode data is too big", iLine+1)
+			}
+			asm.Code = append(asm.Code, byte(len(ins.data)), byte(len(ins.data)>>8))
+		}
+		dataStart := len(asm.Code)
+		asm.Code = append(asm.Code, ins.data...)
+
+		for _, s := range ins.strings {
+			asm.Strings[s.value] = append(asm.Strings[s.value], uint16(dataStart+s.pos))
+		}
+		if scriptIsJump(ins.code) {
+			fixups = append(fixups, fixup{pos: dataStart, end: len(asm.Code), label: ins.label, target: ins.target, line: iLine + 1})
+		}
+	}
+
+	if len(asm.Code) > math.MaxInt16 {
+		return nil, fmt.Errorf("Script is too big (0x%x bytes)", len(asm.Code))
+	}
+
+	for _, f := range fixups {
+		target, ok := labels[f.label]
+		if !ok {
+			if f.target < 0 {
+				return nil, fmt.Errorf("Line %d: unknown label '%s'", f.line, f.label)
+			}
+			target = f.target
+		}
+		binary.LittleEndian.PutUint16(asm.Code[f.pos:], uint16(int16(target-f.end)))
+	}
+
+	return asm, nil
+}
+
+// Assemble replaces opcodes of script with assembled text
+func (s *Script) Assemble(text string) error {
+	asm, err := AssembleScript(text)
+	if err != nil {
+		return err
+	}
+
+	// fill string offsets using temporary strings sector, so script can be parsed back.
+	// short string push form on ps vita requires low byte of offset not equal to 0 or 1
+	code := append([]byte{}, asm.Code...)
+	sector := []byte{0}
+	strs := make([]string, 0, len(asm.Strings))
+	for str := range asm.Strings {
+		strs = append(strs, str)
+	}
+	sort.Strings(strs)
+	for _, str := range strs {
+		encoded, err := charmap.Windows1252.NewEncoder().Bytes([]byte(str))
+		if err != nil {
+			return fmt.Errorf("Cannot encode string '%s': %v", str, err)
+		}
+		for len(sector)%256 < 2 {
+			sector = append(sector, 0)
+		}
+		for _, pos := range asm.Strings[str] {
+			binary.LittleEndian.PutUint16(code[pos:], uint16(len(sector)))
+		}
+		sector = append(append(sector, encoded...), 0)
+	}
+	if len(sector) > 0xffff {
+		return fmt.Errorf("Strings of script are too big")
+	}
+
+	id := s.Id
+	*s = *NewScriptFromData(code, sector)
+	s.Id = id
+	return nil
+}
+
+// CheckRoundTrip assembles decompiled text and compares result with original script bytes.
+// String offsets (ps vita) are resolved by FlpMarshaler, so they are compared by value
+func (s *Script) CheckRoundTrip() error {
+	asm, err := AssembleScript(s.Decompiled)
+	if err != nil {
+		return err
+	}
+	code := asm.Code
+	if len(code) != len(s.original) {
+		return fmt.Errorf("Size mismatch: assembled 0x%x, original 0x%x", len(code), len(s.original))
+	}
+	for str, positions := range asm.Strings {
+		for _, pos := range positions {
+			found := false
+			for _, refPos := range s.staticStringRef[str] {
+				found = found || refPos == pos
+			}
+			if !found {
+				return fmt.Errorf("String '%s' at 0x%x not in original script", str, pos)
+			}
+			copy(code[pos:pos+2], s.original[pos:])
+		}
+	}
+
+	for i := range code {
+		if code[i] != s.original[i] {
+			return fmt.Errorf("Mismatch at 0x%x: assembled 0x%.2x, original 0x%.2x", i, code[i], s.original[i])
+		}
+	}
+	return nil
+}
@@ -101,11 +101,24 @@ func (d4 *StaticLabel) MarshalRenderCommandList() []byte {
 			}
 		}
 
-		o.WriteByte(uint8(len(cmd.Glyphs)))
-		for _, glyph := range cmd.Glyphs {
-			binary.LittleEndian.PutUint16(buf[0:], glyph.GlyphId)
-			binary.LittleEndian.PutUint16(buf[2:], uint16(glyph.Width*16.0))
-			o.Write(buf[:4])
+		// glyphs count byte cannot have 0x80 bit, so long
+		// texts are split into several glyph lists of same command
+		glyphs := cmd.Glyphs
+		for {
+			count := len(glyphs)
+			if count > 0x7f {
+				count = 0x7f
+			}
+			o.WriteByte(uint8(count))
+			for _, glyph := range glyphs[:count] {
+				binary.LittleEndian.PutUint16(buf[0:], glyph.GlyphId)
+				binary.LittleEndian.PutUint16(buf[2:], uint16(glyph.Width*16.0))
+				o.Write(buf[:4])
+			}
+			glyphs = glyphs[count:]
+			if len(glyphs) == 0 {
+				break
+			}
 		}
 	}
 	return o.Bytes()
@@ -0,0 +1,234 @@
+package flp
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mesh "github.com/mogaika/god_of_war_browser/pack/wad/mesh"
+)
+
+const (
+	ttfAtlasPadding  = 1
+	ttfAtlasMaxSize  = 1024
+	ttfDefaultSize   = 60
+	ttfMaxTextureLen = 20 // tag name is 24 bytes including TXR_ prefix
+)
+
+type TtfImportResult struct {
+	Texture string
+	Width   int
+	Height  int
+	Glyphs  int
+	Missing []string // chars not present in ttf
+}
+
+type ttfGlyph struct {
+	char    rune
+	rect    image.Rectangle // pixels relative to baseline
+	advance fixed.Int26_6
+	pos     image.Point // position in atlas
+}
+
+// DefaultTtfChars returns printable ascii chars and every char from font aliases
+func DefaultTtfChars() []rune {
+	chars := make([]rune, 0)
+	for r := rune(0x20); r < 0x7f; r++ {
+		chars = append(chars, r)
+	}
+	if aliases, err := config.GetFontAliases(); err == nil {
+		for r := range aliases {
+			chars = append(chars, r)
+		}
+	}
+	return chars
+}
+
+// packTtfGlyphs places glyphs into smallest power of two atlas using shelves
+func packTtfGlyphs(glyphs []*ttfGlyph) (int, int, error) {
+	sorted := make([]*ttfGlyph, len(glyphs))
+	copy(sorted, glyphs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].rect.Dy() > sorted[j].rect.Dy() })
+
+	for width := 64; width <= ttfAtlasMaxSize; width *= 2 {
+		x, y, shelf := 0, 0, 0
+		fits := true
+		for _, g := range sorted {
+			w, h := g.rect.Dx()+ttfAtlasPadding, g.rect.Dy()+ttfAtlasPadding
+			if w > width {
+				fits = false
+				break
+			}
+			if x+w > width {
+				x, y, shelf = 0, y+shelf, 0
+			}
+			g.pos = image.Pt(x, y)
+			x += w
+			if h > shelf {
+				shelf = h
+			}
+		}
+		height := 1
+		for height < y+shelf {
+			height *= 2
+		}
+		if fits && height <= width {
+			return width, height, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("Glyphs do not fit into %dx%d texture, decrease font size or chars count", ttfAtlasMaxSize, ttfAtlasMaxSize)
+}
+
+// rasterizeTtf renders chars of ttf/otf font with white color and alpha into atlas
+func rasterizeTtf(data []byte, chars []rune, size float64) (*image.NRGBA, []*ttfGlyph, []rune, error) {
+	fnt, err := opentype.Parse(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Cannot parse font: %v", err)
+	}
+	face, err := opentype.NewFace(fnt, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Cannot create font face: %v", err)
+	}
+	defer face.Close()
+
+	var buf sfnt.Buffer
+	glyphs := make([]*ttfGlyph, 0, len(chars))
+	missing := make([]rune, 0)
+	for _, r := range chars {
+		if idx, err := fnt.GlyphIndex(&buf, r); err != nil || idx == 0 {
+			missing = append(missing, r)
+			continue
+		}
+		dr, _, _, advance, ok := face.Glyph(fixed.Point26_6{}, r)
+		if !ok {
+			missing = append(missing, r)
+			continue
+		}
+		glyphs = append(glyphs, &ttfGlyph{char: r, rect: dr, advance: advance})
+	}
+
+	width, height, err := packTtfGlyphs(glyphs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	atlas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for _, g := range glyphs {
+		// mask is reused by face, so draw glyph right after rendering
+		dr, mask, maskp, _, _ := face.Glyph(fixed.Point26_6{}, g.char)
+		draw.DrawMask(atlas, image.Rectangle{g.pos, g.pos.Add(dr.Size())}, image.White, image.Point{}, mask, maskp, draw.Over)
+	}
+	return atlas, glyphs, missing, nil
+}
+
+// ImportTtf rasterizes chars into texture and creates or updates glyphs of font.
+// scale has same meaning as for ImportBmFont
+func (f *FLP) ImportTtf(font *Font, mesh *file_mesh.Mesh, data []byte, chars []rune, size float64, scale float32, textureName string) (image.Image, *TtfImportResult, error) {
+	fontAliases, err := config.GetFontAliases()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot load font aliases file: %v", err)
+	}
+
+	// remove duplicates and check mapping before rasterization
+	uniq := make(map[rune]uint8)
+	unique := make([]rune, 0, len(chars))
+	for _, r := range chars {
+		if _, ok := uniq[r]; ok {
+			continue
+		}
+		charId, err := fontCharByte(fontAliases, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		uniq[r] = charId
+		unique = append(unique, r)
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+
+	atlas, glyphs, missing, err := rasterizeTtf(data, unique, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := atlas.Bounds().Size()
+	for _, g := range glyphs {
+		quad := &fontGlyphQuad{
+			X: [2]float32{float32(g.rect.Min.X), float32(g.rect.Max.X)},
+			Y: [2]float32{float32(g.rect.Min.Y), float32(g.rect.Max.Y)},
+			U: [2]float32{
+				float32(g.pos.X) / float32(b.X),
+				float32(g.pos.X+g.rect.Dx()) / float32(b.X),
+			},
+			V: [2]float32{
+				float32(g.pos.Y) / float32(b.Y),
+				float32(g.pos.Y+g.rect.Dy()) / float32(b.Y),
+			},
+			Texture: textureName,
+		}
+		charWidth := int16(float32(g.advance) / 64.0 * file_mesh.GSFixedPoint8 * scale)
+		setFontGlyph(font, mesh, uniq[g.char], charWidth, quad, scale)
+	}
+
+	result := &TtfImportResult{
+		Texture: "TXR_" + textureName,
+		Width:   b.X,
+		Height:  b.Y,
+		Glyphs:  len(glyphs),
+		Missing: make([]string, len(missing)),
+	}
+	for i, r := range missing {
+		result.Missing[i] = string(r)
+	}
+	return atlas, result, nil
+}
+
+func (f *FLP) actionImportTtf(wrsrc *wad.WadNodeRsrc, data []byte, chars []rune, size float64, scale float32, textureName string) (*TtfImportResult, error) {
+	if len(f.Fonts) != 1 {
+		return nil, fmt.Errorf("Flp must contain exactly one font, found %d", len(f.Fonts))
+	}
+	if textureName == "" {
+		textureName = strings.TrimPrefix(wrsrc.Name(), "FLP_") + "_TTF"
+		if len(textureName) > ttfMaxTextureLen {
+			textureName = textureName[len(textureName)-ttfMaxTextureLen:]
+		}
+	} else if len(textureName) > ttfMaxTextureLen {
+		return nil, fmt.Errorf("Texture name '%s' is longer than %d chars", textureName, ttfMaxTextureLen)
+	}
+	if len(chars) == 0 {
+		chars = DefaultTtfChars()
+	}
+	if size <= 0 {
+		size = ttfDefaultSize
+	}
+
+	mesh, meshTagId, err := getMeshForFlp(wrsrc)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find mesh for flp: %v", err)
+	}
+
+	atlas, result, err := f.ImportTtf(&f.Fonts[0], mesh, data, chars, size, scale, textureName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+		meshTagId:    mesh.MarshalBuffer().Bytes(),
+		wrsrc.Tag.Id: f.marshalBufferWithHeader().Bytes(),
+	}); err != nil {
+		return nil, fmt.Errorf("Error when updating mesh and flp tags: %v", err)
+	}
+
+	if err := importFontTexture(wrsrc, meshTagId, textureName, atlas); err != nil {
+		return nil, fmt.Errorf("Error when importing texture: %v", err)
+	}
+	return result, nil
+}
@@ -23,3 +23,25 @@ func isZeroSizedTag(tag *Tag) bool {
 		panic("unknwn")
 	}
 }
+
+func isGroupStartTag(tag *Tag) bool {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return tag.Tag == TAG_GOW1_FILE_GROUP_START
+	case config.GOW2:
+		return tag.Tag == TAG_GOW2_FILE_GROUP_START
+	default:
+		panic("unknwn")
+	}
+}
+
+func isGroupEndTag(tag *Tag) bool {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return tag.Tag == TAG_GOW1_FILE_GROUP_END
+	case config.GOW2:
+		return tag.Tag == TAG_GOW2_FILE_GROUP_END
+	default:
+		panic("unknwn")
+	}
+}
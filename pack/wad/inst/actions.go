@@ -0,0 +1,166 @@
+package inst
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func parseUint16(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	return uint16(v), err
+}
+
+// ApplyForm updates instance fields present in request.
+// If syncposition2 is set, visibility position moved together with object position
+func (inst *Instance) ApplyForm(r *http.Request) error {
+	if object := r.FormValue("object"); object != "" {
+		if err := utils.CheckStringBuffer(object, 0x18, true); err != nil {
+			return fmt.Errorf("Invalid object name: %v", err)
+		}
+		inst.Object = object
+	}
+	if id := r.FormValue("id"); id != "" {
+		v, err := parseUint16(id)
+		if err != nil {
+			return fmt.Errorf("Invalid id: %v", err)
+		}
+		inst.Id = v
+	}
+	if params := r.FormValue("params"); params != "" {
+		v, err := parseUint16(params)
+		if err != nil {
+			return fmt.Errorf("Invalid params: %v", err)
+		}
+		inst.Params = v
+	}
+
+	oldPosition := inst.Position1
+	if pos := r.FormValue("position1"); pos != "" {
+		if err := utils.ParseVec4(pos, &inst.Position1); err != nil {
+			return fmt.Errorf("Invalid position1: %v", err)
+		}
+	}
+	if rot := r.FormValue("rotation"); rot != "" {
+		if err := utils.ParseVec4(rot, &inst.Rotation); err != nil {
+			return fmt.Errorf("Invalid rotation: %v", err)
+		}
+	}
+	if pos := r.FormValue("position2"); pos != "" {
+		if err := utils.ParseVec4(pos, &inst.Position2); err != nil {
+			return fmt.Errorf("Invalid position2: %v", err)
+		}
+	} else if r.FormValue("syncposition2") != "" {
+		delta := inst.Position1.Sub(oldPosition)
+		for i := 0; i < 3; i++ {
+			inst.Position2[i] += delta[i]
+		}
+	}
+	return nil
+}
+
+// Duplicate inserts copy of instance node (with its subgroup) after original node.
+// Copy gets name and game object id passed to function
+func (inst *Instance) Duplicate(wrsrc *wad.WadNodeRsrc, name string, dup *Instance) error {
+	first, last, err := wrsrc.Wad.GetNodeTagsRange(wrsrc.Node.Id)
+	if err != nil {
+		return err
+	}
+
+	newTags := make([]wad.Tag, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		t := wrsrc.Wad.Tags[i]
+		if i == wrsrc.Tag.Id {
+			t.Name = name
+			t.Data = dup.MarshalToBinary()
+		} else if t.Data != nil {
+			t.Data = append([]byte{}, t.Data...)
+		}
+		newTags = append(newTags, t)
+	}
+
+	return wrsrc.Wad.InsertNewTags(last+1, newTags)
+}
+
+// nextFreeId returns id greater than ids of every instance in same group
+func (inst *Instance) nextFreeId(wrsrc *wad.WadNodeRsrc) uint16 {
+	maxId := inst.Id
+	if parent := wrsrc.Wad.GetNodeById(wrsrc.Node.Parent); parent != nil {
+		for _, id := range parent.SubGroupNodes {
+			if sub, _, err := wrsrc.Wad.GetInstanceFromNode(id); err == nil {
+				if i, ok := sub.(*Instance); ok && i.Id > maxId {
+					maxId = i.Id
+				}
+			}
+		}
+	}
+	return maxId + 1
+}
+
+// nodeNameUsed reports whether any node of wad has name, including nodes inside of groups
+func nodeNameUsed(w *wad.Wad, name string) bool {
+	for _, n := range w.Nodes {
+		if n.Tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// freeName returns base or base with numeric suffix not used by nodes of wad
+func freeName(w *wad.Wad, base string) string {
+	name := base
+	for i := 2; nodeNameUsed(w, name); i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	return name
+}
+
+func (inst *Instance) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "update":
+		updated := *inst
+		if err := updated.ApplyForm(r); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+			wrsrc.Tag.Id: updated.MarshalToBinary(),
+		}); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error updating instance: %v", err))
+			return
+		}
+		webutils.WriteJson(w, updated)
+	case "duplicate":
+		dup := *inst
+		dup.Id = inst.nextFreeId(wrsrc)
+		if err := dup.ApplyForm(r); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+
+		name := r.FormValue("name")
+		if name == "" {
+			name = freeName(wrsrc.Wad, fmt.Sprintf("%s_%d", wrsrc.Name(), dup.Id))
+		} else if nodeNameUsed(wrsrc.Wad, name) {
+			webutils.WriteError(w, fmt.Errorf("Node with name '%s' already exists", name))
+			return
+		}
+		if err := utils.CheckStringBuffer(name, wad.TAG_NAME_SIZE, false); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Invalid name: %v", err))
+			return
+		}
+
+		if err := inst.Duplicate(wrsrc, name, &dup); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error duplicating instance: %v", err))
+			return
+		}
+		webutils.WriteJson(w, map[string]interface{}{"Name": name, "Instance": dup})
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
+	}
+}
@@ -0,0 +1,26 @@
+package inst
+
+import (
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+)
+
+func TestFreeName(t *testing.T) {
+	w := &wad.Wad{Tags: []wad.Tag{{Name: "INST"}, {Name: "INST_5"}, {Name: "INST_5_2"}, {Name: "SUB"}}}
+	for i := range w.Tags {
+		w.Nodes = append(w.Nodes, &wad.Node{Id: wad.NodeId(i), Tag: &w.Tags[i], Parent: wad.NODE_INVALID})
+	}
+	// nested node names are taken too
+	w.Nodes[3].Parent = 0
+
+	for base, expected := range map[string]string{
+		"INST_6": "INST_6",
+		"INST_5": "INST_5_3",
+		"SUB":    "SUB_2",
+	} {
+		if name := freeName(w, base); name != expected {
+			t.Errorf("Free name for '%s' is '%s', expected '%s'", base, name, expected)
+		}
+	}
+}
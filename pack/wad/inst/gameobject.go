@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 
 	"github.com/mogaika/god_of_war_browser/config"
 
@@ -46,6 +47,43 @@ func NewFromData(buf []byte) (*Instance, error) {
 	return inst, nil
 }
 
+// RotationQuat is same as gl-matrix quat.fromEuler used by viewer, but takes radians
+func (inst *Instance) RotationQuat() mgl32.Quat {
+	sx, cx := math.Sincos(float64(inst.Rotation[0]) / 2)
+	sy, cy := math.Sincos(float64(inst.Rotation[1]) / 2)
+	sz, cz := math.Sincos(float64(inst.Rotation[2]) / 2)
+	return mgl32.Quat{
+		W: float32(cx*cy*cz + sx*sy*sz),
+		V: mgl32.Vec3{
+			float32(sx*cy*cz - cx*sy*sz),
+			float32(cx*sy*cz + sx*cy*sz),
+			float32(cx*cy*sz - sx*sy*cz),
+		},
+	}
+}
+
+// Matrix is transformation of object applied by instance
+func (inst *Instance) Matrix() mgl32.Mat4 {
+	return mgl32.Translate3D(inst.Position1[0], inst.Position1[1], inst.Position1[2]).Mul4(inst.RotationQuat().Mat4())
+}
+
+func (inst *Instance) MarshalToBinary() []byte {
+	buf := make([]byte, FILE_SIZE)
+	binary.LittleEndian.PutUint32(buf[0x0:0x4], INSTANCE_MAGIC)
+	copy(buf[0x4:0x1c], utils.StringToBytesBuffer(inst.Object, 0x18, true))
+	binary.LittleEndian.PutUint16(buf[0x1c:0x1e], inst.Id)
+	binary.LittleEndian.PutUint16(buf[0x1e:0x20], inst.Params)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(buf[0x20+i*4:], math.Float32bits(inst.Position1[i]))
+		binary.LittleEndian.PutUint32(buf[0x30+i*4:], math.Float32bits(inst.Rotation[i]))
+		binary.LittleEndian.PutUint32(buf[0x40+i*4:], math.Float32bits(inst.Position2[i]))
+	}
+	for i, v := range inst.Unk {
+		binary.LittleEndian.PutUint32(buf[0x50+i*4:], v)
+	}
+	return buf
+}
+
 type Ajax struct {
 	Instance
 	Scripts []interface{}
@@ -0,0 +1,76 @@
+package light
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// ApplyForm updates light parameters present in request
+func (l *Light) ApplyForm(r *http.Request) error {
+	if flags := r.FormValue("flags"); flags != "" {
+		v, err := strconv.ParseUint(flags, 0, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid flags: %v", err)
+		}
+		l.Flags = uint32(v)
+	}
+
+	for _, vec := range []struct {
+		Name string
+		V    *mgl32.Vec4
+	}{{"position", &l.Position}, {"rotation", &l.Rotation}, {"color", &l.Color}} {
+		if s := r.FormValue(vec.Name); s != "" {
+			if err := utils.ParseVec4(s, vec.V); err != nil {
+				return fmt.Errorf("Invalid %s: %v", vec.Name, err)
+			}
+		}
+	}
+
+	for _, f := range []struct {
+		Name string
+		V    *float32
+	}{{"unk3c", &l.Unk3c}, {"unk40", &l.Unk40}, {"unk44", &l.Unk44}} {
+		if s := r.FormValue(f.Name); s != "" {
+			v, err := strconv.ParseFloat(s, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid %s: %v", f.Name, err)
+			}
+			*f.V = float32(v)
+		}
+	}
+	if s := r.FormValue("unk48"); s != "" {
+		v, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid unk48: %v", err)
+		}
+		l.Unk48 = uint32(v)
+	}
+	return nil
+}
+
+func (l *Light) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "update":
+		updated := *l
+		if err := updated.ApplyForm(r); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+			wrsrc.Tag.Id: updated.MarshalToBinary(),
+		}); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error updating light: %v", err))
+			return
+		}
+		webutils.WriteJson(w, updated)
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
+	}
+}
@@ -61,6 +61,39 @@ func (l *Light) FromWad(data []byte) error {
 	return nil
 }
 
+func (l *Light) TypeName() string {
+	switch l.Flags {
+	case 0:
+		return "ambient"
+	case 1:
+		return "point"
+	case 2, 6:
+		return "directional"
+	default:
+		return "unknown"
+	}
+}
+
+func (l *Light) MarshalToBinary() []byte {
+	buf := make([]byte, FILE_SIZE)
+	binary.LittleEndian.PutUint32(buf[0x00:], LIGHT_MAGIC)
+	binary.LittleEndian.PutUint32(buf[0x04:], l.Unk04)
+	binary.LittleEndian.PutUint32(buf[0x08:], l.Flags)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(buf[0x0c+i*4:], math.Float32bits(l.Position[i]))
+		binary.LittleEndian.PutUint32(buf[0x1c+i*4:], math.Float32bits(l.Rotation[i]))
+		binary.LittleEndian.PutUint32(buf[0x2c+i*4:], math.Float32bits(l.Color[i]))
+	}
+	binary.LittleEndian.PutUint32(buf[0x3c:], math.Float32bits(l.Unk3c))
+	binary.LittleEndian.PutUint32(buf[0x40:], math.Float32bits(l.Unk40))
+	binary.LittleEndian.PutUint32(buf[0x44:], math.Float32bits(l.Unk44))
+	binary.LittleEndian.PutUint32(buf[0x48:], l.Unk48)
+	binary.LittleEndian.PutUint32(buf[0x4c:], math.Float32bits(l.Unk4c))
+	binary.LittleEndian.PutUint32(buf[0x50:], math.Float32bits(l.Unk50))
+	binary.LittleEndian.PutUint32(buf[0x54:], math.Float32bits(l.Unk54))
+	return buf
+}
+
 func (l *Light) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return l, nil
 }
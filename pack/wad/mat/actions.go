@@ -0,0 +1,262 @@
+package mat
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_anm "github.com/mogaika/god_of_war_browser/pack/wad/anm"
+	file_txr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// blend modes and their bits of Flags[0], see ParseFlags
+var blendModes = map[string]uint32{
+	"none":      0,
+	"strange":   1 << 24,
+	"substract": 1 << 25,
+	"usual":     1 << 26,
+	"additive":  1 << 27,
+}
+
+const (
+	layerFlagFilterLinear      = 1 << 16
+	layerFlagDisableDepthWrite = 1 << 19
+	layerFlagsBlend            = 0xf << 24
+)
+
+func parseColor(s string, c *utils.ColorFloat, components int) error {
+	values, err := utils.ParseFloats(s, components)
+	if err != nil {
+		return err
+	}
+	copy(c[:], values)
+	return nil
+}
+
+func setFlag(v *uint32, flag uint32, set bool) {
+	if set {
+		*v |= flag
+	} else {
+		*v &^= flag
+	}
+}
+
+// checkTexture verifies that txr with name is reachable from material same way as in Marshal
+func checkTexture(wrsrc *wad.WadNodeRsrc, name string) error {
+	if err := utils.CheckStringBuffer(name, 24, true); err != nil {
+		return fmt.Errorf("Invalid texture name: %v", err)
+	}
+	n := wrsrc.Wad.GetNodeByName(name, wrsrc.Node.Id-1, false)
+	if n == nil {
+		return fmt.Errorf("Texture '%s' not found before material", name)
+	}
+	inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id)
+	if err != nil {
+		return fmt.Errorf("Error getting texture '%s': %v", name, err)
+	}
+	if _, ok := inst.(*file_txr.Texture); !ok {
+		return fmt.Errorf("'%s' is not a texture", name)
+	}
+	return nil
+}
+
+// animatedLayers returns layers referenced by texture animations of material sub group
+func animatedLayers(wrsrc *wad.WadNodeRsrc) map[int]string {
+	layers := make(map[int]string)
+	for _, id := range wrsrc.Node.SubGroupNodes {
+		n := wrsrc.Wad.GetNodeById(id)
+		inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		anims, ok := inst.(*file_anm.Animations)
+		if !ok {
+			continue
+		}
+		for _, dt := range anims.DataTypes {
+			if layer, ok := animatedLayer(dt); ok {
+				layers[layer] = n.Tag.Name
+			}
+		}
+	}
+	return layers
+}
+
+// animatedLayer returns layer changed by animation data type.
+// Texture sheet animations always change first layer (see gowAnimation.js)
+func animatedLayer(dt file_anm.AnimDatatype) (int, bool) {
+	switch dt.TypeId {
+	case file_anm.DATATYPE_TEXUREPOS:
+		if dt.Param1 != 0 {
+			return int(dt.Param1 & 0x7f), true
+		}
+	case file_anm.DATATYPE_TEXTURESHEET:
+		return 0, true
+	}
+	return 0, false
+}
+
+// checkLayerRemoval fails if animations reference removed layer or layers after it,
+// because animations address layers by index
+func checkLayerRemoval(animated map[int]string, iLayer int) error {
+	for layer, anim := range animated {
+		if layer == iLayer {
+			return fmt.Errorf("Layer %d is animated by '%s'", iLayer, anim)
+		} else if layer > iLayer {
+			return fmt.Errorf("Removing layer %d changes index of layer %d animated by '%s'", iLayer, layer, anim)
+		}
+	}
+	return nil
+}
+
+func formLayerIndex(mat *Material, r *http.Request) (int, error) {
+	s := r.FormValue("layer")
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i >= len(mat.Layers) {
+		return 0, fmt.Errorf("Invalid layer '%s'", s)
+	}
+	return i, nil
+}
+
+// ApplyForm updates layer parameters present in request
+func (l *Layer) ApplyForm(wrsrc *wad.WadNodeRsrc, r *http.Request) error {
+	if s := r.FormValue("flags"); s != "" {
+		parts := strings.Split(s, ",")
+		if len(parts) != 4 {
+			return fmt.Errorf("Flags '%s' must have 4 values", s)
+		}
+		for i, p := range parts {
+			v, err := strconv.ParseUint(strings.TrimSpace(p), 0, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid flags: %v", err)
+			}
+			l.Flags[i] = uint32(v)
+		}
+	}
+
+	if _, ok := r.Form["texture"]; ok {
+		texture := r.FormValue("texture")
+		if texture != "" {
+			if err := checkTexture(wrsrc, texture); err != nil {
+				return err
+			}
+		}
+		l.Texture = texture
+		setFlag(&l.Flags[0], LAYER_FLAG_TEXTURE_PRESENTED, texture != "")
+	}
+
+	if s := r.FormValue("blend"); s != "" {
+		mode, ok := blendModes[s]
+		if !ok {
+			return fmt.Errorf("Unknown blend mode '%s'", s)
+		}
+		l.Flags[0] = l.Flags[0]&^layerFlagsBlend | mode
+	}
+
+	switch s := r.FormValue("filter"); s {
+	case "":
+	case "linear", "nearest":
+		setFlag(&l.Flags[0], layerFlagFilterLinear, s == "linear")
+	default:
+		return fmt.Errorf("Unknown filter '%s'", s)
+	}
+
+	for _, f := range []struct {
+		Name  string
+		Flags *uint32
+		Flag  uint32
+	}{
+		{"disabledepthwrite", &l.Flags[0], layerFlagDisableDepthWrite},
+		{"animuv", &l.GameFlags, 1},
+		{"animother", &l.GameFlags, 2},
+	} {
+		if s := r.FormValue(f.Name); s != "" {
+			v, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("Invalid %s: %v", f.Name, err)
+			}
+			setFlag(f.Flags, f.Flag, v)
+		}
+	}
+
+	if s := r.FormValue("blendcolor"); s != "" {
+		if err := parseColor(s, &l.BlendColor, 4); err != nil {
+			return fmt.Errorf("Invalid blendcolor: %v", err)
+		}
+	}
+
+	return l.ParseFlags()
+}
+
+func (mat *Material) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	updated := *mat
+	updated.Layers = append([]Layer{}, mat.Layers...)
+
+	switch action {
+	case "update":
+		if s := r.FormValue("color"); s != "" {
+			if err := parseColor(s, &updated.Color, 3); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Invalid color: %v", err))
+				return
+			}
+		}
+		if r.FormValue("layer") != "" {
+			iLayer, err := formLayerIndex(&updated, r)
+			if err != nil {
+				webutils.WriteError(w, err)
+				return
+			}
+			if err := updated.Layers[iLayer].ApplyForm(wrsrc, r); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Layer %d: %v", iLayer, err))
+				return
+			}
+		}
+	case "addlayer":
+		// layer is appended, so indexes used by animations are kept.
+		// copy of layer if provided, otherwise layer without texture
+		layer := Layer{BlendColor: utils.ColorFloat{1, 1, 1, 1}}
+		if r.FormValue("layer") != "" {
+			iLayer, err := formLayerIndex(&updated, r)
+			if err != nil {
+				webutils.WriteError(w, err)
+				return
+			}
+			layer = updated.Layers[iLayer]
+		}
+		if err := layer.ApplyForm(wrsrc, r); err != nil {
+			webutils.WriteError(w, fmt.Errorf("New layer: %v", err))
+			return
+		}
+		updated.Layers = append(updated.Layers, layer)
+	case "removelayer":
+		iLayer, err := formLayerIndex(&updated, r)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if len(updated.Layers) == 1 {
+			webutils.WriteError(w, fmt.Errorf("Cannot remove last layer"))
+			return
+		}
+		if err := checkLayerRemoval(animatedLayers(wrsrc), iLayer); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		updated.Layers = append(updated.Layers[:iLayer], updated.Layers[iLayer+1:]...)
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
+		return
+	}
+
+	if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+		wrsrc.Tag.Id: updated.MarshalToBinary(),
+	}); err != nil {
+		webutils.WriteError(w, fmt.Errorf("Error updating material: %v", err))
+		return
+	}
+	webutils.WriteJson(w, &updated)
+}
@@ -49,6 +49,10 @@ const (
 type Material struct {
 	Color  utils.ColorFloat
 	Layers []Layer
+
+	// unknown fields of header and data after layers, kept for marshaling
+	header []byte
+	tail   []byte
 }
 
 const MAT_MAGIC = 0x00000008
@@ -91,6 +95,10 @@ func NewFromData(buf []byte) (*Material, error) {
 
 	mat := &Material{
 		Layers: make([]Layer, binary.LittleEndian.Uint32(buf[0x34:0x38])),
+		header: buf[:HEADER_SIZE],
+	}
+	if end := HEADER_SIZE + len(mat.Layers)*LAYER_SIZE; end < len(buf) {
+		mat.tail = buf[end:]
 	}
 
 	mat.Color = utils.NewColorFloat([]float32{
@@ -130,6 +138,32 @@ func NewFromData(buf []byte) (*Material, error) {
 	return mat, nil
 }
 
+func (mat *Material) MarshalToBinary() []byte {
+	buf := make([]byte, HEADER_SIZE+len(mat.Layers)*LAYER_SIZE+len(mat.tail))
+	copy(buf, mat.header)
+	binary.LittleEndian.PutUint32(buf[0:4], MAT_MAGIC)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint32(buf[8+i*4:], math.Float32bits(mat.Color[i]))
+	}
+	binary.LittleEndian.PutUint32(buf[0x34:0x38], uint32(len(mat.Layers)))
+
+	for iTex := range mat.Layers {
+		l := &mat.Layers[iTex]
+		tbuf := buf[HEADER_SIZE+iTex*LAYER_SIZE:]
+		for i, f := range l.Flags {
+			binary.LittleEndian.PutUint32(tbuf[i*4:], f)
+		}
+		copy(tbuf[16:40], utils.StringToBytesBuffer(l.Texture, 24, true))
+		for i, f := range l.BlendColor {
+			binary.LittleEndian.PutUint32(tbuf[40+i*4:], math.Float32bits(f))
+		}
+		binary.LittleEndian.PutUint32(tbuf[56:60], math.Float32bits(l.FloatUnk))
+		binary.LittleEndian.PutUint32(tbuf[60:64], l.GameFlags)
+	}
+	copy(buf[HEADER_SIZE+len(mat.Layers)*LAYER_SIZE:], mat.tail)
+	return buf
+}
+
 type Ajax struct {
 	Mat             *Material
 	Textures        map[int]interface{}
@@ -0,0 +1,77 @@
+package mat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	file_anm "github.com/mogaika/god_of_war_browser/pack/wad/anm"
+)
+
+func testMaterial() []byte {
+	buf := make([]byte, HEADER_SIZE+2*LAYER_SIZE+4)
+	binary.LittleEndian.PutUint32(buf, MAT_MAGIC)
+	buf[5] = 0x77 // unknown header field
+	binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(0.5))
+	binary.LittleEndian.PutUint32(buf[0x34:], 2)
+	for i, flags := range []uint32{0x04010080, 0x08080000} {
+		l := buf[HEADER_SIZE+i*LAYER_SIZE:]
+		binary.LittleEndian.PutUint32(l, flags)
+		binary.LittleEndian.PutUint32(l[4:], 0x1234)
+		if i == 0 {
+			copy(l[16:], "TXR_test")
+		}
+		for c := 0; c < 4; c++ {
+			binary.LittleEndian.PutUint32(l[40+c*4:], math.Float32bits(float32(c)/4))
+		}
+		binary.LittleEndian.PutUint32(l[56:], math.Float32bits(2))
+		binary.LittleEndian.PutUint32(l[60:], uint32(i+1))
+	}
+	buf[len(buf)-1] = 9 // data after layers
+	return buf
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	data := testMaterial()
+	mat, err := NewFromData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mat.Layers[0].ParsedFlags.HaveTexture || !mat.Layers[0].ParsedFlags.RenderingUsual ||
+		!mat.Layers[1].ParsedFlags.RenderingAdditive || !mat.Layers[1].ParsedFlags.DisableDepthWrite {
+		t.Errorf("Invalid parsed flags %+v %+v", mat.Layers[0].ParsedFlags, mat.Layers[1].ParsedFlags)
+	}
+	if out := mat.MarshalToBinary(); !bytes.Equal(out, data) {
+		t.Errorf("Marshaled material differs from source:\n%x\n%x", out, data)
+	}
+}
+
+func TestCheckLayerRemoval(t *testing.T) {
+	animated := map[int]string{1: "ANM_uv"}
+	if err := checkLayerRemoval(animated, 2); err != nil {
+		t.Errorf("Removal of layer after animated must be allowed: %v", err)
+	}
+	for _, iLayer := range []int{0, 1} {
+		if err := checkLayerRemoval(animated, iLayer); err == nil {
+			t.Errorf("Removal of layer %d must be rejected", iLayer)
+		}
+	}
+}
+
+func TestAnimatedLayer(t *testing.T) {
+	for _, c := range []struct {
+		dt    file_anm.AnimDatatype
+		layer int
+		ok    bool
+	}{
+		{file_anm.AnimDatatype{TypeId: file_anm.DATATYPE_TEXUREPOS, Param1: 0x81}, 1, true},
+		{file_anm.AnimDatatype{TypeId: file_anm.DATATYPE_TEXUREPOS}, 0, false},
+		{file_anm.AnimDatatype{TypeId: file_anm.DATATYPE_TEXTURESHEET, Param1: 3}, 0, true},
+		{file_anm.AnimDatatype{TypeId: file_anm.DATATYPE_MATERIAL, Param1: 1}, 0, false},
+	} {
+		if layer, ok := animatedLayer(c.dt); layer != c.layer || ok != c.ok {
+			t.Errorf("%+v: got layer %d %v", c.dt, layer, ok)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package mdl
+
+import (
+	"fmt"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	fmat "github.com/mogaika/god_of_war_browser/pack/wad/mat"
+	fmesh "github.com/mogaika/god_of_war_browser/pack/wad/mesh"
+	ftxr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+func gltfLayerMaterial(doc *gltf.Document, name string, mat *fmat.Material, iLayer int, txr *ftxr.Ajax) gltf.Material {
+	layer := &mat.Layers[iLayer]
+
+	var color [4]float32
+	for i := range color {
+		color[i] = mat.Color[i] * layer.BlendColor[i]
+		if color[i] > 1 {
+			color[i] = 1
+		} else if color[i] < 0 {
+			color[i] = 0
+		}
+	}
+
+	gm := gltf.Material{
+		Name: fmt.Sprintf("%s_l%d", name, iLayer),
+		PbrMetallicRoughness: &gltf.PbrMetallicRoughness{
+			BaseColorFactor: &color,
+			MetallicFactor:  0,
+			RoughnessFactor: 1,
+		},
+		AlphaMode:   "OPAQUE",
+		DoubleSided: true,
+	}
+
+	blend := "opaque"
+	switch {
+	case layer.ParsedFlags.RenderingUsual:
+		blend = "usual"
+		gm.AlphaMode = "BLEND"
+	case layer.ParsedFlags.RenderingAdditive:
+		blend = "additive"
+		gm.AlphaMode = "BLEND"
+	case layer.ParsedFlags.RenderingSubstract:
+		blend = "substract"
+		gm.AlphaMode = "BLEND"
+	case layer.ParsedFlags.RenderingStrangeBlended:
+		blend = "strange"
+		gm.AlphaMode = "BLEND"
+	}
+	// gltf have no additive or substract blending, so keep original mode for importers that care
+	gm.Extras = map[string]interface{}{
+		"blend":             blend,
+		"disableDepthWrite": layer.ParsedFlags.DisableDepthWrite,
+		"texture":           layer.Texture,
+	}
+
+	if txr != nil && len(txr.Images) != 0 {
+		image, ok := doc.FindImage(layer.Texture)
+		if !ok {
+			image = doc.AddImagePNG(layer.Texture, txr.Images[0].Image)
+		}
+		filter := gltf.FILTER_NEAREST
+		if layer.ParsedFlags.FilterLinear {
+			filter = gltf.FILTER_LINEAR
+		}
+		sampler := doc.AddSampler(gltf.Sampler{
+			MagFilter: filter,
+			MinFilter: filter,
+			WrapS:     gltf.WRAP_REPEAT,
+			WrapT:     gltf.WRAP_REPEAT,
+		})
+		gm.PbrMetallicRoughness.BaseColorTexture = &gltf.TextureInfo{
+			Index: doc.AddTexture(layer.Texture, image, sampler),
+		}
+	}
+
+	return gm
+}
+
+// GLTFModel describes model resources added to gltf document
+type GLTFModel struct {
+	Meshes    []*fmesh.GLTFMeshes
+	Materials fmesh.GLTFMaterialResolver
+	// node of material per mesh material id
+	MaterialNodes []*wad.Node
+}
+
+// ExportGLTFMaterials adds every layer of model materials as separate gltf material
+func (mdl *Model) ExportGLTFMaterials(wrsrc *wad.WadNodeRsrc, doc *gltf.Document) (fmesh.GLTFMaterialResolver, []*wad.Node, error) {
+	materials := make([][]int, 0)
+	nodes := make([]*wad.Node, 0)
+
+	for _, id := range wrsrc.Node.SubGroupNodes {
+		node := wrsrc.Wad.GetNodeById(id)
+		inst, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id)
+		if err != nil {
+			continue
+		}
+		mat, ok := inst.(*fmat.Material)
+		if !ok {
+			continue
+		}
+
+		marshaled, err := mat.Marshal(wrsrc.Wad.GetNodeResourceByNodeId(node.Id))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error marshaling material '%s': %v", node.Tag.Name, err)
+		}
+		textures := marshaled.(fmat.Ajax).Textures
+
+		layers := make([]int, len(mat.Layers))
+		for iLayer := range mat.Layers {
+			var txr *ftxr.Ajax
+			if t, ok := textures[iLayer]; ok && t != nil {
+				txr = t.(*ftxr.Ajax)
+			}
+			layers[iLayer] = doc.AddMaterial(gltfLayerMaterial(doc, node.Tag.Name, mat, iLayer, txr))
+		}
+		materials = append(materials, layers)
+		nodes = append(nodes, node)
+	}
+
+	return func(materialId uint16, layer int) *int {
+		if int(materialId) < len(materials) && layer < len(materials[materialId]) {
+			return gltf.Index(materials[materialId][layer])
+		}
+		return nil
+	}, nodes, nil
+}
+
+// ExportGLTF adds materials and meshes of model to gltf document
+func (mdl *Model) ExportGLTF(wrsrc *wad.WadNodeRsrc, doc *gltf.Document) (*GLTFModel, error) {
+	materials, materialNodes, err := mdl.ExportGLTFMaterials(wrsrc, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GLTFModel{
+		Meshes:        make([]*fmesh.GLTFMeshes, 0),
+		Materials:     materials,
+		MaterialNodes: materialNodes,
+	}
+	for _, id := range wrsrc.Node.SubGroupNodes {
+		node := wrsrc.Wad.GetNodeById(id)
+		if inst, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id); err == nil {
+			if mesh, ok := inst.(*fmesh.Mesh); ok {
+				gm, err := mesh.ExportGLTF(doc, node.Tag.Name, materials)
+				if err != nil {
+					return nil, fmt.Errorf("Error exporting mesh '%s': %v", node.Tag.Name, err)
+				}
+				result.Meshes = append(result.Meshes, gm)
+			}
+		}
+	}
+	return result, nil
+}
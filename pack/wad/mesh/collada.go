@@ -1,10 +1,581 @@
 package mesh
 
-import "github.com/mogaika/go-collada"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
-func NewGOW1ps2MeshFromCollada(c *collada.Collada) (m *Mesh, err error) {
-	m = &Mesh{}
+	"github.com/mogaika/go-collada"
 
-	return
+	"github.com/mogaika/god_of_war_browser/pack/wad/mesh/dmacompiler"
+)
 
+// max joints addressed by vertex meta block (4 bit index)
+const maxJointsPerObject = 16
+
+type ColladaImportOptions struct {
+	// joint name => object joint id. Names not found here parsed as "<name>_<id>" or "<id>"
+	JointIds map[string]uint32
+	// material name => material index inside model. If nil, only one material allowed
+	MaterialIds map[string]uint16
+	// original mesh. Headers and vu program address copied from it
+	Template *Mesh
+}
+
+type colladaVertex struct {
+	v     dmacompiler.Vertex
+	joint uint32
+}
+
+type colladaTriangles struct {
+	material  string
+	format    dmacompiler.Format
+	skinned   bool
+	triangles [][3]colladaVertex
+}
+
+type colladaSourceMap map[string]*collada.Source
+
+func colladaUriId(uri collada.Uri) string {
+	return strings.TrimPrefix(string(uri), "#")
+}
+
+func (sm colladaSourceMap) floats(uri collada.Uri) ([]float32, int, error) {
+	src, ok := sm[colladaUriId(uri)]
+	if !ok || src.FloatArray == nil {
+		return nil, 0, fmt.Errorf("Cannot find float source '%s'", uri)
+	}
+	stride := int(src.TechniqueCommon.Accessor.Stride)
+	if stride == 0 {
+		stride = 1
+	}
+	return src.FloatArray.F32(), stride, nil
+}
+
+func (sm colladaSourceMap) add(sources []*collada.Source) {
+	for _, src := range sources {
+		sm[src.Id] = src
+	}
+}
+
+func colladaJointId(name string, opts *ColladaImportOptions) (uint32, error) {
+	if id, ok := opts.JointIds[name]; ok {
+		return id, nil
+	}
+	num := name
+	if i := strings.LastIndexAny(name, "_-."); i >= 0 {
+		num = name[i+1:]
+	}
+	id, err := strconv.ParseUint(num, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot resolve joint '%s': not in skeleton and have no numeric suffix", name)
+	}
+	return uint32(id), nil
+}
+
+// colladaMaterialId resolves material symbol, exporters usually add "-material" suffix to name
+func colladaMaterialId(symbol string, ids map[string]uint16) (uint16, bool) {
+	if id, ok := ids[symbol]; ok {
+		return id, true
+	}
+	id, ok := ids[strings.TrimSuffix(symbol, "-material")]
+	return id, ok
+}
+
+// colladaMaterialIds resolves every used material symbol. Without model ids only one material allowed
+func colladaMaterialIds(materials []string, ids map[string]uint16) (map[string]uint16, error) {
+	result := make(map[string]uint16)
+	for _, material := range materials {
+		if _, ok := result[material]; ok {
+			continue
+		}
+		if ids == nil {
+			if len(result) != 0 {
+				return nil, fmt.Errorf("Collada uses several materials, but material ids of model are unknown")
+			}
+			result[material] = 0
+		} else if id, ok := colladaMaterialId(material, ids); ok {
+			result[material] = id
+		} else {
+			return nil, fmt.Errorf("Unknown material '%s'", material)
+		}
+	}
+	return result, nil
+}
+
+// readColladaSkin returns joint id for every position index of geometry (using joint with max weight)
+func readColladaSkin(skin *collada.Skin, opts *ColladaImportOptions) ([]uint32, error) {
+	sm := make(colladaSourceMap)
+	sm.add(skin.HasSources.Source)
+
+	var jointNames []string
+	for _, input := range skin.Joints.Input {
+		if input.Semantic == "JOINT" {
+			if src, ok := sm[colladaUriId(input.Source)]; ok && src.NameArray != nil {
+				jointNames = src.NameArray.N()
+			}
+		}
+	}
+	if jointNames == nil {
+		return nil, fmt.Errorf("Cannot find skin joints names")
+	}
+
+	jointIds := make([]uint32, len(jointNames))
+	for i, name := range jointNames {
+		id, err := colladaJointId(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		jointIds[i] = id
+	}
+
+	vw := &skin.VertexWeights
+	jointOffset, weightOffset, stride := -1, -1, 0
+	var weights []float32
+	for _, input := range vw.Input {
+		switch input.Semantic {
+		case "JOINT":
+			jointOffset = int(input.Offset)
+		case "WEIGHT":
+			weightOffset = int(input.Offset)
+			var err error
+			if weights, _, err = sm.floats(input.Source); err != nil {
+				return nil, err
+			}
+		}
+		if int(input.Offset)+1 > stride {
+			stride = int(input.Offset) + 1
+		}
+	}
+	if jointOffset < 0 || weightOffset < 0 || vw.VCount == nil || vw.V == nil {
+		return nil, fmt.Errorf("Incomplete skin vertex weights")
+	}
+
+	vcount := vw.VCount.I()
+	v := vw.V.I()
+	result := make([]uint32, len(vcount))
+	pos := 0
+	for iVertex, count := range vcount {
+		bestWeight := float32(-1)
+		for i := 0; i < count; i++ {
+			base := (pos + i) * stride
+			if base+stride > len(v) {
+				return nil, fmt.Errorf("Skin weights array too short")
+			}
+			joint, weight := v[base+jointOffset], weights[v[base+weightOffset]]
+			if weight > bestWeight && joint >= 0 && joint < len(jointIds) {
+				bestWeight = weight
+				result[iVertex] = jointIds[joint]
+			}
+		}
+		pos += count
+	}
+	return result, nil
+}
+
+type colladaPrimitive struct {
+	material string
+	inputs   []*collada.InputShared
+	vcount   []int
+	p        []int
+}
+
+func readColladaMeshPrimitives(cm *collada.Mesh) []colladaPrimitive {
+	prims := make([]colladaPrimitive, 0)
+	for _, t := range cm.Triangles {
+		if t.P == nil {
+			continue
+		}
+		prims = append(prims, colladaPrimitive{material: t.Material, inputs: t.Input, p: t.P.I()})
+	}
+	for _, pl := range cm.Polylist {
+		if pl.P == nil || pl.VCount == nil {
+			continue
+		}
+		prims = append(prims, colladaPrimitive{material: pl.Material, inputs: pl.Input, vcount: pl.VCount.I(), p: pl.P.I()})
+	}
+	return prims
+}
+
+func readColladaGeometry(geom *collada.Geometry, skinJoints []uint32) ([]*colladaTriangles, error) {
+	cm := geom.Mesh
+	sm := make(colladaSourceMap)
+	sm.add(cm.Source)
+
+	// inputs of <vertices> are referenced by VERTEX semantic
+	var positions, vnormals []float32
+	var posStride, vnormStride int
+	for _, input := range cm.Vertices.Input {
+		var err error
+		switch input.Semantic {
+		case "POSITION":
+			positions, posStride, err = sm.floats(input.Source)
+		case "NORMAL":
+			vnormals, vnormStride, err = sm.floats(input.Source)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if positions == nil {
+		return nil, fmt.Errorf("Geometry '%s' have no positions", geom.Id)
+	}
+
+	result := make([]*colladaTriangles, 0)
+	for _, prim := range readColladaMeshPrimitives(cm) {
+		ct := &colladaTriangles{material: prim.material, skinned: skinJoints != nil}
+
+		stride := 0
+		vertexOffset, normalOffset, uvOffset, colorOffset := -1, -1, -1, -1
+		var normals, uvs, colors []float32
+		var normStride, uvStride, colorStride int
+		for _, input := range prim.inputs {
+			var err error
+			switch input.Semantic {
+			case "VERTEX":
+				vertexOffset = int(input.Offset)
+			case "NORMAL":
+				normalOffset = int(input.Offset)
+				normals, normStride, err = sm.floats(input.Source)
+			case "TEXCOORD":
+				if uvOffset < 0 || input.Set == 0 {
+					uvOffset = int(input.Offset)
+					uvs, uvStride, err = sm.floats(input.Source)
+				}
+			case "COLOR":
+				colorOffset = int(input.Offset)
+				colors, colorStride, err = sm.floats(input.Source)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if int(input.Offset)+1 > stride {
+				stride = int(input.Offset) + 1
+			}
+		}
+		if vertexOffset < 0 {
+			return nil, fmt.Errorf("Geometry '%s' primitive without VERTEX input", geom.Id)
+		}
+		ct.format.HasUV = uvOffset >= 0
+		ct.format.HasNormals = normalOffset >= 0 || vnormals != nil
+		ct.format.HasColors = true
+
+		getVertex := func(idx int) (colladaVertex, error) {
+			var cv colladaVertex
+			base := idx * stride
+			if base+stride > len(prim.p) {
+				return cv, fmt.Errorf("Index array too short")
+			}
+			iPos := prim.p[base+vertexOffset]
+			if (iPos+1)*posStride > len(positions) || posStride < 3 {
+				return cv, fmt.Errorf("Position index %d out of range", iPos)
+			}
+			cv.v.X, cv.v.Y, cv.v.Z = positions[iPos*posStride], positions[iPos*posStride+1], positions[iPos*posStride+2]
+			if skinJoints != nil && iPos < len(skinJoints) {
+				cv.joint = skinJoints[iPos]
+			}
+
+			if normalOffset >= 0 {
+				i := prim.p[base+normalOffset] * normStride
+				cv.v.NX, cv.v.NY, cv.v.NZ = normals[i], normals[i+1], normals[i+2]
+			} else if vnormals != nil {
+				i := iPos * vnormStride
+				cv.v.NX, cv.v.NY, cv.v.NZ = vnormals[i], vnormals[i+1], vnormals[i+2]
+			}
+			if uvOffset >= 0 {
+				i := prim.p[base+uvOffset] * uvStride
+				// collada origin is bottom left
+				cv.v.U, cv.v.V = uvs[i], 1.0-uvs[i+1]
+			}
+
+			cv.v.R, cv.v.G, cv.v.B, cv.v.A = 0x80, 0x80, 0x80, 0x80
+			if colorOffset >= 0 {
+				i := prim.p[base+colorOffset] * colorStride
+				toPs2 := func(f float32) uint8 {
+					if f >= 1.0 {
+						return 0x80
+					} else if f <= 0 {
+						return 0
+					}
+					return uint8(f * 0x80)
+				}
+				cv.v.R, cv.v.G, cv.v.B = toPs2(colors[i]), toPs2(colors[i+1]), toPs2(colors[i+2])
+				if colorStride > 3 {
+					cv.v.A = toPs2(colors[i+3])
+				}
+			}
+			return cv, nil
+		}
+
+		vcount := prim.vcount
+		if vcount == nil {
+			vcount = make([]int, len(prim.p)/stride/3)
+			for i := range vcount {
+				vcount[i] = 3
+			}
+		}
+
+		idx := 0
+		for _, count := range vcount {
+			poly := make([]colladaVertex, count)
+			for i := range poly {
+				var err error
+				if poly[i], err = getVertex(idx + i); err != nil {
+					return nil, fmt.Errorf("Geometry '%s': %v", geom.Id, err)
+				}
+			}
+			// triangle fan
+			for i := 2; i < count; i++ {
+				ct.triangles = append(ct.triangles, [3]colladaVertex{poly[0], poly[i-1], poly[i]})
+			}
+			idx += count
+		}
+		result = append(result, ct)
+	}
+	return result, nil
+}
+
+func readCollada(c *collada.Collada, opts *ColladaImportOptions) ([]*colladaTriangles, error) {
+	skins := make(map[string]*collada.Skin)
+	for _, lib := range c.LibraryControllers {
+		for _, ctrl := range lib.Controller {
+			if ctrl.Skin != nil {
+				skins[colladaUriId(ctrl.Skin.Source)] = ctrl.Skin
+			}
+		}
+	}
+
+	result := make([]*colladaTriangles, 0)
+	for _, lib := range c.LibraryGeometries {
+		for _, geom := range lib.Geometry {
+			if geom.Mesh == nil {
+				continue
+			}
+			var skinJoints []uint32
+			if skin, ok := skins[geom.Id]; ok {
+				var err error
+				if skinJoints, err = readColladaSkin(skin, opts); err != nil {
+					return nil, fmt.Errorf("Error reading skin of '%s': %v", geom.Id, err)
+				}
+			}
+			triangles, err := readColladaGeometry(geom, skinJoints)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, triangles...)
+		}
+	}
+	return result, nil
+}
+
+// splitByJoints divides triangles into groups referencing at most maxJointsPerObject joints
+func splitByJoints(triangles [][3]colladaVertex) ([][][3]colladaVertex, [][]uint32) {
+	groups := make([][][3]colladaVertex, 0)
+	mappers := make([][]uint32, 0)
+
+	jointIndex := func(joints []uint32, id uint32) int {
+		for i, j := range joints {
+			if j == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var current [][3]colladaVertex
+	var joints []uint32
+	for _, tri := range triangles {
+		newJoints := make([]uint32, 0, 3)
+		for _, v := range tri {
+			if jointIndex(joints, v.joint) < 0 && jointIndex(newJoints, v.joint) < 0 {
+				newJoints = append(newJoints, v.joint)
+			}
+		}
+		if len(joints)+len(newJoints) > maxJointsPerObject {
+			groups = append(groups, current)
+			mappers = append(mappers, joints)
+			current, joints = nil, newJoints
+		} else {
+			joints = append(joints, newJoints...)
+		}
+		current = append(current, tri)
+	}
+	if len(current) != 0 {
+		groups = append(groups, current)
+		mappers = append(mappers, joints)
+	}
+	return groups, mappers
+}
+
+// buildStrips deduplicates vertices and converts triangles to strips.
+// Vertex BoneId is index in joints mapper
+func buildStrips(triangles [][3]colladaVertex, joints []uint32) ([][]dmacompiler.Vertex, int) {
+	vertices := make([]dmacompiler.Vertex, 0)
+	vertexIndex := make(map[dmacompiler.Vertex]int)
+	indexes := make([][3]int, len(triangles))
+
+	for iTri, tri := range triangles {
+		for i, cv := range tri {
+			v := cv.v
+			for iJoint, j := range joints {
+				if j == cv.joint {
+					v.BoneId = iJoint
+				}
+			}
+			idx, ok := vertexIndex[v]
+			if !ok {
+				idx = len(vertices)
+				vertexIndex[v] = idx
+				vertices = append(vertices, v)
+			}
+			indexes[iTri][i] = idx
+		}
+	}
+
+	strips := make([][]dmacompiler.Vertex, 0)
+	for _, strip := range dmacompiler.Stripify(indexes) {
+		vs := make([]dmacompiler.Vertex, len(strip))
+		for i, idx := range strip {
+			vs[i] = vertices[idx]
+		}
+		strips = append(strips, vs)
+	}
+	return strips, len(vertices)
+}
+
+func (o *Object) compileFromCompiled(c *dmacompiler.Compiled, jointMapper []uint32) {
+	o.TextureLayersCount = 1
+	o.InstancesCount = 1
+	o.DmaTagsCountPerPacket = uint32(c.DmaTagsCount())
+	o.NextFreeVUBufferId = uint16(c.NextFreeBuffer)
+
+	dmaSize := uint32(c.DmaTagsCount() * 0x10)
+	jointMapSize := uint32(len(jointMapper) * 4)
+	if pad := jointMapSize % 0x10; pad != 0 {
+		jointMapSize += 0x10 - pad
+	}
+
+	programs := make([]byte, 0)
+	for _, p := range c.Programs {
+		programs = append(programs, p...)
+	}
+
+	// dma addresses are relative to object start
+	raw := make([]byte, 0, dmaSize+jointMapSize+uint32(len(programs)))
+	raw = append(raw, c.DmaChain(OBJECT_GOW1_HEADER_SIZE+dmaSize+jointMapSize)...)
+	raw = append(raw, make([]byte, jointMapSize)...)
+	raw = append(raw, programs...)
+	o.RawDmaAndJointsData = raw
+
+	o.JointMapElementsCount = uint16(len(jointMapper))
+	if len(jointMapper) != 0 {
+		o.JointMappers = [][]uint32{jointMapper}
+	} else {
+		o.JointMappers = nil
+	}
+}
+
+// NewGOW1ps2MeshFromCollada compiles collada geometries into mesh with one part and group.
+// Every material (and every 16 joints inside material) become separate object
+func NewGOW1ps2MeshFromCollada(c *collada.Collada, opts *ColladaImportOptions) (*Mesh, error) {
+	if opts == nil {
+		opts = &ColladaImportOptions{}
+	}
+
+	trianglesSets, err := readCollada(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge sets of same material and format
+	type setKey struct {
+		material string
+		format   dmacompiler.Format
+		skinned  bool
+	}
+	merged := make(map[setKey]*colladaTriangles)
+	keys := make([]setKey, 0)
+	for _, ts := range trianglesSets {
+		key := setKey{ts.material, ts.format, ts.skinned}
+		if m, ok := merged[key]; ok {
+			m.triangles = append(m.triangles, ts.triangles...)
+		} else {
+			merged[key] = ts
+			keys = append(keys, key)
+		}
+	}
+
+	materials := make([]string, len(keys))
+	for i, key := range keys {
+		materials[i] = key.material
+	}
+	materialIds, err := colladaMaterialIds(materials, opts.MaterialIds)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return materialIds[keys[i].material] < materialIds[keys[j].material]
+	})
+
+	m := &Mesh{}
+	part := Part{Unk00: 1}
+	group := Group{HideDistance: 1000000.0}
+	var templateObject *Object
+	if t := opts.Template; t != nil {
+		m.Vectors = t.Vectors
+		m.Unk0c, m.Unk10, m.Unk14 = t.Unk0c, t.Unk10, t.Unk14
+		m.Flags0x20, m.NameOfRootJoint = t.Flags0x20, t.NameOfRootJoint
+		m.Unk28, m.Unk2c, m.Unk30, m.BaseBoneIndex = t.Unk28, t.Unk2c, t.Unk30, t.BaseBoneIndex
+		if len(t.Parts) != 0 {
+			part.Unk00, part.JointId = t.Parts[0].Unk00, t.Parts[0].JointId
+			if len(t.Parts[0].Groups) != 0 {
+				group.HideDistance = t.Parts[0].Groups[0].HideDistance
+				if len(t.Parts[0].Groups[0].Objects) != 0 {
+					templateObject = &t.Parts[0].Groups[0].Objects[0]
+				}
+			}
+		}
+	}
+
+	for _, key := range keys {
+		materialId := materialIds[key.material]
+
+		triangleGroups, mappers := splitByJoints(merged[key].triangles)
+		for iGroup, triangles := range triangleGroups {
+			strips, sourceVertices := buildStrips(triangles, mappers[iGroup])
+
+			o := Object{Type: 0x1d, MaterialId: materialId, SourceVerticesCount: uint16(sourceVertices)}
+			var mscalAddr uint16
+			if templateObject != nil {
+				o.Type, o.Unk02 = templateObject.Type, templateObject.Unk02
+				o.Flags, o.FlagsMask = templateObject.Flags, templateObject.FlagsMask
+				o.Unk19, o.Unk1c = templateObject.Unk19, templateObject.Unk1c
+				mscalAddr = templateObject.microProgramAddr
+			} else if key.skinned {
+				o.Type = 0xe
+			}
+
+			compiled, err := dmacompiler.Compile(strips, key.format, mscalAddr)
+			if err != nil {
+				return nil, fmt.Errorf("Error compiling material '%s': %v", key.material, err)
+			}
+			mapper := mappers[iGroup]
+			if !key.skinned {
+				mapper = nil
+			}
+			o.compileFromCompiled(compiled, mapper)
+			group.Objects = append(group.Objects, o)
+		}
+	}
+
+	part.Groups = []Group{group}
+	m.Parts = []Part{part}
+
+	// reparse, so packets are filled and stream verified by parser
+	result := &Mesh{}
+	if err := result.parseGow1(m.MarshalBuffer().Bytes(), nil); err != nil {
+		return nil, fmt.Errorf("Compiled mesh verification failed: %v", err)
+	}
+	return result, nil
 }
@@ -0,0 +1,29 @@
+package mesh
+
+import (
+	"testing"
+)
+
+func TestColladaMaterialIds(t *testing.T) {
+	materials := []string{"matB-material", "matA-material", "matB-material"}
+
+	if _, err := colladaMaterialIds(materials, nil); err == nil {
+		t.Errorf("Several materials accepted without material ids of model")
+	}
+	if _, err := colladaMaterialIds(materials, map[string]uint16{"matA": 0}); err == nil {
+		t.Errorf("Unknown material accepted")
+	}
+
+	ids, err := colladaMaterialIds(materials, map[string]uint16{"matA": 0, "matB": 1, "matB-material": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids["matA-material"] != 0 || ids["matB-material"] != 2 {
+		t.Errorf("Unexpected ids %v", ids)
+	}
+
+	ids, err = colladaMaterialIds([]string{"single", "single"}, nil)
+	if err != nil || len(ids) != 1 || ids["single"] != 0 {
+		t.Errorf("Single material: %v %v", ids, err)
+	}
+}
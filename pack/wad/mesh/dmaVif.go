@@ -5,15 +5,16 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/mogaika/god_of_war_browser/pack/wad/mesh/dmacompiler"
 	"github.com/mogaika/god_of_war_browser/ps2/dma"
 	"github.com/mogaika/god_of_war_browser/ps2/vif"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
-var unpackBuffersBases = []uint32{0, 0x155, 0x2ab}
+var unpackBuffersBases = dmacompiler.UnpackBuffersBases
 
-const GSFixedPoint8 = 16.0
-const GSFixedPoint24 = 4096.0
+const GSFixedPoint8 = dmacompiler.GSFixedPoint8
+const GSFixedPoint24 = dmacompiler.GSFixedPoint24
 
 type MeshParserStream struct {
 	Data                []byte
@@ -470,6 +471,7 @@ func (ms *MeshParserStream) ParseVif() error {
 			case vif.VIF_CMD_NOP:
 			case vif.VIF_CMD_STCYCL:
 			case vif.VIF_CMD_MSCAL:
+				ms.Object.microProgramAddr = vifCode.Imm()
 				if err := ms.flushState(); err != nil {
 					return err
 				}
@@ -1,10 +1,39 @@
 package dmacompiler
 
+// VU memory bases of buffers used for unpacking vertex data
+var UnpackBuffersBases = []uint32{0, 0x155, 0x2ab}
+
+const VUMemorySize = 0x400
+
+const GSFixedPoint8 = 16.0
+const GSFixedPoint24 = 4096.0
+
 type Vertex struct {
-	X, Y, Z float32
-	Skip    bool
-	BoneId  int
+	X, Y, Z    float32
+	Skip       bool
+	BoneId     int
+	U, V       float32
+	NX, NY, NZ float32
+	R, G, B, A uint8
+}
+
+type Format struct {
+	HasUV      bool
+	HasNormals bool
+	HasColors  bool
+}
+
+// Batch is part of strip stream that fits into one vu buffer
+type Batch struct {
+	Vertices []Vertex
+	Buffer   int
 }
 
 type Compiled struct {
+	Format  Format
+	Batches []Batch
+	// vif program per batch, qword aligned and ended with mscal
+	Programs [][]byte
+	// index of buffer after last used
+	NextFreeBuffer int
 }
@@ -0,0 +1,88 @@
+package dmacompiler
+
+type stripEdge struct {
+	a, b int
+}
+
+type stripifier struct {
+	triangles [][3]int
+	used      []bool
+	edges     map[stripEdge][]int
+}
+
+func newStripifier(triangles [][3]int) *stripifier {
+	s := &stripifier{
+		triangles: triangles,
+		used:      make([]bool, len(triangles)),
+		edges:     make(map[stripEdge][]int),
+	}
+	for iTri, t := range triangles {
+		for i := 0; i < 3; i++ {
+			e := stripEdge{t[i], t[(i+1)%3]}
+			s.edges[e] = append(s.edges[e], iTri)
+		}
+	}
+	return s
+}
+
+// findNext returns unused triangle containing directed edge a->b and its third vertex
+func (s *stripifier) findNext(a, b int, visited map[int]bool) (int, int) {
+	for _, iTri := range s.edges[stripEdge{a, b}] {
+		if s.used[iTri] || visited[iTri] {
+			continue
+		}
+		t := s.triangles[iTri]
+		for i := 0; i < 3; i++ {
+			if t[i] == a && t[(i+1)%3] == b {
+				return iTri, t[(i+2)%3]
+			}
+		}
+	}
+	return -1, -1
+}
+
+// grow extends strip started by triangle using winding of strip:
+// even triangles are (v[i], v[i+1], v[i+2]), odd triangles are (v[i+1], v[i], v[i+2])
+func (s *stripifier) grow(start int, rotation int) ([]int, []int) {
+	t := s.triangles[start]
+	strip := []int{t[rotation%3], t[(rotation+1)%3], t[(rotation+2)%3]}
+	tris := []int{start}
+	visited := map[int]bool{start: true}
+	for {
+		p, q := strip[len(strip)-2], strip[len(strip)-1]
+		if len(tris)%2 != 0 {
+			p, q = q, p
+		}
+		iTri, x := s.findNext(p, q, visited)
+		if iTri < 0 {
+			break
+		}
+		visited[iTri] = true
+		tris = append(tris, iTri)
+		strip = append(strip, x)
+	}
+	return strip, tris
+}
+
+// Stripify converts triangle list into list of strips of vertex indexes
+func Stripify(triangles [][3]int) [][]int {
+	s := newStripifier(triangles)
+	strips := make([][]int, 0)
+	for iTri := range triangles {
+		if s.used[iTri] {
+			continue
+		}
+		var best, bestTris []int
+		for rotation := 0; rotation < 3; rotation++ {
+			strip, tris := s.grow(iTri, rotation)
+			if len(strip) > len(best) {
+				best, bestTris = strip, tris
+			}
+		}
+		for _, t := range bestTris {
+			s.used[t] = true
+		}
+		strips = append(strips, best)
+	}
+	return strips
+}
@@ -0,0 +1,101 @@
+package dmacompiler
+
+import (
+	"sort"
+	"testing"
+)
+
+// canonicalTriangle rotates triangle so smallest index is first, winding is kept
+func canonicalTriangle(t [3]int) [3]int {
+	for t[0] > t[1] || t[0] > t[2] {
+		t = [3]int{t[1], t[2], t[0]}
+	}
+	return t
+}
+
+func sortedTriangles(triangles [][3]int) [][3]int {
+	result := make([][3]int, len(triangles))
+	for i, t := range triangles {
+		result[i] = canonicalTriangle(t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return result
+}
+
+// stripTriangles decodes strip using winding described in stripifier.grow
+func stripTriangles(strip []int) [][3]int {
+	triangles := make([][3]int, 0)
+	for i := 0; i+2 < len(strip); i++ {
+		if i%2 == 0 {
+			triangles = append(triangles, [3]int{strip[i], strip[i+1], strip[i+2]})
+		} else {
+			triangles = append(triangles, [3]int{strip[i+1], strip[i], strip[i+2]})
+		}
+	}
+	return triangles
+}
+
+// gridTriangles returns w*h quads of grid split into triangles with same winding
+func gridTriangles(w, h int) [][3]int {
+	triangles := make([][3]int, 0)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := y*(w+1) + x
+			b, c, d := a+1, a+w+1, a+w+2
+			triangles = append(triangles, [3]int{a, b, d}, [3]int{a, d, c})
+		}
+	}
+	return triangles
+}
+
+func compareTriangles(t *testing.T, got, expected [][3]int) {
+	t.Helper()
+	got, expected = sortedTriangles(got), sortedTriangles(expected)
+	if len(got) != len(expected) {
+		t.Fatalf("Got %d triangles, expected %d", len(got), len(expected))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("Triangle %d: %v, expected %v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestStripifyGrid(t *testing.T) {
+	triangles := gridTriangles(8, 5)
+	strips := Stripify(triangles)
+
+	decoded := make([][3]int, 0)
+	for _, strip := range strips {
+		if len(strip) < 3 {
+			t.Fatalf("Strip too short: %v", strip)
+		}
+		decoded = append(decoded, stripTriangles(strip)...)
+	}
+	compareTriangles(t, decoded, triangles)
+
+	if len(strips) >= len(triangles) {
+		t.Errorf("Triangles are not joined into strips: %d strips", len(strips))
+	}
+}
+
+func TestStripifyDisjoint(t *testing.T) {
+	triangles := [][3]int{{0, 1, 2}, {3, 4, 5}, {6, 8, 7}}
+	strips := Stripify(triangles)
+	if len(strips) != 3 {
+		t.Fatalf("Got %d strips, expected 3: %v", len(strips), strips)
+	}
+	decoded := make([][3]int, 0)
+	for _, strip := range strips {
+		decoded = append(decoded, stripTriangles(strip)...)
+	}
+	compareTriangles(t, decoded, triangles)
+}
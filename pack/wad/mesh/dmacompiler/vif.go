@@ -0,0 +1,416 @@
+package dmacompiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/mogaika/god_of_war_browser/ps2/dma"
+	"github.com/mogaika/god_of_war_browser/ps2/vif"
+)
+
+const (
+	VIF_UNPACK_V2_32 = 0x64
+	VIF_UNPACK_V2_16 = 0x65
+	VIF_UNPACK_V3_8  = 0x6a
+	VIF_UNPACK_V4_32 = 0x6c
+	VIF_UNPACK_V4_16 = 0x6d
+	VIF_UNPACK_V4_8  = 0x6e
+
+	VIF_UNPACK_UNSIGNED = 1 << 14
+
+	// vif num field is 8 bit
+	maxVerticesPerBatch = 0xff
+)
+
+func vifCode(cmd uint8, num uint8, imm uint16) uint32 {
+	return uint32(cmd)<<24 | uint32(num)<<16 | uint32(imm)
+}
+
+func bufferSize(buffer int) uint32 {
+	if buffer+1 < len(UnpackBuffersBases) {
+		return UnpackBuffersBases[buffer+1] - UnpackBuffersBases[buffer]
+	}
+	return VUMemorySize - UnpackBuffersBases[buffer]
+}
+
+func (f Format) qwordsPerVertex() uint32 {
+	q := uint32(1)
+	if f.HasUV {
+		q++
+	}
+	if f.HasNormals {
+		q++
+	}
+	if f.HasColors {
+		q++
+	}
+	return q
+}
+
+type batchBuilder struct {
+	format    Format
+	compiled  *Compiled
+	vertices  []Vertex
+	blocks    uint32
+	lastJoint int
+}
+
+func (b *batchBuilder) buffer() int {
+	return len(b.compiled.Batches) % len(UnpackBuffersBases)
+}
+
+func (b *batchBuilder) canAdd(vs ...Vertex) bool {
+	if len(b.vertices)+len(vs) > maxVerticesPerBatch {
+		return false
+	}
+	blocks := b.blocks
+	lastJoint := b.lastJoint
+	for i, v := range vs {
+		if (len(b.vertices) == 0 && i == 0) || v.BoneId != lastJoint {
+			blocks++
+		}
+		lastJoint = v.BoneId
+	}
+	// vertex meta blocks + vertices data + boundaries
+	need := blocks + uint32(len(b.vertices)+len(vs))*b.format.qwordsPerVertex() + 1
+	return need <= bufferSize(b.buffer())
+}
+
+func (b *batchBuilder) add(v Vertex, skip bool) {
+	if len(b.vertices) == 0 || v.BoneId != b.lastJoint {
+		b.blocks++
+	}
+	b.lastJoint = v.BoneId
+	v.Skip = skip
+	b.vertices = append(b.vertices, v)
+}
+
+func (b *batchBuilder) recountBlocks() {
+	b.blocks = 0
+	for i, v := range b.vertices {
+		if i == 0 || v.BoneId != b.vertices[i-1].BoneId {
+			b.blocks++
+		}
+	}
+	if len(b.vertices) != 0 {
+		b.lastJoint = b.vertices[len(b.vertices)-1].BoneId
+	}
+}
+
+func (b *batchBuilder) flush() {
+	if len(b.vertices) != 0 {
+		b.compiled.Batches = append(b.compiled.Batches, Batch{Vertices: b.vertices, Buffer: b.buffer()})
+	}
+	b.vertices = nil
+	b.blocks = 0
+}
+
+// SplitStrips distributes strips over batches, that fit into vu buffers.
+// Strips that do not fit are restarted in next batch from even triangle to keep winding
+func SplitStrips(strips [][]Vertex, format Format) (*Compiled, error) {
+	b := &batchBuilder{format: format, compiled: &Compiled{Format: format, Batches: make([]Batch, 0)}}
+
+	for iStrip, strip := range strips {
+		if len(strip) < 3 {
+			return nil, fmt.Errorf("Strip %d is too short: %d vertices", iStrip, len(strip))
+		}
+
+		start := 0
+		for start+2 < len(strip) {
+			if !b.canAdd(strip[start : start+3]...) {
+				b.flush()
+			}
+			subStart := len(b.vertices)
+			b.add(strip[start], true)
+			b.add(strip[start+1], true)
+
+			i := start + 2
+			for ; i < len(strip) && b.canAdd(strip[i]); i++ {
+				b.add(strip[i], false)
+			}
+			if i == len(strip) {
+				break
+			}
+
+			if (i-2-start)%2 != 0 {
+				// drop last triangle, so next sub strip starts from even triangle
+				i--
+				b.vertices = b.vertices[:len(b.vertices)-1]
+			}
+			if len(b.vertices)-subStart < 3 {
+				// nothing left from sub strip
+				b.vertices = b.vertices[:subStart]
+				i = start + 2
+			}
+			b.recountBlocks()
+			b.flush()
+			start = i - 2
+		}
+	}
+	b.flush()
+
+	b.compiled.NextFreeBuffer = len(b.compiled.Batches) % len(UnpackBuffersBases)
+	return b.compiled, nil
+}
+
+// vertexMetaBlock encodes joints and material flags for group of vertices
+// layout described in mesh/dmaVif.go MeshParserState.ToPacket
+func vertexMetaBlock(count int, first, last bool, joint int, format Format) []byte {
+	var block [0x10]byte
+
+	// 0x2 - have texture, 0xf - lit, 0x1 - not gui, 0x5 - end mark
+	matFlags := make([]byte, 0, 4)
+	if format.HasUV {
+		matFlags = append(matFlags, 0x2)
+	}
+	if format.HasNormals {
+		matFlags = append(matFlags, 0xf)
+	}
+	matFlags = append(matFlags, 0x1, 0x5)
+
+	block[0] = byte(count)
+	if last {
+		block[1] = 0x80
+	}
+	block[4] = byte(len(matFlags))
+	if first {
+		block[5] = 0x40
+	}
+	if format.HasUV {
+		block[6] = 0x2e
+	} else if format.HasColors {
+		block[6] = 0x26
+	} else {
+		block[6] = 0x22
+	}
+	block[7] = byte(len(matFlags)) << 4
+
+	flags := uint32(0)
+	for i, f := range matFlags {
+		flags |= uint32(f) << uint(i*4)
+	}
+	binary.LittleEndian.PutUint32(block[8:], flags)
+
+	block[12] = byte(joint << 2)
+	block[13] = byte(joint << 4)
+	if joint == 0 {
+		block[15] = 0x80
+	}
+	return block[:]
+}
+
+func quantize(v float32, scale float32, bits uint) (int64, error) {
+	q := int64(math.Floor(float64(v*scale) + 0.5))
+	limit := int64(1) << (bits - 1)
+	if q < -limit || q >= limit {
+		return 0, fmt.Errorf("Value %f out of range of %d bit fixed point (scale %f)", v, bits, scale)
+	}
+	return q, nil
+}
+
+func boundaries(vertices []Vertex) [4]float32 {
+	var min, max [3]float32
+	for i, v := range vertices {
+		p := [3]float32{v.X, v.Y, v.Z}
+		for j := range p {
+			if i == 0 || p[j] < min[j] {
+				min[j] = p[j]
+			}
+			if i == 0 || p[j] > max[j] {
+				max[j] = p[j]
+			}
+		}
+	}
+	var res [4]float32
+	for j := 0; j < 3; j++ {
+		res[j] = (min[j] + max[j]) / 2
+	}
+	for _, v := range vertices {
+		dx, dy, dz := v.X-res[0], v.Y-res[1], v.Z-res[2]
+		if r := float32(math.Sqrt(float64(dx*dx + dy*dy + dz*dz))); r > res[3] {
+			res[3] = r
+		}
+	}
+	return res
+}
+
+type vifWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *vifWriter) code(c uint32) {
+	binary.Write(&w.buf, binary.LittleEndian, c)
+}
+
+func (w *vifWriter) unpack(cmd uint8, num int, addr uint32, flags uint16, data []byte) {
+	w.code(vifCode(cmd, uint8(num), uint16(addr&0x3ff)|flags))
+	w.buf.Write(data)
+	if pad := w.buf.Len() % 4; pad != 0 {
+		w.buf.Write(make([]byte, 4-pad))
+	}
+}
+
+func (w *vifWriter) alignQword() {
+	for w.buf.Len()%0x10 != 0 {
+		w.code(vifCode(vif.VIF_CMD_NOP, 0, 0))
+	}
+}
+
+func (b *Batch) compile(format Format, mscalAddr uint16) ([]byte, error) {
+	n := len(b.Vertices)
+	base := UnpackBuffersBases[b.Buffer]
+
+	var meta bytes.Buffer
+	blocks := 0
+	for i := 0; i < n; {
+		j := i
+		for j < n && b.Vertices[j].BoneId == b.Vertices[i].BoneId {
+			j++
+		}
+		if b.Vertices[i].BoneId < 0 || b.Vertices[i].BoneId > 0xf {
+			return nil, fmt.Errorf("Joint index %d out of range [0:15]", b.Vertices[i].BoneId)
+		}
+		meta.Write(vertexMetaBlock(j-i, i == 0, j == n, b.Vertices[i].BoneId, format))
+		blocks++
+		i = j
+	}
+
+	xyzw := make([]byte, n*8)
+	for i, v := range b.Vertices {
+		for j, f := range []float32{v.X, v.Y, v.Z} {
+			q, err := quantize(f, GSFixedPoint8, 16)
+			if err != nil {
+				return nil, fmt.Errorf("Vertex %d position: %v", i, err)
+			}
+			binary.LittleEndian.PutUint16(xyzw[i*8+j*2:], uint16(int16(q)))
+		}
+		if v.Skip {
+			xyzw[i*8+7] = 0x80
+		}
+	}
+
+	w := &vifWriter{}
+	w.code(vifCode(vif.VIF_CMD_STCYCL, 0, 0x0101))
+
+	addr := base
+	w.unpack(VIF_UNPACK_V4_32, blocks, addr, 0, meta.Bytes())
+	addr += uint32(blocks)
+	w.unpack(VIF_UNPACK_V4_16, n, addr, 0, xyzw)
+	addr += uint32(n)
+
+	if format.HasColors {
+		rgba := make([]byte, n*4)
+		for i, v := range b.Vertices {
+			copy(rgba[i*4:], []byte{v.R, v.G, v.B, v.A})
+		}
+		w.unpack(VIF_UNPACK_V4_8, n, addr, VIF_UNPACK_UNSIGNED, rgba)
+		addr += uint32(n)
+	}
+
+	if format.HasUV {
+		wide := false
+		for _, v := range b.Vertices {
+			if _, err := quantize(v.U, GSFixedPoint24, 16); err != nil {
+				wide = true
+			}
+			if _, err := quantize(v.V, GSFixedPoint24, 16); err != nil {
+				wide = true
+			}
+		}
+		if wide {
+			uv := make([]byte, n*8)
+			for i, v := range b.Vertices {
+				for j, f := range []float32{v.U, v.V} {
+					q, err := quantize(f, GSFixedPoint24, 32)
+					if err != nil {
+						return nil, fmt.Errorf("Vertex %d uv: %v", i, err)
+					}
+					binary.LittleEndian.PutUint32(uv[i*8+j*4:], uint32(int32(q)))
+				}
+			}
+			w.unpack(VIF_UNPACK_V2_32, n, addr, 0, uv)
+		} else {
+			uv := make([]byte, n*4)
+			for i, v := range b.Vertices {
+				for j, f := range []float32{v.U, v.V} {
+					q, _ := quantize(f, GSFixedPoint24, 16)
+					binary.LittleEndian.PutUint16(uv[i*4+j*2:], uint16(int16(q)))
+				}
+			}
+			w.unpack(VIF_UNPACK_V2_16, n, addr, 0, uv)
+		}
+		addr += uint32(n)
+	}
+
+	if format.HasNormals {
+		norm := make([]byte, n*3)
+		for i, v := range b.Vertices {
+			for j, f := range []float32{v.NX, v.NY, v.NZ} {
+				q, err := quantize(f, 100.0, 8)
+				if err != nil {
+					return nil, fmt.Errorf("Vertex %d normal: %v", i, err)
+				}
+				norm[i*3+j] = byte(int8(q))
+			}
+		}
+		w.unpack(VIF_UNPACK_V3_8, n, addr, 0, norm)
+		addr += uint32(n)
+	}
+
+	var bndr bytes.Buffer
+	for _, f := range boundaries(b.Vertices) {
+		binary.Write(&bndr, binary.LittleEndian, f)
+	}
+	w.unpack(VIF_UNPACK_V4_32, 1, addr, 0, bndr.Bytes())
+	addr++
+
+	if addr > base+bufferSize(b.Buffer) {
+		return nil, fmt.Errorf("Batch overflows vu buffer %d: 0x%x > 0x%x", b.Buffer, addr, base+bufferSize(b.Buffer))
+	}
+
+	w.code(vifCode(vif.VIF_CMD_MSCAL, 0, mscalAddr))
+	w.alignQword()
+	return w.buf.Bytes(), nil
+}
+
+// Compile splits strips into batches and generates vif program for each batch
+func Compile(strips [][]Vertex, format Format, mscalAddr uint16) (*Compiled, error) {
+	c, err := SplitStrips(strips, format)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Programs = make([][]byte, len(c.Batches))
+	for i := range c.Batches {
+		if c.Programs[i], err = c.Batches[i].compile(format, mscalAddr); err != nil {
+			return nil, fmt.Errorf("Error compiling batch %d: %v", i, err)
+		}
+	}
+	return c, nil
+}
+
+func dmaTag(id uint8, qwc uint32, addr uint32) []byte {
+	var tag [0x10]byte
+	binary.LittleEndian.PutUint64(tag[:], uint64(qwc&0xffff)|uint64(id&7)<<28|uint64(addr&0x7fffffff)<<32)
+	return tag[:]
+}
+
+// DmaChain returns dma tags calling every program by dma_tag_ref and terminated by dma_tag_ret.
+// programsOffset is address of first program, programs placed one after another
+func (c *Compiled) DmaChain(programsOffset uint32) []byte {
+	var buf bytes.Buffer
+	offset := programsOffset
+	for _, p := range c.Programs {
+		buf.Write(dmaTag(dma.DMA_TAG_REF, uint32(len(p)/0x10), offset))
+		offset += uint32(len(p))
+	}
+	buf.Write(dmaTag(dma.DMA_TAG_RET, 0, 0))
+	return buf.Bytes()
+}
+
+// DmaTagsCount returns count of qwords used by DmaChain
+func (c *Compiled) DmaTagsCount() int {
+	return len(c.Programs) + 1
+}
@@ -0,0 +1,154 @@
+package dmacompiler
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/ps2/dma"
+	"github.com/mogaika/god_of_war_browser/ps2/vif"
+)
+
+// testStrips returns strips with vertex index stored in X
+func testStrips(strips [][]int) [][]Vertex {
+	result := make([][]Vertex, len(strips))
+	for i, strip := range strips {
+		result[i] = make([]Vertex, len(strip))
+		for j, idx := range strip {
+			result[i][j] = Vertex{X: float32(idx), Y: 1, Z: -1, U: 0.5, V: 0.25, NZ: 1, BoneId: idx / 50 % 3}
+		}
+	}
+	return result
+}
+
+// batchTriangles decodes triangles of batch, every sub strip starts with two skipped vertices
+func batchTriangles(b *Batch) [][3]int {
+	triangles := make([][3]int, 0)
+	start, skipped := 0, 0
+	for k, v := range b.Vertices {
+		if v.Skip {
+			if skipped%2 == 0 {
+				start = k
+			}
+			skipped++
+			continue
+		}
+		a, c, d := int(b.Vertices[k-2].X), int(b.Vertices[k-1].X), int(v.X)
+		if (k-2-start)%2 == 0 {
+			triangles = append(triangles, [3]int{a, c, d})
+		} else {
+			triangles = append(triangles, [3]int{c, a, d})
+		}
+	}
+	return triangles
+}
+
+func TestSplitStrips(t *testing.T) {
+	long := make([]int, 1000)
+	for i := range long {
+		long[i] = i
+	}
+	strips := [][]int{long, {1000, 1001, 1002}, {1003, 1004, 1005, 1006}}
+	format := Format{HasUV: true, HasNormals: true, HasColors: true}
+
+	c, err := SplitStrips(testStrips(strips), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Batches) < 2 {
+		t.Fatalf("Long strip must be split, got %d batches", len(c.Batches))
+	}
+
+	expected := make([][3]int, 0)
+	for _, strip := range strips {
+		expected = append(expected, stripTriangles(strip)...)
+	}
+	decoded := make([][3]int, 0)
+	for i := range c.Batches {
+		b := &c.Batches[i]
+		if b.Buffer != i%len(UnpackBuffersBases) {
+			t.Errorf("Batch %d uses buffer %d", i, b.Buffer)
+		}
+		if len(b.Vertices) < 3 || !b.Vertices[0].Skip || !b.Vertices[1].Skip {
+			t.Errorf("Batch %d does not start with sub strip", i)
+		}
+
+		blocks := 0
+		for k, v := range b.Vertices {
+			if k == 0 || v.BoneId != b.Vertices[k-1].BoneId {
+				blocks++
+			}
+		}
+		if need := uint32(blocks) + uint32(len(b.Vertices))*format.qwordsPerVertex() + 1; need > bufferSize(b.Buffer) {
+			t.Errorf("Batch %d needs 0x%x qwords, buffer size 0x%x", i, need, bufferSize(b.Buffer))
+		}
+		decoded = append(decoded, batchTriangles(b)...)
+	}
+	compareTriangles(t, decoded, expected)
+
+	if c.NextFreeBuffer != len(c.Batches)%len(UnpackBuffersBases) {
+		t.Errorf("NextFreeBuffer %d for %d batches", c.NextFreeBuffer, len(c.Batches))
+	}
+
+	if _, err := SplitStrips(testStrips([][]int{{0, 1}}), format); err == nil {
+		t.Errorf("Short strip accepted")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	long := make([]int, 600)
+	for i := range long {
+		long[i] = i
+	}
+	const mscalAddr = 0x12
+
+	c, err := Compile(testStrips([][]int{long}), Format{HasUV: true, HasNormals: true}, mscalAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Programs) != len(c.Batches) {
+		t.Fatalf("Got %d programs for %d batches", len(c.Programs), len(c.Batches))
+	}
+
+	var offset uint32 = 0x100
+	chain := c.DmaChain(offset)
+	if len(chain) != c.DmaTagsCount()*0x10 || c.DmaTagsCount() != len(c.Programs)+1 {
+		t.Fatalf("Dma chain size 0x%x for %d programs", len(chain), len(c.Programs))
+	}
+	for i, p := range c.Programs {
+		if len(p)%0x10 != 0 {
+			t.Errorf("Program %d is not qword aligned: 0x%x", i, len(p))
+		}
+
+		// mscal is last command, followed only by nop padding
+		mscal := -1
+		for pos := len(p) - 4; pos >= len(p)-0x10; pos -= 4 {
+			if code := binary.LittleEndian.Uint32(p[pos:]); code>>24 == vif.VIF_CMD_MSCAL {
+				if code&0xffff != mscalAddr {
+					t.Errorf("Program %d calls 0x%x", i, code&0xffff)
+				}
+				mscal = pos
+				break
+			} else if code != 0 {
+				t.Errorf("Program %d has command 0x%x after mscal", i, code)
+				break
+			}
+		}
+		if mscal < 0 {
+			t.Errorf("Program %d is not ended with mscal", i)
+		}
+
+		tag := binary.LittleEndian.Uint64(chain[i*0x10:])
+		if id, qwc, addr := uint8(tag>>28&7), uint32(tag&0xffff), uint32(tag>>32); id != dma.DMA_TAG_REF ||
+			qwc != uint32(len(p)/0x10) || addr != offset {
+			t.Errorf("Dma tag %d: id %d qwc 0x%x addr 0x%x", i, id, qwc, addr)
+		}
+		offset += uint32(len(p))
+	}
+	if tag := binary.LittleEndian.Uint64(chain[len(c.Programs)*0x10:]); uint8(tag>>28&7) != dma.DMA_TAG_RET {
+		t.Errorf("Dma chain is not terminated by ret: 0x%x", tag)
+	}
+
+	if _, err := Compile(testStrips([][]int{{5000, 1, 2}}), Format{}, mscalAddr); err == nil {
+		t.Errorf("Position out of fixed point range accepted")
+	}
+}
@@ -9,8 +9,12 @@ import (
 	"net/http"
 
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/mogaika/go-collada"
+
+	"github.com/mogaika/god_of_war_browser/config"
 
 	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mat "github.com/mogaika/god_of_war_browser/pack/wad/mat"
 	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
@@ -114,11 +118,72 @@ func (m *Mesh) ExportObj(_w io.Writer, bones []mgl32.Mat4, materials []string) e
 	return nil
 }
 
+// colladaImportOptions resolves material ids from parent model and joint ids from parent object
+func (mesh *Mesh) colladaImportOptions(wrsrc *wad.WadNodeRsrc) *ColladaImportOptions {
+	opts := &ColladaImportOptions{Template: mesh}
+
+	mdlNode := wrsrc.Wad.GetNodeById(wrsrc.Node.Parent)
+	if mdlNode == nil {
+		return opts
+	}
+	opts.MaterialIds = make(map[string]uint16)
+	for _, id := range mdlNode.SubGroupNodes {
+		node := wrsrc.Wad.GetNodeById(id)
+		if inst, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id); err == nil {
+			if _, ok := inst.(*file_mat.Material); ok {
+				opts.MaterialIds[node.Tag.Name] = uint16(len(opts.MaterialIds))
+			}
+		}
+	}
+
+	// object package imports mesh, so skeleton accessed by interface
+	if objNode := wrsrc.Wad.GetNodeById(mdlNode.Parent); objNode != nil {
+		if inst, _, err := wrsrc.Wad.GetInstanceFromNode(objNode.Id); err == nil {
+			if skeleton, ok := inst.(interface{ JointIds() map[string]uint32 }); ok {
+				opts.JointIds = skeleton.JointIds()
+			}
+		}
+	}
+	return opts
+}
+
 func (mesh *Mesh) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
 	switch action {
 	case "obj":
 		var buf bytes.Buffer
 		log.Printf("Error when exporting mesh: %v", mesh.ExportObj(&buf, nil, nil))
 		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Tag.Name+".obj")
+	case "importcollada":
+		if config.GetGOWVersion() != config.GOW1 || config.GetPlayStationVersion() != config.PS2 {
+			webutils.WriteError(w, fmt.Errorf("Collada import supported only for gow1 ps2"))
+			return
+		}
+
+		fDae, _, err := r.FormFile("data")
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		defer fDae.Close()
+
+		c, err := collada.LoadDocumentFromReader(fDae)
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error parsing collada: %v", err))
+			return
+		}
+
+		newMesh, err := NewGOW1ps2MeshFromCollada(c, mesh.colladaImportOptions(wrsrc))
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error importing collada: %v", err))
+			return
+		}
+
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+			wrsrc.Tag.Id: newMesh.MarshalBuffer().Bytes(),
+		}); err != nil {
+			webutils.WriteError(w, err)
+		}
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
 	}
 }
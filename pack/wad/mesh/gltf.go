@@ -0,0 +1,184 @@
+package mesh
+
+import (
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+// GLTFMeshes groups exported primitives by vertex space, because
+// node of gltf document can reference only one skin
+type GLTFMeshes struct {
+	Static     *int // objects without joint maps
+	JointSpace *int // vertices relative to joint, skinned by joint idle matrix
+	BindSpace  *int // vertices in bind pose, skinned by idle * inverse bind matrix (UseInvertedMatrix)
+}
+
+// GLTFMaterialResolver returns gltf material index of layer of mesh material, or nil
+type GLTFMaterialResolver func(materialId uint16, layer int) *int
+
+type gltfPrimitiveBuilder struct {
+	positions [][3]float32
+	normals   [][3]float32
+	uvs       [][2]float32
+	colors    [][4]float32
+	joints    [][4]uint16
+	weights   [][4]float32
+	indices   []uint32
+}
+
+func (pb *gltfPrimitiveBuilder) addPacket(packet *Packet, jointMapper []uint32) {
+	base := uint32(len(pb.positions))
+	haveUV := packet.Uvs.U != nil
+	haveNorm := packet.Norms.X != nil
+	haveColor := packet.Blend.R != nil
+	haveJoints := packet.Joints != nil && jointMapper != nil
+
+	for i := range packet.Trias.X {
+		pb.positions = append(pb.positions, [3]float32{packet.Trias.X[i], packet.Trias.Y[i], packet.Trias.Z[i]})
+		if haveUV {
+			pb.uvs = append(pb.uvs, [2]float32{packet.Uvs.U[i], packet.Uvs.V[i]})
+		}
+		if haveNorm {
+			n := mgl32.Vec3{packet.Norms.X[i], packet.Norms.Y[i], packet.Norms.Z[i]}
+			if n.Len() > 0.0001 {
+				n = n.Normalize()
+			} else {
+				n = mgl32.Vec3{0, 1, 0}
+			}
+			pb.normals = append(pb.normals, [3]float32(n))
+		}
+		if haveColor {
+			// 0x80 is full intensity
+			c := [4]float32{}
+			for iC, v := range []uint16{packet.Blend.R[i], packet.Blend.G[i], packet.Blend.B[i], packet.Blend.A[i]} {
+				c[iC] = mgl32.Clamp(float32(v)/128.0, 0, 1)
+			}
+			pb.colors = append(pb.colors, c)
+		}
+		if haveJoints {
+			// renderer blends two joints equally
+			j1 := uint16(jointMapper[packet.Joints[i]])
+			j2 := j1
+			if packet.Joints2 != nil {
+				j2 = uint16(jointMapper[packet.Joints2[i]])
+			}
+			if j1 == j2 {
+				pb.joints = append(pb.joints, [4]uint16{j1, 0, 0, 0})
+				pb.weights = append(pb.weights, [4]float32{1, 0, 0, 0})
+			} else {
+				pb.joints = append(pb.joints, [4]uint16{j1, j2, 0, 0})
+				pb.weights = append(pb.weights, [4]float32{0.5, 0.5, 0, 0})
+			}
+		}
+		if !packet.Trias.Skip[i] {
+			idx := base + uint32(i)
+			pb.indices = append(pb.indices, idx-2, idx-1, idx)
+		}
+	}
+}
+
+func (pb *gltfPrimitiveBuilder) build(doc *gltf.Document, material *int) *gltf.Primitive {
+	if len(pb.indices) == 0 {
+		return nil
+	}
+	p := &gltf.Primitive{
+		Attributes: map[string]int{"POSITION": doc.AddVec3(pb.positions, true)},
+		Indices:    gltf.Index(doc.AddIndices(pb.indices)),
+		Material:   material,
+		Mode:       gltf.MODE_TRIANGLES,
+	}
+	// attributes must cover all vertices, so skip partially presented ones
+	if len(pb.normals) == len(pb.positions) {
+		p.Attributes["NORMAL"] = doc.AddVec3(pb.normals, false)
+	}
+	if len(pb.uvs) == len(pb.positions) {
+		p.Attributes["TEXCOORD_0"] = doc.AddVec2(pb.uvs)
+	}
+	if len(pb.colors) == len(pb.positions) {
+		p.Attributes["COLOR_0"] = doc.AddVec4(pb.colors)
+	}
+	if len(pb.joints) == len(pb.positions) {
+		p.Attributes["JOINTS_0"] = doc.AddJoints(pb.joints)
+		p.Attributes["WEIGHTS_0"] = doc.AddVec4(pb.weights)
+	}
+	return p
+}
+
+// ExportGLTF adds mesh primitives to gltf document. Joint indices of
+// vertices are global object joint ids (mapped through JointMappers)
+func (m *Mesh) ExportGLTF(doc *gltf.Document, name string, materials GLTFMaterialResolver) (*GLTFMeshes, error) {
+	var static, jointSpace, bindSpace []gltf.Primitive
+
+	for iPart, part := range m.Parts {
+		for iGroup, group := range part.Groups {
+			for iObject := range group.Objects {
+				object := &group.Objects[iObject]
+
+				layers := int(object.TextureLayersCount)
+				if layers == 0 {
+					layers = 1
+				}
+
+				for iDmaPacket := range object.Packets {
+					iInstance := iDmaPacket / layers
+					iLayer := iDmaPacket % layers
+
+					var jointMapper []uint32
+					if iInstance < len(object.JointMappers) && len(object.JointMappers[iInstance]) != 0 {
+						jointMapper = object.JointMappers[iInstance]
+					}
+
+					var pb gltfPrimitiveBuilder
+					for iPacket := range object.Packets[iDmaPacket] {
+						packet := &object.Packets[iDmaPacket][iPacket]
+						if jointMapper != nil && packet.Joints != nil {
+							for _, j := range append(append([]uint16{}, packet.Joints...), packet.Joints2...) {
+								if int(j) >= len(jointMapper) {
+									return nil, fmt.Errorf("Joint %d out of joint map (p%dg%do%d)", j, iPart, iGroup, iObject)
+								}
+							}
+						}
+						pb.addPacket(packet, jointMapper)
+					}
+
+					var material *int
+					if materials != nil {
+						material = materials(object.MaterialId, iLayer)
+					}
+					p := pb.build(doc, material)
+					if p == nil {
+						continue
+					}
+					p.Extras = map[string]interface{}{
+						"part": iPart, "group": iGroup, "object": iObject,
+						"instance": iInstance, "layer": iLayer,
+					}
+
+					switch {
+					case pb.joints == nil:
+						static = append(static, *p)
+					case object.UseInvertedMatrix:
+						bindSpace = append(bindSpace, *p)
+					default:
+						jointSpace = append(jointSpace, *p)
+					}
+				}
+			}
+		}
+	}
+
+	result := &GLTFMeshes{}
+	if len(static) != 0 {
+		result.Static = gltf.Index(doc.AddMesh(gltf.Mesh{Name: name, Primitives: static}))
+	}
+	if len(jointSpace) != 0 {
+		result.JointSpace = gltf.Index(doc.AddMesh(gltf.Mesh{Name: name + "_joint", Primitives: jointSpace}))
+	}
+	if len(bindSpace) != 0 {
+		result.BindSpace = gltf.Index(doc.AddMesh(gltf.Mesh{Name: name + "_bind", Primitives: bindSpace}))
+	}
+	return result, nil
+}
@@ -56,6 +56,8 @@ type Object struct {
 	RawDmaAndJointsData []byte
 	UseInvertedMatrix   bool
 	JointMappers        [][]uint32
+
+	microProgramAddr uint16 // vu1 program called by mscal
 }
 
 type Group struct {
@@ -0,0 +1,320 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/anm"
+	file_mdl "github.com/mogaika/god_of_war_browser/pack/wad/mdl"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+func findAnimationsInGroup(w *wad.Wad, nodes []wad.NodeId) *anm.Animations {
+	for _, id := range nodes {
+		if inst, _, err := w.GetInstanceFromNode(id); err == nil {
+			if anims, ok := inst.(*anm.Animations); ok {
+				return anims
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeAnimation returns skinning animation of act found by group and act names (first act when empty).
+// When rate is not zero, animation resampled to rate frames per second
+func (obj *Object) DecodeAnimation(wrsrc *wad.WadNodeRsrc, groupName, actName string, rate float32) (*anm.SkinningAnimation, error) {
+	anims := findAnimationsInGroup(wrsrc.Wad, wrsrc.Node.SubGroupNodes)
+	if anims == nil {
+		return nil, fmt.Errorf("Object have no animations")
+	}
+
+	for iState, dt := range anims.DataTypes {
+		if dt.TypeId != anm.DATATYPE_SKINNING {
+			continue
+		}
+		for iGroup, group := range anims.Groups {
+			if groupName != "" && group.Name != groupName {
+				continue
+			}
+			for iAct, act := range group.Acts {
+				if actName != "" && act.Name != actName {
+					continue
+				}
+				sa, err := anims.DecodeSkinning(iGroup, iAct, iState, obj.SkinningIdlePose())
+				if err != nil {
+					return nil, err
+				}
+				if rate > 0 {
+					sa = sa.Resample(rate)
+				}
+				return sa, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Cannot find skinning act '%s' in group '%s'", actName, groupName)
+}
+
+func animationKeyframeTimes(frameTime float32, framesCount int) []float32 {
+	times := make([]float32, framesCount)
+	for i := range times {
+		times[i] = float32(i) * frameTime
+	}
+	return times
+}
+
+func addSkinningAnimationGLTF(doc *gltf.Document, skel *GLTFSkeleton, sa *anm.SkinningAnimation) {
+	a := gltf.Animation{
+		Name:     sa.Group + "_" + sa.Act,
+		Channels: make([]gltf.AnimationChannel, 0),
+		Samplers: make([]gltf.AnimationSampler, 0),
+	}
+	input := doc.AddScalarFloats(animationKeyframeTimes(sa.FrameTime, sa.FramesCount), true)
+
+	addChannel := func(joint int, path string, output int) {
+		a.Samplers = append(a.Samplers, gltf.AnimationSampler{Input: input, Interpolation: "LINEAR", Output: output})
+		a.Channels = append(a.Channels, gltf.AnimationChannel{
+			Sampler: len(a.Samplers) - 1,
+			Target:  gltf.AnimationChannelTarget{Node: gltf.Index(skel.Joints[joint]), Path: path},
+		})
+	}
+	for _, track := range sa.Joints {
+		if track.Rotations != nil {
+			addChannel(track.Joint, "rotation", doc.AddAnimationVec4(track.Rotations))
+		}
+		if track.Positions != nil {
+			addChannel(track.Joint, "translation", doc.AddAnimationVec3(track.Positions))
+		}
+	}
+	if len(a.Channels) != 0 {
+		doc.AddAnimation(a)
+	}
+}
+
+// textureposOffsets combines uv offset streams of state into per frame offsets
+func textureposOffsets(states []*anm.AnimState8Texturepos) [][2]float32 {
+	offsets := make([][2]float32, 0)
+	for _, state := range states {
+		for coord := 0; coord < 2; coord++ {
+			samples, ok := state.Stream.Samples[coord].([]float32)
+			if !ok {
+				continue
+			}
+			for len(offsets) < len(samples) {
+				offsets = append(offsets, [2]float32{})
+			}
+			for i, v := range samples {
+				offsets[i][coord] = v
+			}
+		}
+	}
+	return offsets
+}
+
+func resampleOffsets(offsets [][2]float32, frameTime, rate float32) [][2]float32 {
+	lastTime := float32(len(offsets)-1) * frameTime
+	result := make([][2]float32, int(lastTime*rate+1e-4)+1)
+	for i := range result {
+		f := float32(i) / rate / frameTime
+		i0 := int(f)
+		if i0 >= len(offsets)-1 {
+			result[i] = offsets[len(offsets)-1]
+			continue
+		}
+		k := f - float32(i0)
+		for c := 0; c < 2; c++ {
+			result[i][c] = offsets[i0][c] + (offsets[i0+1][c]-offsets[i0][c])*k
+		}
+	}
+	return result
+}
+
+// addMaterialUVAnimationsGLTF exports texture position animations of materials,
+// targeting KHR_texture_transform offset through KHR_animation_pointer
+func addMaterialUVAnimationsGLTF(doc *gltf.Document, w *wad.Wad, model *file_mdl.GLTFModel, rate float32) {
+	for iMaterial, matNode := range model.MaterialNodes {
+		anims := findAnimationsInGroup(w, matNode.SubGroupNodes)
+		if anims == nil || len(anims.Groups) == 0 || anims.Groups[0].IsExternal {
+			continue
+		}
+		for iState, dt := range anims.DataTypes {
+			if dt.TypeId != anm.DATATYPE_TEXUREPOS {
+				continue
+			}
+			layer := int(dt.Param1 & 0x7f)
+			gltfMaterial := model.Materials(uint16(iMaterial), layer)
+			if gltfMaterial == nil {
+				continue
+			}
+			texture := doc.Materials[*gltfMaterial].PbrMetallicRoughness.BaseColorTexture
+			if texture == nil {
+				continue
+			}
+
+			for _, act := range anims.Groups[0].Acts {
+				sd := &act.StateDescrs[iState]
+				states, ok := sd.Data.([]*anm.AnimState8Texturepos)
+				if !ok || sd.FrameTime <= 0 {
+					continue
+				}
+				offsets := textureposOffsets(states)
+				if len(offsets) == 0 {
+					continue
+				}
+				frameTime := sd.FrameTime
+				if rate > 0 {
+					offsets = resampleOffsets(offsets, frameTime, rate)
+					frameTime = 1 / rate
+				}
+
+				if texture.Extensions == nil {
+					texture.Extensions = make(map[string]interface{})
+				}
+				texture.Extensions["KHR_texture_transform"] = map[string]interface{}{"offset": [2]float32{0, 0}}
+				doc.UseExtension("KHR_texture_transform")
+				doc.UseExtension("KHR_animation_pointer")
+
+				input := doc.AddScalarFloats(animationKeyframeTimes(frameTime, len(offsets)), true)
+				output := doc.AddAnimationVec2(offsets)
+				pointer := fmt.Sprintf("/materials/%d/pbrMetallicRoughness/baseColorTexture/extensions/KHR_texture_transform/offset", *gltfMaterial)
+				doc.AddAnimation(gltf.Animation{
+					Name:     fmt.Sprintf("%s_l%d_%s", matNode.Tag.Name, layer, act.Name),
+					Samplers: []gltf.AnimationSampler{{Input: input, Interpolation: "LINEAR", Output: output}},
+					Channels: []gltf.AnimationChannel{{
+						Sampler: 0,
+						Target: gltf.AnimationChannelTarget{
+							Path:       "pointer",
+							Extensions: map[string]interface{}{"KHR_animation_pointer": map[string]string{"pointer": pointer}},
+						},
+					}},
+				})
+			}
+		}
+	}
+}
+
+// ExportAnimationGLTF builds gltf document of object with skinning animation of act and uv animations of materials
+func (obj *Object) ExportAnimationGLTF(wrsrc *wad.WadNodeRsrc, groupName, actName string, rate float32) (*gltf.Document, error) {
+	sa, err := obj.DecodeAnimation(wrsrc, groupName, actName, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, skel, models, err := obj.exportGLTF(wrsrc)
+	if err != nil {
+		return nil, err
+	}
+
+	addSkinningAnimationGLTF(doc, skel, sa)
+	for _, model := range models {
+		addMaterialUVAnimationsGLTF(doc, wrsrc.Wad, model, rate)
+	}
+	return doc, nil
+}
+
+// quatToEulerZXY returns angles in degrees for rotation R = Rz * Rx * Ry
+func quatToEulerZXY(q [4]float32) (z, x, y float64) {
+	m := mgl32.Quat{W: q[3], V: mgl32.Vec3{q[0], q[1], q[2]}}.Mat4()
+	sx := math.Max(-1, math.Min(1, float64(m.At(2, 1))))
+	x = math.Asin(sx)
+	z = math.Atan2(-float64(m.At(0, 1)), float64(m.At(1, 1)))
+	y = math.Atan2(-float64(m.At(2, 0)), float64(m.At(2, 2)))
+	return z * 180 / math.Pi, x * 180 / math.Pi, y * 180 / math.Pi
+}
+
+func bvhJointName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "joint"
+	}
+	return strings.Replace(name, " ", "_", -1)
+}
+
+// ExportAnimationBVH writes skinning animation as bvh driven by object joint hierarchy.
+// Position channels contain absolute local translation of joint
+func (obj *Object) ExportAnimationBVH(w io.Writer, sa *anm.SkinningAnimation) error {
+	children := make([][]int, len(obj.Joints))
+	roots := make([]int, 0)
+	idleT := make([][3]float32, len(obj.Joints))
+	idleR := make([][4]float32, len(obj.Joints))
+	for i, j := range obj.Joints {
+		idleT[i], idleR[i], _ = decomposeMat4(j.ParentToJoint)
+		if j.Parent == JOINT_CHILD_NONE {
+			roots = append(roots, i)
+		} else {
+			children[j.Parent] = append(children[j.Parent], i)
+		}
+	}
+
+	tracks := make(map[int]*anm.SkinningJointTrack)
+	for i := range sa.Joints {
+		tracks[sa.Joints[i].Joint] = &sa.Joints[i]
+	}
+	hasPosition := func(joint int) bool {
+		t, ok := tracks[joint]
+		return obj.Joints[joint].Parent == JOINT_CHILD_NONE || (ok && t.Positions != nil)
+	}
+
+	bw := bufio.NewWriter(w)
+	order := make([]int, 0, len(obj.Joints))
+
+	var writeJoint func(joint int, depth int)
+	writeJoint = func(joint int, depth int) {
+		indent := strings.Repeat("\t", depth)
+		kind := "JOINT"
+		if depth == 0 {
+			kind = "ROOT"
+		}
+		t := idleT[joint]
+		fmt.Fprintf(bw, "%s%s %s\n%s{\n", indent, kind, bvhJointName(obj.Joints[joint].Name), indent)
+		fmt.Fprintf(bw, "%s\tOFFSET %f %f %f\n", indent, t[0], t[1], t[2])
+		if hasPosition(joint) {
+			fmt.Fprintf(bw, "%s\tCHANNELS 6 Xposition Yposition Zposition Zrotation Xrotation Yrotation\n", indent)
+		} else {
+			fmt.Fprintf(bw, "%s\tCHANNELS 3 Zrotation Xrotation Yrotation\n", indent)
+		}
+		order = append(order, joint)
+
+		if len(children[joint]) == 0 {
+			fmt.Fprintf(bw, "%s\tEnd Site\n%s\t{\n%s\t\tOFFSET 0.0 0.0 0.0\n%s\t}\n", indent, indent, indent, indent)
+		}
+		for _, child := range children[joint] {
+			writeJoint(child, depth+1)
+		}
+		fmt.Fprintf(bw, "%s}\n", indent)
+	}
+
+	fmt.Fprintf(bw, "HIERARCHY\n")
+	for _, root := range roots {
+		writeJoint(root, 0)
+	}
+
+	fmt.Fprintf(bw, "MOTION\nFrames: %d\nFrame Time: %f\n", sa.FramesCount, sa.FrameTime)
+	for frame := 0; frame < sa.FramesCount; frame++ {
+		line := make([]string, 0, len(order)*6)
+		for _, joint := range order {
+			t, r := idleT[joint], idleR[joint]
+			if track, ok := tracks[joint]; ok {
+				if track.Positions != nil {
+					t = track.Positions[frame]
+				}
+				if track.Rotations != nil {
+					r = track.Rotations[frame]
+				}
+			}
+			if hasPosition(joint) {
+				line = append(line, fmt.Sprintf("%f %f %f", t[0], t[1], t[2]))
+			}
+			z, x, y := quatToEulerZXY(r)
+			line = append(line, fmt.Sprintf("%f %f %f", z, x, y))
+		}
+		fmt.Fprintf(bw, "%s\n", strings.Join(line, " "))
+	}
+
+	return bw.Flush()
+}
@@ -3,10 +3,12 @@ package obj
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/go-gl/mathgl/mgl32"
 
@@ -72,5 +74,88 @@ func (obj *Object) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *
 		}
 
 		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Name()+".zip")
+	case "gltf":
+		var buf bytes.Buffer
+		if err := obj.ExportGLB(wrsrc, &buf); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error exporting gltf: %v", err))
+			return
+		}
+		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Name()+".glb")
+	case "animation":
+		var rate float32
+		if fps := r.URL.Query().Get("fps"); fps != "" {
+			f, err := strconv.ParseFloat(fps, 32)
+			if err != nil || f <= 0 {
+				webutils.WriteError(w, fmt.Errorf("Invalid fps '%s'", fps))
+				return
+			}
+			rate = float32(f)
+		}
+		group, act := r.URL.Query().Get("group"), r.URL.Query().Get("act")
+
+		var buf bytes.Buffer
+		var fileName string
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "gltf":
+			doc, err := obj.ExportAnimationGLTF(wrsrc, group, act, rate)
+			if err == nil {
+				err = doc.EncodeGLB(&buf)
+			}
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("Error exporting animation: %v", err))
+				return
+			}
+			fileName = wrsrc.Name() + "_" + act + ".glb"
+		case "bvh":
+			sa, err := obj.DecodeAnimation(wrsrc, group, act, rate)
+			if err == nil {
+				err = obj.ExportAnimationBVH(&buf, sa)
+			}
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("Error exporting animation: %v", err))
+				return
+			}
+			fileName = wrsrc.Name() + "_" + act + ".bvh"
+		default:
+			webutils.WriteError(w, fmt.Errorf("Unknown animation format '%s'", format))
+			return
+		}
+		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), fileName)
+	case "skeleton":
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			data, err := json.MarshalIndent(obj.Skeleton(), "", "\t")
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("Error exporting skeleton: %v", err))
+				return
+			}
+			webutils.WriteFile(w, bytes.NewReader(data), wrsrc.Name()+"_skeleton.json")
+		case "gltf":
+			var buf bytes.Buffer
+			if err := obj.ExportSkeletonGLTF(wrsrc.Name()).EncodeGLB(&buf); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Error exporting skeleton: %v", err))
+				return
+			}
+			webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Name()+"_skeleton.glb")
+		default:
+			webutils.WriteError(w, fmt.Errorf("Unknown skeleton format '%s'", format))
+		}
+	case "joint":
+		updated := obj.clone()
+		j, err := updated.ApplyJointForm(r)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		data, err := updated.MarshalToBinary()
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{wrsrc.Tag.Id: data}); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error updating object: %v", err))
+			return
+		}
+		webutils.WriteJson(w, updated.Skeleton()[j.Id])
 	}
 }
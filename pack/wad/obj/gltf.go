@@ -0,0 +1,180 @@
+package obj
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mdl "github.com/mogaika/god_of_war_browser/pack/wad/mdl"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+// GLTFSkeleton describes joint nodes of object added to gltf document
+type GLTFSkeleton struct {
+	Root   int   // node containing joints hierarchy
+	Joints []int // node of every object joint
+	// vertices of meshes can be relative to joint or be in bind pose,
+	// so there are two skins with different inverse bind matrices
+	JointSpaceSkin int
+	BindSpaceSkin  int
+}
+
+func decomposeMat4(m mgl32.Mat4) ([3]float32, [4]float32, [3]float32) {
+	t := [3]float32{m[12], m[13], m[14]}
+	sc := [3]float32{m.Col(0).Vec3().Len(), m.Col(1).Vec3().Len(), m.Col(2).Vec3().Len()}
+
+	rm := mgl32.Ident4()
+	for c := 0; c < 3; c++ {
+		if sc[c] != 0 {
+			rm.SetCol(c, m.Col(c).Mul(1/sc[c]))
+		}
+	}
+	rm.SetCol(3, mgl32.Vec4{0, 0, 0, 1})
+	q := mgl32.Mat4ToQuat(rm).Normalize()
+	return t, [4]float32{q.V[0], q.V[1], q.V[2], q.W}, sc
+}
+
+// ExportGLTFSkeleton adds joint hierarchy with idle transforms to gltf document
+func (obj *Object) ExportGLTFSkeleton(doc *gltf.Document, name string) *GLTFSkeleton {
+	skel := &GLTFSkeleton{
+		Root:   doc.AddNode(gltf.Node{Name: name}),
+		Joints: make([]int, len(obj.Joints)),
+	}
+
+	identity := make([][16]float32, len(obj.Joints))
+	bind := make([][16]float32, len(obj.Joints))
+	for i := range obj.Joints {
+		j := &obj.Joints[i]
+
+		// animated nodes cannot use matrix, so store decomposed transform
+		t, r, sc := decomposeMat4(j.ParentToJoint)
+		skel.Joints[i] = doc.AddNode(gltf.Node{
+			Name:        j.Name,
+			Translation: &t,
+			Rotation:    &r,
+			Scale:       &sc,
+			Extras: map[string]interface{}{
+				"id":         j.Id,
+				"flags":      j.Flags,
+				"isSkinned":  j.IsSkinned,
+				"isExternal": j.IsExternal,
+			},
+		})
+
+		// joints are stored in hierarchy order, so parent always added before child
+		if j.Parent == JOINT_CHILD_NONE {
+			doc.AddChild(skel.Root, skel.Joints[i])
+		} else {
+			doc.AddChild(skel.Joints[j.Parent], skel.Joints[i])
+		}
+
+		identity[i] = mgl32.Ident4()
+		bind[i] = j.BindToJointMat
+	}
+
+	skel.JointSpaceSkin = doc.AddSkin(gltf.Skin{
+		Name:                name + "_joint",
+		InverseBindMatrices: gltf.Index(doc.AddMat4(identity)),
+		Skeleton:            gltf.Index(skel.Root),
+		Joints:              skel.Joints,
+	})
+	skel.BindSpaceSkin = doc.AddSkin(gltf.Skin{
+		Name:                name + "_bind",
+		InverseBindMatrices: gltf.Index(doc.AddMat4(bind)),
+		Skeleton:            gltf.Index(skel.Root),
+		Joints:              skel.Joints,
+	})
+
+	return skel
+}
+
+// ExportGLTF builds gltf document with skeleton, skinned meshes and materials of object
+func (obj *Object) ExportGLTF(wrsrc *wad.WadNodeRsrc) (*gltf.Document, error) {
+	doc, _, _, err := obj.exportGLTF(wrsrc)
+	return doc, err
+}
+
+func (obj *Object) exportGLTF(wrsrc *wad.WadNodeRsrc) (*gltf.Document, *GLTFSkeleton, []*file_mdl.GLTFModel, error) {
+	doc := gltf.NewDocument("god_of_war_browser")
+
+	models, err := obj.ExportGLTFModels(wrsrc, doc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	skel, skinned := obj.AddGLTFNodes(doc, wrsrc.Name(), models)
+	doc.AddScene(wrsrc.Name(), append([]int{skel.Root}, skinned...))
+	return doc, skel, models.Models, nil
+}
+
+// GLTFModels are models of object added to gltf document
+type GLTFModels struct {
+	Names  []string
+	Models []*file_mdl.GLTFModel
+}
+
+// ExportGLTFModels adds meshes and materials of object models to gltf document.
+// Result can be shared between several instances of object
+func (obj *Object) ExportGLTFModels(wrsrc *wad.WadNodeRsrc, doc *gltf.Document) (*GLTFModels, error) {
+	models := &GLTFModels{
+		Names:  make([]string, 0),
+		Models: make([]*file_mdl.GLTFModel, 0),
+	}
+	for _, id := range wrsrc.Node.SubGroupNodes {
+		n := wrsrc.Wad.GetNodeById(id)
+		inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		mdl, ok := inst.(*file_mdl.Model)
+		if !ok {
+			continue
+		}
+
+		model, err := mdl.ExportGLTF(wrsrc.Wad.GetNodeResourceByNodeId(n.Id), doc)
+		if err != nil {
+			return nil, err
+		}
+		models.Names = append(models.Names, n.Tag.Name)
+		models.Models = append(models.Models, model)
+	}
+	if len(models.Models) == 0 {
+		return nil, fmt.Errorf("Cannot find model :-( .")
+	}
+	return models, nil
+}
+
+// AddGLTFNodes adds skeleton and mesh nodes of object instance.
+// Returned skinned mesh nodes must be placed in scene root, because their transform is ignored
+func (obj *Object) AddGLTFNodes(doc *gltf.Document, name string, models *GLTFModels) (*GLTFSkeleton, []int) {
+	skel := obj.ExportGLTFSkeleton(doc, name)
+	skinned := make([]int, 0)
+
+	for iModel, model := range models.Models {
+		modelName := models.Names[iModel]
+		for _, m := range model.Meshes {
+			if m.Static != nil {
+				doc.AddChild(skel.Root, doc.AddNode(gltf.Node{Name: modelName, Mesh: m.Static}))
+			}
+			if m.JointSpace != nil {
+				skinned = append(skinned, doc.AddNode(gltf.Node{
+					Name: modelName + "_joint", Mesh: m.JointSpace, Skin: gltf.Index(skel.JointSpaceSkin)}))
+			}
+			if m.BindSpace != nil {
+				skinned = append(skinned, doc.AddNode(gltf.Node{
+					Name: modelName + "_bind", Mesh: m.BindSpace, Skin: gltf.Index(skel.BindSpaceSkin)}))
+			}
+		}
+	}
+	return skel, skinned
+}
+
+func (obj *Object) ExportGLB(wrsrc *wad.WadNodeRsrc, w io.Writer) error {
+	doc, err := obj.ExportGLTF(wrsrc)
+	if err != nil {
+		return err
+	}
+	return doc.EncodeGLB(w)
+}
@@ -76,6 +76,8 @@ type Object struct {
 	Vectors5  [][4]int32   // idle pos rot quaterion Q.14fp
 	Vectors6  []mgl32.Vec4 // idle pose scale
 	Vectors7  []mgl32.Vec4
+
+	raw []byte // original file, used as base of marshaling
 }
 
 func (obj *Object) StringJoint(id int16, spaces string) string {
@@ -121,7 +123,7 @@ func (obj *Object) StringTree() string {
 }
 
 func NewFromData(buf []byte) (*Object, error) {
-	obj := new(Object)
+	obj := &Object{raw: buf}
 
 	obj.jointsCount = binary.LittleEndian.Uint32(buf[0x1c:0x20])
 	obj.dataOffset = binary.LittleEndian.Uint32(buf[0x28:0x2c])
@@ -280,6 +282,19 @@ func (obj *Object) FeelJoints() {
 	}
 }
 
+// SkinningIdlePose returns local idle transforms of joints used as base of skinning animations
+func (obj *Object) SkinningIdlePose() []anm.SkinningJointPose {
+	pose := make([]anm.SkinningJointPose, len(obj.Joints))
+	for i := range obj.Joints {
+		pose[i].IsQuaternion = obj.Joints[i].Flags&0x8000 != 0
+		for c := 0; c < 4; c++ {
+			pose[i].Rotation[c] = float32(obj.Vectors5[i][c])
+		}
+		pose[i].Position = obj.Vectors4[i]
+	}
+	return pose
+}
+
 type ObjMarshal struct {
 	Data       *Object
 	Model      interface{}
@@ -0,0 +1,240 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad/anm"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/gltf"
+)
+
+// SkeletonJoint is joint description for skeleton export
+type SkeletonJoint struct {
+	Id         int16
+	Name       string
+	Parent     int16
+	ParentName string `json:",omitempty"`
+	Children   []int16
+	Flags      uint32
+	IsSkinned  bool
+	IsExternal bool
+
+	// idle transform relative to parent, rotation is normalized quaternion (xyzw)
+	IdlePosition [3]float32
+	IdleRotation [4]float32
+	IdleScale    [3]float32
+
+	ParentToJoint     mgl32.Mat4
+	BindToJointMat    mgl32.Mat4
+	OurJointToIdleMat mgl32.Mat4
+	RenderMat         mgl32.Mat4
+}
+
+// Skeleton returns joints with names of parents and children
+func (obj *Object) Skeleton() []SkeletonJoint {
+	joints := make([]SkeletonJoint, len(obj.Joints))
+	for i := range obj.Joints {
+		j := &obj.Joints[i]
+		pose := &joints[i]
+		*pose = SkeletonJoint{
+			Id:                j.Id,
+			Name:              j.Name,
+			Parent:            j.Parent,
+			Children:          make([]int16, 0),
+			Flags:             j.Flags,
+			IsSkinned:         j.IsSkinned,
+			IsExternal:        j.IsExternal,
+			IdlePosition:      [3]float32{obj.Vectors4[i][0], obj.Vectors4[i][1], obj.Vectors4[i][2]},
+			IdleScale:         [3]float32{obj.Vectors6[i][0], obj.Vectors6[i][1], obj.Vectors6[i][2]},
+			ParentToJoint:     j.ParentToJoint,
+			BindToJointMat:    j.BindToJointMat,
+			OurJointToIdleMat: j.OurJointToIdleMat,
+			RenderMat:         j.RenderMat,
+		}
+		var rot [4]float32
+		for c := range rot {
+			rot[c] = float32(obj.Vectors5[i][c])
+		}
+		pose.IdleRotation = anm.JointRotationToQuat(rot, j.Flags&0x8000 != 0)
+
+		if j.Parent != JOINT_CHILD_NONE {
+			pose.ParentName = obj.Joints[j.Parent].Name
+			joints[j.Parent].Children = append(joints[j.Parent].Children, j.Id)
+		}
+	}
+	return joints
+}
+
+// ExportSkeletonGLTF builds gltf document with joints hierarchy and skins only
+func (obj *Object) ExportSkeletonGLTF(name string) *gltf.Document {
+	doc := gltf.NewDocument("god_of_war_browser")
+	skel := obj.ExportGLTFSkeleton(doc, name)
+	doc.AddScene(name, []int{skel.Root})
+	return doc
+}
+
+// JointByName returns joint by index or by name
+func (obj *Object) JointByName(s string) (*Joint, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		if id < 0 || id >= len(obj.Joints) {
+			return nil, fmt.Errorf("Joint index %d out of range", id)
+		}
+		return &obj.Joints[id], nil
+	}
+	for i := range obj.Joints {
+		if obj.Joints[i].Name == s {
+			return &obj.Joints[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Joint '%s' not found", s)
+}
+
+// JointIds returns joint name => joint id, used by collada import of meshes
+func (obj *Object) JointIds() map[string]uint32 {
+	ids := make(map[string]uint32, len(obj.Joints))
+	for i := range obj.Joints {
+		ids[obj.Joints[i].Name] = uint32(obj.Joints[i].Id)
+	}
+	return ids
+}
+
+// eulerToQuat is same as gl-matrix quat.fromEuler, angles in degrees
+func eulerToQuat(x, y, z float32) mgl32.Quat {
+	toHalfRad := math.Pi / 360
+	sx, cx := math.Sincos(float64(x) * toHalfRad)
+	sy, cy := math.Sincos(float64(y) * toHalfRad)
+	sz, cz := math.Sincos(float64(z) * toHalfRad)
+	return mgl32.Quat{
+		W: float32(cx*cy*cz + sx*sy*sz),
+		V: mgl32.Vec3{
+			float32(sx*cy*cz - cx*sy*sz),
+			float32(cx*sy*cz + sx*cy*sz),
+			float32(cx*cy*sz - sx*sy*cz),
+		},
+	}
+}
+
+// SetJointIdle changes idle transform of joint and updates dependent matrices.
+// Nil arguments are kept. Rotation is euler in degrees (xyz) or quaternion (xyzw)
+func (obj *Object) SetJointIdle(id int16, position, rotation, scale []float32) error {
+	j := &obj.Joints[id]
+	isQuaternion := j.Flags&0x8000 != 0
+
+	if position != nil {
+		copy(obj.Vectors4[id][:3], position)
+	}
+	if scale != nil {
+		copy(obj.Vectors6[id][:3], scale)
+	}
+	if rotation != nil {
+		var q mgl32.Quat
+		if len(rotation) == 4 {
+			q = mgl32.Quat{W: rotation[3], V: mgl32.Vec3{rotation[0], rotation[1], rotation[2]}}
+			if q.Len() < 1e-6 {
+				return fmt.Errorf("Zero quaternion")
+			}
+			q = q.Normalize()
+		} else {
+			q = eulerToQuat(rotation[0], rotation[1], rotation[2])
+		}
+
+		if isQuaternion {
+			for c, v := range []float32{q.V[0], q.V[1], q.V[2], q.W} {
+				obj.Vectors5[id][c] = int32(math.Floor(float64(v)*(1<<14) + 0.5))
+			}
+		} else if len(rotation) == 3 {
+			// euler stored as Q.14 fraction of full turn
+			for c := 0; c < 3; c++ {
+				obj.Vectors5[id][c] = int32(math.Floor(float64(rotation[c])/360*(1<<14) + 0.5))
+			}
+		} else {
+			return fmt.Errorf("Joint '%s' uses euler rotation, quaternion not supported", j.Name)
+		}
+	}
+
+	var rot [4]float32
+	for c := range rot {
+		rot[c] = float32(obj.Vectors5[id][c])
+	}
+	q := anm.JointRotationToQuat(rot, isQuaternion)
+	pos, sc := obj.Vectors4[id], obj.Vectors6[id]
+
+	obj.Matrixes1[id] = mgl32.Translate3D(pos[0], pos[1], pos[2]).
+		Mul4(mgl32.Quat{W: q[3], V: mgl32.Vec3{q[0], q[1], q[2]}}.Mat4()).
+		Mul4(mgl32.Scale3D(sc[0], sc[1], sc[2]))
+	obj.FeelJoints()
+	return nil
+}
+
+// ApplyJointForm changes idle transform of joint from "joint" request param
+// using "position", "rotation" and "scale" params
+func (obj *Object) ApplyJointForm(r *http.Request) (*Joint, error) {
+	j, err := obj.JointByName(r.FormValue("joint"))
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]float32, 3)
+	for i, f := range []struct {
+		Name   string
+		Counts []int
+	}{{"position", []int{3}}, {"rotation", []int{3, 4}}, {"scale", []int{3}}} {
+		if s := r.FormValue(f.Name); s != "" {
+			if values[i], err = utils.ParseFloats(s, f.Counts...); err != nil {
+				return nil, fmt.Errorf("Invalid %s: %v", f.Name, err)
+			}
+		}
+	}
+	return j, obj.SetJointIdle(j.Id, values[0], values[1], values[2])
+}
+
+// clone copies joints and idle pose, so they can be edited without touching cached object
+func (obj *Object) clone() *Object {
+	c := *obj
+	c.Joints = append([]Joint{}, obj.Joints...)
+	c.Matrixes1 = append([]mgl32.Mat4{}, obj.Matrixes1...)
+	c.Vectors4 = append([]mgl32.Vec4{}, obj.Vectors4...)
+	c.Vectors5 = append([][4]int32{}, obj.Vectors5...)
+	c.Vectors6 = append([]mgl32.Vec4{}, obj.Vectors6...)
+	return &c
+}
+
+// MarshalToBinary writes matrices and idle vectors into original file data
+func (obj *Object) MarshalToBinary() ([]byte, error) {
+	buf := make([]byte, len(obj.raw))
+	copy(buf, obj.raw)
+
+	var data bytes.Buffer
+	write := func(offset uint32, v interface{}) error {
+		data.Reset()
+		if err := binary.Write(&data, binary.LittleEndian, v); err != nil {
+			return err
+		}
+		copy(buf[obj.dataOffset+offset:], data.Bytes())
+		return nil
+	}
+
+	for _, part := range []struct {
+		Offset uint32
+		Data   interface{}
+	}{
+		{DATA_HEADER_SIZE, obj.Matrixes1},
+		{obj.Mat2offset, obj.Matrixes2},
+		{obj.Mat3offset, obj.Matrixes3},
+		{obj.Vec4offset, obj.Vectors4},
+		{obj.Vec5offset, obj.Vectors5},
+		{obj.Vec6offset, obj.Vectors6},
+		{obj.Vec7offset, obj.Vectors7},
+	} {
+		if err := write(part.Offset, part.Data); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
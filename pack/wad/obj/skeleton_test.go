@@ -0,0 +1,107 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testObject builds object with chain of joints, first joint uses euler rotation, others quaternion
+func testObject(joints int) []byte {
+	dataOff := HEADER_SIZE + joints*0x10 + joints*0x18
+	mat3 := DATA_HEADER_SIZE + joints*0x40
+	vec := mat3 + joints*0x40
+	buf := make([]byte, dataOff+vec+joints*0x10*4)
+	binary.LittleEndian.PutUint32(buf[0x1c:], uint32(joints))
+	binary.LittleEndian.PutUint32(buf[0x28:], uint32(dataOff))
+
+	d := buf[dataOff:]
+	binary.LittleEndian.PutUint32(d[0:], uint32(joints))
+	binary.LittleEndian.PutUint32(d[4:], uint32(mat3))
+	binary.LittleEndian.PutUint32(d[12:], uint32(mat3))
+	binary.LittleEndian.PutUint32(d[16:], uint32(joints))
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(d[32+i*4:], uint32(vec+i*joints*0x10))
+	}
+
+	for i := 0; i < joints; i++ {
+		j := buf[HEADER_SIZE+i*0x10:]
+		if i != 0 {
+			binary.LittleEndian.PutUint32(j, 0x8000)
+		}
+		binary.LittleEndian.PutUint16(j[4:], 0xffff)
+		binary.LittleEndian.PutUint16(j[6:], 0xffff)
+		binary.LittleEndian.PutUint16(j[8:], uint16(i-1))
+		copy(buf[HEADER_SIZE+joints*0x10+i*0x18:], []byte{'j', byte('0' + i)})
+		for k := 0; k < 4; k++ {
+			binary.LittleEndian.PutUint32(d[DATA_HEADER_SIZE+i*0x40+k*0x14:], math.Float32bits(1))
+			binary.LittleEndian.PutUint32(d[mat3+i*0x40+k*0x14:], math.Float32bits(1))
+		}
+		if i != 0 {
+			binary.LittleEndian.PutUint32(d[vec+joints*0x10+i*0x10+12:], 1<<14)
+		}
+		for k := 0; k < 3; k++ {
+			binary.LittleEndian.PutUint32(d[vec+2*joints*0x10+i*0x10+k*4:], math.Float32bits(1))
+		}
+	}
+	return buf
+}
+
+func TestSetJointIdle(t *testing.T) {
+	data := testObject(2)
+	obj, err := NewFromData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := obj.MarshalToBinary(); err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("Marshaled object differs from source: %v", err)
+	}
+
+	edited := obj.clone()
+	if err := edited.SetJointIdle(0, []float32{1, 2, 3}, []float32{90, 0, 0}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := edited.SetJointIdle(1, nil, []float32{0, 0, 90}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Vectors4[0][0] != 0 || obj.Vectors5[0][0] != 0 {
+		t.Errorf("Source object modified")
+	}
+
+	out, err := edited.MarshalToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := NewFromData(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := float32(math.Sqrt(0.5))
+	skel := reparsed.Skeleton()
+	for i, expected := range [][4]float32{{s, 0, 0, s}, {0, 0, s, s}} {
+		for c := range expected {
+			if math.Abs(float64(skel[i].IdleRotation[c]-expected[c])) > 1e-3 {
+				t.Errorf("Joint %d rotation %v, expected %v", i, skel[i].IdleRotation, expected)
+				break
+			}
+		}
+	}
+	if skel[0].IdlePosition != [3]float32{1, 2, 3} {
+		t.Errorf("Joint 0 position %v", skel[0].IdlePosition)
+	}
+	if len(skel[0].Children) != 1 || skel[1].ParentName != "j0" {
+		t.Errorf("Invalid hierarchy %v %q", skel[0].Children, skel[1].ParentName)
+	}
+
+	// rotation by 90 degrees around x maps y axis to z
+	if m := reparsed.Joints[0].OurJointToIdleMat; m[12] != 1 || m[13] != 2 || m[14] != 3 ||
+		math.Abs(float64(m.Col(1)[2]-1)) > 1e-3 {
+		t.Errorf("Invalid idle matrix %v", m)
+	}
+	// child is placed at parent origin
+	if m := reparsed.Joints[1].OurJointToIdleMat; m[12] != 1 || m[13] != 2 || m[14] != 3 {
+		t.Errorf("Invalid child idle matrix %v", m)
+	}
+}
@@ -0,0 +1,179 @@
+package sbk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Bank looks like 989snd (SCREAM) SBlk version 2, so command (grain) types are named as there.
+// Meaning of most args is a guess, raw bytes are kept in every command
+const (
+	CmdNull          = 0
+	CmdTone          = 1
+	CmdXrefId        = 2 // play other sound by id
+	CmdXrefNum       = 3 // play other sound by number
+	CmdLfo           = 4
+	CmdStartChild    = 5
+	CmdStopChild     = 6
+	CmdPluginMessage = 7 // used for sounds streamed from vpk
+	CmdBranch        = 8
+	CmdTone2         = 9
+	CmdControlNull   = 20
+	CmdLoopStart     = 21
+	CmdLoopEnd       = 22
+	CmdLoopContinue  = 23
+	CmdStop          = 24
+	CmdRandPlay      = 25 // play one of next Args[0] commands
+	CmdRandDelay     = 26
+	CmdRandPitchBend = 27
+	CmdPitchBend     = 28
+	CmdAddPitchBend  = 29
+	CmdSetRegister   = 30
+	CmdAddRegister   = 31
+)
+
+var commandNames = map[uint8]string{
+	CmdNull:          "null",
+	CmdTone:          "tone",
+	CmdXrefId:        "xref_id",
+	CmdXrefNum:       "xref_num",
+	CmdLfo:           "lfo",
+	CmdStartChild:    "start_child",
+	CmdStopChild:     "stop_child",
+	CmdPluginMessage: "plugin_message",
+	CmdBranch:        "branch",
+	CmdTone2:         "tone2",
+	CmdControlNull:   "control_null",
+	CmdLoopStart:     "loop_start",
+	CmdLoopEnd:       "loop_end",
+	CmdLoopContinue:  "loop_continue",
+	CmdStop:          "stop",
+	CmdRandPlay:      "rand_play",
+	CmdRandDelay:     "rand_delay",
+	CmdRandPitchBend: "rand_pitch_bend",
+	CmdPitchBend:     "pitch_bend",
+	CmdAddPitchBend:  "add_pitch_bend",
+	CmdSetRegister:   "set_register",
+	CmdAddRegister:   "add_register",
+}
+
+const toneSize = 0x18
+
+// Tone describes sample playback, referenced by tone commands
+type Tone struct {
+	Priority      int8
+	Volume        int8 // 0..127
+	CenterNote    int8 // note when sample played with native pitch
+	CenterFine    int8 // in 1/128 of semitone
+	Pan           int16
+	MapLow        int8 // note range
+	MapHigh       int8
+	PitchBendLow  int8
+	PitchBendHigh int8
+	ADSR1         uint16
+	ADSR2         uint16
+	Flags         uint16
+	SampleOffset  uint32 // in bank stream block
+}
+
+func (t *Tone) Parse(b []byte) {
+	t.Priority = int8(b[0])
+	t.Volume = int8(b[1])
+	t.CenterNote = int8(b[2])
+	t.CenterFine = int8(b[3])
+	t.Pan = int16(binary.LittleEndian.Uint16(b[4:]))
+	t.MapLow = int8(b[6])
+	t.MapHigh = int8(b[7])
+	t.PitchBendLow = int8(b[8])
+	t.PitchBendHigh = int8(b[9])
+	t.ADSR1 = binary.LittleEndian.Uint16(b[0xa:])
+	t.ADSR2 = binary.LittleEndian.Uint16(b[0xc:])
+	t.Flags = binary.LittleEndian.Uint16(b[0xe:])
+	t.SampleOffset = binary.LittleEndian.Uint32(b[0x10:])
+}
+
+// SampleRate of sample when sound played at middle C (spu plays 48000 at center note)
+func (t *Tone) SampleRate() float64 {
+	return 48000 * math.Pow(2, (60-float64(t.CenterNote))/12-float64(t.CenterFine)/(12*128))
+}
+
+type Command struct {
+	Type  uint8
+	Name  string
+	Args  [3]byte
+	Delay int32 // before next command, probably in ticks
+
+	// Args as signed 24 bit value, used as volume, pan, pitch bend or delay depending on type
+	Value int32
+	// for tone commands
+	ToneOffset uint32 `json:",omitempty"`
+	Tone       *Tone  `json:",omitempty"`
+}
+
+func (c *Command) Parse(b []byte, h []byte) {
+	copy(c.Args[:], b[:3])
+	c.Type = b[3]
+	c.Delay = int32(binary.LittleEndian.Uint32(b[4:]))
+	c.Value = int32(binary.LittleEndian.Uint32(b[:4])<<8) >> 8
+
+	if name, ok := commandNames[c.Type]; ok {
+		c.Name = name
+	} else {
+		c.Name = fmt.Sprintf("unknown_%d", c.Type)
+	}
+
+	if c.Type == CmdTone || c.Type == CmdTone2 {
+		c.ToneOffset = binary.LittleEndian.Uint32(b[:4]) & 0xffffff
+		if int(c.ToneOffset)+toneSize <= len(h) {
+			c.Tone = &Tone{}
+			c.Tone.Parse(h[c.ToneOffset:])
+		}
+	}
+}
+
+type BankSound struct {
+	Name          string
+	Volume        int8 // 0..127
+	VolumeGroup   int8
+	Pan           int16
+	InstanceLimit uint8
+	Flags         uint16
+	Commands      []Command
+	CommandOffset uint32
+}
+
+func (d *BankSound) Parse(b []byte) {
+	d.Volume = int8(b[0])
+	d.VolumeGroup = int8(b[1])
+	d.Pan = int16(binary.LittleEndian.Uint16(b[2:]))
+	d.Commands = make([]Command, b[4])
+	d.InstanceLimit = b[5]
+	d.Flags = binary.LittleEndian.Uint16(b[6:])
+	d.CommandOffset = binary.LittleEndian.Uint32(b[8:])
+}
+
+// ParseCommands decodes commands, h is header block, start is commands offset in it
+func (d *BankSound) ParseCommands(h []byte, start uint32) error {
+	// if streamed from vpk file then only one plugin_message cmd with:
+	// Args = 68/88/a8/0/20, 0/7/6, 0 Delay = 1/0
+	for i := range d.Commands {
+		off := int(start + d.CommandOffset + uint32(i)*8)
+		if off+8 > len(h) {
+			return fmt.Errorf("Command %d out of header", i)
+		}
+		d.Commands[i].Parse(h[off:], h)
+	}
+	return nil
+}
+
+// Tones returns tones played by sound
+func (d *BankSound) Tones() []*Tone {
+	tones := make([]*Tone, 0)
+	for i := range d.Commands {
+		if t := d.Commands[i].Tone; t != nil {
+			tones = append(tones, t)
+		}
+	}
+	return tones
+}
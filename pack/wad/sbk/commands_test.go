@@ -0,0 +1,79 @@
+package sbk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+)
+
+func TestCommandParse(t *testing.T) {
+	h := make([]byte, 0x40)
+	tone := h[0x20:]
+	tone[1] = 100 // volume
+	tone[2] = 60  // center note
+	binary.LittleEndian.PutUint32(tone[0x10:], 0x120)
+
+	var cmd Command
+	cmd.Parse([]byte{0x20, 0x00, 0x00, CmdTone, 5, 0, 0, 0}, h)
+	if cmd.Name != "tone" || cmd.Delay != 5 || cmd.ToneOffset != 0x20 || cmd.Tone == nil {
+		t.Fatalf("Invalid tone command %+v", cmd)
+	}
+	if cmd.Tone.Volume != 100 || cmd.Tone.SampleOffset != 0x120 || math.Abs(cmd.Tone.SampleRate()-48000) > 1e-6 {
+		t.Errorf("Invalid tone %+v", cmd.Tone)
+	}
+
+	// tone out of header is not resolved
+	cmd = Command{}
+	cmd.Parse([]byte{0x30, 0x00, 0x00, CmdTone, 0, 0, 0, 0}, h)
+	if cmd.Tone != nil {
+		t.Errorf("Tone out of header resolved")
+	}
+
+	// value is signed 24 bit
+	cmd = Command{}
+	cmd.Parse([]byte{0xfe, 0xff, 0xff, CmdPitchBend, 0, 0, 0, 0}, h)
+	if cmd.Name != "pitch_bend" || cmd.Value != -2 || cmd.Tone != nil {
+		t.Errorf("Invalid pitch bend command %+v", cmd)
+	}
+	cmd = Command{}
+	cmd.Parse([]byte{0xff, 0xff, 0x7f, 0x63, 0, 0, 0, 0}, h)
+	if cmd.Name != "unknown_99" || cmd.Value != 0x7fffff {
+		t.Errorf("Invalid unknown command %+v", cmd)
+	}
+}
+
+func TestBankSample(t *testing.T) {
+	first := adpcm.Encode(make([]int16, 28*3), &adpcm.Loop{Start: 28, End: 28 * 3})
+	// second sample has no end flag, so it ends at next sample
+	second := make([]byte, 16*2)
+	third := adpcm.Encode(make([]int16, 28), nil)
+
+	b := &Bank{StreamBlock: append(append(append([]byte{}, first...), second...), third...)}
+	b.BankSounds = make([]BankSound, 3)
+	for i, offset := range []int{0, len(first), len(first) + len(second)} {
+		b.BankSounds[i].Commands = []Command{{Type: CmdTone, Tone: &Tone{SampleOffset: uint32(offset)}}}
+	}
+
+	data, loop, err := b.Sample(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, first) || loop == nil || *loop != (adpcm.Loop{Start: 28, End: 28 * 3}) {
+		t.Errorf("Invalid first sample, size %d, loop %v", len(data), loop)
+	}
+
+	data, loop, err = b.Sample(uint32(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(second) || loop != nil {
+		t.Errorf("Second sample size %d, loop %v", len(data), loop)
+	}
+
+	if _, _, err := b.Sample(3); err == nil {
+		t.Errorf("Expected error for unaligned offset")
+	}
+}
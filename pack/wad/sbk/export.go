@@ -0,0 +1,257 @@
+package sbk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+	"github.com/mogaika/god_of_war_browser/ps2/vagp"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// sampleEnd returns offset of next sample referenced by tones or end of stream block
+func (b *Bank) sampleEnd(offset uint32) int {
+	end := len(b.StreamBlock)
+	for iSnd := range b.BankSounds {
+		for _, t := range b.BankSounds[iSnd].Tones() {
+			if t.SampleOffset > offset && int(t.SampleOffset) < end {
+				end = int(t.SampleOffset)
+			}
+		}
+	}
+	return end
+}
+
+// Sample returns adpcm blocks of stream block starting at offset up to block with end flag
+// or start of next sample, and loop found by block flags, nil if sample is not looped
+func (b *Bank) Sample(offset uint32) ([]byte, *adpcm.Loop, error) {
+	if offset%16 != 0 || int(offset) >= len(b.StreamBlock) {
+		return nil, nil, fmt.Errorf("Invalid sample offset 0x%x", offset)
+	}
+	limit := b.sampleEnd(offset)
+	end := int(offset)
+	for end+16 <= limit {
+		flags := b.StreamBlock[end+1]
+		end += 16
+		if flags&adpcm.FlagLoopEnd != 0 {
+			break
+		}
+	}
+	data := b.StreamBlock[offset:end]
+	return data, adpcm.FindLoop(data), nil
+}
+
+func adpcmToWave(data []byte, sampleRate uint32, loop *adpcm.Loop) ([]byte, int, error) {
+	pcm, err := adpcm.NewAdpcmStream().Unpack(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	if err := utils.WaveWriteHeaderLoop(&buf, 1, sampleRate, uint32(len(pcm)), loop); err != nil {
+		return nil, 0, err
+	}
+	buf.Write(pcm)
+	return buf.Bytes(), len(pcm) / 2, nil
+}
+
+type exportSample struct {
+	File       string
+	Offset     uint32
+	SampleRate uint32
+	Samples    int
+	Loop       *adpcm.Loop `json:",omitempty"`
+}
+
+type exportVag struct {
+	Name       string
+	File       string
+	SampleRate uint32
+}
+
+func sfzVolume(volumes ...int8) float64 {
+	gain := 1.0
+	for _, v := range volumes {
+		gain *= float64(v) / 127
+	}
+	if gain <= 0 {
+		return -144
+	}
+	return 20 * math.Log10(gain)
+}
+
+// sfzPan converts pan in degrees (0 - center, 90 - right, 270 - left) to sfz range
+func sfzPan(pans ...int16) float64 {
+	sum := 0.0
+	for _, p := range pans {
+		sum += math.Sin(float64(p) * math.Pi / 180)
+	}
+	return math.Max(-100, math.Min(100, sum*100))
+}
+
+// exportBank writes samples, json and sfz of sblk bank. Sound index is used as sfz key
+func (sbk *SBK) exportBank(zw *zip.Writer, name string) error {
+	b := sbk.Bank
+	samples := make(map[uint32]*exportSample)
+	soundSamples := make([][]string, len(b.BankSounds))
+
+	for iSnd := range b.BankSounds {
+		snd := &b.BankSounds[iSnd]
+		soundSamples[iSnd] = make([]string, 0)
+		for _, t := range snd.Tones() {
+			s, ok := samples[t.SampleOffset]
+			if !ok {
+				data, loop, err := b.Sample(t.SampleOffset)
+				if err != nil {
+					return fmt.Errorf("Sound %s: %v", snd.Name, err)
+				}
+				s = &exportSample{
+					File:       fmt.Sprintf("samples/%.6x.wav", t.SampleOffset),
+					Offset:     t.SampleOffset,
+					SampleRate: uint32(t.SampleRate() + 0.5),
+					Loop:       loop,
+				}
+				wav, count, err := adpcmToWave(data, s.SampleRate, loop)
+				if err != nil {
+					return fmt.Errorf("Sound %s: %v", snd.Name, err)
+				}
+				s.Samples = count
+				if err := writeZipFile(zw, name+"/"+s.File, wav); err != nil {
+					return err
+				}
+				samples[t.SampleOffset] = s
+			}
+			soundSamples[iSnd] = append(soundSamples[iSnd], s.File)
+		}
+	}
+
+	sampleList := make([]*exportSample, 0, len(samples))
+	for _, s := range samples {
+		sampleList = append(sampleList, s)
+	}
+	sort.Slice(sampleList, func(i, j int) bool { return sampleList[i].Offset < sampleList[j].Offset })
+
+	jsonData, err := json.MarshalIndent(struct {
+		Bank         *Bank
+		Samples      []*exportSample
+		SoundSamples [][]string // sample files of every bank sound
+	}{b, sampleList, soundSamples}, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, name+"/"+name+".json", jsonData); err != nil {
+		return err
+	}
+
+	var sfz bytes.Buffer
+	fmt.Fprintf(&sfz, "// %s, sound index is used as key\n", name)
+	for iSnd := range b.BankSounds {
+		snd := &b.BankSounds[iSnd]
+		fmt.Fprintf(&sfz, "\n// %d %s\n", iSnd, snd.Name)
+		if iSnd > 127 {
+			fmt.Fprintf(&sfz, "// not mapped, out of keys\n")
+			continue
+		}
+		fmt.Fprintf(&sfz, "<group> key=%d\n", iSnd)
+
+		randLeft, randCount, randIndex := 0, 0, 0
+		for _, cmd := range snd.Commands {
+			if cmd.Type == CmdRandPlay {
+				randCount, randIndex = int(cmd.Args[0]), 0
+				randLeft = randCount
+				continue
+			}
+			t := cmd.Tone
+			if t == nil {
+				if cmd.Type != CmdNull {
+					fmt.Fprintf(&sfz, "// %s %d delay %d\n", cmd.Name, cmd.Value, cmd.Delay)
+				}
+				continue
+			}
+			s := samples[t.SampleOffset]
+			fmt.Fprintf(&sfz, "<region> sample=%s pitch_keycenter=%d tune=%d volume=%.2f pan=%.1f",
+				s.File, iSnd, int(math.Round(1200*math.Log2(t.SampleRate()/float64(s.SampleRate)))),
+				sfzVolume(snd.Volume, t.Volume), sfzPan(snd.Pan, t.Pan))
+			if s.Loop != nil {
+				fmt.Fprintf(&sfz, " loop_mode=loop_continuous loop_start=%d loop_end=%d", s.Loop.Start, s.Loop.End-1)
+			}
+			if randLeft > 0 {
+				fmt.Fprintf(&sfz, " lorand=%.4f hirand=%.4f",
+					float64(randIndex)/float64(randCount), float64(randIndex+1)/float64(randCount))
+				randIndex++
+				randLeft--
+			}
+			sfz.WriteString("\n")
+		}
+	}
+	return writeZipFile(zw, name+"/"+name+".sfz", sfz.Bytes())
+}
+
+// exportVags writes every vag as wav with json and sfz list
+func (sbk *SBK) exportVags(zw *zip.Writer, name string, data []byte) error {
+	vags := make([]exportVag, 0, len(sbk.Sounds))
+	var sfz bytes.Buffer
+	fmt.Fprintf(&sfz, "// %s, sound index is used as key\n", name)
+	for iSnd, snd := range sbk.Sounds {
+		end := uint32(len(data))
+		if iSnd != len(sbk.Sounds)-1 {
+			end = sbk.Sounds[iSnd+1].StreamId
+		}
+		vag, err := vagp.NewVAGPFromReader(bytes.NewReader(data[snd.StreamId:end]))
+		if err != nil {
+			return fmt.Errorf("Sound %s: %v", snd.Name, err)
+		}
+		wav, err := vag.AsWave()
+		if err != nil {
+			return fmt.Errorf("Sound %s: %v", snd.Name, err)
+		}
+		file := snd.Name + ".wav"
+		if err := writeZipFile(zw, name+"/"+file, wav.Bytes()); err != nil {
+			return err
+		}
+		vags = append(vags, exportVag{Name: snd.Name, File: file, SampleRate: vag.SampleRate})
+		if iSnd <= 127 {
+			fmt.Fprintf(&sfz, "<region> key=%d sample=%s // %s\n", iSnd, file, snd.Name)
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(vags, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, name+"/"+name+".json", jsonData); err != nil {
+		return err
+	}
+	return writeZipFile(zw, name+"/"+name+".sfz", sfz.Bytes())
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Export writes zip with wav of every sample, json description and sfz instrument
+func (sbk *SBK) Export(wrsrc *wad.WadNodeRsrc, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	var err error
+	if sbk.IsVagFiles {
+		err = sbk.exportVags(zw, wrsrc.Name(), wrsrc.Tag.Data)
+	} else if sbk.Bank != nil {
+		err = sbk.exportBank(zw, wrsrc.Name())
+	} else {
+		err = fmt.Errorf("Bank not loaded")
+	}
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
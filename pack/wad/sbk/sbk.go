@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 
 	"github.com/mogaika/god_of_war_browser/config"
 
+	file_vag "github.com/mogaika/god_of_war_browser/pack/vag"
 	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/ps2/vagp"
 	"github.com/mogaika/god_of_war_browser/utils"
 	"github.com/mogaika/god_of_war_browser/webutils"
@@ -24,54 +27,6 @@ type Sound struct {
 	StreamId uint32 // file offset for vag
 }
 
-type Command struct {
-	Cmd uint8 // volume????
-	B1  uint8
-	B2  uint8
-	B3  uint8
-	U4  uint32
-}
-
-func (c *Command) Parse(b []byte) {
-	c.Cmd = b[0]
-	c.B1 = b[1]
-	c.B2 = b[2]
-	c.B3 = b[3]
-	c.U4 = binary.LittleEndian.Uint32(b[4:])
-}
-
-type BankSound struct {
-	Name          string
-	Commands      []Command
-	CommandOffset uint32
-
-	B0 uint8
-	B1 uint8 // == 1 if streamed from vpk?
-	B5 uint8
-	B6 uint8
-}
-
-func (d *BankSound) Parse(b []byte) {
-	d.B0 = b[0]
-	d.B1 = b[1]
-
-	d.B5 = b[5]
-	d.B6 = b[6]
-
-	d.Commands = make([]Command, b[4])
-	d.CommandOffset = binary.LittleEndian.Uint32(b[8:])
-}
-
-func (d *BankSound) ParseCommands(c []byte) {
-	// if streamed from vpk file then only one cmd with:
-	// Cmd = 68/88/a8/0/20/
-	// B1 = 0/7/6 B2 = 0 B3 = 7 U4 = 1/0
-
-	for i := range d.Commands {
-		d.Commands[i].Parse(c[d.CommandOffset+uint32(i)*8:])
-	}
-}
-
 type Bank struct {
 	HeaderBlockStart uint32
 	HeaderBlockSize  uint32
@@ -106,11 +61,15 @@ func (b *Bank) parseHeader(h []byte) error {
 	b.SomeInt2 = u32(0x2c)
 	b.SmpdStart = u32(0x34)
 
+	b.CommandsStart = commandsStart
+
 	b.BankSounds = make([]BankSound, b.SoundsCount)
 	for i := range b.BankSounds {
 		doff := uint32(0x40 + i*12)
 		b.BankSounds[i].Parse(h[doff:])
-		b.BankSounds[i].ParseCommands(h[commandsStart:])
+		if err := b.BankSounds[i].ParseCommands(h, commandsStart); err != nil {
+			return fmt.Errorf("Sound %d: %v", i, err)
+		}
 	}
 
 	return nil
@@ -220,6 +179,86 @@ func (sbk *SBK) httpSendSound(w http.ResponseWriter, wrsrc *wad.WadNodeRsrc, snd
 	}
 }
 
+// ReplaceVag replaces vag of sound in vag bank and moves streams of following sounds.
+// Sounds of sbk are not changed, new stream ids of every sound are returned
+func (sbk *SBK) ReplaceVag(data []byte, sndName string, vag []byte) ([]byte, []uint32, error) {
+	if !sbk.IsVagFiles {
+		return nil, nil, errors.New("Sounds are not stored as vag files")
+	}
+	for iSnd, snd := range sbk.Sounds {
+		if snd.Name != sndName {
+			continue
+		}
+		end := uint32(len(data))
+		if iSnd != len(sbk.Sounds)-1 {
+			end = sbk.Sounds[iSnd+1].StreamId
+		}
+
+		result := make([]byte, 0, len(data)-int(end-snd.StreamId)+len(vag))
+		result = append(result, data[:snd.StreamId]...)
+		result = append(result, vag...)
+		result = append(result, data[end:]...)
+
+		delta := uint32(len(vag)) - (end - snd.StreamId)
+		streamIds := make([]uint32, len(sbk.Sounds))
+		for i := range sbk.Sounds {
+			streamIds[i] = sbk.Sounds[i].StreamId
+			if i > iSnd {
+				streamIds[i] += delta
+				binary.LittleEndian.PutUint32(result[8+i*28+24:], streamIds[i])
+			}
+		}
+		return result, streamIds, nil
+	}
+	return nil, nil, errors.New("Cannot find sound")
+}
+
+func (sbk *SBK) httpImportWav(w http.ResponseWriter, r *http.Request, wrsrc *wad.WadNodeRsrc, sndName string) error {
+	wav, rate, loop, err := file_vag.ReadWaveUpload(r)
+	if err != nil {
+		return err
+	}
+
+	if !sbk.IsVagFiles {
+		return errors.New("Sounds are not stored as vag files")
+	}
+	var vag *vagp.VAGP
+	for iSnd, snd := range sbk.Sounds {
+		if snd.Name == sndName {
+			end := uint32(len(wrsrc.Tag.Data))
+			if iSnd != len(sbk.Sounds)-1 {
+				end = sbk.Sounds[iSnd+1].StreamId
+			}
+			if vag, err = vagp.NewVAGPFromReader(bytes.NewReader(wrsrc.Tag.Data[snd.StreamId:end])); err != nil {
+				return fmt.Errorf("Cannot parse original vag: %v", err)
+			}
+			break
+		}
+	}
+	if vag == nil {
+		return errors.New("Cannot find sound")
+	}
+	vag.ReplaceWave(wav, rate, loop)
+
+	data, streamIds, err := sbk.ReplaceVag(wrsrc.Tag.Data, sndName, vag.Marshal())
+	if err != nil {
+		return err
+	}
+	if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{wrsrc.Tag.Id: data}); err != nil {
+		return err
+	}
+	for i := range sbk.Sounds {
+		sbk.Sounds[i].StreamId = streamIds[i]
+	}
+	webutils.WriteJson(w, &file_vag.ImportResult{
+		SampleRate: vag.SampleRate,
+		Channels:   1,
+		Samples:    len(vag.WaveData) / 16 * adpcm.BlockSamples,
+		Size:       len(data),
+	})
+	return nil
+}
+
 func (sbk *SBK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
 	sndName := r.URL.Query().Get("snd")
 
@@ -228,6 +267,17 @@ func (sbk *SBK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *htt
 		sbk.httpSendSound(w, wrsrc, sndName, true)
 	case "vag":
 		sbk.httpSendSound(w, wrsrc, sndName, false)
+	case "importwav":
+		if err := sbk.httpImportWav(w, r, wrsrc, sndName); err != nil {
+			webutils.WriteError(w, err)
+		}
+	case "export":
+		var buf bytes.Buffer
+		if err := sbk.Export(wrsrc, &buf); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, &buf, wrsrc.Name()+".zip")
 	default:
 		log.Printf("Unknown action: %v", action)
 	}
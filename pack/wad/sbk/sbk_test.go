@@ -0,0 +1,53 @@
+package sbk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestReplaceVag(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	sizes := []int{16, 32, 48}
+	data := make([]byte, 8+len(names)*28)
+	binary.LittleEndian.PutUint32(data, SBK_VAG_MAGIC)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(names)))
+	for i, name := range names {
+		copy(data[8+i*28:], name)
+		binary.LittleEndian.PutUint32(data[8+i*28+24:], uint32(len(data)))
+		data = append(data, bytes.Repeat([]byte{byte(i + 1)}, sizes[i])...)
+	}
+
+	sbk, err := NewFromData(bytes.NewReader(data), false, uint32(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]Sound{}, sbk.Sounds...)
+
+	vag := bytes.Repeat([]byte{9}, 64)
+	result, streamIds, err := sbk.ReplaceVag(data, "b", vag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sbk.Sounds, original) {
+		t.Errorf("Sounds changed before save: %v", sbk.Sounds)
+	}
+
+	replaced, err := NewFromData(bytes.NewReader(result), false, uint32(len(result)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, snd := range replaced.Sounds {
+		if snd.StreamId != streamIds[i] {
+			t.Errorf("Sound %d stream id %d, expected %d", i, snd.StreamId, streamIds[i])
+		}
+	}
+	if !bytes.Equal(result[streamIds[1]:streamIds[2]], vag) || result[streamIds[2]] != 3 || len(result) != len(data)+32 {
+		t.Errorf("Invalid streams layout")
+	}
+
+	if _, _, err := sbk.ReplaceVag(data, "unknown", vag); err == nil {
+		t.Errorf("Expected error for unknown sound")
+	}
+}
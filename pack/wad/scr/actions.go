@@ -0,0 +1,75 @@
+package scr
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/scr/targets"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// MarshalToBinary supports only targets that can be marshaled back.
+// Header after target name is not reversed and no size field is known there, so it is kept as is
+func (sp *ScriptParams) MarshalToBinary() ([]byte, error) {
+	var data []byte
+	switch v := sp.Data.(type) {
+	case *targets.Entities:
+		data = v.MarshalToBinary()
+	default:
+		return nil, fmt.Errorf("Marshaling of script target '%s' not supported", sp.TargetName)
+	}
+	return append(append([]byte{}, sp.header...), data...), nil
+}
+
+// ReplaceEntityHandler assembles text into handler of entity with index iEntity
+func (sp *ScriptParams) ReplaceEntityHandler(iEntity int, handler uint16, text string) error {
+	entities, ok := sp.Data.(*targets.Entities)
+	if !ok {
+		return fmt.Errorf("Script target '%s' is not SCR_Entities", sp.TargetName)
+	}
+	if iEntity < 0 || iEntity >= len(entities.Array) {
+		return fmt.Errorf("Invalid entity index %d", iEntity)
+	}
+	return entities.Array[iEntity].ReplaceHandler(handler, text)
+}
+
+func (sp *ScriptParams) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "handler":
+		iEntity, err := strconv.Atoi(r.FormValue("entity"))
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Invalid entity: %v", err))
+			return
+		}
+		handler, err := strconv.ParseUint(r.FormValue("handler"), 0, 16)
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Invalid handler: %v", err))
+			return
+		}
+
+		// work on fresh copy, so failed edit not affects cached instance
+		edited, err := NewFromData(wrsrc.Tag.Data)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if err := edited.ReplaceEntityHandler(iEntity, uint16(handler), r.FormValue("code")); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		data, err := edited.MarshalToBinary()
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{wrsrc.Tag.Id: data}); err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error updating script: %v", err))
+			return
+		}
+		webutils.WriteJson(w, edited.Data)
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
+	}
+}
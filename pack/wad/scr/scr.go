@@ -14,11 +14,14 @@ const HEADER_SIZE = 0x24
 type ScriptParams struct {
 	TargetName string
 	Data       interface{}
+
+	header []byte
 }
 
 func NewFromData(buf []byte) (*ScriptParams, error) {
 	sp := &ScriptParams{
 		TargetName: utils.BytesToString(buf[4:20]),
+		header:     append([]byte{}, buf[:HEADER_SIZE]...),
 	}
 
 	if loader := store.GetScriptLoader(sp.TargetName); loader != nil {
@@ -0,0 +1,279 @@
+package targets
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EscStringRef is push_string operand that must be patched with offset of string
+type EscStringRef struct {
+	Pos   int // position of u16 operand in Code
+	Value string
+}
+
+// EscJumpRef is jump operand with target outside of assembled text, left as is
+type EscJumpRef struct {
+	Pos    int // position of u16 operand in Code
+	Target int
+}
+
+type EscAssembly struct {
+	Code    []byte
+	Strings []EscStringRef
+	Jumps   []EscJumpRef
+}
+
+var (
+	escLineRe     = regexp.MustCompile(`^(?:(0x[0-9a-fA-F]+):\s*)?(?:([0-9a-fA-F]{2}):\s*)?(.*)$`)
+	escLabelRe    = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):$`)
+	escScopeVarRe = regexp.MustCompile(`^\w+ from \((0x[0-9a-fA-F]+)\).* val (0x[0-9a-fA-F]+)$`)
+	escCallRe     = regexp.MustCompile(`^call_function scope\((0x[0-9a-fA-F]+)\), func\((0x[0-9a-fA-F]+)\).*=> (\w+)$`)
+	escCallNameRe = regexp.MustCompile(`^call_function '(.*)' => (\w+)$`)
+	escJumpRe     = regexp.MustCompile(`^pop_jmp_if_not_zero (?:offset\(\+?(0x[0-9a-fA-F]+)\)|@([A-Za-z_][A-Za-z0-9_]*))$`)
+)
+
+func typeIdFromString(s string) (uint8, error) {
+	for i := uint8(0); i < 4; i++ {
+		if TypeIdToString(i) == s {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown type '%s'", s)
+}
+
+// escFuncByName looks up scope and function id by description returned from GetEscFunc
+func escFuncByName(name string) (uint16, uint16, error) {
+	found := currentEscFunctions().byName[name]
+	if len(found) == 0 {
+		return 0, 0, fmt.Errorf("Unknown function '%s'", name)
+	} else if len(found) > 1 {
+		return 0, 0, fmt.Errorf("Function '%s' is ambiguous: 0x%x:0x%x and 0x%x:0x%x, use scope and id",
+			name, found[0].Scope, found[0].Id, found[1].Scope, found[1].Id)
+	}
+	return found[0].Scope, found[0].Id, nil
+}
+
+func parseHex16(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	return uint16(v), err
+}
+
+func escScopeFuncArg(scope, fid uint16) ([]byte, error) {
+	if scope > 0xf || fid > 0xfff {
+		return nil, fmt.Errorf("Scope 0x%x or function 0x%x out of range", scope, fid)
+	}
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], scope<<12|fid)
+	return buf[:], nil
+}
+
+// AssembleEscScript compiles text produced by DecompileEscScript back to opcodes.
+// base is offset of code inside of opcodes stream, used for labels.
+// Besides decompiler output it accepts label lines "name:" and "pop_jmp_if_not_zero @name;".
+// Jump operands are probably offsets from start of opcodes stream (same as handler start),
+// so numeric jumps to address of decompiled line are relocated to new address of that line,
+// other numeric jumps are kept and listed in Jumps
+func AssembleEscScript(text string, base int) (*EscAssembly, error) {
+	type fixup struct {
+		pos    int
+		label  string
+		oldPtr int
+		line   int
+	}
+
+	asm := &EscAssembly{Code: make([]byte, 0), Strings: make([]EscStringRef, 0), Jumps: make([]EscJumpRef, 0)}
+	labels := make(map[string]int)
+	oldAddrs := make(map[int]int)
+	fixups := make([]fixup, 0)
+
+	u16 := func(v uint16) {
+		asm.Code = append(asm.Code, byte(v), byte(v>>8))
+	}
+	u32 := func(v uint32) {
+		asm.Code = append(asm.Code, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+
+	for iLine, rawLine := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if m := escLabelRe.FindStringSubmatch(line); m != nil {
+			labels[m[1]] = base + len(asm.Code)
+			continue
+		}
+
+		m := escLineRe.FindStringSubmatch(line)
+		if m[1] != "" {
+			addr, err := strconv.ParseUint(m[1], 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: invalid address: %v", iLine+1, err)
+			}
+			oldAddrs[int(addr)] = base + len(asm.Code)
+		}
+		origOpcode := -1
+		if m[2] != "" {
+			v, _ := strconv.ParseUint(m[2], 16, 8)
+			origOpcode = int(v)
+		}
+		instr := strings.TrimSuffix(strings.TrimSpace(m[3]), ";")
+
+		lineErr := func(format string, args ...interface{}) error {
+			return fmt.Errorf("Line %d '%s': %s", iLine+1, rawLine, fmt.Sprintf(format, args...))
+		}
+
+		if instr == escExit.Mnemonic {
+			// keep original opcode, any opcode >= 0x3a stops script
+			if origOpcode >= escOpcodeExit {
+				asm.Code = append(asm.Code, byte(origOpcode))
+			} else {
+				asm.Code = append(asm.Code, escOpcodeExit)
+			}
+			continue
+		}
+
+		mnemonic := instr
+		if _, ok := escOpcodesByMnemonic[instr]; !ok {
+			if i := strings.IndexByte(instr, ' '); i >= 0 {
+				mnemonic = instr[:i]
+			}
+		}
+		operand := strings.TrimSpace(strings.TrimPrefix(instr, mnemonic))
+
+		candidates, ok := escOpcodesByMnemonic[mnemonic]
+		if !ok {
+			return nil, lineErr("unknown instruction")
+		}
+		kind := escOpcodes[candidates[0]].Operand
+		if kind == escOperandCall {
+			// return type selects opcode
+			var typeName string
+			if cm := escCallRe.FindStringSubmatch(instr); cm != nil {
+				typeName = cm[3]
+			} else if cm := escCallNameRe.FindStringSubmatch(instr); cm != nil {
+				typeName = cm[2]
+			} else {
+				return nil, lineErr("expected 'call_function scope(0x<scope>), func(0x<id>) => <type>'")
+			}
+			typeId, err := typeIdFromString(typeName)
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			for _, c := range candidates {
+				if escOpcodes[c].Type == typeId {
+					candidates = []byte{c}
+				}
+			}
+		}
+		// same mnemonic may have several opcodes, prefer original one
+		opcode := candidates[0]
+		for _, c := range candidates {
+			if int(c) == origOpcode {
+				opcode = c
+			}
+		}
+		asm.Code = append(asm.Code, opcode)
+
+		switch kind {
+		case escOperandNone:
+			if operand != "" {
+				return nil, lineErr("unexpected operand")
+			}
+		case escOperandFloat:
+			f, err := strconv.ParseFloat(operand, 32)
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			u32(math.Float32bits(float32(f)))
+		case escOperandInt:
+			i, err := strconv.ParseInt(operand, 0, 32)
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			u32(uint32(int32(i)))
+		case escOperandString:
+			if len(operand) < 2 || operand[0] != '\'' || operand[len(operand)-1] != '\'' {
+				return nil, lineErr("string must be quoted with '")
+			}
+			asm.Strings = append(asm.Strings, EscStringRef{Pos: len(asm.Code), Value: operand[1 : len(operand)-1]})
+			u16(0)
+		case escOperandScopeVar:
+			sm := escScopeVarRe.FindStringSubmatch(instr)
+			if sm == nil {
+				return nil, lineErr("expected '%s from (0x<scope>) val 0x<id>'", mnemonic)
+			}
+			scope, err := parseHex16(sm[1])
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			fid, err := parseHex16(sm[2])
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			arg, err := escScopeFuncArg(scope, fid)
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			asm.Code = append(asm.Code, arg...)
+		case escOperandCall:
+			var scope, fid uint16
+			var err error
+			if cm := escCallRe.FindStringSubmatch(instr); cm != nil {
+				if scope, err = parseHex16(cm[1]); err != nil {
+					return nil, lineErr("%v", err)
+				}
+				if fid, err = parseHex16(cm[2]); err != nil {
+					return nil, lineErr("%v", err)
+				}
+			} else if scope, fid, err = escFuncByName(escCallNameRe.FindStringSubmatch(instr)[1]); err != nil {
+				return nil, lineErr("%v", err)
+			}
+			arg, err := escScopeFuncArg(scope, fid)
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			asm.Code = append(asm.Code, arg...)
+		case escOperandJump:
+			jm := escJumpRe.FindStringSubmatch(instr)
+			if jm == nil {
+				return nil, lineErr("expected 'pop_jmp_if_not_zero offset(+0x<offset>)' or 'pop_jmp_if_not_zero @label'")
+			}
+			f := fixup{pos: len(asm.Code), label: jm[2], oldPtr: -1, line: iLine + 1}
+			if jm[1] != "" {
+				v, err := parseHex16(jm[1])
+				if err != nil {
+					return nil, lineErr("%v", err)
+				}
+				f.oldPtr = int(v)
+			}
+			fixups = append(fixups, f)
+			u16(0)
+		}
+	}
+
+	for _, f := range fixups {
+		var target int
+		if f.label != "" {
+			addr, ok := labels[f.label]
+			if !ok {
+				return nil, fmt.Errorf("Line %d: unknown label '%s'", f.line, f.label)
+			}
+			target = addr
+		} else if addr, ok := oldAddrs[f.oldPtr]; ok {
+			target = addr
+		} else {
+			target = f.oldPtr
+			asm.Jumps = append(asm.Jumps, EscJumpRef{Pos: f.pos, Target: target})
+		}
+		if target > 0xffff {
+			return nil, fmt.Errorf("Line %d: jump target 0x%x out of range", f.line, target)
+		}
+		binary.LittleEndian.PutUint16(asm.Code[f.pos:], uint16(target))
+	}
+
+	return asm, nil
+}
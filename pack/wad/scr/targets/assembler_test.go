@@ -0,0 +1,168 @@
+package targets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// handler 1 code, string operand is patched with offset of "hello"
+var testHandler1 = []byte{
+	0x0e, 0x00, 0x00, // 0x00 push_string 'hello'
+	0x0f, 0x0c, 0x00, // 0x03 pop_jmp_if_not_zero 0x0c
+	0x01, 5, 0, 0, 0, // 0x06 push_int 5
+	0x38, // 0x0b pop_result
+	0x3a, // 0x0c exit
+}
+
+// handler 2 code starting at 0x0d
+var testHandler2 = []byte{
+	0x11,             // 0x0d push_bool TRUE
+	0x0f, 0x18, 0x00, // 0x0e pop_jmp_if_not_zero 0x18
+	0x00, 0x00, 0x00, 0xc0, 0x3f, // 0x11 push_float 1.5
+	0x0a, 0x00, 0x10, // 0x16 call_function 1:0 => float
+	0x3b, // 0x19 exit
+}
+
+func testEntity() []byte {
+	stream := append(append([]byte{}, testHandler1...), testHandler2...)
+	// jump to exit of handler 2
+	binary.LittleEndian.PutUint16(stream[len(testHandler1)+2:], uint16(len(stream)-1))
+	text := []byte("ent\x00hello\x00")
+	binary.LittleEndian.PutUint16(stream[1:], uint16(len(stream)+4))
+
+	raw := make([]byte, 0x54)
+	binary.LittleEndian.PutUint16(raw[0x48:], 77)
+	binary.LittleEndian.PutUint16(raw[0x4c:], 2)
+	binary.LittleEndian.PutUint16(raw[0x4e:], 2)
+	binary.LittleEndian.PutUint16(raw[0x50:], 1)
+	binary.LittleEndian.PutUint16(raw[0x52:], uint16(2+len(stream)))
+	raw = append(raw, 1, 0, 0, 0, 2, 0, byte(len(testHandler1)), 0) // handlers table
+	raw = append(raw, 5, 0)                                         // depends ids
+	raw = append(raw, 0xaa, 0xbb)                                   // unknown
+	raw = append(append(raw, stream...), text...)
+	raw = append(raw, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint16(raw[0x44:], uint16(len(raw)))
+	return raw
+}
+
+var escAddrRe = regexp.MustCompile(`(?m)^0x[0-9a-f]{4}: [0-9A-F]{2}:\s*`)
+
+// instructions strips addresses and jump offsets from decompiled text
+func instructions(s string) string {
+	return regexp.MustCompile(`offset\(\+0x[0-9a-f]+\)`).ReplaceAllString(escAddrRe.ReplaceAllString(s, ""), "offset")
+}
+
+func TestAssembleEscScriptRoundTrip(t *testing.T) {
+	e := EntityFromBytes(testEntity())
+	stream := e.Raw[e.opcodesStreamStart():e.textStart()]
+	for id, h := range e.Handlers {
+		if strings.Contains(h.Decompiled, "unknown") {
+			t.Fatalf("Handler %d is not decompiled: %s", id, h.Decompiled)
+		}
+		asm, err := AssembleEscScript(h.Decompiled, h.Start)
+		if err != nil {
+			t.Fatalf("Handler %d: %v", id, err)
+		}
+		for _, ref := range asm.Strings {
+			if ref.Value != "hello" {
+				t.Errorf("Unexpected string '%s'", ref.Value)
+			}
+			copy(asm.Code[ref.Pos:], stream[h.Start+ref.Pos:h.Start+ref.Pos+2])
+		}
+		if len(asm.Jumps) != 0 {
+			t.Errorf("Handler %d: jumps to decompiled lines must be resolved: %v", id, asm.Jumps)
+		}
+		if orig := stream[h.Start : h.Start+len(asm.Code)]; !bytes.Equal(asm.Code, orig) {
+			t.Errorf("Handler %d:\n% x\n% x", id, asm.Code, orig)
+		}
+	}
+}
+
+func TestAssembleEscScriptErrors(t *testing.T) {
+	for _, text := range []string{
+		"push_bool MAYBE;",
+		"push_int x;",
+		"push_string hello;",
+		"pop_jmp_if_not_zero @missing;",
+		"call_function scope(0x10), func(0x1) => int;",
+		"get_scope_int from (0x1) val 0x1000;",
+		"pop_result 1;",
+		"something;",
+	} {
+		if _, err := AssembleEscScript(text, 0); err == nil {
+			t.Errorf("'%s' assembled", text)
+		}
+	}
+}
+
+func TestReplaceHandler(t *testing.T) {
+	e := EntityFromBytes(testEntity())
+	handler2 := instructions(e.Handlers[2].Decompiled)
+
+	err := e.ReplaceHandler(1, `
+		push_string 'new';
+		pop_jmp_if_not_zero @end;
+		push_string 'hello';
+		pop_result;
+	end:
+		exit;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Name != "ent" || e.EntityUniqueID != 77 || len(e.DependsEntitiesIds) != 1 || e.DependsEntitiesIds[0] != 5 {
+		t.Errorf("Entity fields changed: %+v", e)
+	}
+	if e.StringsCount != 3 {
+		t.Errorf("StringsCount %d, expected 3", e.StringsCount)
+	}
+	if int(e.Size) != len(e.Raw) || len(e.Raw)%ENTITY_ALIGN != 0 {
+		t.Errorf("Size %d, len %d", e.Size, len(e.Raw))
+	}
+	if e.Raw[e.opcodesStreamStart()-2] != 0xaa || e.Raw[e.opcodesStreamStart()-1] != 0xbb {
+		t.Errorf("Unknown bytes before opcodes stream are not kept")
+	}
+	// old code of handler 1 is dropped
+	if expected := len(testHandler2) + 11; int(e.OpcodesStreamsSize) != 2+expected {
+		t.Errorf("OpcodesStreamsSize 0x%x, expected 0x%x", e.OpcodesStreamsSize, 2+expected)
+	}
+	if e.Handlers[2].Start != 0 {
+		t.Errorf("Handler 2 is not moved to start of stream: 0x%x", e.Handlers[2].Start)
+	}
+	if got := instructions(e.Handlers[2].Decompiled); got != handler2 {
+		t.Errorf("Handler 2 changed:\n%s\nexpected:\n%s", got, handler2)
+	}
+	if !strings.Contains(e.Handlers[2].Decompiled, "offset(+0xc)") {
+		t.Errorf("Jump of handler 2 is not relocated:\n%s", e.Handlers[2].Decompiled)
+	}
+
+	expected := "push_string 'new';\npop_jmp_if_not_zero offset;\npush_string 'hello';\npop_result;\nexit;\n"
+	if got := instructions(e.Handlers[1].Decompiled); got != expected {
+		t.Errorf("Handler 1:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	// replacing again reuses added string and moves handler 1 code
+	if err := e.ReplaceHandler(2, "push_string 'new';\npop_result;\nexit;"); err != nil {
+		t.Fatal(err)
+	}
+	if e.StringsCount != 3 {
+		t.Errorf("StringsCount %d, expected 3", e.StringsCount)
+	}
+	if got := instructions(e.Handlers[1].Decompiled); got != expected {
+		t.Errorf("Handler 1 after move:\n%s\nexpected:\n%s", got, expected)
+	}
+	if got := instructions(e.Handlers[2].Decompiled); got != "push_string 'new';\npop_result;\nexit;\n" {
+		t.Errorf("Handler 2:\n%s", got)
+	}
+
+	if err := e.ReplaceHandler(3, "exit;"); err == nil {
+		t.Errorf("Missing handler replaced")
+	}
+	if err := e.ReplaceHandler(1, "pop_jmp_if_not_zero offset(+0x7);\nexit;"); err == nil {
+		t.Errorf("Jump into middle of dropped code accepted")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"strconv"
 
 	"github.com/go-gl/mathgl/mgl32"
 
@@ -51,76 +52,12 @@ const (
 	SCOPE_LEVELDATA  = 3
 )
 
-func GetEscFunc(scope, fid uint16) string {
-	switch scope {
-	case SCOPE_ENTITY:
-		switch fid {
-		case 0x08:
-			return "Printf(format, a1,a2,a3,a4)"
-		case 0x09, 0x0a, 0x0b, 0x0c:
-			return "Get name or index of entity(index in arr[4])"
-		case 0xd:
-			return "PlayStreamedEntry? (string name)"
-
-		case 0x10:
-			return "PreLoadStreamedEntry? (unk, string name)"
-		}
-	case SCOPE_INTERNAL:
-		switch fid {
-		case 0x0:
-			return "CheckPoint ()"
-
-		case 0x2:
-			return "Load? (s1, s2)"
-		case 0x3:
-			return "LoadWad? (s1)"
-		case 0x4:
-			return "LoadForWarp? (s1)"
-		case 0x5:
-			return "Warp? ()"
-		case 0x6:
-			return "LoadCheck? (s1)"
-		case 0x7:
-			return "Goto? (s1)"
-
-		case 0x9:
-			return "AbortCutscene? (bool)"
-
-		case 0xa:
-			return "Print text on screen(type, messageID)"
-
-		case 0xc:
-			return "Idle (bool needIdle)"
-
-		case 0x13:
-			return "Trigger you have failed screen()"
-		case 0x14:
-			return "??CreateTimer??(fDuration): timer_id"
-
-		case 0x17:
-			return "??DestroyTimer??(timerId)"
-		case 0x18:
-			return "??PauseTimer_Or_TimerGetElapsedSeconds??(timerId): elapsed_sec"
-		case 0x19:
-			return "??StartTimer??(timerId)"
-
-		case 0x1f:
-			return "Print text on screen(unkn, type, messageID)"
-
-		case 0x2f:
-			return "Comlete Game"
-		}
-	}
-	return ""
-}
-
 func argsParseScopeFunc(b []byte) (scope, fid uint16) {
 	args := binary.LittleEndian.Uint16(b)
 	return args >> 12, args & 0xfff
 }
 
 func DecompileEscScript(b []byte, pointer int) string {
-	fail := false
 	var output bytes.Buffer
 
 	wrline := func(format string, args ...interface{}) {
@@ -133,11 +70,16 @@ func DecompileEscScript(b []byte, pointer int) string {
 		}
 	}()
 
-	for !fail {
+	for {
 		opcode := b[pointer]
 		output.WriteString(fmt.Sprintf("0x%.4x: %.2X:  ", pointer, opcode))
 
-		if opcode >= 0x3a {
+		op, ok := escLookupOpcode(opcode)
+		if !ok {
+			wrline("unknown opcode 0x%x;", opcode)
+			break
+		}
+		if op == &escExit {
 			wrline("exit;")
 			break
 		}
@@ -145,16 +87,16 @@ func DecompileEscScript(b []byte, pointer int) string {
 		pointer++
 		opcodeBuf := b[pointer:]
 
-		switch opcode {
-		case 0x00:
-			wrline("push_float %f;", math.Float32frombits(binary.LittleEndian.Uint32(opcodeBuf)))
-			pointer += 4
-		case 0x01:
-			wrline("push_int %d;", int32(binary.LittleEndian.Uint32(opcodeBuf)))
-			pointer += 4
-		case 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09:
+		switch op.Operand {
+		case escOperandNone:
+			wrline("%s;", op.Mnemonic)
+		case escOperandFloat:
+			// shortest representation, so assembler restores exact value
+			wrline("%s %s;", op.Mnemonic, strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(opcodeBuf))), 'f', -1, 32))
+		case escOperandInt:
+			wrline("%s %d;", op.Mnemonic, int32(binary.LittleEndian.Uint32(opcodeBuf)))
+		case escOperandScopeVar:
 			scope, fid := argsParseScopeFunc(opcodeBuf)
-			pointer += 2
 			var target string
 			if scope < 8 {
 				target = ScopeToString(scope)
@@ -163,70 +105,18 @@ func DecompileEscScript(b []byte, pointer int) string {
 			} else if scope > 8 {
 				target = "Array at 0x334A98 word[0x256]"
 			}
-			if opcode < 0x06 {
-				wrline("get_scope_%s from (0x%x)'%s' val 0x%x;", TypeIdToString(opcode-0x02), scope, target, fid)
-			} else {
-				wrline("set_scope_%s from (0x%x)'%s' val 0x%x;", TypeIdToString(opcode-0x06), scope, target, fid)
-			}
-		case 0x0a, 0x0b, 0x0c, 0x0d:
+			wrline("%s from (0x%x)'%s' val 0x%x;", op.Mnemonic, scope, target, fid)
+		case escOperandCall:
 			scope, fid := argsParseScopeFunc(opcodeBuf)
-			wrline("call_function scope(0x%x), func(0x%x) '%s' => %s;", scope, fid, GetEscFunc(scope, fid), TypeIdToString(opcode-0x0a))
-			pointer += 2
-		case 0x0e:
+			wrline("%s scope(0x%x), func(0x%x) '%s' => %s;", op.Mnemonic, scope, fid, GetEscFunc(scope, fid), TypeIdToString(op.Type))
+		case escOperandString:
 			off := binary.LittleEndian.Uint16(opcodeBuf)
-			wrline("push_string '%s';", utils.BytesToString(b[off:]))
-			pointer += 2
-		case 0x0f:
+			wrline("%s '%s';", op.Mnemonic, utils.BytesToString(b[off:]))
+		case escOperandJump:
 			off := binary.LittleEndian.Uint16(opcodeBuf)
-			wrline("pop_jmp_if_not_zero offset(+0x%x);", off)
-			pointer += 2
-
-		case 0x11:
-			wrline("push_bool TRUE;")
-		case 0x12:
-			wrline("push_bool FALSE;")
-
-		case 0x15:
-			wrline("pop_pop_int_sum_push;")
-
-		case 0x1e:
-			wrline("pop_bool2float_push;") // if input == 0 ? 1.0 : 0.0
-
-		case 0x21:
-			wrline("pop_float2int_push;")
-
-		case 0x23:
-			wrline("pop_int2float_push;")
-		case 0x24:
-			wrline("pop_push_bool_if_zero;")
-		case 0x25:
-			wrline("pop_pop_push_bool_logical_and;")
-
-		case 0x2b:
-			wrline("pop_pop_push_bool_if_not_less;")
-
-		case 0x2e:
-			wrline("pop_pop_push_bool_if_less;")
-
-		case 0x30:
-			wrline("pop_pop_strcmp_push_bool_if_less_then_zero;")
-		case 0x31:
-			wrline("pop_pop_push_bool_if_not_less")
-
-		case 0x33:
-			wrline("pop_pop_strcmp_push_bool_if_not_zero;")
-		case 0x34, 0x36:
-			wrline("pop_pop_push_bool_if_equal;")
-
-		case 0x37:
-			wrline("pop_pop_strcmp_push_bool_if_string_equal;")
-		case 0x38:
-			wrline("pop_result;")
-
-		default:
-			wrline("unknown opcode 0x%x;", opcode)
-			fail = true
+			wrline("%s offset(+0x%x);", op.Mnemonic, off)
 		}
+		pointer += op.Operand.size()
 	}
 	return output.String()
 }
@@ -247,6 +137,8 @@ type Entity struct {
 	DependsEntitiesIds []uint16
 	Name               string
 	Handlers           map[uint16]EntityHandler
+
+	Raw []byte `json:"-"`
 }
 
 func EntityFromBytes(b []byte) *Entity {
@@ -290,6 +182,7 @@ func EntityFromBytes(b []byte) *Entity {
 	}
 
 	utils.ReadBytes(&e.Matrix, b[:0x40])
+	e.Raw = append([]byte{}, b[:e.Size]...)
 	return e
 }
 
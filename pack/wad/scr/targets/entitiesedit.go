@@ -0,0 +1,205 @@
+package targets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// Entity layout: matrix at 0x00, header fields at 0x40, handlers table at 0x54
+// (HandlersCount of id u16 and start u16), DependsEntitiesCount of u16 ids,
+// opcodes section of OpcodesStreamsSize bytes (2 unknown bytes and opcodes stream)
+// and text section with entity name and strings padded up to Size.
+// Handler starts, jump and string operands are offsets relative to opcodes stream.
+
+// ENTITY_ALIGN keeps u16 and f32 fields of next entity aligned
+const ENTITY_ALIGN = 4
+
+func (e *Entity) opcodesStreamStart() int {
+	return 0x54 + int(e.HandlersCount)*4 + int(e.DependsEntitiesCount)*2 + 2
+}
+
+func (e *Entity) textStart() int {
+	return 0x54 + int(e.OpcodesStreamsSize) + int(e.HandlersCount)*4 + int(e.DependsEntitiesCount)*2
+}
+
+// text returns text section without padding
+func (e *Entity) text() []byte {
+	text := e.Raw[e.textStart():]
+	end := len(text)
+	for end > 0 && text[end-1] == 0 {
+		end--
+	}
+	if end < len(text) {
+		// keep terminator of last string
+		end++
+	}
+	return text[:end]
+}
+
+// findString returns offset of nil terminated string in text
+func findString(text []byte, bs []byte) (int, bool) {
+	for pos := 0; pos < len(text); {
+		end := bytes.IndexByte(text[pos:], 0)
+		if end < 0 {
+			break
+		}
+		if bytes.Equal(text[pos:pos+end], bs) {
+			return pos, true
+		}
+		pos += end + 1
+	}
+	return 0, false
+}
+
+type escCodeRange struct {
+	Start, End int // in old stream
+	NewStart   int
+}
+
+// relocate returns new position of old stream offset if it is code of one of ranges
+func relocate(ranges []*escCodeRange, own *escCodeRange, off int) (int, bool) {
+	if own != nil && off >= own.Start && off < own.End {
+		return off - own.Start + own.NewStart, true
+	}
+	for _, r := range ranges {
+		if off >= r.Start && off < r.End {
+			return off - r.Start + r.NewStart, true
+		}
+	}
+	return 0, false
+}
+
+// ReplaceHandler assembles text into handler and rebuilds opcodes and text sections.
+// Code of other handlers is moved with jumps and strings relocated,
+// code of replaced handler is dropped and new strings are added to text section
+func (e *Entity) ReplaceHandler(id uint16, text string) error {
+	tableIndex := -1
+	for i := 0; i < int(e.HandlersCount); i++ {
+		if binary.LittleEndian.Uint16(e.Raw[0x54+i*4:]) == id {
+			tableIndex = i
+			break
+		}
+	}
+	if tableIndex < 0 {
+		return fmt.Errorf("Entity '%s' has no handler %d", e.Name, id)
+	}
+
+	streamStart := e.opcodesStreamStart()
+	oldStream := e.Raw[streamStart:e.textStart()]
+	oldTextOff := len(oldStream)
+
+	// code of kept handlers, several handlers can share code
+	byStart := make(map[int]*escCodeRange)
+	ranges := make([]*escCodeRange, 0)
+	for i := 0; i < int(e.HandlersCount); i++ {
+		start := int(binary.LittleEndian.Uint16(e.Raw[0x54+i*4+2:]))
+		if i == tableIndex || byStart[start] != nil {
+			continue
+		}
+		r := &escCodeRange{Start: start}
+		if err := escWalk(oldStream, start, func(pos int, opcode byte, op *escOpcode) {
+			r.End = pos + 1 + op.Operand.size()
+		}); err != nil {
+			return fmt.Errorf("Cannot move handler %d of entity '%s': %v",
+				binary.LittleEndian.Uint16(e.Raw[0x54+i*4:]), e.Name, err)
+		}
+		byStart[start] = r
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+	code := make([]byte, 0, len(oldStream))
+	for _, r := range ranges {
+		r.NewStart = len(code)
+		code = append(code, oldStream[r.Start:r.End]...)
+	}
+	base := len(code)
+	asm, err := AssembleEscScript(text, base)
+	if err != nil {
+		return err
+	}
+	code = append(code, asm.Code...)
+	newTextOff := len(code)
+
+	// relocate operands of moved code
+	for _, r := range ranges {
+		var relocErr error
+		escWalk(oldStream, r.Start, func(pos int, opcode byte, op *escOpcode) {
+			operand := code[pos-r.Start+r.NewStart+1:]
+			off := int(binary.LittleEndian.Uint16(operand))
+			switch op.Operand {
+			case escOperandJump:
+				if newOff, ok := relocate(ranges, r, off); ok {
+					binary.LittleEndian.PutUint16(operand, uint16(newOff))
+				} else if relocErr == nil {
+					relocErr = fmt.Errorf("Jump at 0x%x to 0x%x is outside of kept handlers", pos, off)
+				}
+			case escOperandString:
+				if off >= oldTextOff {
+					binary.LittleEndian.PutUint16(operand, uint16(off-oldTextOff+newTextOff))
+				} else if relocErr == nil {
+					relocErr = fmt.Errorf("String at 0x%x points to opcodes 0x%x", pos, off)
+				}
+			}
+		})
+		if relocErr != nil {
+			return fmt.Errorf("Cannot move code of entity '%s': %v", e.Name, relocErr)
+		}
+	}
+	for _, j := range asm.Jumps {
+		newOff, ok := relocate(ranges, nil, j.Target)
+		if !ok {
+			return fmt.Errorf("Jump to 0x%x is outside of kept handlers", j.Target)
+		}
+		binary.LittleEndian.PutUint16(code[base+j.Pos:], uint16(newOff))
+	}
+
+	textSection := append([]byte{}, e.text()...)
+	added := 0
+	for _, ref := range asm.Strings {
+		bs := utils.StringToBytes(ref.Value, false)
+		off, ok := findString(textSection, bs)
+		if !ok {
+			off = len(textSection)
+			textSection = append(append(textSection, bs...), 0)
+			added++
+		}
+		binary.LittleEndian.PutUint16(code[base+ref.Pos:], uint16(newTextOff+off))
+	}
+
+	raw := append([]byte{}, e.Raw[:streamStart]...)
+	raw = append(append(raw, code...), textSection...)
+	for len(raw)%ENTITY_ALIGN != 0 {
+		raw = append(raw, 0)
+	}
+	if len(raw) > 0xffff || newTextOff+len(textSection) > 0xffff {
+		return fmt.Errorf("Entity '%s' is too big after edit (0x%x bytes)", e.Name, len(raw))
+	}
+
+	for i := 0; i < int(e.HandlersCount); i++ {
+		start := base
+		if i != tableIndex {
+			start = byStart[int(binary.LittleEndian.Uint16(e.Raw[0x54+i*4+2:]))].NewStart
+		}
+		binary.LittleEndian.PutUint16(raw[0x54+i*4+2:], uint16(start))
+	}
+	binary.LittleEndian.PutUint16(raw[0x44:], uint16(len(raw)))
+	// probably count of strings in text section
+	binary.LittleEndian.PutUint16(raw[0x4c:], e.StringsCount+uint16(added))
+	binary.LittleEndian.PutUint16(raw[0x52:], uint16(2+len(code)))
+
+	*e = *EntityFromBytes(raw)
+	return nil
+}
+
+func (es *Entities) MarshalToBinary() []byte {
+	var buf bytes.Buffer
+	for _, e := range es.Array {
+		buf.Write(e.Raw)
+	}
+	return buf.Bytes()
+}
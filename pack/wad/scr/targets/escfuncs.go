@@ -0,0 +1,224 @@
+package targets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+const EscFunctionsFile = "esc_functions.cfg"
+
+type EscArgument struct {
+	Name string `json:",omitempty"`
+	Type string `json:",omitempty"` // one of TypeIdToString values, empty if unknown
+}
+
+// EscFunction is entry of functions catalogue loaded from EscFunctionsFile
+type EscFunction struct {
+	Scope   uint16
+	Id      uint16
+	Name    string
+	Args    []EscArgument `json:",omitempty"`
+	Returns *EscArgument  `json:",omitempty"`
+	Notes   string        `json:",omitempty"`
+	// "gow1", "gow2", empty means function is same for every version
+	Versions []string `json:",omitempty"`
+}
+
+type EscFuncKey struct {
+	Scope uint16
+	Id    uint16
+}
+
+// escFunctionsIndex is catalogue of single gow version
+type escFunctionsIndex struct {
+	sorted []*EscFunction // by scope and id
+	byKey  map[EscFuncKey]*EscFunction
+	byName map[string][]*EscFunction // by description returned from String
+}
+
+var (
+	escFunctionsOnce sync.Once
+	escFunctionsLock sync.RWMutex
+	// by escVersionName, built when catalogue is loaded
+	escFunctionsIndexes = make(map[string]*escFunctionsIndex)
+)
+
+func escVersionName(v config.GOWVersion) string {
+	switch v {
+	case config.GOW1:
+		return "gow1"
+	case config.GOW2:
+		return "gow2"
+	}
+	return ""
+}
+
+func (f *EscFunction) String() string {
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = strings.TrimSpace(a.Name + " " + a.Type)
+	}
+	s := fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
+	if f.Returns != nil {
+		s += ": " + strings.TrimSpace(f.Returns.Name+" "+f.Returns.Type)
+	}
+	return s
+}
+
+func (f *EscFunction) validate() error {
+	isType := func(t string) bool {
+		for i := uint8(0); i < 4; i++ {
+			if TypeIdToString(i) == t {
+				return true
+			}
+		}
+		return t == ""
+	}
+	for _, a := range f.Args {
+		if !isType(a.Type) {
+			return fmt.Errorf("Function 0x%x:0x%x '%s' argument '%s' has unknown type '%s'", f.Scope, f.Id, f.Name, a.Name, a.Type)
+		}
+	}
+	if f.Returns != nil && !isType(f.Returns.Type) {
+		return fmt.Errorf("Function 0x%x:0x%x '%s' has unknown return type '%s'", f.Scope, f.Id, f.Name, f.Returns.Type)
+	}
+	for _, v := range f.Versions {
+		if v != "gow1" && v != "gow2" {
+			return fmt.Errorf("Function 0x%x:0x%x '%s' has unknown version '%s'", f.Scope, f.Id, f.Name, v)
+		}
+	}
+	return nil
+}
+
+// LoadEscFunctions reads functions catalogue from EscFunctionsFile, replacing previous one
+func LoadEscFunctions() error {
+	data, err := ioutil.ReadFile(EscFunctionsFile)
+	if err != nil {
+		return fmt.Errorf("Cannot read file %s: %v", EscFunctionsFile, err)
+	}
+
+	var funcs []*EscFunction
+	if err := json.Unmarshal(data, &funcs); err != nil {
+		return fmt.Errorf("Unmarshaling error: %v", err)
+	}
+	for _, f := range funcs {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+
+	setEscFunctions(funcs)
+	return nil
+}
+
+func setEscFunctions(funcs []*EscFunction) {
+	indexes := make(map[string]*escFunctionsIndex)
+	for _, version := range []config.GOWVersion{config.GOWunknown, config.GOW1, config.GOW2} {
+		indexes[escVersionName(version)] = newEscFunctionsIndex(funcs, escVersionName(version))
+	}
+
+	escFunctionsLock.Lock()
+	escFunctionsIndexes = indexes
+	escFunctionsLock.Unlock()
+}
+
+func loadEscFunctionsOnce() {
+	escFunctionsOnce.Do(func() {
+		if err := LoadEscFunctions(); err != nil {
+			log.Printf("[scr] Esc functions catalogue not loaded: %v", err)
+		}
+	})
+}
+
+func newEscFunctionsIndex(funcs []*EscFunction, version string) *escFunctionsIndex {
+	idx := &escFunctionsIndex{
+		byKey:  make(map[EscFuncKey]*EscFunction),
+		byName: make(map[string][]*EscFunction),
+	}
+	for _, f := range funcs {
+		key := EscFuncKey{f.Scope, f.Id}
+		if len(f.Versions) == 0 {
+			// version specific entry wins
+			if _, ok := idx.byKey[key]; !ok {
+				idx.byKey[key] = f
+			}
+			continue
+		}
+		for _, v := range f.Versions {
+			if v == version {
+				idx.byKey[key] = f
+			}
+		}
+	}
+
+	idx.sorted = make([]*EscFunction, 0, len(idx.byKey))
+	for _, f := range idx.byKey {
+		idx.sorted = append(idx.sorted, f)
+	}
+	sort.Slice(idx.sorted, func(i, j int) bool {
+		if idx.sorted[i].Scope != idx.sorted[j].Scope {
+			return idx.sorted[i].Scope < idx.sorted[j].Scope
+		}
+		return idx.sorted[i].Id < idx.sorted[j].Id
+	})
+	for _, f := range idx.sorted {
+		name := f.String()
+		idx.byName[name] = append(idx.byName[name], f)
+	}
+	return idx
+}
+
+func currentEscFunctions() *escFunctionsIndex {
+	loadEscFunctionsOnce()
+
+	escFunctionsLock.RLock()
+	defer escFunctionsLock.RUnlock()
+	if idx := escFunctionsIndexes[escVersionName(config.GetGOWVersion())]; idx != nil {
+		return idx
+	}
+	return newEscFunctionsIndex(nil, "")
+}
+
+// EscFunctions returns catalogue entries for current gow version sorted by scope and id.
+// Slice is shared, do not modify it
+func EscFunctions() []*EscFunction {
+	return currentEscFunctions().sorted
+}
+
+func LookupEscFunc(scope, fid uint16) *EscFunction {
+	return currentEscFunctions().byKey[EscFuncKey{scope, fid}]
+}
+
+// GetEscFunc returns description of function or empty string if function is unknown
+func GetEscFunc(scope, fid uint16) string {
+	if f := LookupEscFunc(scope, fid); f != nil {
+		return f.String()
+	}
+	return ""
+}
+
+// EscScriptCalls walks opcodes stream same way as DecompileEscScript and counts called functions
+func EscScriptCalls(b []byte, pointer int, counts map[EscFuncKey]int) {
+	escWalk(b, pointer, func(pos int, opcode byte, op *escOpcode) {
+		if op.Operand == escOperandCall {
+			scope, fid := argsParseScopeFunc(b[pos+1:])
+			counts[EscFuncKey{scope, fid}]++
+		}
+	})
+}
+
+// CountEscCalls adds calls of every handler of every entity to counts
+func (es *Entities) CountEscCalls(counts map[EscFuncKey]int) {
+	for _, e := range es.Array {
+		for _, h := range e.Handlers {
+			EscScriptCalls(h.Stream, h.Start, counts)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package targets
+
+import (
+	"fmt"
+	"sort"
+)
+
+type escOperand int
+
+const (
+	escOperandNone     escOperand = iota
+	escOperandFloat               // f32 value
+	escOperandInt                 // i32 value
+	escOperandScopeVar            // u16 scope<<12|id
+	escOperandCall                // u16 scope<<12|id
+	escOperandString              // u16 offset of string relative to opcodes stream
+	escOperandJump                // u16 offset relative to opcodes stream
+)
+
+func (o escOperand) size() int {
+	switch o {
+	case escOperandNone:
+		return 0
+	case escOperandFloat, escOperandInt:
+		return 4
+	default:
+		return 2
+	}
+}
+
+type escOpcode struct {
+	Mnemonic string
+	Operand  escOperand
+	Type     uint8 // value type of scope vars and return type of calls, see TypeIdToString
+}
+
+// any opcode starting from escOpcodeExit stops script
+const escOpcodeExit = 0x3a
+
+var escExit = escOpcode{Mnemonic: "exit"}
+
+// escOpcodes is description of every known opcode, used by decompiler and assembler
+var escOpcodes = map[byte]escOpcode{
+	0x00: {"push_float", escOperandFloat, 0},
+	0x01: {"push_int", escOperandInt, 1},
+	0x02: {"get_scope_float", escOperandScopeVar, 0},
+	0x03: {"get_scope_int", escOperandScopeVar, 1},
+	0x04: {"get_scope_bool", escOperandScopeVar, 2},
+	0x05: {"get_scope_string", escOperandScopeVar, 3},
+	0x06: {"set_scope_float", escOperandScopeVar, 0},
+	0x07: {"set_scope_int", escOperandScopeVar, 1},
+	0x08: {"set_scope_bool", escOperandScopeVar, 2},
+	0x09: {"set_scope_string", escOperandScopeVar, 3},
+	0x0a: {"call_function", escOperandCall, 0},
+	0x0b: {"call_function", escOperandCall, 1},
+	0x0c: {"call_function", escOperandCall, 2},
+	0x0d: {"call_function", escOperandCall, 3},
+	0x0e: {"push_string", escOperandString, 3},
+	0x0f: {"pop_jmp_if_not_zero", escOperandJump, 0},
+	0x11: {"push_bool TRUE", escOperandNone, 2},
+	0x12: {"push_bool FALSE", escOperandNone, 2},
+	0x15: {"pop_pop_int_sum_push", escOperandNone, 0},
+	0x1e: {"pop_bool2float_push", escOperandNone, 0}, // if input == 0 ? 1.0 : 0.0
+	0x21: {"pop_float2int_push", escOperandNone, 0},
+	0x23: {"pop_int2float_push", escOperandNone, 0},
+	0x24: {"pop_push_bool_if_zero", escOperandNone, 0},
+	0x25: {"pop_pop_push_bool_logical_and", escOperandNone, 0},
+	0x2b: {"pop_pop_push_bool_if_not_less", escOperandNone, 0},
+	0x2e: {"pop_pop_push_bool_if_less", escOperandNone, 0},
+	0x30: {"pop_pop_strcmp_push_bool_if_less_then_zero", escOperandNone, 0},
+	0x31: {"pop_pop_push_bool_if_not_less", escOperandNone, 0},
+	0x33: {"pop_pop_strcmp_push_bool_if_not_zero", escOperandNone, 0},
+	0x34: {"pop_pop_push_bool_if_equal", escOperandNone, 0},
+	0x36: {"pop_pop_push_bool_if_equal", escOperandNone, 0},
+	0x37: {"pop_pop_strcmp_push_bool_if_string_equal", escOperandNone, 0},
+	0x38: {"pop_result", escOperandNone, 0},
+}
+
+// escOpcodesByMnemonic lists opcodes with same mnemonic in ascending order
+var escOpcodesByMnemonic = func() map[string][]byte {
+	result := make(map[string][]byte)
+	for opcode, op := range escOpcodes {
+		result[op.Mnemonic] = append(result[op.Mnemonic], opcode)
+	}
+	for _, opcodes := range result {
+		sort.Slice(opcodes, func(i, j int) bool { return opcodes[i] < opcodes[j] })
+	}
+	return result
+}()
+
+func escLookupOpcode(opcode byte) (*escOpcode, bool) {
+	if opcode >= escOpcodeExit {
+		return &escExit, true
+	}
+	op, ok := escOpcodes[opcode]
+	return &op, ok
+}
+
+// escWalk calls cb for every instruction starting from pointer until exit instruction.
+// Operand of instruction is b[pos+1:pos+1+op.Operand.size()]
+func escWalk(b []byte, pointer int, cb func(pos int, opcode byte, op *escOpcode)) error {
+	for {
+		if pointer >= len(b) {
+			return fmt.Errorf("Script at 0x%x has no exit", pointer)
+		}
+		opcode := b[pointer]
+		op, ok := escLookupOpcode(opcode)
+		if !ok {
+			return fmt.Errorf("Unknown opcode 0x%x at 0x%x", opcode, pointer)
+		}
+		if pointer+1+op.Operand.size() > len(b) {
+			return fmt.Errorf("Operand of opcode 0x%x at 0x%x is out of stream", opcode, pointer)
+		}
+		cb(pointer, opcode, op)
+		if op == &escExit {
+			return nil
+		}
+		pointer += 1 + op.Operand.size()
+	}
+}
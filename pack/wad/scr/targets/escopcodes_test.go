@@ -0,0 +1,76 @@
+package targets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+func setTestEscFunctions(funcs []*EscFunction) {
+	escFunctionsOnce.Do(func() {})
+	setEscFunctions(funcs)
+}
+
+func TestEscFuncByName(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+	setTestEscFunctions([]*EscFunction{
+		{Scope: 0, Id: 9, Name: "GetEntity", Args: []EscArgument{{Name: "index"}}},
+		{Scope: 0, Id: 10, Name: "GetEntity", Args: []EscArgument{{Name: "index"}}},
+		{Scope: 1, Id: 0, Name: "CheckPoint"},
+	})
+	defer setTestEscFunctions(nil)
+
+	if scope, id, err := escFuncByName("CheckPoint()"); err != nil || scope != 1 || id != 0 {
+		t.Errorf("CheckPoint: %v %v %v", scope, id, err)
+	}
+	if _, _, err := escFuncByName("GetEntity(index)"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Ambiguous name accepted: %v", err)
+	}
+	if _, _, err := escFuncByName("Unknown()"); err == nil {
+		t.Errorf("Unknown name accepted")
+	}
+	if _, err := AssembleEscScript("call_function 'GetEntity(index)' => int;", 0); err == nil {
+		t.Errorf("Ambiguous call assembled")
+	}
+}
+
+func TestLookupEscFuncVersions(t *testing.T) {
+	common := &EscFunction{Scope: 0, Id: 1, Name: "Common"}
+	gow2 := &EscFunction{Scope: 0, Id: 1, Name: "Gow2Only", Versions: []string{"gow2"}}
+	setTestEscFunctions([]*EscFunction{gow2, common, {Scope: 2, Id: 0, Name: "Other"}})
+	defer setTestEscFunctions(nil)
+	defer config.SetGOWVersion(config.GOW1)
+
+	config.SetGOWVersion(config.GOW1)
+	if f := LookupEscFunc(0, 1); f != common {
+		t.Errorf("gow1 lookup got %v", f)
+	}
+	config.SetGOWVersion(config.GOW2)
+	if f := LookupEscFunc(0, 1); f != gow2 {
+		t.Errorf("gow2 lookup got %v", f)
+	}
+	if funcs := EscFunctions(); len(funcs) != 2 || funcs[0] != gow2 || funcs[1].Name != "Other" {
+		t.Errorf("Unexpected catalogue %v", funcs)
+	}
+	if f := LookupEscFunc(3, 3); f != nil {
+		t.Errorf("Unknown function found %v", f)
+	}
+}
+
+func TestEscScriptCalls(t *testing.T) {
+	stream := []byte{
+		0x01, 1, 0, 0, 0, // push_int 1
+		0x0b, 0x09, 0x00, // call 0:9 => int
+		0x0f, 0x00, 0x00, // pop_jmp_if_not_zero
+		0x0a, 0x00, 0x10, // call 1:0 => float
+		0x0b, 0x09, 0x00, // call 0:9 => int
+		0x3a,
+		0x0a, 0x05, 0x00, // after exit
+	}
+	counts := make(map[EscFuncKey]int)
+	EscScriptCalls(stream, 0, counts)
+	if len(counts) != 2 || counts[EscFuncKey{0, 9}] != 2 || counts[EscFuncKey{1, 0}] != 1 {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+}
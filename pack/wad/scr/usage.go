@@ -0,0 +1,155 @@
+package scr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/scr/targets"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+type EscFunctionUsage struct {
+	Scope     uint16
+	Id        uint16
+	ScopeName string
+	Function  *targets.EscFunction `json:",omitempty"` // nil if function is not in catalogue
+	Calls     int
+	Scripts   int // count of script resources calling function
+}
+
+type EscFunctionsReport struct {
+	Functions []*EscFunctionUsage
+	Errors    []string
+}
+
+type escUsageCounter struct {
+	calls   map[targets.EscFuncKey]int
+	scripts map[targets.EscFuncKey]int
+	errors  []string
+}
+
+func newEscUsageCounter() *escUsageCounter {
+	return &escUsageCounter{
+		calls:   make(map[targets.EscFuncKey]int),
+		scripts: make(map[targets.EscFuncKey]int),
+		errors:  make([]string, 0),
+	}
+}
+
+func (c *escUsageCounter) addWad(w *wad.Wad) {
+	for _, n := range w.Nodes {
+		// skip links and non script tags without loading every resource
+		if w.GetNodeById(n.Id) != n || n.Tag == nil || len(n.Tag.Data) < HEADER_SIZE ||
+			binary.LittleEndian.Uint32(n.Tag.Data) != SCRIPT_MAGIC {
+			continue
+		}
+		inst, _, err := w.GetInstanceFromNode(n.Id)
+		if err != nil {
+			c.errors = append(c.errors, fmt.Sprintf("%s: %s: %v", w.Name(), n.Tag.Name, err))
+			continue
+		}
+		sp, ok := inst.(*ScriptParams)
+		if !ok {
+			continue
+		}
+		if entities, ok := sp.Data.(*targets.Entities); ok {
+			counts := make(map[targets.EscFuncKey]int)
+			entities.CountEscCalls(counts)
+			for key, count := range counts {
+				c.calls[key] += count
+				c.scripts[key]++
+			}
+		}
+	}
+}
+
+// report lists every catalogue function and every unknown called function,
+// most called functions first
+func (c *escUsageCounter) report() *EscFunctionsReport {
+	usages := make(map[targets.EscFuncKey]*EscFunctionUsage)
+	get := func(key targets.EscFuncKey) *EscFunctionUsage {
+		if u, ok := usages[key]; ok {
+			return u
+		}
+		u := &EscFunctionUsage{Scope: key.Scope, Id: key.Id, ScopeName: targets.ScopeToString(key.Scope)}
+		usages[key] = u
+		return u
+	}
+	for _, f := range targets.EscFunctions() {
+		get(targets.EscFuncKey{Scope: f.Scope, Id: f.Id}).Function = f
+	}
+	for key, count := range c.calls {
+		u := get(key)
+		u.Calls = count
+		u.Scripts = c.scripts[key]
+	}
+
+	report := &EscFunctionsReport{Functions: make([]*EscFunctionUsage, 0, len(usages)), Errors: c.errors}
+	for _, u := range usages {
+		report.Functions = append(report.Functions, u)
+	}
+	sort.Slice(report.Functions, func(i, j int) bool {
+		a, b := report.Functions[i], report.Functions[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Id < b.Id
+	})
+	return report
+}
+
+func escFunctionsAction(rw http.ResponseWriter, r *http.Request, fill func(c *escUsageCounter) error) error {
+	if r.FormValue("reload") != "" {
+		if err := targets.LoadEscFunctions(); err != nil {
+			return err
+		}
+	}
+	c := newEscUsageCounter()
+	if err := fill(c); err != nil {
+		return err
+	}
+	webutils.WriteJson(rw, c.report())
+	return nil
+}
+
+func init() {
+	wad.SetActionHandler("escfunctions", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		return escFunctionsAction(rw, r, func(c *escUsageCounter) error {
+			c.addWad(w)
+			return nil
+		})
+	})
+	pack.SetActionHandler("escfunctions", func(d vfs.Directory, rw http.ResponseWriter, r *http.Request) error {
+		return escFunctionsAction(rw, r, func(c *escUsageCounter) error {
+			files, err := d.List()
+			if err != nil {
+				return err
+			}
+			sort.Strings(files)
+			for _, name := range files {
+				if strings.ToUpper(filepath.Ext(name)) != ".WAD" {
+					continue
+				}
+				inst, err := pack.GetInstanceHandler(d, name)
+				if err != nil {
+					c.errors = append(c.errors, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				if w, ok := inst.(*wad.Wad); ok {
+					c.addWad(w)
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package shg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mdl "github.com/mogaika/god_of_war_browser/pack/wad/mdl"
+	file_mesh "github.com/mogaika/god_of_war_browser/pack/wad/mesh"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// ObjectPair is shadow object together with mesh part it probably belongs to.
+// Objects are matched with parts of model meshes by order
+type ObjectPair struct {
+	Index   int
+	Mesh    string `json:",omitempty"`
+	Part    int
+	JointId uint16
+	Object  *Object
+}
+
+type Ajax struct {
+	Name    string
+	Model   string `json:",omitempty"`
+	Objects []ObjectPair
+}
+
+// findModel returns model node owning shadow lod: parent node or node with lod name
+func (sl *ShadowLod) findModel(wrsrc *wad.WadNodeRsrc) (*wad.Node, *file_mdl.Model) {
+	candidates := []*wad.Node{wrsrc.Wad.GetNodeById(wrsrc.Node.Parent)}
+	if sl.Name != "" {
+		candidates = append(candidates, wrsrc.Wad.GetNodeByName(sl.Name, wrsrc.Node.Id, false))
+	}
+	for _, n := range candidates {
+		if n == nil {
+			continue
+		}
+		if inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id); err == nil {
+			if mdl, ok := inst.(*file_mdl.Model); ok {
+				return n, mdl
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (sl *ShadowLod) pairObjects(wrsrc *wad.WadNodeRsrc) *Ajax {
+	ajax := &Ajax{
+		Name:    sl.Name,
+		Objects: make([]ObjectPair, len(sl.Objects)),
+	}
+	for i, o := range sl.Objects {
+		ajax.Objects[i] = ObjectPair{Index: i, Part: -1, Object: o}
+	}
+
+	modelNode, _ := sl.findModel(wrsrc)
+	if modelNode == nil {
+		return ajax
+	}
+	ajax.Model = modelNode.Tag.Name
+
+	i := 0
+	for _, id := range modelNode.SubGroupNodes {
+		n := wrsrc.Wad.GetNodeById(id)
+		inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			continue
+		}
+		mesh, ok := inst.(*file_mesh.Mesh)
+		if !ok {
+			continue
+		}
+		for iPart := range mesh.Parts {
+			if i >= len(ajax.Objects) {
+				return ajax
+			}
+			ajax.Objects[i].Mesh = n.Tag.Name
+			ajax.Objects[i].Part = iPart
+			ajax.Objects[i].JointId = mesh.Parts[iPart].JointId
+			i++
+		}
+	}
+	return ajax
+}
+
+// ExportObj writes render mesh of owning model (if found) and shadow volumes of every object
+func (sl *ShadowLod) ExportObj(wrsrc *wad.WadNodeRsrc, w io.Writer) error {
+	if modelNode, mdl := sl.findModel(wrsrc); mdl != nil {
+		bones := make([]mgl32.Mat4, mdl.JointsCount)
+		for i := range bones {
+			bones[i] = mgl32.Ident4()
+		}
+		if _, err := mdl.ExportObj(wrsrc.Wad.GetNodeResourceByNodeId(modelNode.Id), bones,
+			wrsrc.Name()+".mtl", w, ioutil.Discard); err != nil {
+			return fmt.Errorf("Error exporting model '%s': %v", modelNode.Tag.Name, err)
+		}
+	}
+
+	// relative indexes used, so vertices of model are not counted
+	bw := bufio.NewWriter(w)
+	for i, o := range sl.Objects {
+		g := o.Geometry()
+
+		fmt.Fprintf(bw, "o shadow_%d\n", i)
+		for _, v := range g.Vertices {
+			fmt.Fprintf(bw, "v %f %f %f\n", v[0], v[1], v[2])
+		}
+		for _, face := range g.Faces {
+			if face == nil {
+				continue
+			}
+			fmt.Fprintf(bw, "f")
+			for _, v := range face {
+				fmt.Fprintf(bw, " %d", v-len(g.Vertices))
+			}
+			fmt.Fprintf(bw, "\n")
+		}
+
+		if len(g.Points) != 0 {
+			fmt.Fprintf(bw, "o shadow_points_%d\n", i)
+			for _, p := range g.Points {
+				fmt.Fprintf(bw, "v %f %f %f\n", p[0], p[1], p[2])
+			}
+			fmt.Fprintf(bw, "p")
+			for j := range g.Points {
+				fmt.Fprintf(bw, " %d", j-len(g.Points))
+			}
+			fmt.Fprintf(bw, "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+func (sl *ShadowLod) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "obj":
+		var buf bytes.Buffer
+		if err := sl.ExportObj(wrsrc, &buf); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Name()+".obj")
+	default:
+		webutils.WriteError(w, fmt.Errorf("Unknown action '%s'", action))
+	}
+}
@@ -0,0 +1,168 @@
+package shg
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const geometryEpsilon = 1e-3
+
+// ShadowGeometry is interpretation of shadow object vectors:
+// Vectors3 are probably shadow volume vertices (xyz) and
+// Vectors4 are planes bounding volume (normal xyz, distance w).
+// Volume is rebuilt from planes, so PointsOnPlanes shows how good guess is
+type ShadowGeometry struct {
+	Points []mgl32.Vec3
+
+	// corners of convex volume bounded by planes
+	Vertices []mgl32.Vec3
+	// polygon of every plane (indexes of Vertices), nil if plane not touches volume
+	Faces [][]int
+
+	// sign of plane distance, plane equation is n.p + DistanceSign*w = 0
+	DistanceSign   float32
+	PointsOnPlanes int
+}
+
+func planeDistance(plane mgl32.Vec4, sign float32, p mgl32.Vec3) float32 {
+	return plane.Vec3().Dot(p) + sign*plane[3]
+}
+
+func (so *Object) countPointsOnPlanes(points []mgl32.Vec3, sign float32) int {
+	count := 0
+	for _, p := range points {
+		for _, plane := range so.Vectors4 {
+			if d := planeDistance(plane, sign, p); d > -geometryEpsilon && d < geometryEpsilon {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Geometry builds convex volume from planes of object.
+// Every triple of planes is intersected, so it is used only by export
+func (so *Object) Geometry() *ShadowGeometry {
+	g := &ShadowGeometry{
+		Points:       make([]mgl32.Vec3, len(so.Vectors3)),
+		Vertices:     make([]mgl32.Vec3, 0),
+		Faces:        make([][]int, len(so.Vectors4)),
+		DistanceSign: 1,
+	}
+	for i, v := range so.Vectors3 {
+		g.Points[i] = v.Vec3()
+	}
+
+	if neg := so.countPointsOnPlanes(g.Points, -1); neg > so.countPointsOnPlanes(g.Points, 1) {
+		g.DistanceSign = -1
+	}
+	g.PointsOnPlanes = so.countPointsOnPlanes(g.Points, g.DistanceSign)
+
+	// reference point inside of volume, used to orient planes
+	var center mgl32.Vec3
+	if len(g.Points) != 0 {
+		for _, p := range g.Points {
+			center = center.Add(p)
+		}
+		center = center.Mul(1 / float32(len(g.Points)))
+	} else {
+		center = so.Vector1.Vec3()
+	}
+
+	planes := make([]mgl32.Vec4, len(so.Vectors4))
+	for i, plane := range so.Vectors4 {
+		// orient plane so inside of volume is negative
+		if planeDistance(plane, g.DistanceSign, center) > 0 {
+			plane = plane.Mul(-1)
+		}
+		planes[i] = plane
+	}
+
+	inside := func(p mgl32.Vec3) bool {
+		for _, plane := range planes {
+			if planeDistance(plane, g.DistanceSign, p) > geometryEpsilon {
+				return false
+			}
+		}
+		return true
+	}
+
+	addVertex := func(p mgl32.Vec3) int {
+		for i, v := range g.Vertices {
+			if v.ApproxEqualThreshold(p, geometryEpsilon) {
+				return i
+			}
+		}
+		g.Vertices = append(g.Vertices, p)
+		return len(g.Vertices) - 1
+	}
+
+	facePoints := make([]map[int]bool, len(planes))
+	for i := range facePoints {
+		facePoints[i] = make(map[int]bool)
+	}
+	for a := 0; a < len(planes); a++ {
+		for b := a + 1; b < len(planes); b++ {
+			for c := b + 1; c < len(planes); c++ {
+				p, ok := intersectPlanes(planes[a], planes[b], planes[c], g.DistanceSign)
+				if !ok || !inside(p) {
+					continue
+				}
+				v := addVertex(p)
+				for i, plane := range planes {
+					if d := planeDistance(plane, g.DistanceSign, p); d > -geometryEpsilon && d < geometryEpsilon {
+						facePoints[i][v] = true
+					}
+				}
+			}
+		}
+	}
+
+	for i, points := range facePoints {
+		if len(points) >= 3 {
+			g.Faces[i] = g.sortFace(planes[i].Vec3(), points)
+		}
+	}
+	return g
+}
+
+// intersectPlanes solves n1.p = -s*w1, n2.p = -s*w2, n3.p = -s*w3
+func intersectPlanes(p1, p2, p3 mgl32.Vec4, sign float32) (mgl32.Vec3, bool) {
+	n1, n2, n3 := p1.Vec3(), p2.Vec3(), p3.Vec3()
+	det := n1.Dot(n2.Cross(n3))
+	if math.Abs(float64(det)) < 1e-6 {
+		return mgl32.Vec3{}, false
+	}
+	p := n2.Cross(n3).Mul(-sign * p1[3]).
+		Add(n3.Cross(n1).Mul(-sign * p2[3])).
+		Add(n1.Cross(n2).Mul(-sign * p3[3]))
+	return p.Mul(1 / det), true
+}
+
+// sortFace orders vertices of face counter clockwise around outer normal
+func (g *ShadowGeometry) sortFace(normal mgl32.Vec3, points map[int]bool) []int {
+	face := make([]int, 0, len(points))
+	var center mgl32.Vec3
+	for v := range points {
+		face = append(face, v)
+		center = center.Add(g.Vertices[v])
+	}
+	center = center.Mul(1 / float32(len(face)))
+
+	axisX := g.Vertices[face[0]].Sub(center)
+	if axisX.Len() < 1e-6 {
+		axisX = normal.Cross(mgl32.Vec3{0, 0, 1})
+	}
+	axisX = axisX.Normalize()
+	axisY := normal.Normalize().Cross(axisX)
+
+	angle := func(v int) float64 {
+		d := g.Vertices[v].Sub(center)
+		return math.Atan2(float64(d.Dot(axisY)), float64(d.Dot(axisX)))
+	}
+	sort.Slice(face, func(i, j int) bool { return angle(face[i]) < angle(face[j]) })
+	return face
+}
@@ -72,7 +72,7 @@ func NewFromData(buf []byte) (*ShadowLod, error) {
 }
 
 func (sl *ShadowLod) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
-	return sl, nil
+	return sl.pairObjects(wrsrc), nil
 }
 
 func init() {
@@ -0,0 +1,100 @@
+package shg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+)
+
+// testCubeLod returns shadow lod with single object: corners and planes of cube with size 2
+func testCubeLod() []byte {
+	points := make([]mgl32.Vec4, 0, 8)
+	for i := 0; i < 8; i++ {
+		points = append(points, mgl32.Vec4{float32(i&1*2 - 1), float32(i>>1&1*2 - 1), float32(i>>2&1*2 - 1), 1})
+	}
+	planes := []mgl32.Vec4{{1, 0, 0, -1}, {-1, 0, 0, -1}, {0, 1, 0, -1}, {0, -1, 0, -1}, {0, 0, 1, -1}, {0, 0, -1, -1}}
+
+	object := make([]byte, 0x30)
+	binary.LittleEndian.PutUint16(object[0x12:], uint16(len(points)))
+	binary.LittleEndian.PutUint16(object[0x14:], uint16(len(planes)))
+	var buf bytes.Buffer
+	buf.Write(object)
+	binary.Write(&buf, binary.LittleEndian, points)
+	binary.Write(&buf, binary.LittleEndian, planes)
+
+	header := make([]byte, 0x20)
+	copy(header[4:], "SHADOW")
+	binary.LittleEndian.PutUint32(header[0x10:], 1)
+	binary.LittleEndian.PutUint32(header[0x14:], 0x18)
+	binary.LittleEndian.PutUint32(header[0x18:], 0x20)
+	return append(header, buf.Bytes()...)
+}
+
+func TestParseAndExportObj(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	sl := &ShadowLod{}
+	if err := sl.Parse(testCubeLod()); err != nil {
+		t.Fatal(err)
+	}
+	if sl.Name != "SHADOW" || len(sl.Objects) != 1 || len(sl.Objects[0].Vectors3) != 8 || len(sl.Objects[0].Vectors4) != 6 {
+		t.Fatalf("Unexpected lod %+v", sl)
+	}
+
+	g := sl.Objects[0].Geometry()
+	if len(g.Vertices) != 8 || g.PointsOnPlanes != 8 {
+		t.Errorf("Got %d vertices, %d points on planes", len(g.Vertices), g.PointsOnPlanes)
+	}
+	for i, face := range g.Faces {
+		if len(face) != 4 {
+			t.Errorf("Face %d: %v", i, face)
+		}
+	}
+
+	// lod without owning model, so only shadow volumes are exported
+	w := &wad.Wad{Tags: []wad.Tag{{Name: "SHADOW", Size: 1}}}
+	w.Nodes = []*wad.Node{{Tag: &w.Tags[0], Parent: wad.NODE_INVALID}}
+	wrsrc := &wad.WadNodeRsrc{Node: w.Nodes[0], Wad: w, Tag: &w.Tags[0]}
+	var obj bytes.Buffer
+	if err := sl.ExportObj(wrsrc, &obj); err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for _, l := range strings.Split(strings.TrimSpace(obj.String()), "\n") {
+		fields := strings.Fields(l)
+		count[fields[0]]++
+		if fields[0] != "f" {
+			continue
+		}
+		// relative indexes must point to vertices of shadow object
+		for _, idx := range fields[1:] {
+			if v, err := strconv.Atoi(idx); err != nil || v < -8 || v > -1 {
+				t.Errorf("Invalid face index in '%s'", l)
+			}
+		}
+	}
+	if count["o"] != 2 || count["v"] != 16 || count["f"] != 6 || count["p"] != 1 {
+		t.Errorf("Unexpected obj %v:\n%s", count, obj.String())
+	}
+
+	// volume is not built for marshal
+	data, err := sl.Marshal(wrsrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(doc), "Vertices") {
+		t.Errorf("Marshal contains geometry: %s", doc)
+	}
+}
@@ -21,25 +21,49 @@ func (txr *Texture) ChangeTexture(wrsrc *wad.WadNodeRsrc, fNewImage io.Reader) e
 		return err
 	}
 
+	updates, err := txr.changeTextureData(wrsrc, img)
+	if err != nil {
+		return err
+	}
+	return wrsrc.Wad.UpdateTagsData(updates)
+}
+
+func (txr *Texture) getGfxAndPalNodes(wrsrc *wad.WadNodeRsrc) (*wad.Node, *wad.Node, error) {
 	if txr.GfxName == "" || txr.PalName == "" {
-		return fmt.Errorf("Do not support texture with lod levels")
+		return nil, nil, fmt.Errorf("Do not support texture with lod levels")
 	}
 
 	gfxcn := wrsrc.Wad.GetNodeByName(txr.GfxName, wrsrc.Node.Id, false)
+	if gfxcn == nil {
+		return nil, nil, fmt.Errorf("Cannot find gfx: %s", txr.GfxName)
+	}
 	palcn := wrsrc.Wad.GetNodeByName(txr.PalName, wrsrc.Node.Id, false)
+	if palcn == nil {
+		return nil, nil, fmt.Errorf("Cannot find pal: %s", txr.PalName)
+	}
+	return gfxcn, palcn, nil
+}
+
+// changeTextureData converts image to gfx and pal data
+// returns new tags data without saving wad, so multiple textures can be changed at once
+func (txr *Texture) changeTextureData(wrsrc *wad.WadNodeRsrc, img image.Image) (map[wad.TagId][]byte, error) {
+	gfxcn, palcn, err := txr.getGfxAndPalNodes(wrsrc)
+	if err != nil {
+		return nil, err
+	}
 
 	gfxcw, _, gfxErr := wrsrc.Wad.GetInstanceFromNode(gfxcn.Id)
 	palcw, _, palErr := wrsrc.Wad.GetInstanceFromNode(palcn.Id)
 
-	gfxc := gfxcw.(*file_gfx.GFX)
-	palc := palcw.(*file_gfx.GFX)
-
 	if gfxErr != nil || palErr != nil {
-		return fmt.Errorf("Cannot get gfx or pal instance: %v, %v", gfxErr, palErr)
+		return nil, fmt.Errorf("Cannot get gfx or pal instance: %v, %v", gfxErr, palErr)
 	}
 
+	gfxc := gfxcw.(*file_gfx.GFX)
+	palc := palcw.(*file_gfx.GFX)
+
 	if len(gfxc.Data) != 1 {
-		return fmt.Errorf("Do not support gfx with DatasCount != 1")
+		return nil, fmt.Errorf("Do not support gfx with DatasCount != 1")
 	}
 
 	b := img.Bounds().Max
@@ -64,23 +88,23 @@ func (txr *Texture) ChangeTexture(wrsrc *wad.WadNodeRsrc, fNewImage io.Reader) e
 	if len(palc.Data) == 2 {
 		log.Println("Detected grayscale palette. Calculating new grayscale palette...")
 		if err := gfxSecondPaletteToGrayscale(palc); err != nil {
-			return fmt.Errorf("Error when calculating grayscale palette: %v", err)
+			return nil, fmt.Errorf("Error when calculating grayscale palette: %v", err)
 		}
 	}
 
 	gfxBinRaw, err := gfxc.MarshalToBinary()
 	if err != nil {
-		return fmt.Errorf("gfxc.MarshalToBinary(): %v", err)
+		return nil, fmt.Errorf("gfxc.MarshalToBinary(): %v", err)
 	}
 
 	palBinRaw, err := palc.MarshalToBinary()
 	if err != nil {
-		return fmt.Errorf("palc.MarshalToBinary(): %v", err)
+		return nil, fmt.Errorf("palc.MarshalToBinary(): %v", err)
 	}
-	return wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
+	return map[wad.TagId][]byte{
 		gfxcn.Tag.Id: gfxBinRaw,
 		palcn.Tag.Id: palBinRaw,
-	})
+	}, nil
 }
 
 func gfxSecondPaletteToGrayscale(palc *file_gfx.GFX) error {
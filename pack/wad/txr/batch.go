@@ -0,0 +1,282 @@
+package txr
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_gfx "github.com/mogaika/god_of_war_browser/pack/wad/gfx"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+type BatchReportEntry struct {
+	Wad     string
+	File    string
+	Texture string `json:",omitempty"`
+	Reason  string `json:",omitempty"`
+}
+
+type BatchReport struct {
+	Matched []BatchReportEntry
+	Skipped []BatchReportEntry
+	Failed  []BatchReportEntry
+}
+
+func newBatchReport() *BatchReport {
+	return &BatchReport{
+		Matched: make([]BatchReportEntry, 0),
+		Skipped: make([]BatchReportEntry, 0),
+		Failed:  make([]BatchReportEntry, 0),
+	}
+}
+
+type batchImage struct {
+	f       *zip.File
+	wad     string
+	texture string
+}
+
+// parseBatchFileName accepts "<TXR name>.png" and "<wad>/<TXR name>.png" names
+func parseBatchFileName(name string) (wadName string, txrName string, err error) {
+	dir, file := path.Split(name)
+	dir = strings.Trim(dir, "/")
+	if strings.Contains(dir, "/") {
+		return "", "", fmt.Errorf("Too deep directory structure")
+	}
+
+	ext := path.Ext(file)
+	switch strings.ToLower(ext) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+	default:
+		return "", "", fmt.Errorf("Not an image")
+	}
+	return dir, strings.TrimSuffix(file, ext), nil
+}
+
+func collectBatchImages(zr *zip.Reader, report *BatchReport) []batchImage {
+	images := make([]batchImage, 0)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		wadName, txrName, err := parseBatchFileName(f.Name)
+		if err != nil {
+			report.Skipped = append(report.Skipped, BatchReportEntry{File: f.Name, Reason: err.Error()})
+			continue
+		}
+		images = append(images, batchImage{f: f, wad: wadName, texture: txrName})
+	}
+	return images
+}
+
+func (bi *batchImage) decode() (image.Image, error) {
+	rc, err := bi.f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	img, _, err := image.Decode(rc)
+	return img, err
+}
+
+func findTextureNode(w *wad.Wad, name string) *wad.Node {
+	if n := w.GetNodeByName(name, 0, true); n != nil {
+		return n
+	}
+	if !strings.HasPrefix(name, "TXR_") {
+		return w.GetNodeByName("TXR_"+name, 0, true)
+	}
+	return nil
+}
+
+// replaceTexturesInWad changes all matched textures and saves wad once
+func replaceTexturesInWad(w *wad.Wad, images []batchImage, allowResize bool, report *BatchReport) error {
+	updates := make(map[wad.TagId][]byte)
+
+	for _, bi := range images {
+		entry := BatchReportEntry{Wad: w.Name(), File: bi.f.Name}
+		fail := func(format string, args ...interface{}) {
+			entry.Reason = fmt.Sprintf(format, args...)
+			report.Failed = append(report.Failed, entry)
+		}
+
+		node := findTextureNode(w, bi.texture)
+		if node == nil {
+			entry.Reason = fmt.Sprintf("Cannot find texture '%s'", bi.texture)
+			report.Skipped = append(report.Skipped, entry)
+			continue
+		}
+		entry.Texture = node.Tag.Name
+
+		inst, _, err := w.GetInstanceFromNode(node.Id)
+		if err != nil {
+			fail("Cannot get texture instance: %v", err)
+			continue
+		}
+		txr, ok := inst.(*Texture)
+		if !ok {
+			entry.Reason = fmt.Sprintf("'%s' is not a texture", node.Tag.Name)
+			report.Skipped = append(report.Skipped, entry)
+			continue
+		}
+
+		wrsrc := w.GetNodeResourceByNodeId(node.Id)
+		gfxcn, palcn, err := txr.getGfxAndPalNodes(wrsrc)
+		if err != nil {
+			fail("Format mismatch: %v", err)
+			continue
+		}
+		if _, ex := updates[gfxcn.Tag.Id]; ex {
+			fail("Gfx '%s' shared with already replaced texture", txr.GfxName)
+			continue
+		}
+		if _, ex := updates[palcn.Tag.Id]; ex {
+			fail("Pal '%s' shared with already replaced texture", txr.PalName)
+			continue
+		}
+
+		gfxcw, _, err := w.GetInstanceFromNode(gfxcn.Id)
+		if err != nil {
+			fail("Cannot get gfx instance: %v", err)
+			continue
+		}
+		gfxc := gfxcw.(*file_gfx.GFX)
+
+		img, err := bi.decode()
+		if err != nil {
+			fail("Cannot decode image: %v", err)
+			continue
+		}
+
+		size := img.Bounds().Size()
+		if !allowResize && (uint32(size.X) != gfxc.Width || uint32(size.Y) != gfxc.RealHeight) {
+			fail("Dimension mismatch: image %dx%d, texture %dx%d", size.X, size.Y, gfxc.Width, gfxc.RealHeight)
+			continue
+		}
+		if size.X&(size.X-1) != 0 || size.Y&(size.Y-1) != 0 {
+			fail("Format mismatch: image %dx%d dimensions are not power of two", size.X, size.Y)
+			continue
+		}
+
+		txrUpdates, err := txr.changeTextureData(wrsrc, img)
+		if err != nil {
+			fail("Change texture error: %v", err)
+			continue
+		}
+		for id, data := range txrUpdates {
+			updates[id] = data
+		}
+		report.Matched = append(report.Matched, entry)
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	log.Printf("[txr] Batch updating %d tags in %s", len(updates), w.Name())
+	return w.UpdateTagsData(updates)
+}
+
+// ReplaceTexturesFromZip changes textures of wad using "<TXR name>.png" or "<wad>/<TXR name>.png" images of archive
+func ReplaceTexturesFromZip(w *wad.Wad, zr *zip.Reader, allowResize bool) (*BatchReport, error) {
+	report := newBatchReport()
+
+	images := make([]batchImage, 0)
+	for _, bi := range collectBatchImages(zr, report) {
+		if bi.wad == "" || strings.EqualFold(bi.wad, w.Name()) {
+			images = append(images, bi)
+		} else {
+			report.Skipped = append(report.Skipped, BatchReportEntry{
+				Wad: bi.wad, File: bi.f.Name, Reason: "Image is for another wad"})
+		}
+	}
+
+	return report, replaceTexturesInWad(w, images, allowResize, report)
+}
+
+// ReplaceTexturesInPack changes textures of multiple wads using "<wad>/<TXR name>.png" images of archive
+func ReplaceTexturesInPack(d vfs.Directory, zr *zip.Reader, allowResize bool) (*BatchReport, error) {
+	report := newBatchReport()
+
+	wads := make(map[string][]batchImage)
+	for _, bi := range collectBatchImages(zr, report) {
+		if bi.wad == "" {
+			report.Skipped = append(report.Skipped, BatchReportEntry{
+				File: bi.f.Name, Reason: "Wad name not provided"})
+		} else {
+			wads[bi.wad] = append(wads[bi.wad], bi)
+		}
+	}
+
+	wadNames := make([]string, 0, len(wads))
+	for wadName := range wads {
+		wadNames = append(wadNames, wadName)
+	}
+	sort.Strings(wadNames)
+
+	for _, wadName := range wadNames {
+		failAll := func(reason string) {
+			for _, bi := range wads[wadName] {
+				report.Failed = append(report.Failed, BatchReportEntry{
+					Wad: wadName, File: bi.f.Name, Reason: reason})
+			}
+		}
+
+		inst, err := pack.GetInstanceHandler(d, wadName)
+		if err != nil {
+			failAll(fmt.Sprintf("Cannot open wad: %v", err))
+			continue
+		}
+		w, ok := inst.(*wad.Wad)
+		if !ok {
+			failAll(fmt.Sprintf("'%s' is not a wad", wadName))
+			continue
+		}
+		if err := replaceTexturesInWad(w, wads[wadName], allowResize, report); err != nil {
+			return report, fmt.Errorf("Error saving wad '%s': %v", wadName, err)
+		}
+	}
+
+	return report, nil
+}
+
+func batchReplaceFromRequest(rw http.ResponseWriter, r *http.Request, replace func(zr *zip.Reader, allowResize bool) (*BatchReport, error)) error {
+	fZip, hZip, err := r.FormFile("data")
+	if err != nil {
+		return err
+	}
+	defer fZip.Close()
+
+	zr, err := zip.NewReader(fZip, hZip.Size)
+	if err != nil {
+		return err
+	}
+
+	report, err := replace(zr, r.FormValue("allowresize") != "")
+	if err != nil {
+		return err
+	}
+	webutils.WriteJson(rw, report)
+	return nil
+}
+
+func init() {
+	wad.SetActionHandler("replacetextures", func(w *wad.Wad, rw http.ResponseWriter, r *http.Request) error {
+		return batchReplaceFromRequest(rw, r, func(zr *zip.Reader, allowResize bool) (*BatchReport, error) {
+			return ReplaceTexturesFromZip(w, zr, allowResize)
+		})
+	})
+	pack.SetActionHandler("replacetextures", func(d vfs.Directory, rw http.ResponseWriter, r *http.Request) error {
+		return batchReplaceFromRequest(rw, r, func(zr *zip.Reader, allowResize bool) (*BatchReport, error) {
+			return ReplaceTexturesInPack(d, zr, allowResize)
+		})
+	})
+}
@@ -15,6 +15,9 @@ import (
 
 const WAD_ITEM_SIZE = 0x20
 
+// tag name is not nil terminated when it takes whole field
+const TAG_NAME_SIZE = 24
+
 type File interface {
 	Marshal(rsrc *WadNodeRsrc) (interface{}, error)
 }
@@ -125,7 +128,7 @@ func MarshalTag(t *Tag) []byte {
 	binary.LittleEndian.PutUint16(buf[0:2], t.Tag)
 	binary.LittleEndian.PutUint16(buf[2:4], t.Flags)
 	binary.LittleEndian.PutUint32(buf[4:8], t.Size)
-	copy(buf[8:32], utils.StringToBytesBuffer(t.Name, 24, false))
+	copy(buf[8:8+TAG_NAME_SIZE], utils.StringToBytesBuffer(t.Name, TAG_NAME_SIZE, false))
 	return buf
 }
 
@@ -305,10 +308,42 @@ func (w *Wad) GetNodeByName(name string, searchStart NodeId, searchForward bool)
 	return nil
 }
 
+// GetNodeTagsRange returns first and last tag of node including tags of its subgroup.
+// Group start tag precedes tag of node that owns group
+func (w *Wad) GetNodeTagsRange(nodeId NodeId) (TagId, TagId, error) {
+	n := w.Nodes[nodeId]
+	if n.Tag.Id == 0 || !isGroupStartTag(&w.Tags[n.Tag.Id-1]) {
+		return n.Tag.Id, n.Tag.Id, nil
+	}
+
+	first := n.Tag.Id - 1
+	depth := 0
+	for i := first; int(i) < len(w.Tags); i++ {
+		if isGroupStartTag(&w.Tags[i]) {
+			depth++
+		} else if isGroupEndTag(&w.Tags[i]) {
+			depth--
+			if depth == 0 {
+				return first, i, nil
+			}
+		}
+	}
+	return first, first, fmt.Errorf("Group of node %d-%s is not closed", n.Id, n.Tag.Name)
+}
+
 func alignToWadTag(pos int) int {
 	return ((pos + 15) / 16) * 16
 }
 
+type SaveHandler func(wad *Wad)
+
+var gSaveHandlers []SaveHandler
+
+// AddSaveHandler registers callback called after wad saved, used to drop data cached for wad
+func AddSaveHandler(h SaveHandler) {
+	gSaveHandlers = append(gSaveHandlers, h)
+}
+
 func (w *Wad) Save(tags []Tag) error {
 	var buf bytes.Buffer
 
@@ -335,7 +370,13 @@ func (w *Wad) Save(tags []Tag) error {
 		return fmt.Errorf("Error when parsing tags: %v", err)
 	}
 
-	return w.Source.Save(io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len())))
+	if err := w.Source.Save(io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len()))); err != nil {
+		return err
+	}
+	for _, h := range gSaveHandlers {
+		h(w)
+	}
+	return nil
 }
 
 func (w *Wad) InsertNewTags(insertAfterId TagId, newTags []Tag) error {
@@ -10,6 +10,23 @@ import (
 	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
+type ActionHandler func(wad *Wad, w http.ResponseWriter, r *http.Request) error
+
+var gActionHandlers map[string]ActionHandler = make(map[string]ActionHandler, 0)
+
+// SetActionHandler registers action that operates on whole wad instead of single resource
+func SetActionHandler(action string, h ActionHandler) {
+	gActionHandlers[action] = h
+}
+
+func (wad *Wad) WebHandlerCallHttpAction(w http.ResponseWriter, r *http.Request, action string) error {
+	if h, ex := gActionHandlers[action]; ex {
+		return h(wad, w, r)
+	} else {
+		return fmt.Errorf("Cannot find wad action handler for '%s'", action)
+	}
+}
+
 func (wad *Wad) WebHandlerForNodeByTagId(w http.ResponseWriter, tagId TagId) error {
 	tag := wad.GetTagById(tagId)
 	node := wad.GetNodeById(tag.NodeId)
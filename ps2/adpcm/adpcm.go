@@ -17,6 +17,14 @@ var vag_f = [5][2]float64{
 type AdpcmStream struct {
 	hist1 float64
 	hist2 float64
+
+	// loop found by block flags during Unpack, in output samples
+	Loop *Loop
+
+	pos          int
+	loopStart    int
+	hasLoopStart bool
+	ended        bool
 }
 
 func AdpcmSizeToWaveSize(size int) int {
@@ -42,6 +50,8 @@ func (stream *AdpcmStream) Unpack(packs []byte) ([]byte, error) {
 			continue
 		}
 
+		stream.trackFlags(packs[blockStart+1])
+
 		predict_nr := uint32(packs[blockStart])
 		shift_factor := predict_nr & 0xf
 		predict_nr >>= 4
@@ -78,6 +88,43 @@ func (stream *AdpcmStream) Unpack(packs []byte) ([]byte, error) {
 	return result[:iResultPos], nil
 }
 
+// trackFlags updates loop state by flags of next block
+func (stream *AdpcmStream) trackFlags(flags byte) {
+	if !stream.ended {
+		if flags&FlagLoopStart != 0 && !stream.hasLoopStart {
+			stream.loopStart = stream.pos
+			stream.hasLoopStart = true
+		}
+		// all flags on single block is used as end marker, not as loop
+		if flags&FlagLoopEnd != 0 {
+			if flags&FlagLoopRepeat != 0 && stream.loopStart != stream.pos {
+				stream.Loop = &Loop{Start: stream.loopStart, End: stream.pos + BlockSamples}
+			}
+			stream.ended = true
+		}
+	}
+	stream.pos += BlockSamples
+}
+
+// ScanFlags tracks loop by block flags without decoding, so stream can be scanned by parts.
+// Returns true when end of sound reached and rest of stream can be skipped
+func (stream *AdpcmStream) ScanFlags(packs []byte) bool {
+	for iBlock := 0; iBlock < len(packs)/16 && !stream.ended; iBlock++ {
+		if packs[iBlock*16] == 0xc0 {
+			continue
+		}
+		stream.trackFlags(packs[iBlock*16+1])
+	}
+	return stream.ended
+}
+
+// FindLoop scans block flags without decoding, returns nil if stream is not looped
+func FindLoop(packs []byte) *Loop {
+	var stream AdpcmStream
+	stream.ScanFlags(packs)
+	return stream.Loop
+}
+
 func NewAdpcmStream() *AdpcmStream {
 	return &AdpcmStream{}
 }
@@ -0,0 +1,191 @@
+package adpcm
+
+import (
+	"math"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// block flags (second byte of block)
+const (
+	FlagLoopEnd    = 1 // jump to loop start, mute if FlagLoopRepeat not set
+	FlagLoopRepeat = 2
+	FlagLoopStart  = 4
+)
+
+const BlockSamples = 28
+
+// Loop in samples, End is exclusive. Sound is padded and loop is fitted to blocks on encoding
+type Loop = utils.WaveLoop
+
+// decodeSample mimics Unpack, including int16 overflow of output
+func decodeSample(nibble int, shift uint, predicted float64) (float64, int16) {
+	v := float64(int16(nibble<<12)>>shift) + predicted
+	return v, int16(int(v + 0.5))
+}
+
+// packBlock tries every filter and shift and encodes block with least square error
+func (stream *AdpcmStream) packBlock(samples []int16, flags byte) [16]byte {
+	var block [16]byte
+	var best [BlockSamples]int
+	bestErr := math.Inf(1)
+	bestFilter, bestShift := 0, uint(0)
+	bestHist1, bestHist2 := stream.hist1, stream.hist2
+
+	var nibbles [BlockSamples]int
+	for filter := range vag_f {
+		for shift := uint(0); shift <= 12; shift++ {
+			step := float64(int(1) << (12 - shift))
+			hist1, hist2 := stream.hist1, stream.hist2
+			err := 0.0
+			for i := 0; i < BlockSamples; i++ {
+				target := 0.0
+				if i < len(samples) {
+					target = float64(samples[i])
+				}
+				predicted := hist1*vag_f[filter][0] + hist2*vag_f[filter][1]
+				nibble := int(math.Floor((target-predicted)/step + 0.5))
+				if nibble > 7 {
+					nibble = 7
+				} else if nibble < -8 {
+					nibble = -8
+				}
+				v, out := decodeSample(nibble, shift, predicted)
+				// overflowed output is wrapped by decoder, so move nibble towards zero
+				for nibble != 0 && math.Abs(v+0.5-float64(out)) > 1 {
+					if nibble > 0 {
+						nibble--
+					} else {
+						nibble++
+					}
+					v, out = decodeSample(nibble, shift, predicted)
+				}
+				d := float64(out) - target
+				err += d * d
+				if err >= bestErr {
+					break
+				}
+				nibbles[i] = nibble
+				hist2, hist1 = hist1, v
+			}
+			if err < bestErr {
+				bestErr = err
+				best = nibbles
+				bestFilter, bestShift = filter, shift
+				bestHist1, bestHist2 = hist1, hist2
+			}
+		}
+	}
+
+	stream.hist1, stream.hist2 = bestHist1, bestHist2
+	block[0] = byte(bestFilter<<4) | byte(bestShift)
+	block[1] = flags
+	for i := 0; i < BlockSamples; i += 2 {
+		block[2+i/2] = byte(best[i]&0xf) | byte(best[i+1]&0xf)<<4
+	}
+	return block
+}
+
+// Pack encodes 16 bit pcm samples to adpcm blocks. Last block is padded with silence
+func (stream *AdpcmStream) Pack(samples []int16, flags func(iBlock int) byte) []byte {
+	blocks := (len(samples) + BlockSamples - 1) / BlockSamples
+	result := make([]byte, 0, blocks*16)
+	for iBlock := 0; iBlock < blocks; iBlock++ {
+		end := (iBlock + 1) * BlockSamples
+		if end > len(samples) {
+			end = len(samples)
+		}
+		var f byte
+		if flags != nil {
+			f = flags(iBlock)
+		}
+		block := stream.packBlock(samples[iBlock*BlockSamples:end], f)
+		result = append(result, block[:]...)
+	}
+	return result
+}
+
+// loops shorter than this are repeated until length is multiple of block, longer are stretched
+const maxLoopUnroll = 1 << 16
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// alignLoop pads start of sound with silence, so loop starts on block boundary,
+// and makes loop length multiple of block. Loop is repeated several times if it is short,
+// otherwise it is periodically stretched by less than half of block. Sound after loop is dropped
+func alignLoop(samples []int16, loop *Loop) ([]int16, *Loop) {
+	start, end := loop.Start, loop.End
+	if end > len(samples) {
+		end = len(samples)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start >= end {
+		return samples, nil
+	}
+
+	body := samples[start:end]
+	if length := len(body); length%BlockSamples != 0 {
+		if repeats := BlockSamples / gcd(length, BlockSamples); repeats*length <= maxLoopUnroll {
+			body = make([]int16, 0, repeats*length)
+			for i := 0; i < repeats; i++ {
+				body = append(body, samples[start:end]...)
+			}
+		} else {
+			// linear interpolation wrapping to loop start, so jump stays seamless
+			newLength := (length + BlockSamples/2) / BlockSamples * BlockSamples
+			body = make([]int16, newLength)
+			for i := range body {
+				pos := float64(i) * float64(length) / float64(newLength)
+				i0 := int(pos)
+				i1 := (i0 + 1) % length
+				f := pos - float64(i0)
+				body[i] = int16(math.Floor(float64(samples[start+i0])*(1-f) + float64(samples[start+i1])*f + 0.5))
+			}
+		}
+	}
+
+	pad := (BlockSamples - start%BlockSamples) % BlockSamples
+	result := make([]int16, pad, pad+start+len(body))
+	result = append(result, samples[:start]...)
+	result = append(result, body...)
+	return result, &Loop{Start: pad + start, End: len(result)}
+}
+
+// Encode compresses mono stream. Sound without loop is terminated with FlagLoopEnd,
+// looped sound is aligned to blocks (see alignLoop) and cut after loop end block
+func Encode(samples []int16, loop *Loop) []byte {
+	if loop != nil {
+		samples, loop = alignLoop(samples, loop)
+	}
+	blocks := (len(samples) + BlockSamples - 1) / BlockSamples
+	if blocks == 0 {
+		blocks = 1
+		samples = make([]int16, BlockSamples)
+	}
+	startBlock, endBlock := -1, blocks-1
+	if loop != nil {
+		startBlock = loop.Start / BlockSamples
+		endBlock = loop.End/BlockSamples - 1
+	}
+
+	return NewAdpcmStream().Pack(samples, func(iBlock int) byte {
+		var flags byte
+		if startBlock != -1 && iBlock >= startBlock {
+			flags |= FlagLoopRepeat
+			if iBlock == startBlock {
+				flags |= FlagLoopStart
+			}
+		}
+		if iBlock == endBlock {
+			flags |= FlagLoopEnd
+		}
+		return flags
+	})
+}
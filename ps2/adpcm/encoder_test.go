@@ -0,0 +1,108 @@
+package adpcm
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	samples := make([]int16, 28*100+5)
+	for i := range samples {
+		samples[i] = int16(20000*math.Sin(float64(i)*0.05) + 8000*math.Sin(float64(i)*0.31))
+	}
+
+	packed := Encode(samples, nil)
+	if len(packed) != 101*16 {
+		t.Fatalf("Wrong size %d", len(packed))
+	}
+	if packed[len(packed)-15] != FlagLoopEnd {
+		t.Errorf("Last block has flags %x", packed[len(packed)-15])
+	}
+
+	pcm, err := NewAdpcmStream().Unpack(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signal, noise float64
+	for i, s := range samples {
+		d := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) - float64(s)
+		signal += float64(s) * float64(s)
+		noise += d * d
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < 30 {
+		t.Errorf("Poor quality, snr %.1f db", snr)
+	}
+}
+
+func TestEncodeLoopFlags(t *testing.T) {
+	packed := Encode(make([]int16, 28*10), &Loop{Start: 28 * 2, End: 28 * 6})
+	if len(packed) != 6*16 {
+		t.Fatalf("Loop end must cut stream, size %d", len(packed))
+	}
+	expected := []byte{0, 0, 6, 2, 2, 3}
+	for i, flags := range expected {
+		if packed[i*16+1] != flags {
+			t.Errorf("Block %d flags %x, expected %x", i, packed[i*16+1], flags)
+		}
+	}
+}
+
+func TestEncodeLoopAlign(t *testing.T) {
+	samples := make([]int16, 50000)
+	for i := range samples {
+		samples[i] = int16(12000*math.Sin(float64(i)*0.07) + 6000*math.Sin(float64(i)*0.013))
+	}
+
+	for _, loop := range []Loop{{Start: 59, End: 59 + 150}, {Start: 3, End: 3 + 28*20}, {Start: 100, End: 100 + 30001}} {
+		packed := Encode(samples, &loop)
+		stream := NewAdpcmStream()
+		pcm, err := stream.Unpack(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := stream.Loop
+		if decoded == nil || decoded.Start%BlockSamples != 0 || decoded.End*2 != len(pcm) {
+			t.Fatalf("Loop %v decoded as %v, pcm samples %d", loop, decoded, len(pcm)/2)
+		}
+		length := loop.End - loop.Start
+		stretched := (decoded.End-decoded.Start)%length != 0
+		if diff := decoded.End - decoded.Start - length; stretched && (diff > BlockSamples/2 || diff < -BlockSamples/2) {
+			t.Errorf("Loop %v length changed by %d", loop, diff)
+		}
+
+		// compare loop region and samples before it with input
+		pad := decoded.Start - loop.Start
+		var signal, noise float64
+		for i := pad; i < decoded.End; i++ {
+			src := i - pad
+			if src >= loop.Start {
+				pos := src - loop.Start
+				if stretched {
+					pos = int(float64(pos)*float64(length)/float64(decoded.End-decoded.Start) + 0.5)
+				}
+				src = loop.Start + pos%length
+			}
+			d := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) - float64(samples[src])
+			signal += float64(samples[src]) * float64(samples[src])
+			noise += d * d
+		}
+		if snr := 10 * math.Log10(signal/noise); snr < 25 {
+			t.Errorf("Loop %v region differs from input, snr %.1f db", loop, snr)
+		}
+	}
+}
+
+func TestUnpackLoop(t *testing.T) {
+	packed := Encode(make([]int16, 28*10), &Loop{Start: 28 * 2, End: 28 * 6})
+	stream := NewAdpcmStream()
+	if _, err := stream.Unpack(packed); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Loop == nil || *stream.Loop != (Loop{Start: 28 * 2, End: 28 * 6}) {
+		t.Errorf("Invalid loop %v", stream.Loop)
+	}
+	if loop := FindLoop(Encode(make([]int16, 28*10), nil)); loop != nil {
+		t.Errorf("Unexpected loop %v", loop)
+	}
+}
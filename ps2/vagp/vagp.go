@@ -4,20 +4,24 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
+const HeaderSize = 0x30
+
 type VAGP struct {
 	WaveData   []byte `json:"-"`
 	Channels   byte
 	SampleRate uint32
+	header     [HeaderSize]byte
 }
 
 func NewVAGPFromReader(r io.Reader) (*VAGP, error) {
-	var buf [0x30]byte
+	var buf [HeaderSize]byte
 	if _, err := r.Read(buf[:]); err != nil {
 		return nil, err
 	}
@@ -30,6 +34,7 @@ func NewVAGPFromReader(r io.Reader) (*VAGP, error) {
 		Channels:   buf[0x1E],
 		SampleRate: binary.BigEndian.Uint32(buf[0x10:0x14]),
 		WaveData:   make([]byte, binary.BigEndian.Uint32(buf[0xC:0x10])),
+		header:     buf,
 	}
 
 	if _, err := r.Read(vagp.WaveData); err != nil {
@@ -41,13 +46,13 @@ func NewVAGPFromReader(r io.Reader) (*VAGP, error) {
 
 func (vagp *VAGP) AsWave() (*bytes.Buffer, error) {
 	if vagp.Channels > 1 {
-		panic("Not mono not supported")
+		return nil, fmt.Errorf("Unsupported channels count %d, only mono supported", vagp.Channels)
 	}
 
 	var buf bytes.Buffer
 
-	//WaveWriteHeader(w io.Writer, channels int16, sampleRate uint32, dataSize uint32) error {
-	if err := utils.WaveWriteHeader(&buf, 1, vagp.SampleRate, uint32((len(vagp.WaveData)/16)*28*2)); err != nil {
+	loop := adpcm.FindLoop(vagp.WaveData)
+	if err := utils.WaveWriteHeaderLoop(&buf, 1, vagp.SampleRate, uint32((len(vagp.WaveData)/16)*28*2), loop); err != nil {
 		return nil, err
 	}
 
@@ -59,3 +64,28 @@ func (vagp *VAGP) AsWave() (*bytes.Buffer, error) {
 
 	return &buf, nil
 }
+
+// Marshal returns vag file, unknown header fields are kept from parsed file
+func (vagp *VAGP) Marshal() []byte {
+	result := make([]byte, HeaderSize+len(vagp.WaveData))
+	copy(result, vagp.header[:])
+	copy(result[0:4], []byte{0x56, 0x41, 0x47, 0x70})
+	binary.BigEndian.PutUint32(result[0xC:], uint32(len(vagp.WaveData)))
+	binary.BigEndian.PutUint32(result[0x10:], vagp.SampleRate)
+	copy(result[HeaderSize:], vagp.WaveData)
+	return result
+}
+
+// ReplaceWave encodes wave into vag. Wave is mixed to mono and resampled to rate,
+// if rate is 0 then sample rate of vag is used. If loop is nil then loop of wave is used
+func (vagp *VAGP) ReplaceWave(wav *utils.Wave, rate uint32, loop *adpcm.Loop) {
+	if rate == 0 {
+		rate = vagp.SampleRate
+	}
+	wav = wav.Remix(1).Resample(rate)
+	if loop == nil {
+		loop = wav.Loop
+	}
+	vagp.SampleRate = rate
+	vagp.WaveData = adpcm.Encode(wav.Samples[0], loop)
+}
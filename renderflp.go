@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/flp"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+// renderFlp renders frames of flp referenced as "WADNAME/FLP_name" into png file
+func renderFlp(rootfs vfs.Directory, path string, frames string, columns int, out string) error {
+	i := strings.LastIndexByte(path, '/')
+	if i == -1 {
+		return fmt.Errorf("Flp path must be in format 'wadname/flpname'")
+	}
+	wadName, flpName := path[:i], path[i+1:]
+
+	inst, err := pack.GetInstanceHandler(rootfs, wadName)
+	if err != nil {
+		return err
+	}
+	w, ok := inst.(*file_wad.Wad)
+	if !ok {
+		return fmt.Errorf("'%s' is not a wad file", wadName)
+	}
+
+	for _, node := range w.Nodes {
+		if node.Tag.Name != flpName {
+			continue
+		}
+		inst, _, err := w.GetInstanceFromNode(node.Id)
+		if err != nil {
+			return fmt.Errorf("Cannot parse %s: %v", flpName, err)
+		}
+		f, ok := inst.(*flp.FLP)
+		if !ok {
+			continue
+		}
+
+		opts := &flp.RenderOptions{Columns: columns}
+		if opts.Frames, err = flp.ParseRenderFrames(frames); err != nil {
+			return err
+		}
+		data, err := f.RenderPng(w.GetNodeResourceByNodeId(node.Id), opts)
+		if err != nil {
+			return err
+		}
+		if out == "" {
+			out = flpName + ".png"
+		}
+		return ioutil.WriteFile(out, data, 0666)
+	}
+	return fmt.Errorf("Cannot find flp '%s' in '%s'", flpName, wadName)
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
@@ -53,6 +54,21 @@ func StringToBytesBuffer(s string, bufSize int, nilTerminate bool) []byte {
 	return bs
 }
 
+// CheckStringBuffer returns error if string does not fit StringToBytesBuffer with same arguments
+func CheckStringBuffer(s string, bufSize int, nilTerminate bool) error {
+	bs, _, err := transform.Bytes(charmap.Windows1252.NewEncoder(), []byte(s))
+	if err != nil {
+		return fmt.Errorf("Cannot encode '%s': %v", s, err)
+	}
+	if nilTerminate {
+		bs = append(bs, 0)
+	}
+	if len(bs) > bufSize {
+		return fmt.Errorf("'%s' is too long, limit is %d bytes", s, bufSize)
+	}
+	return nil
+}
+
 func StringToBytes(s string, nilTerminate bool) []byte {
 	bs, _, err := transform.Bytes(charmap.Windows1252.NewEncoder(), []byte(s))
 	if err != nil {
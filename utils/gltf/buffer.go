@@ -0,0 +1,217 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+const (
+	GLB_MAGIC      = 0x46546c67 // "glTF"
+	GLB_CHUNK_JSON = 0x4e4f534a // "JSON"
+	GLB_CHUNK_BIN  = 0x004e4942 // "BIN\0"
+)
+
+// AddBufferView appends data to binary chunk aligned to 4 bytes
+func (doc *Document) AddBufferView(data []byte, target int) int {
+	for len(doc.bin)%4 != 0 {
+		doc.bin = append(doc.bin, 0)
+	}
+	doc.BufferViews = append(doc.BufferViews, BufferView{
+		Buffer:     0,
+		ByteOffset: len(doc.bin),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	doc.bin = append(doc.bin, data...)
+	return len(doc.BufferViews) - 1
+}
+
+func (doc *Document) addAccessor(data []byte, target int, a Accessor) int {
+	bv := doc.AddBufferView(data, target)
+	a.BufferView = &bv
+	doc.Accessors = append(doc.Accessors, a)
+	return len(doc.Accessors) - 1
+}
+
+func floatsToBytes(f []float32) []byte {
+	buf := make([]byte, len(f)*4)
+	for i, v := range f {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// minMax calculates per component bounds, required for POSITION and animation input accessors
+func minMax(f []float32, components int) ([]float32, []float32) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	min := make([]float32, components)
+	max := make([]float32, components)
+	copy(min, f[:components])
+	copy(max, f[:components])
+	for i := components; i < len(f); i++ {
+		c := i % components
+		if f[i] < min[c] {
+			min[c] = f[i]
+		}
+		if f[i] > max[c] {
+			max[c] = f[i]
+		}
+	}
+	return min, max
+}
+
+func (doc *Document) addFloatAccessor(f []float32, components int, typ string, target int, bounds bool) int {
+	a := Accessor{
+		ComponentType: COMPONENT_FLOAT,
+		Count:         len(f) / components,
+		Type:          typ,
+	}
+	if bounds {
+		a.Min, a.Max = minMax(f, components)
+	}
+	return doc.addAccessor(floatsToBytes(f), target, a)
+}
+
+func (doc *Document) AddScalarFloats(f []float32, bounds bool) int {
+	return doc.addFloatAccessor(f, 1, "SCALAR", 0, bounds)
+}
+
+func (doc *Document) AddVec2(v [][2]float32) int {
+	f := make([]float32, 0, len(v)*2)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 2, "VEC2", TARGET_ARRAY_BUFFER, false)
+}
+
+// AddVec3 stores vertex attribute, bounds are required for positions
+func (doc *Document) AddVec3(v [][3]float32, bounds bool) int {
+	f := make([]float32, 0, len(v)*3)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 3, "VEC3", TARGET_ARRAY_BUFFER, bounds)
+}
+
+func (doc *Document) AddVec4(v [][4]float32) int {
+	f := make([]float32, 0, len(v)*4)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 4, "VEC4", TARGET_ARRAY_BUFFER, false)
+}
+
+// AddAnimationVec* functions store sampler output, which is not vertex attribute
+func (doc *Document) AddAnimationVec3(v [][3]float32) int {
+	f := make([]float32, 0, len(v)*3)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 3, "VEC3", 0, false)
+}
+
+func (doc *Document) AddAnimationVec2(v [][2]float32) int {
+	f := make([]float32, 0, len(v)*2)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 2, "VEC2", 0, false)
+}
+
+func (doc *Document) AddAnimationVec4(v [][4]float32) int {
+	f := make([]float32, 0, len(v)*4)
+	for _, e := range v {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 4, "VEC4", 0, false)
+}
+
+func (doc *Document) AddMat4(m [][16]float32) int {
+	f := make([]float32, 0, len(m)*16)
+	for _, e := range m {
+		f = append(f, e[:]...)
+	}
+	return doc.addFloatAccessor(f, 16, "MAT4", 0, false)
+}
+
+// AddJoints stores JOINTS_0 attribute
+func (doc *Document) AddJoints(j [][4]uint16) int {
+	buf := make([]byte, len(j)*8)
+	for i, e := range j {
+		for c := range e {
+			binary.LittleEndian.PutUint16(buf[i*8+c*2:], e[c])
+		}
+	}
+	return doc.addAccessor(buf, TARGET_ARRAY_BUFFER, Accessor{
+		ComponentType: COMPONENT_UNSIGNED_SHORT,
+		Count:         len(j),
+		Type:          "VEC4",
+	})
+}
+
+func (doc *Document) AddIndices(indices []uint32) int {
+	buf := make([]byte, len(indices)*4)
+	for i, v := range indices {
+		binary.LittleEndian.PutUint32(buf[i*4:], v)
+	}
+	return doc.addAccessor(buf, TARGET_ELEMENT_ARRAY_BUFFER, Accessor{
+		ComponentType: COMPONENT_UNSIGNED_INT,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+}
+
+func writeGlbChunk(w io.Writer, typ uint32, data []byte, pad byte) error {
+	padded := len(data)
+	for padded%4 != 0 {
+		padded++
+	}
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(padded))
+	binary.LittleEndian.PutUint32(hdr[4:], typ)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.Repeat([]byte{pad}, padded-len(data)))
+	return err
+}
+
+// EncodeGLB writes binary glTF container with json and bin chunks
+func (doc *Document) EncodeGLB(w io.Writer) error {
+	if len(doc.bin) != 0 {
+		doc.Buffers = []Buffer{{ByteLength: len(doc.bin)}}
+	}
+
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	total := 12 + 8 + len(jsonData) + (4-len(jsonData)%4)%4
+	if len(doc.bin) != 0 {
+		total += 8 + len(doc.bin) + (4-len(doc.bin)%4)%4
+	}
+
+	var hdr [12]byte
+	binary.LittleEndian.PutUint32(hdr[0:], GLB_MAGIC)
+	binary.LittleEndian.PutUint32(hdr[4:], 2)
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(total))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if err := writeGlbChunk(w, GLB_CHUNK_JSON, jsonData, ' '); err != nil {
+		return err
+	}
+	if len(doc.bin) != 0 {
+		return writeGlbChunk(w, GLB_CHUNK_BIN, doc.bin, 0)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package gltf
+
+// Minimal glTF 2.0 document builder with binary (.glb) encoding
+// https://registry.khronos.org/glTF/specs/2.0/glTF-2.0.html
+
+const (
+	COMPONENT_BYTE           = 5120
+	COMPONENT_UNSIGNED_BYTE  = 5121
+	COMPONENT_SHORT          = 5122
+	COMPONENT_UNSIGNED_SHORT = 5123
+	COMPONENT_UNSIGNED_INT   = 5125
+	COMPONENT_FLOAT          = 5126
+)
+
+const (
+	TARGET_ARRAY_BUFFER         = 34962
+	TARGET_ELEMENT_ARRAY_BUFFER = 34963
+)
+
+const (
+	MODE_POINTS         = 0
+	MODE_LINES          = 1
+	MODE_TRIANGLES      = 4
+	MODE_TRIANGLE_STRIP = 5
+)
+
+const (
+	FILTER_NEAREST = 9728
+	FILTER_LINEAR  = 9729
+)
+
+const (
+	WRAP_CLAMP_TO_EDGE   = 33071
+	WRAP_MIRRORED_REPEAT = 33648
+	WRAP_REPEAT          = 10497
+)
+
+type Asset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type Scene struct {
+	Name   string      `json:"name,omitempty"`
+	Nodes  []int       `json:"nodes"`
+	Extras interface{} `json:"extras,omitempty"`
+}
+
+type Node struct {
+	Name        string                 `json:"name,omitempty"`
+	Children    []int                  `json:"children,omitempty"`
+	Matrix      *[16]float32           `json:"matrix,omitempty"`
+	Translation *[3]float32            `json:"translation,omitempty"`
+	Rotation    *[4]float32            `json:"rotation,omitempty"`
+	Scale       *[3]float32            `json:"scale,omitempty"`
+	Mesh        *int                   `json:"mesh,omitempty"`
+	Skin        *int                   `json:"skin,omitempty"`
+	Extensions  map[string]interface{} `json:"extensions,omitempty"`
+	Extras      interface{}            `json:"extras,omitempty"`
+}
+
+type Primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices,omitempty"`
+	Material   *int           `json:"material,omitempty"`
+	Mode       int            `json:"mode"`
+	Extras     interface{}    `json:"extras,omitempty"`
+}
+
+type Mesh struct {
+	Name       string      `json:"name,omitempty"`
+	Primitives []Primitive `json:"primitives"`
+	Extras     interface{} `json:"extras,omitempty"`
+}
+
+type Skin struct {
+	Name                string `json:"name,omitempty"`
+	InverseBindMatrices *int   `json:"inverseBindMatrices,omitempty"`
+	Skeleton            *int   `json:"skeleton,omitempty"`
+	Joints              []int  `json:"joints"`
+}
+
+type TextureInfo struct {
+	Index      int                    `json:"index"`
+	TexCoord   int                    `json:"texCoord,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type PbrMetallicRoughness struct {
+	BaseColorFactor  *[4]float32  `json:"baseColorFactor,omitempty"`
+	BaseColorTexture *TextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float32      `json:"metallicFactor"`
+	RoughnessFactor  float32      `json:"roughnessFactor"`
+}
+
+type Material struct {
+	Name                 string                 `json:"name,omitempty"`
+	PbrMetallicRoughness *PbrMetallicRoughness  `json:"pbrMetallicRoughness,omitempty"`
+	AlphaMode            string                 `json:"alphaMode,omitempty"`
+	AlphaCutoff          *float32               `json:"alphaCutoff,omitempty"`
+	DoubleSided          bool                   `json:"doubleSided,omitempty"`
+	Extensions           map[string]interface{} `json:"extensions,omitempty"`
+	Extras               interface{}            `json:"extras,omitempty"`
+}
+
+type Texture struct {
+	Name    string `json:"name,omitempty"`
+	Sampler *int   `json:"sampler,omitempty"`
+	Source  *int   `json:"source,omitempty"`
+}
+
+type Image struct {
+	Name       string `json:"name,omitempty"`
+	MimeType   string `json:"mimeType,omitempty"`
+	BufferView *int   `json:"bufferView,omitempty"`
+}
+
+type Sampler struct {
+	MagFilter int `json:"magFilter,omitempty"`
+	MinFilter int `json:"minFilter,omitempty"`
+	WrapS     int `json:"wrapS,omitempty"`
+	WrapT     int `json:"wrapT,omitempty"`
+}
+
+type Accessor struct {
+	Name          string    `json:"name,omitempty"`
+	BufferView    *int      `json:"bufferView,omitempty"`
+	ByteOffset    int       `json:"byteOffset,omitempty"`
+	ComponentType int       `json:"componentType"`
+	Normalized    bool      `json:"normalized,omitempty"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type BufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset,omitempty"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride,omitempty"`
+	Target     int `json:"target,omitempty"`
+}
+
+type Buffer struct {
+	ByteLength int    `json:"byteLength"`
+	Uri        string `json:"uri,omitempty"`
+}
+
+type AnimationChannelTarget struct {
+	Node       *int                   `json:"node,omitempty"`
+	Path       string                 `json:"path"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type AnimationChannel struct {
+	Sampler int                    `json:"sampler"`
+	Target  AnimationChannelTarget `json:"target"`
+}
+
+type AnimationSampler struct {
+	Input         int    `json:"input"`
+	Interpolation string `json:"interpolation,omitempty"`
+	Output        int    `json:"output"`
+}
+
+type Animation struct {
+	Name     string             `json:"name,omitempty"`
+	Channels []AnimationChannel `json:"channels"`
+	Samplers []AnimationSampler `json:"samplers"`
+	Extras   interface{}        `json:"extras,omitempty"`
+}
+
+type Document struct {
+	Asset              Asset                  `json:"asset"`
+	ExtensionsUsed     []string               `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string               `json:"extensionsRequired,omitempty"`
+	Scene              *int                   `json:"scene,omitempty"`
+	Scenes             []Scene                `json:"scenes,omitempty"`
+	Nodes              []Node                 `json:"nodes,omitempty"`
+	Meshes             []Mesh                 `json:"meshes,omitempty"`
+	Skins              []Skin                 `json:"skins,omitempty"`
+	Materials          []Material             `json:"materials,omitempty"`
+	Textures           []Texture              `json:"textures,omitempty"`
+	Images             []Image                `json:"images,omitempty"`
+	Samplers           []Sampler              `json:"samplers,omitempty"`
+	Accessors          []Accessor             `json:"accessors,omitempty"`
+	BufferViews        []BufferView           `json:"bufferViews,omitempty"`
+	Buffers            []Buffer               `json:"buffers,omitempty"`
+	Animations         []Animation            `json:"animations,omitempty"`
+	Extensions         map[string]interface{} `json:"extensions,omitempty"`
+
+	bin []byte
+}
+
+func NewDocument(generator string) *Document {
+	return &Document{
+		Asset: Asset{Version: "2.0", Generator: generator},
+	}
+}
+
+// Index returns pointer to copy of i, used for optional index fields
+func Index(i int) *int {
+	return &i
+}
+
+// UseExtension adds extension to extensionsUsed list once
+func (doc *Document) UseExtension(name string) {
+	for _, e := range doc.ExtensionsUsed {
+		if e == name {
+			return
+		}
+	}
+	doc.ExtensionsUsed = append(doc.ExtensionsUsed, name)
+}
+
+func (doc *Document) AddScene(name string, nodes []int) int {
+	if nodes == nil {
+		nodes = make([]int, 0)
+	}
+	doc.Scenes = append(doc.Scenes, Scene{Name: name, Nodes: nodes})
+	if doc.Scene == nil {
+		doc.Scene = Index(len(doc.Scenes) - 1)
+	}
+	return len(doc.Scenes) - 1
+}
+
+func (doc *Document) AddNode(n Node) int {
+	doc.Nodes = append(doc.Nodes, n)
+	return len(doc.Nodes) - 1
+}
+
+// AddChild links node child to parent
+func (doc *Document) AddChild(parent int, child int) {
+	doc.Nodes[parent].Children = append(doc.Nodes[parent].Children, child)
+}
+
+func (doc *Document) AddMesh(m Mesh) int {
+	doc.Meshes = append(doc.Meshes, m)
+	return len(doc.Meshes) - 1
+}
+
+func (doc *Document) AddSkin(s Skin) int {
+	doc.Skins = append(doc.Skins, s)
+	return len(doc.Skins) - 1
+}
+
+func (doc *Document) AddMaterial(m Material) int {
+	doc.Materials = append(doc.Materials, m)
+	return len(doc.Materials) - 1
+}
+
+func (doc *Document) AddSampler(s Sampler) int {
+	for i, ex := range doc.Samplers {
+		if ex == s {
+			return i
+		}
+	}
+	doc.Samplers = append(doc.Samplers, s)
+	return len(doc.Samplers) - 1
+}
+
+func (doc *Document) AddAnimation(a Animation) int {
+	doc.Animations = append(doc.Animations, a)
+	return len(doc.Animations) - 1
+}
+
+// AddImagePNG embeds png image into binary chunk
+func (doc *Document) AddImagePNG(name string, data []byte) int {
+	bv := doc.AddBufferView(data, 0)
+	doc.Images = append(doc.Images, Image{Name: name, MimeType: "image/png", BufferView: &bv})
+	return len(doc.Images) - 1
+}
+
+// FindImage returns index of image with name, so images can be shared between models
+func (doc *Document) FindImage(name string) (int, bool) {
+	for i := range doc.Images {
+		if doc.Images[i].Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (doc *Document) AddTexture(name string, image int, sampler int) int {
+	doc.Textures = append(doc.Textures, Texture{Name: name, Source: &image, Sampler: &sampler})
+	return len(doc.Textures) - 1
+}
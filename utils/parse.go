@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ParseFloats parses comma separated list, counts are allowed lengths of list
+func ParseFloats(s string, counts ...int) ([]float32, error) {
+	parts := strings.Split(s, ",")
+	valid := false
+	for _, c := range counts {
+		valid = valid || len(parts) == c
+	}
+	if !valid {
+		return nil, fmt.Errorf("'%s' must have %v components", s, counts)
+	}
+	result := make([]float32, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = float32(f)
+	}
+	return result, nil
+}
+
+// ParseVec4 parses "x,y,z" or "x,y,z,w" into v, missing w is kept
+func ParseVec4(s string, v *mgl32.Vec4) error {
+	values, err := ParseFloats(s, 3, 4)
+	if err != nil {
+		return err
+	}
+	copy(v[:], values)
+	return nil
+}
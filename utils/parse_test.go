@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestParseVec4(t *testing.T) {
+	v := mgl32.Vec4{0, 0, 0, 1}
+	if err := ParseVec4("1, 2.5,-3", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (mgl32.Vec4{1, 2.5, -3, 1}) {
+		t.Errorf("Got %v", v)
+	}
+	for _, s := range []string{"1,2", "1,2,3,4,5", "1,x,3"} {
+		if err := ParseVec4(s, &v); err == nil {
+			t.Errorf("'%s' accepted", s)
+		}
+	}
+}
+
+func TestCheckStringBuffer(t *testing.T) {
+	for _, c := range []struct {
+		S            string
+		NilTerminate bool
+		Ok           bool
+	}{
+		{"12345678", false, true},
+		{"12345678", true, false},
+		{"1234567", true, true},
+		{"123456é", true, true},
+		{"一", false, false},
+	} {
+		if err := CheckStringBuffer(c.S, 8, c.NilTerminate); (err == nil) != c.Ok {
+			t.Errorf("'%s' nil terminate %v: %v", c.S, c.NilTerminate, err)
+		}
+		if c.Ok {
+			StringToBytesBuffer(c.S, 8, c.NilTerminate)
+		}
+	}
+}
@@ -2,25 +2,40 @@ package utils
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 )
 
+// WaveLoop in samples, End is exclusive
+type WaveLoop struct {
+	Start int
+	End   int
+}
+
 func WaveWriteHeader(w io.Writer, channels uint16, sampleRate uint32, dataSize uint32) error {
-	var buf [0x2c]byte
-	var pos = 0
+	return WaveWriteHeaderLoop(w, channels, sampleRate, dataSize, nil)
+}
+
+// WaveWriteHeaderLoop writes header with cue and smpl chunks if loop provided
+func WaveWriteHeaderLoop(w io.Writer, channels uint16, sampleRate uint32, dataSize uint32, loop *WaveLoop) error {
+	buf := make([]byte, 0, 0x2c+0x24+0x44)
 
 	write16 := func(v uint16) {
-		binary.LittleEndian.PutUint16(buf[pos:pos+2], v)
-		pos += 2
+		buf = append(buf, byte(v), byte(v>>8))
 	}
 
 	write32 := func(v uint32) {
-		binary.LittleEndian.PutUint32(buf[pos:pos+4], v)
-		pos += 4
+		buf = append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+
+	riffSize := 36 + dataSize
+	if loop != nil {
+		riffSize += 8 + 4 + 2*24 + 8 + 36 + 24
 	}
 
 	write32(0x46464952) // "RIFF"
-	write32(36 + dataSize)
+	write32(riffSize)
 	write32(0x45564157)                        // "WAVE"
 	write32(0x20746d66)                        // "fmt " chunk
 	write32(16)                                // chunk size
@@ -30,9 +45,240 @@ func WaveWriteHeader(w io.Writer, channels uint16, sampleRate uint32, dataSize u
 	write32(sampleRate * uint32(channels) * 2) // byteRate (sampleRate * channels * bytesPerSample)
 	write16(uint16(channels) * 2)              // blockAlign (channels * bytesPerSample)
 	write16(16)                                // bits per sample
-	write32(0x61746164)                        // "data"
-	write32(dataSize)                          // data chunk size
 
-	_, err := w.Write(buf[:])
+	if loop != nil {
+		write32(0x20657563) // "cue "
+		write32(4 + 2*24)
+		write32(2) // loop start and loop end points
+		for i, pos := range []int{loop.Start, loop.End} {
+			write32(uint32(i + 1)) // id
+			write32(uint32(pos))   // position
+			write32(0x61746164)    // "data"
+			write32(0)             // chunk start
+			write32(0)             // block start
+			write32(uint32(pos))   // sample offset
+		}
+
+		// sample period in nanoseconds, zero if rate is unknown
+		var samplePeriod uint32
+		if sampleRate != 0 {
+			samplePeriod = 1000000000 / sampleRate
+		}
+
+		write32(0x6c706d73) // "smpl"
+		write32(36 + 24)
+		write32(0) // manufacturer
+		write32(0) // product
+		write32(samplePeriod)
+		write32(60) // midi unity note
+		write32(0)  // midi pitch fraction
+		write32(0)  // smpte format
+		write32(0)  // smpte offset
+		write32(1)  // loops count
+		write32(0)  // sampler data
+		write32(1)  // cue point id
+		write32(0)  // forward loop
+		write32(uint32(loop.Start))
+		write32(uint32(loop.End - 1)) // inclusive
+		write32(0)                    // fraction
+		write32(0)                    // infinite play count
+	}
+
+	write32(0x61746164) // "data"
+	write32(dataSize)   // data chunk size
+
+	_, err := w.Write(buf)
 	return err
 }
+
+// Wave is decoded pcm stream, samples are stored per channel
+type Wave struct {
+	SampleRate uint32
+	Samples    [][]int16
+	Loop       *WaveLoop
+}
+
+func (w *Wave) Channels() int {
+	return len(w.Samples)
+}
+
+// WaveRead decodes riff wave with 8/16/24/32 bit integer or 32/64 bit float samples
+func WaveRead(data []byte) (*Wave, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("Not a riff wave file")
+	}
+
+	var format, channels, bits uint16
+	var sampleRate uint32
+	var pcm []byte
+	var loop *WaveLoop
+	cues := make(map[uint32]int)
+	cueIds := make([]uint32, 0)
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if size > len(data)-pos {
+			size = len(data) - pos
+		}
+		chunk := data[pos : pos+size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("Fmt chunk is too small")
+			}
+			format = binary.LittleEndian.Uint16(chunk[0:])
+			channels = binary.LittleEndian.Uint16(chunk[2:])
+			sampleRate = binary.LittleEndian.Uint32(chunk[4:])
+			bits = binary.LittleEndian.Uint16(chunk[14:])
+			// WAVE_FORMAT_EXTENSIBLE, format is first 2 bytes of subformat guid
+			if format == 0xfffe && size >= 26 {
+				format = binary.LittleEndian.Uint16(chunk[24:])
+			}
+		case "data":
+			pcm = chunk
+		case "smpl":
+			if size >= 36+24 && binary.LittleEndian.Uint32(chunk[28:]) != 0 {
+				loop = &WaveLoop{
+					Start: int(binary.LittleEndian.Uint32(chunk[36+8:])),
+					End:   int(binary.LittleEndian.Uint32(chunk[36+12:])) + 1,
+				}
+			}
+		case "cue ":
+			for i := 4; i+24 <= size; i += 24 {
+				id := binary.LittleEndian.Uint32(chunk[i:])
+				cues[id] = int(binary.LittleEndian.Uint32(chunk[i+20:]))
+				cueIds = append(cueIds, id)
+			}
+		}
+		pos += size + size&1
+	}
+
+	if channels == 0 || sampleRate == 0 {
+		return nil, fmt.Errorf("Fmt chunk not found")
+	}
+	if pcm == nil {
+		return nil, fmt.Errorf("Data chunk not found")
+	}
+
+	var sample func(b []byte) int16
+	switch {
+	case format == 1 && bits == 8:
+		sample = func(b []byte) int16 { return int16(int(b[0])-0x80) << 8 }
+	case format == 1 && bits == 16:
+		sample = func(b []byte) int16 { return int16(binary.LittleEndian.Uint16(b)) }
+	case format == 1 && bits == 24:
+		sample = func(b []byte) int16 { return int16(uint16(b[1]) | uint16(b[2])<<8) }
+	case format == 1 && bits == 32:
+		sample = func(b []byte) int16 { return int16(binary.LittleEndian.Uint32(b) >> 16) }
+	case format == 3 && bits == 32:
+		sample = func(b []byte) int16 {
+			return floatToSample(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		}
+	case format == 3 && bits == 64:
+		sample = func(b []byte) int16 {
+			return floatToSample(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported wave format %d with %d bits per sample", format, bits)
+	}
+
+	// without smpl chunk pair of cue points is used as loop
+	if loop == nil && len(cueIds) == 2 {
+		loop = &WaveLoop{Start: cues[cueIds[0]], End: cues[cueIds[1]]}
+	}
+
+	bytesPerSample := int(bits / 8)
+	count := len(pcm) / (bytesPerSample * int(channels))
+	if loop != nil && (loop.Start < 0 || loop.End <= loop.Start || loop.End > count) {
+		loop = nil
+	}
+	wave := &Wave{SampleRate: sampleRate, Samples: make([][]int16, channels), Loop: loop}
+	for ch := range wave.Samples {
+		wave.Samples[ch] = make([]int16, count)
+		for i := range wave.Samples[ch] {
+			wave.Samples[ch][i] = sample(pcm[(i*int(channels)+ch)*bytesPerSample:])
+		}
+	}
+	return wave, nil
+}
+
+func floatToSample(f float64) int16 {
+	return int16(math.Max(-32768, math.Min(32767, math.Floor(f*32768+0.5))))
+}
+
+// Remix returns wave with requested channels count.
+// Mono is duplicated to every channel, other layouts are mixed down to mono first
+func (w *Wave) Remix(channels int) *Wave {
+	if channels == w.Channels() {
+		return w
+	}
+	mono := w.Samples[0]
+	if w.Channels() != 1 {
+		mono = make([]int16, len(w.Samples[0]))
+		for i := range mono {
+			sum := 0
+			for _, ch := range w.Samples {
+				sum += int(ch[i])
+			}
+			mono[i] = int16(sum / w.Channels())
+		}
+	}
+	result := &Wave{SampleRate: w.SampleRate, Samples: make([][]int16, channels), Loop: w.Loop}
+	for i := range result.Samples {
+		result.Samples[i] = mono
+	}
+	return result
+}
+
+const waveResampleTaps = 16
+
+// Resample converts wave to sample rate using windowed sinc interpolation
+func (w *Wave) Resample(rate uint32) *Wave {
+	if rate == w.SampleRate || rate == 0 {
+		return w
+	}
+	ratio := float64(rate) / float64(w.SampleRate)
+	// cutoff frequency in input samples, low pass filter when downsampling
+	cutoff := math.Min(1, ratio)
+	taps := int(math.Ceil(waveResampleTaps / cutoff))
+
+	result := &Wave{SampleRate: rate, Samples: make([][]int16, w.Channels())}
+	if w.Loop != nil {
+		result.Loop = &WaveLoop{
+			Start: int(math.Floor(float64(w.Loop.Start)*ratio + 0.5)),
+			End:   int(math.Floor(float64(w.Loop.End)*ratio + 0.5)),
+		}
+	}
+	for ch, in := range w.Samples {
+		out := make([]int16, int(float64(len(in))*ratio))
+		for i := range out {
+			center := float64(i) / ratio
+			first := int(math.Floor(center)) - taps + 1
+			sum, weights := 0.0, 0.0
+			for j := first; j < first+taps*2; j++ {
+				if j < 0 || j >= len(in) {
+					continue
+				}
+				x := (float64(j) - center) * cutoff
+				weight := sinc(x) * sinc(x/waveResampleTaps)
+				sum += float64(in[j]) * weight
+				weights += weight
+			}
+			if weights != 0 {
+				sum /= weights
+			}
+			out[i] = int16(math.Max(-32768, math.Min(32767, math.Floor(sum+0.5))))
+		}
+		result.Samples[ch] = out
+	}
+	return result
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
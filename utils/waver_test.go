@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWaveLoopRoundTrip(t *testing.T) {
+	samples := make([]byte, 100*2)
+	loop := &WaveLoop{Start: 10, End: 90}
+
+	var buf bytes.Buffer
+	if err := WaveWriteHeaderLoop(&buf, 1, 22050, uint32(len(samples)), loop); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(samples)
+
+	wav, err := WaveRead(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wav.Samples[0]) != 100 {
+		t.Errorf("Invalid samples count %d", len(wav.Samples[0]))
+	}
+	if wav.Loop == nil || *wav.Loop != *loop {
+		t.Errorf("Invalid loop %v", wav.Loop)
+	}
+}
+
+func TestWaveLoopZeroRate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WaveWriteHeaderLoop(&buf, 1, 0, 0, &WaveLoop{Start: 0, End: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
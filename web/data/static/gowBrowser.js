@@ -18,6 +18,10 @@ function getActionLinkForWadNode(wad, nodeid, action, params = '') {
     return '/action/' + wad + '/' + nodeid + '/' + action + '?' + params;
 }
 
+function getActionLinkForWad(wad, action, params = '') {
+    return '/action/' + wad + '/' + action + '?' + params;
+}
+
 function treeInputFilterHandler($el, localStorageKey) {
     var filterText = $el.val().toLowerCase();
     if (localStorageKey) {
@@ -135,6 +139,33 @@ function uploadAjaxHandler() {
     });
 }
 
+function uploadActionReportHandler(link) {
+    var form = $('<form method="post" enctype="multipart/form-data">');
+    var fileInput = $('<input type="file" name="data">');
+    form.append(fileInput);
+
+    fileInput.trigger("click");
+    fileInput.change(function() {
+        if (fileInput[0].files.length == 0) {
+            return;
+        }
+
+        $.ajax({
+            url: link,
+            type: 'post',
+            data: new FormData(form[0]),
+            processData: false,
+            contentType: false,
+            dataType: 'json',
+            success: function(report) {
+                set3dVisible(false);
+                dataSummary.empty();
+                dataSummary.append($('<pre>').text(JSON.stringify(report, undefined, 2)));
+            }
+        });
+    });
+}
+
 function packLoadFile(filename) {
     dataTree.empty();
     dataSummary.empty();
@@ -188,9 +219,12 @@ function treeLoadVagVpk(filename, data) {
     list.append($("<li>").append("SampleRate: " + data.SampleRate));
     list.append($("<li>").append("Channels: " + data.Channels));
     list.append($("<li>").append($("<a>").attr("href", wavPath).append("Download WAV")));
+    list.append($("<li>").append($("<a>").attr('title', 'Encode uploaded WAV with sample rate of this file').append("Replace with WAV").click(function() {
+        uploadActionReportHandler(getActionLinkForWad(filename, 'importwav'));
+    })));
     dataTree.append(list)
 
-    dataTree.append($("<audio controls autoplay>").append($("<source>").attr("src", wavPath)));
+    dataTree.append($("<audio controls autoplay>").append($("<source>").attr("src", '/stream/pack/' + filename)));
 
     setLocation(filename, '#/' + filename);
 }
@@ -233,6 +267,24 @@ function treeLoadWad(wadName, data) {
     dataSelectors.append($('<div class="item-selector">').click(function() {
         treeLoadWadAsTags(wadName, data);
     }).text("Tags"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        uploadActionReportHandler(getActionLinkForWad(wadName, 'replacetextures'));
+    }).attr('title', 'Upload zip of <TXR name>.png images').text("Replace textures"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        window.location = getActionLinkForWad(wadName, 'gltfscene');
+    }).attr('title', 'Download every cxt chunk with lights and collision as .glb').text("Export scene"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        window.open(getActionLinkForWad(wadName, 'lights'));
+    }).attr('title', 'List of lights with world transforms').text("Lights"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        window.open(getActionLinkForWad(wadName, 'escfunctions'));
+    }).attr('title', 'Known and unknown script functions with call counts').text("ESC functions"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        window.location = getActionLinkForWad(wadName, 'localization');
+    }).attr('title', 'Download gettext .po file with texts of every flp').text("Export localization"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        uploadActionReportHandler(getActionLinkForWad(wadName, 'importlocalization'));
+    }).attr('title', 'Upload translated .po file, report contains chars missed in fonts').text("Import localization"));
 
     if (wad_last_load_view_type === 'nodes') {
         treeLoadWadAsNodes(wadName, data);
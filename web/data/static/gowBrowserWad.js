@@ -177,6 +177,7 @@ function treeLoadWadNode(wad, tagid, filterServerId = undefined) {
                             lightName.setMaskBit(5);
                             gr_instance.texts.push(lightName);
                         } else {
+                            summaryLoadWadLight(data, wad, tagid);
                             needMarshalDump = true;
                             needHexDump = true;
                         }
@@ -185,7 +186,7 @@ function treeLoadWadNode(wad, tagid, filterServerId = undefined) {
                         summaryLoadWadTxr(data, wad, tagid);
                         break;
                     case 0x00000008: // material
-                        summaryLoadWadMat(data);
+                        summaryLoadWadMat(data, wad, tagid);
                         break;
                     case 0x00000011: // collision
                         gr_instance.cleanup();
@@ -194,6 +195,9 @@ function treeLoadWadNode(wad, tagid, filterServerId = undefined) {
                         let mdl = new grModel();
                         loadCollisionFromAjax(mdl, data);
 
+                        dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, tagid, 'export', 'format=obj')).append('Download .obj'));
+                        dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, tagid, 'export', 'format=gltf')).append('Download .glb'));
+
                         gr_instance.models.push(mdl);
                         gr_instance.requestRedraw();
                         break;
@@ -217,13 +221,18 @@ function treeLoadWadNode(wad, tagid, filterServerId = undefined) {
                         summaryLoadWadCxt(data, wad, tagid);
                         break;
                     case 0x00020001: // gameObject
-                        summaryLoadWadGameObject(data);
+                        summaryLoadWadGameObject(data, wad, tagid);
                         break;
                     case 0x00010004: // script
-                        summaryLoadWadScript(data);
+                        summaryLoadWadScript(data, wad, tagid);
                         needMarshalDump = true;
                         needHexDump = true;
                         break;
+                    case 0x00000027: // shadow lod
+                        set3dVisible(false);
+                        dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, tagid, 'obj')).append('Download .obj(model+shadow volumes)'));
+                        needMarshalDump = true;
+                        break;
                     case 0x0000000c: // gfx pal
                     default:
                         set3dVisible(false);
@@ -232,7 +241,7 @@ function treeLoadWadNode(wad, tagid, filterServerId = undefined) {
                         break;
                 }
             } else if (tag.Tag == 112) {
-                summaryLoadWadGeomShape(data);
+                summaryLoadWadGeomShape(data, wad, tagid);
             } else {
                 needHexDump = true;
             }
@@ -788,7 +797,7 @@ function summaryLoadWadTxr(data, wad, nodeid) {
     dataSummary.append(form);
 }
 
-function summaryLoadWadMat(data) {
+function summaryLoadWadMat(data, wad, nodeid) {
     set3dVisible(false);
     let clr = data.Mat.Color;
     let clrBgAttr = 'background-color: rgb(' + parseInt(clr[0] * 255) + ',' + parseInt(clr[1] * 255) + ',' + parseInt(clr[2] * 255) + ')';
@@ -845,12 +854,42 @@ function summaryLoadWadMat(data) {
             ltable.append($('<tr>').append($('<td>').append(k)).append(td));
         });
 
+        let pf = layer.ParsedFlags;
+        let blend = pf.RenderingUsual ? 'usual' : pf.RenderingAdditive ? 'additive' :
+            pf.RenderingSubstract ? 'substract' : pf.RenderingStrangeBlended ? 'strange' : 'none';
+        let form = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'update'));
+        let ftbl = $('<table>');
+        let field = function(title, name, value) {
+            ftbl.append($('<tr>').append($('<td>').text(title)).append($('<td>').append($('<input type="text">').attr('name', name).val(value))));
+        };
+        form.append($('<input type="hidden" name="layer">').val(l));
+        field("texture", "texture", layer.Texture);
+        field("blend (none, usual, additive, substract, strange)", "blend", blend);
+        field("filter (linear, nearest)", "filter", pf.FilterLinear ? 'linear' : 'nearest');
+        field("disable depth write", "disabledepthwrite", pf.DisableDepthWrite);
+        field("blend color", "blendcolor", layer.BlendColor.join(','));
+        field("uv animation", "animuv", pf.AnimationUVEnabled);
+        field("other animation", "animother", pf.AnimationOtherEnabled);
+        ftbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Update layer">'))));
+        ltable.append($('<tr>').append($('<td>').append('Edit')).append($('<td>').append(form.append(ftbl))));
+
+        let dupLink = getActionLinkForWadNode(wad, nodeid, 'addlayer', 'layer=' + l);
+        let removeLink = getActionLinkForWadNode(wad, nodeid, 'removelayer', 'layer=' + l);
+        ltable.append($('<tr>').append($('<td>')).append($('<td>')
+            .append($('<a>').attr('href', dupLink).text('Duplicate layer')).append(' ')
+            .append($('<a>').attr('href', removeLink).text('Remove layer'))));
+
         table.append($('<tr>')
             .append($('<td>').append('Layer ' + l))
             .append($('<td>').append(ltable))
         );
     };
 
+    let colorForm = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'update'));
+    colorForm.append($('<input type="text" name="color">').val(clr.slice(0, 3).join(',')));
+    colorForm.append($('<input type="submit" value="Update color">'));
+    table.append($('<tr>').append($('<td>').append('Edit color')).append($('<td>').append(colorForm)));
+
     dataSummary.append(table);
 }
 
@@ -922,6 +961,24 @@ function summaryLoadWadObj(data, wad, nodeid) {
 
     let dumplink = getActionLinkForWadNode(wad, nodeid, 'zip');
     dataSummary.append($('<a class="center">').attr('href', dumplink).append('Download .zip(obj+mtl+png)'));
+    let gltflink = getActionLinkForWadNode(wad, nodeid, 'gltf');
+    dataSummary.append($('<a class="center">').attr('href', gltflink).append('Download .glb(skeleton+skin+materials)'));
+    let skeljsonlink = getActionLinkForWadNode(wad, nodeid, 'skeleton', 'format=json');
+    dataSummary.append($('<a class="center">').attr('href', skeljsonlink).append('Download skeleton .json'));
+    let skelgltflink = getActionLinkForWadNode(wad, nodeid, 'skeleton', 'format=gltf');
+    dataSummary.append($('<a class="center">').attr('href', skelgltflink).append('Download skeleton .glb(skin only)'));
+
+    let jointForm = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'joint'));
+    let jointTbl = $('<table>');
+    let jointField = function(title, name) {
+        jointTbl.append($('<tr>').append($('<td>').text(title)).append($('<td>').append($('<input type="text">').attr('name', name))));
+    };
+    jointField("joint (index or name)", "joint");
+    jointField("idle position (x,y,z)", "position");
+    jointField("idle rotation (euler degrees x,y,z or quaternion x,y,z,w)", "rotation");
+    jointField("idle scale (x,y,z)", "scale");
+    jointTbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Update joint">'))));
+    dataSummary.append(jointForm.append(jointTbl));
 
     let jointsTable = $('<table>');
 
@@ -937,7 +994,8 @@ function summaryLoadWadObj(data, wad, nodeid) {
                     for (let dt in anim.DataTypes) {
                         switch (anim.DataTypes[dt].TypeId) {
                             case 0:
-                                let $option = $("<option>").text(group.Name + ": " + act.Name);
+                                let $option = $("<option>").text(group.Name + ": " + act.Name)
+                                    .data("group", group.Name).data("act", act.Name);
                                 $option.dblclick([anim, act, dt, data.Data], function(ev) {
                                     let anim = new gaObjSkeletAnimation(ev.data[0], ev.data[1], ev.data[2], ev.data[3], gr_instance.models[0]);
                                     ga_instance.addAnimation(anim);
@@ -960,7 +1018,30 @@ function summaryLoadWadObj(data, wad, nodeid) {
             }
         });
 
-        dataSummary.append($animSelector).append($stopAnim);
+        let $animExport = $("<div>").addClass("center");
+        let $animFps = $("<input type='number' min='1' placeholder='native fps'>").css("width", "7em");
+        let exportAnimation = function(format) {
+            let $option = $animSelector.find("option:selected");
+            if (!$option.length) {
+                return;
+            }
+            let params = 'format=' + format +
+                '&group=' + encodeURIComponent($option.data("group")) +
+                '&act=' + encodeURIComponent($option.data("act"));
+            if ($animFps.val()) {
+                params += '&fps=' + $animFps.val();
+            }
+            window.location = getActionLinkForWadNode(wad, nodeid, 'animation', params);
+        };
+        $animExport.append($("<button>").text("Export .glb").click(function() {
+            exportAnimation('gltf');
+        }));
+        $animExport.append($("<button>").text("Export .bvh").click(function() {
+            exportAnimation('bvh');
+        }));
+        $animExport.append($animFps);
+
+        dataSummary.append($animSelector).append($stopAnim).append($animExport);
     }
 
     $.each(data.Data.Joints, function(joint_id, joint) {
@@ -1002,7 +1083,27 @@ function summaryLoadWadObj(data, wad, nodeid) {
 }
 
 
-function summaryLoadWadGameObject(data) {
+function summaryLoadWadLight(data, wad, nodeid) {
+    set3dVisible(false);
+
+    let form = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'update'));
+    let tbl = $('<table>');
+    let field = function(title, name, value) {
+        tbl.append($('<tr>').append($('<td>').text(title)).append($('<td>').append($('<input type="text">').attr('name', name).val(value))));
+    };
+    field("flags (0 ambient, 1 point, 2/6 directional)", "flags", data.Flags);
+    field("position", "position", data.Position.join(','));
+    field("rotation", "rotation", data.Rotation.join(','));
+    field("color", "color", data.Color.join(','));
+    field("unk3c", "unk3c", data.Unk3c);
+    field("unk40", "unk40", data.Unk40);
+    field("unk44", "unk44", data.Unk44);
+    field("unk48", "unk48", data.Unk48);
+    tbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Update light">'))));
+    dataSummary.append(form.append(tbl));
+}
+
+function summaryLoadWadGameObject(data, wad, nodeid) {
     gr_instance.cleanup();
     set3dVisible(false);
     let table = $('<table>');
@@ -1010,6 +1111,29 @@ function summaryLoadWadGameObject(data) {
         table.append($('<tr>').append($('<td>').text(k)).append($('<td>').text(JSON.stringify(data[k]))));
     }
     dataSummary.append(table);
+
+    let field = function(tbl, title, name, value) {
+        tbl.append($('<tr>').append($('<td>').text(title)).append($('<td>').append($('<input type="text">').attr('name', name).val(value))));
+    };
+
+    let form = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'update'));
+    let tbl = $('<table>');
+    field(tbl, "object", "object", data.Object);
+    field(tbl, "id", "id", data.Id);
+    field(tbl, "params", "params", data.Params);
+    field(tbl, "position", "position1", data.Position1.join(','));
+    field(tbl, "rotation (rad)", "rotation", data.Rotation.join(','));
+    field(tbl, "visibility position", "position2", '');
+    tbl.append($('<tr>').append($('<td>').text("move visibility position with object")).append($('<td>').append($('<input type="checkbox" name="syncposition2" checked>'))));
+    tbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Update instance">'))));
+    dataSummary.append(form.append(tbl));
+
+    let dupform = $('<form class="flexedform" method="post">').attr('action', getActionLinkForWadNode(wad, nodeid, 'duplicate'));
+    let duptbl = $('<table>');
+    field(duptbl, "new node name", "name", '');
+    field(duptbl, "position", "position1", data.Position1.join(','));
+    duptbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Duplicate instance">'))));
+    dataSummary.append(dupform.append(duptbl));
 }
 
 function loadCxtFromAjax(data, parseScripts = true) {
@@ -1057,6 +1181,10 @@ function summaryLoadWadCxt(data, wad, nodeid) {
     }
 
     if ((data.Instances !== null && data.Instances.length) || gw_cxt_group_loading) {
+        if (!gw_cxt_group_loading) {
+            let gltflink = getActionLinkForWadNode(wad, nodeid, 'gltf');
+            dataSummary.append($('<a class="center">').attr('href', gltflink).append('Download .glb(scene)'));
+        }
         set3dVisible(true);
         loadCxtFromAjax(data);
         gr_instance.requestRedraw();
@@ -1068,6 +1196,8 @@ function summaryLoadWadCxt(data, wad, nodeid) {
 
 function summaryLoadWadSbk(data, wad, nodeid) {
     set3dVisible(false);
+    dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, nodeid, 'export'))
+        .attr('title', 'Zip with wav of every sample, json description and sfz instrument').append('Export bank'));
     let list = $("<ul>");
     for (let i = 0; i < data.Sounds.length; i++) {
         let snd = data.Sounds[i];
@@ -1083,6 +1213,9 @@ function summaryLoadWadSbk(data, wad, nodeid) {
         let li = $("<li>").append(vaglink);
 
         if (data.IsVagFiles) {
+            li.append(" ").append($("<a>").attr('title', 'Encode uploaded WAV with sample rate of this sound').text("(replace)").click(function() {
+                uploadActionReportHandler(getSndLink('importwav'));
+            }));
             li.append("<br>").append(wavlink);
         }
         list.append(li);
@@ -1090,10 +1223,13 @@ function summaryLoadWadSbk(data, wad, nodeid) {
     dataSummary.append(list);
 }
 
-function summaryLoadWadGeomShape(data) {
+function summaryLoadWadGeomShape(data, wad, tagid) {
     gr_instance.cleanup();
     set3dVisible(true);
 
+    dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, tagid, 'export', 'format=obj')).append('Download .obj'));
+    dataSummary.append($('<a class="center">').attr('href', getActionLinkForWadNode(wad, tagid, 'export', 'format=gltf')).append('Download .glb'));
+
     let m_vertexes = [];
     m_vertexes.length = data.Vertexes.length * 3;
     for (let i in data.Vertexes) {
@@ -1121,7 +1257,7 @@ function summaryLoadWadGeomShape(data) {
     gr_instance.requestRedraw();
 }
 
-function summaryLoadWadScript(data) {
+function summaryLoadWadScript(data, wad, nodeid) {
     gr_instance.cleanup();
 
     dataSummary.append($("<h3>").append("Scirpt " + data.TargetName));
@@ -1135,9 +1271,27 @@ function summaryLoadWadScript(data) {
                 let v = e[j];
                 if (j == "Handlers") {
                     for (let hi in v) {
+                        let code = $("<textarea>").attr("rows", 10).attr("cols", 80).val(v[hi].Decompiled);
+                        let btn = $("<button>").text("Assemble and save").click(function() {
+                            $.post({
+                                url: getActionLinkForWadNode(wad, nodeid, 'handler'),
+                                data: {
+                                    'entity': i,
+                                    'handler': hi,
+                                    'code': code.val()
+                                },
+                                success: function(a) {
+                                    if (a != "" && a.error) {
+                                        alert('Error assembling: ' + a.error);
+                                    } else {
+                                        alert('Success!');
+                                    }
+                                }
+                            });
+                        });
                         ht.append(
                             $("<tr>").append($("<td>").append('Handler #' + hi))
-                            .append($("<td>").append(v[hi].Decompiled.replaceAll('\n', '<br>'))));
+                            .append($("<td>").append(code).append("<br>").append(btn)));
                     }
                 } else {
                     switch (j) {
@@ -1572,9 +1726,26 @@ function summaryLoadWadFlp(flp, wad, tagid) {
             let $data_table = $("<table>");
 
             let print_script = function(script) {
-                let code = script.Decompiled;
                 let $code_element = $("<div>").text(" > click to show decompiled script < ").css('cursor', 'pointer').click(function() {
-                    $(this).empty().css('cursor', '').append(code).off('click');
+                    let $code = $("<textarea>").attr("rows", 12).attr("cols", 80).val(script.Decompiled);
+                    let $assemble = $("<button>").text("Assemble and save").click(function() {
+                        $.post({
+                            url: getActionLinkForWadNode(wad, tagid, 'script'),
+                            data: {
+                                'id': script.Id,
+                                'code': $code.val()
+                            },
+                            success: function(a) {
+                                if (a != "" && a.error) {
+                                    alert('Error assembling: ' + a.error);
+                                } else {
+                                    $code.val(a.Decompiled);
+                                    alert('Success!');
+                                }
+                            }
+                        });
+                    });
+                    $(this).empty().css('cursor', '').off('click').append($code, "<br>", $assemble);
                 })
                 return $code_element;
             }
@@ -1611,7 +1782,7 @@ function summaryLoadWadFlp(flp, wad, tagid) {
                         let $frame = $("<table>");
                         $frame.append(_row(_column("name"), _column(frame.Name)));
                         $frame.append(_row(_column("frame end time"), _column(frame.WhenThisFrameEnds)));
-                        $frame.append(_row(_column("element"), _column(print_ref_handler(frame.ElementHandler))));
+                        $frame.append(_row(_column("element"), _column(print_ref_handler(flpdata.GlobalHandlersIndexes[frame.ElementHandler]))));
                         $frame.append(_row(_column("color"), _column(print_ref_handler({
                             TypeArrayId: 10,
                             IdInThatTypeArray: frame.ColorId
@@ -1742,7 +1913,7 @@ function summaryLoadWadFlp(flp, wad, tagid) {
                 let parse_parenting_data6_sub1 = function(h, o) {
                     for (let anim of o.ElementsAnimation) {
                         for (let frame of anim.KeyFrames) {
-                            check_parenting(h, frame.ElementHandler);
+                            check_parenting(h, flpdata.GlobalHandlersIndexes[frame.ElementHandler]);
                             check_parenting(h, {
                                 TypeArrayId: 9,
                                 IdInThatTypeArray: frame.TransformationId
@@ -1769,7 +1940,7 @@ function summaryLoadWadFlp(flp, wad, tagid) {
                             }
                             break;
                         case 5:
-                            check_parenting(h, o.FontHandler);
+                            check_parenting(h, flpdata.GlobalHandlersIndexes[o.FontHandler]);
                             break;
                         case 6:
                             parse_parenting_data6_sub1(h, o.Sub1);
@@ -1866,6 +2037,21 @@ function summaryLoadWadFlp(flp, wad, tagid) {
         let importDiv = $('<div id="flpimportfont">');
         importDiv.append($('<label>').text('font scale').append(importBMFontScale));
         importDiv.append(importBMFontInput);
+
+        let importTtfSize = $('<input type="number" min="4" max="200" value="60" step="1">');
+        let importTtfTexture = $('<input type="text" maxlength="20" placeholder="texture name">');
+        let importTtfChars = $('<input type="text" placeholder="chars, empty for ascii and font aliases">');
+        let importTtfInput = $('<button>').text('Import glyphs from TTF/OTF file').click(function() {
+            let u = new URLSearchParams();
+            u.append('scale', $("#importbmfontscale").val());
+            u.append('size', importTtfSize.val());
+            u.append('texture', importTtfTexture.val());
+            u.append('chars', importTtfChars.val());
+            uploadActionReportHandler(getActionLinkForWadNode(wad, tagid, 'importttf', u.toString()));
+        });
+        importDiv.append($('<br>'));
+        importDiv.append($('<label>').text('size (px)').append(importTtfSize));
+        importDiv.append(importTtfTexture, importTtfChars, importTtfInput);
         importDiv.append($('<a>').text('Link to usage instruction').attr('target', '_blank')
             .attr('href', 'https://github.com/mogaika/god_of_war_browser/blob/master/LOCALIZATION.md'));
         dataSummary.append(importDiv);
@@ -1961,11 +2147,45 @@ function summaryLoadWadFlp(flp, wad, tagid) {
         gr_instance.requestRedraw();
     }
 
+    let flp_render = function() {
+        set3dVisible(false);
+        dataSummary.empty();
+
+        let $frames = $("<input type=text>").val("0");
+        let $columns = $("<input type=number min=0>").val(0);
+        let $img = $("<img>").addClass('no-interpolate');
+        let $link = $("<a target='_blank'>").text("open");
+        let render = function() {
+            let link = getActionLinkForWadNode(wad, tagid, 'render', $.param({
+                'frames': $frames.val(),
+                'columns': $columns.val(),
+            }));
+            $img.attr('src', link);
+            $link.attr('href', link);
+        }
+
+        dataSummary.append($("<div>").append("Frames: ", $frames, " <sub>0,5,10-20 or 0-100:10</sub>"));
+        dataSummary.append($("<div>").append("Columns: ", $columns, " <sub>0 - auto</sub>"));
+        dataSummary.append($("<div>").append($("<button>").text("Render").click(render), " ", $link));
+        dataSummary.append($img);
+        render();
+    }
+
     dataSummarySelectors.append($('<div class="item-selector">').click(flp_list_labels).text("Labels editor"));
     dataSummarySelectors.append($('<div class="item-selector">').click(flp_print_dump).text("Dump"));
     dataSummarySelectors.append($('<div class="item-selector">').click(flp_scripts_strings).text("Scripts strings"));
+    dataSummarySelectors.append($('<div class="item-selector">').click(function() {
+        window.location = getActionLinkForWadNode(wad, tagid, 'json');
+    }).attr('title', 'Download whole flp as json, scripts are stored as text').text("Export json"));
+    dataSummarySelectors.append($('<div class="item-selector">').click(function() {
+        uploadActionReportHandler(getActionLinkForWadNode(wad, tagid, 'importjson'));
+    }).attr('title', 'Replace flp with edited json').text("Import json"));
+    dataSummarySelectors.append($('<div class="item-selector">').click(function() {
+        window.open(getActionLinkForWadNode(wad, tagid, 'scriptcheck'));
+    }).attr('title', 'Scripts which are not assembled back to identical bytes').text("Scripts check"));
     dataSummarySelectors.append($('<div class="item-selector">').click(flp_view_font).text("Font viewer"));
     dataSummarySelectors.append($('<div class="item-selector">').click(flp_view_object_viewer).text("Obj viewer"));
+    dataSummarySelectors.append($('<div class="item-selector">').click(flp_render).attr('title', 'Render root timeline frames without scripts').text("Render frames"));
 
     // flp_list_labels();
     flp_view_object_viewer();
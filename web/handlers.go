@@ -10,10 +10,12 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/mogaika/god_of_war_browser/pack"
+	file_vag "github.com/mogaika/god_of_war_browser/pack/vag"
 	file_vpk "github.com/mogaika/god_of_war_browser/pack/vpk"
 	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
 	file_vagp "github.com/mogaika/god_of_war_browser/ps2/vagp"
@@ -108,25 +110,23 @@ func HandlerDumpPackParamFile(w http.ResponseWriter, r *http.Request) {
 				webutils.WriteFile(w, wav, file+".WAV")
 			}
 		case *file_vpk.VPK:
-			vpk := data.(*file_vpk.VPK)
-
 			f, err := vfs.DirectoryGetFile(ServerDirectory, file)
 			if err != nil {
 				webutils.WriteError(w, err)
-			} else {
-				fr, err := vfs.OpenFileAndGetReader(f, true)
-				if err != nil {
-					webutils.WriteError(w, err)
-				}
-				defer f.Close()
+				return
+			}
+			fr, err := vfs.OpenFileAndGetReader(f, true)
+			if err != nil {
+				webutils.WriteError(w, err)
+				return
+			}
+			defer f.Close()
 
-				var buf bytes.Buffer
-				_, err = vpk.AsWave(fr, &buf)
-				if err != nil {
-					webutils.WriteError(w, fmt.Errorf("Error converting to wav: %v", err))
-				} else {
-					webutils.WriteFile(w, &buf, file+".WAV")
-				}
+			wr, err := data.(*file_vpk.VPK).NewWaveReader(fr)
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("Error converting to wav: %v", err))
+			} else {
+				webutils.WriteFile(w, wr, file+".WAV")
 			}
 		default:
 			webutils.WriteError(w, fmt.Errorf("File %s not contain subdata", file))
@@ -134,6 +134,48 @@ func HandlerDumpPackParamFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandlerStreamPackFile sends sound file as wav decoded on the fly, range requests are supported
+func HandlerStreamPackFile(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	data, err := pack.GetInstanceHandler(ServerDirectory, file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	switch data.(type) {
+	case *file_vagp.VAGP:
+		wav, err := data.(*file_vagp.VAGP).AsWave()
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error converting to wav: %v", err))
+			return
+		}
+		http.ServeContent(w, r, file+".WAV", time.Time{}, bytes.NewReader(wav.Bytes()))
+	case *file_vpk.VPK:
+		f, err := vfs.DirectoryGetFile(ServerDirectory, file)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		fr, err := vfs.OpenFileAndGetReader(f, true)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		defer f.Close()
+
+		wr, err := data.(*file_vpk.VPK).NewWaveReader(fr)
+		if err != nil {
+			webutils.WriteError(w, fmt.Errorf("Error converting to wav: %v", err))
+			return
+		}
+		http.ServeContent(w, r, file+".WAV", time.Time{}, wr)
+	default:
+		webutils.WriteError(w, fmt.Errorf("File %s is not a sound", file))
+	}
+}
+
 func HandlerActionPackFileParam(w http.ResponseWriter, r *http.Request) {
 	file := mux.Vars(r)["file"]
 	param := mux.Vars(r)["param"]
@@ -160,6 +202,40 @@ func HandlerActionPackFileParam(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func HandlerActionPackFile(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	action := mux.Vars(r)["action"]
+	data, err := pack.GetInstanceHandler(ServerDirectory, file)
+	if err != nil {
+		log.Printf("Error getting file from pack: %v", err)
+		webutils.WriteError(w, err)
+	} else {
+		switch data.(type) {
+		case *file_wad.Wad:
+			if err := data.(*file_wad.Wad).WebHandlerCallHttpAction(w, r, action); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Wad handler error on %s: %v", file, err))
+			}
+		case *file_vagp.VAGP:
+			if err := file_vag.HttpAction(ServerDirectory, file, data.(*file_vagp.VAGP), w, r, action); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Vag handler error on %s: %v", file, err))
+			}
+		case *file_vpk.VPK:
+			if err := data.(*file_vpk.VPK).HttpAction(ServerDirectory, file, w, r, action); err != nil {
+				webutils.WriteError(w, fmt.Errorf("Vpk handler error on %s: %v", file, err))
+			}
+		default:
+			webutils.WriteError(w, fmt.Errorf("File %s not support actions", file))
+		}
+	}
+}
+
+func HandlerActionPack(w http.ResponseWriter, r *http.Request) {
+	action := mux.Vars(r)["action"]
+	if err := pack.CallActionHandler(ServerDirectory, w, r, action); err != nil {
+		webutils.WriteError(w, fmt.Errorf("Pack handler error: %v", err))
+	}
+}
+
 func HandlerUploadPackFile(w http.ResponseWriter, r *http.Request) {
 	targetFile := mux.Vars(r)["file"]
 	fileStream, _, err := r.FormFile("data")
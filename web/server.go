@@ -24,11 +24,14 @@ func StartServer(addr string, d vfs.Directory, webPath string) error {
 
 	r := mux.NewRouter()
 	r.HandleFunc("/action/{file}/{param}/{action}", HandlerActionPackFileParam)
+	r.HandleFunc("/action/{file}/{action}", HandlerActionPackFile)
+	r.HandleFunc("/action/{action}", HandlerActionPack)
 	r.HandleFunc("/json/pack/{file}/{param}", HandlerAjaxPackFileParam)
 	r.HandleFunc("/json/pack/{file}", HandlerAjaxPackFile)
 	r.HandleFunc("/json/pack", HandlerAjaxPack)
 	r.HandleFunc("/dump/pack/{file}/{param}", HandlerDumpPackParamFile)
 	r.HandleFunc("/dump/pack/{file}", HandlerDumpPackFile)
+	r.HandleFunc("/stream/pack/{file}", HandlerStreamPackFile)
 	r.HandleFunc("/upload/pack/{file}", HandlerUploadPackFile)
 	r.HandleFunc("/upload/pack/{file}/{param}", HandlerUploadPackFileParam)
 	r.HandleFunc("/ws/status", HandlerWebsocketStatus)